@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/types"
 )
@@ -50,8 +51,12 @@ func (iter *CommitIterator) Next() (LogNode, bool) {
 	branches := branchList{}
 	parents := commitRefsFromSet(br.commit.Get(datas.ParentsField).(types.Set))
 	for _, p := range parents {
-		b := branch{cr: p, commit: iter.db.ReadValue(p.TargetHash()).(types.Struct)}
-		branches = append(branches, b)
+		var commit types.Value
+		if d.Try(func() { commit = iter.db.ReadValue(p.TargetHash()) }, datas.ShallowError{}) != nil {
+			// History beyond a shallow copy isn't there to show.
+			continue
+		}
+		branches = append(branches, branch{cr: p, commit: commit.(types.Struct)})
 	}
 	iter.branches = iter.branches.Splice(col, 1, branches...)
 
@@ -16,13 +16,24 @@ import (
 )
 
 var commands = []*util.Command{
+	nomsApply,
+	nomsCherryPick,
 	nomsCommit,
+	nomsCompact,
 	nomsConfig,
 	nomsDiff,
 	nomsDs,
+	nomsFetch,
+	nomsFsck,
+	nomsGC,
 	nomsLog,
 	nomsMerge,
 	nomsMigrate,
+	nomsPull,
+	nomsPush,
+	nomsRebase,
+	nomsReflog,
+	nomsRevert,
 	nomsRoot,
 	nomsServe,
 	nomsShow,
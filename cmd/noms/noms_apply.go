@@ -0,0 +1,82 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/diff"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var forceApply bool
+
+var nomsApply = &util.Command{
+	Run:       runApply,
+	UsageLine: "apply [options] <patch-file> <dataset>",
+	Short:     "Applies a patch written by noms diff --format=json to a dataset",
+	Long:      "Applies the changes in patch-file to the head value of dataset and commits the result. If patch-file is -, the patch is read from stdin. The patch must have been made against the current head value, unless --force is given.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the dataset argument.",
+	Flags:     setupApplyFlags,
+	Nargs:     2,
+}
+
+func setupApplyFlags() *flag.FlagSet {
+	applyFlagSet := flag.NewFlagSet("apply", flag.ExitOnError)
+	applyFlagSet.BoolVar(&forceApply, "force", false, "apply the patch even if it was made against a different value")
+	spec.RegisterCommitMetaFlags(applyFlagSet)
+	verbose.RegisterVerboseFlags(applyFlagSet)
+	return applyFlagSet
+}
+
+func runApply(args []string) int {
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		r = f
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(args[1])
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+
+	head, ok := ds.MaybeHeadValue()
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Dataset %s has no head", args[1]))
+	}
+
+	pf, err := diff.ReadPatch(r, db)
+	d.CheckErrorNoUsage(err)
+	if head.Hash() != pf.From && !forceApply {
+		d.CheckErrorNoUsage(fmt.Errorf("Patch was made against #%s, but the head value of %s is #%s. Use --force to apply it anyway", pf.From, args[1], head.Hash()))
+	}
+	pf.WriteChunks(db)
+
+	value := diff.Apply(head, pf.Patch)
+	if value.Hash() == head.Hash() {
+		fmt.Fprintf(os.Stdout, "Dataset %s is unchanged by the patch\n", args[1])
+		return 0
+	}
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+
+	oldHeadRef := ds.HeadRef()
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+
+	fmt.Fprintf(os.Stdout, "New head #%v (was #%v)\n", ds.HeadRef().TargetHash().String(), oldHeadRef.TargetHash().String())
+	return 0
+}
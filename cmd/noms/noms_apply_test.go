@@ -0,0 +1,93 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsApply(t *testing.T) {
+	suite.Run(t, &nomsApplyTestSuite{})
+}
+
+type nomsApplyTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsApplyTestSuite) commit(dbName, dsName string, v types.Value) datas.Dataset {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir+"/"+dbName))
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+	ds, err := db.CommitValue(db.GetDataset(dsName), v)
+	s.NoError(err)
+	return ds
+}
+
+func (s *nomsApplyTestSuite) headValue(dbName, dsName string) types.Value {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir+"/"+dbName, dsName))
+	s.NoError(err)
+	defer sp.Close()
+	return sp.GetDataset().HeadValue()
+}
+
+func (s *nomsApplyTestSuite) TestApplyToOtherDatabase() {
+	list := make([]types.Value, 5000)
+	for i := range list {
+		list[i] = types.String(strings.Repeat("y", i%50))
+	}
+	v1 := types.NewStruct("Doc", types.StructData{"title": types.String("draft"), "tags": types.NewSet(types.String("a"))})
+	v2 := types.NewStruct("Doc", types.StructData{"title": types.String("final"), "tags": types.NewSet(types.String("b")), "body": types.NewList(list...)})
+
+	first := s.commit("src", "docs", v1)
+	s.commit("src", "docs", v2)
+	s.commit("dst", "docs", v1)
+
+	oldSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/src", "#"+first.HeadRef().TargetHash().String()+".value")
+	newSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/src", "docs.value")
+	out, _ := s.MustRun(main, []string{"diff", "--format=json", oldSpec, newSpec})
+	s.Contains(out, `"changeType": "modified"`)
+	s.Contains(out, `"text": "\"final\""`)
+
+	patchFile := filepath.Join(s.TempDir, "docs.patch")
+	s.NoError(ioutil.WriteFile(patchFile, []byte(out), 0644))
+
+	dstSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/dst", "docs")
+	stdout, _ := s.MustRun(main, []string{"apply", patchFile, dstSpec})
+	s.Contains(stdout, "New head #")
+	s.True(v2.Equals(s.headValue("dst", "docs")))
+
+	// The head value has moved on, so the patch no longer applies.
+	_, stderr, err := s.Run(main, []string{"apply", patchFile, dstSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Use --force to apply it anyway")
+}
+
+func (s *nomsApplyTestSuite) TestApplyBadInput() {
+	s.commit("bad", "ds", types.Number(1))
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "ds")
+
+	patchFile := filepath.Join(s.TempDir, "bad.patch")
+	s.NoError(ioutil.WriteFile(patchFile, []byte("not a patch"), 0644))
+	_, _, err := s.Run(main, []string{"apply", patchFile, dsSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+
+	_, stderr, err := s.Run(main, []string{"apply", patchFile, spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "empty")})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "has no head")
+
+	_, stderr, err = s.Run(main, []string{"diff", "--format=yaml", dsSpec, dsSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Unknown format yaml")
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/diff"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsCherryPick = &util.Command{
+	Run:       runCherryPick,
+	UsageLine: "cherry-pick [options] <commit> <dataset>",
+	Short:     "Applies the changes made by a commit to the head of a dataset",
+	Long:      "Computes the difference between <commit> and its parent, applies it to the head value of <dataset> and commits the result. If the changes don't apply cleanly, they are three-way merged using --policy to resolve conflicts. <commit> must be in the same database as <dataset>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the commit and dataset arguments.",
+	Flags:     setupCherryPickFlags,
+	Nargs:     2,
+}
+
+func setupCherryPickFlags() *flag.FlagSet {
+	return setupPickFlags("cherry-pick")
+}
+
+func setupPickFlags(name string) *flag.FlagSet {
+	pickFlagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	pickFlagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy to use if the changes can't be applied cleanly. Supported values are 'n' (none), 'l' (keep the dataset's value), 'r' (take the commit's value) and 'p' (prompt).")
+	spec.RegisterCommitMetaFlags(pickFlagSet)
+	verbose.RegisterVerboseFlags(pickFlagSet)
+	return pickFlagSet
+}
+
+func runCherryPick(args []string) int {
+	return pickCommit(args[0], args[1], false)
+}
+
+// pickCommit applies the changes made by the commit at commitSpec to the head
+// of the dataset at dsSpec or, if revert is true, undoes them.
+func pickCommit(commitSpec, dsSpec string, revert bool) int {
+	resolve := decideResolveFunc(resolver)
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	headRef, ok := ds.MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s has no data", ds.ID())
+
+	commitDB, value, err := cfg.GetPath(commitSpec)
+	d.CheckErrorNoUsage(err)
+	defer commitDB.Close()
+	checkIfTrue(value == nil, "Object not found: %s", commitSpec)
+	checkIfTrue(!datas.IsCommitType(value.Type()), "%s does not reference a Commit object", commitSpec)
+
+	commit, ok := db.ReadValue(value.Hash()).(types.Struct)
+	checkIfTrue(!ok, "Commit %s is not in the same database as %s", commitSpec, dsSpec)
+	parents := commit.Get(datas.ParentsField).(types.Set)
+	checkIfTrue(parents.Len() != 1, "Commit %s must have exactly one parent, but has %d", commitSpec, parents.Len())
+	parent := parents.First().(types.Ref).TargetValue(db).(types.Struct)
+
+	from, to := parent.Get(datas.ValueField), commit.Get(datas.ValueField)
+	message := "Cherry-pick of #" + commit.Hash().String()
+	if revert {
+		from, to = to, from
+		message = "Revert of #" + commit.Hash().String()
+	}
+
+	merged, err := diff.CherryPick(ds.HeadValue(), from, to, db, resolve, nil)
+	d.CheckErrorNoUsage(err)
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", map[string]string{"message": message}, nil)
+	d.CheckErrorNoUsage(err)
+
+	ds, err = db.Commit(ds, merged, datas.CommitOptions{Parents: types.NewSet(headRef), Meta: meta})
+	d.CheckErrorNoUsage(err)
+
+	fmt.Printf("New head #%v (was #%v)\n", ds.HeadRef().TargetHash().String(), headRef.TargetHash().String())
+	return 0
+}
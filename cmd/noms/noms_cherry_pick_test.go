@@ -0,0 +1,96 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsCherryPick(t *testing.T) {
+	suite.Run(t, &nomsCherryPickTestSuite{})
+}
+
+type nomsCherryPickTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsCherryPickTestSuite) setup(dbName string) (fixSpec, conflictSpec string) {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir+"/"+dbName))
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	staging, err := db.CommitValue(db.GetDataset("staging"), types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2)))
+	s.NoError(err)
+	staging, err = db.CommitValue(staging, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2), types.String("fix"), types.Bool(true)))
+	s.NoError(err)
+	fixSpec = spec.CreateValueSpecString("ldb", s.LdbDir+"/"+dbName, "#"+staging.HeadRef().TargetHash().String())
+	staging, err = db.CommitValue(staging, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(3), types.String("fix"), types.Bool(true)))
+	s.NoError(err)
+	conflictSpec = spec.CreateValueSpecString("ldb", s.LdbDir+"/"+dbName, "#"+staging.HeadRef().TargetHash().String())
+
+	_, err = db.CommitValue(db.GetDataset("production"), types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(5)))
+	s.NoError(err)
+	return
+}
+
+func (s *nomsCherryPickTestSuite) headValue(dbName, dsName string) (types.Value, types.Struct) {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir+"/"+dbName, dsName))
+	s.NoError(err)
+	defer sp.Close()
+	ds := sp.GetDataset()
+	return ds.HeadValue(), ds.Head().Get(datas.MetaField).(types.Struct)
+}
+
+func (s *nomsCherryPickTestSuite) TestCherryPickAndRevert() {
+	fixSpec, _ := s.setup("revert")
+	prodSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/revert", "production")
+
+	stdout, _ := s.MustRun(main, []string{"cherry-pick", fixSpec, prodSpec})
+	s.Contains(stdout, "New head #")
+	head, meta := s.headValue("revert", "production")
+	s.True(types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(5), types.String("fix"), types.Bool(true)).Equals(head))
+	s.Contains(string(meta.Get("message").(types.String)), "Cherry-pick of #")
+
+	stdout, _ = s.MustRun(main, []string{"revert", "--message", "Undo the fix", fixSpec, prodSpec})
+	s.Contains(stdout, "New head #")
+	head, meta = s.headValue("revert", "production")
+	s.True(types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(5)).Equals(head))
+	s.Equal(types.String("Undo the fix"), meta.Get("message"))
+}
+
+func (s *nomsCherryPickTestSuite) TestCherryPickConflict() {
+	_, conflictSpec := s.setup("conflict")
+	prodSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/conflict", "production")
+
+	// The picked commit changes "b" from 2 to 3, but production has it set to 5.
+	_, stderr, err := s.Run(main, []string{"cherry-pick", conflictSpec, prodSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Conflict")
+
+	s.MustRun(main, []string{"cherry-pick", "--policy", "r", conflictSpec, prodSpec})
+	head, _ := s.headValue("conflict", "production")
+	s.True(types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(3)).Equals(head))
+}
+
+func (s *nomsCherryPickTestSuite) TestCherryPickBadInput() {
+	s.setup("bad")
+	dbSpec := s.LdbDir + "/bad"
+	prodSpec := spec.CreateValueSpecString("ldb", dbSpec, "production")
+
+	_, stderr, err := s.Run(main, []string{"cherry-pick", spec.CreateValueSpecString("ldb", dbSpec, "staging.value"), prodSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "does not reference a Commit object")
+
+	_, stderr, err = s.Run(main, []string{"cherry-pick", prodSpec, prodSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "must have exactly one parent")
+}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/attic-labs/noms/cmd/util"
@@ -15,17 +16,22 @@ import (
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
-var allowDupe bool
+var (
+	allowDupe   bool
+	commitValue string
+	commitFile  string
+)
 
 var nomsCommit = &util.Command{
 	Run:       runCommit,
 	UsageLine: "commit [options] [absolute-path] <dataset>",
 	Short:     "Commits a specified value as head of the dataset",
-	Long:      "If absolute-path is not provided, then it is read from stdin. See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the dataset and absolute-path arguments.",
+	Long:      "If absolute-path is not provided, then it is read from stdin. Instead of an absolute-path, the value to commit can be written out in the syntax printed by noms show, either with --value or in the file given by --value-file.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the dataset and absolute-path arguments.",
 	Flags:     setupCommitFlags,
 	Nargs:     1, // if absolute-path not present we read it from stdin
 }
@@ -33,6 +39,8 @@ var nomsCommit = &util.Command{
 func setupCommitFlags() *flag.FlagSet {
 	commitFlagSet := flag.NewFlagSet("commit", flag.ExitOnError)
 	commitFlagSet.BoolVar(&allowDupe, "allow-dupe", false, "creates a new commit, even if it would be identical (modulo metadata and parents) to the existing HEAD.")
+	commitFlagSet.StringVar(&commitValue, "value", "", "commits this value, written in the syntax printed by noms show, e.g. 'Person {name: \"Ann\"}'")
+	commitFlagSet.StringVar(&commitFile, "value-file", "", "commits the value in this file, written in the syntax printed by noms show. Use - for stdin.")
 	spec.RegisterCommitMetaFlags(commitFlagSet)
 	verbose.RegisterVerboseFlags(commitFlagSet)
 	return commitFlagSet
@@ -44,20 +52,28 @@ func runCommit(args []string) int {
 	d.CheckError(err)
 	defer db.Close()
 
-	var path string
-	if len(args) == 2 {
-		path = args[0]
+	var value types.Value
+	if commitValue != "" || commitFile != "" {
+		if len(args) == 2 || commitValue != "" && commitFile != "" {
+			d.CheckError(errors.New("Only one of absolute-path, --value and --value-file may be given"))
+		}
+		value = parseCommitValue(db)
 	} else {
-		readPath, _, err := bufio.NewReader(os.Stdin).ReadLine()
+		var path string
+		if len(args) == 2 {
+			path = args[0]
+		} else {
+			readPath, _, err := bufio.NewReader(os.Stdin).ReadLine()
+			d.CheckError(err)
+			path = string(readPath)
+		}
+		absPath, err := spec.NewAbsolutePath(path)
 		d.CheckError(err)
-		path = string(readPath)
-	}
-	absPath, err := spec.NewAbsolutePath(path)
-	d.CheckError(err)
 
-	value := absPath.Resolve(db)
-	if value == nil {
-		d.CheckErrorNoUsage(errors.New(fmt.Sprintf("Error resolving value: %s", path)))
+		value = absPath.Resolve(db)
+		if value == nil {
+			d.CheckErrorNoUsage(errors.New(fmt.Sprintf("Error resolving value: %s", path)))
+		}
 	}
 
 	oldCommitRef, oldCommitExists := ds.MaybeHeadRef()
@@ -82,3 +98,23 @@ func runCommit(args []string) int {
 	}
 	return 0
 }
+
+func parseCommitValue(vrw types.ValueReadWriter) types.Value {
+	text := commitValue
+	if commitFile != "" {
+		var data []byte
+		var err error
+		if commitFile == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(commitFile)
+		}
+		d.CheckErrorNoUsage(err)
+		text = string(data)
+	}
+	value, err := types.ParseHumanReadable(vrw, text)
+	if err != nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Error parsing value: %s", err))
+	}
+	return value
+}
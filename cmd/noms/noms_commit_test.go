@@ -5,7 +5,9 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/attic-labs/noms/go/datas"
@@ -214,3 +216,38 @@ func (s *nomsCommitTestSuite) TestNomsCommitInvalidMetadataFieldName() {
 		s.MustRun(main, []string{"commit", "--allow-dupe=1", "--meta=_foo=bar", "#" + ref.TargetHash().String(), sp.Spec})
 	})
 }
+
+func (s *nomsCommitTestSuite) TestNomsCommitLiteralValue() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir, "commitLiteral"))
+	s.NoError(err)
+	defer sp.Close()
+
+	stdoutString, _ := s.MustRun(main, []string{"commit", "--value", `Person {name: "Ann", tags: Set<String>({})}`, sp.Spec})
+	s.Contains(stdoutString, "New head #")
+
+	expected := types.NewStruct("Person", types.StructData{"name": types.String("Ann"), "tags": types.NewSet()})
+	sp, _ = spec.ForDataset(sp.Spec)
+	defer sp.Close()
+	s.True(expected.Equals(sp.GetDataset().HeadValue()))
+
+	_, stderrString, exitErr := s.Run(main, []string{"commit", "--value", `Person {name: }`, sp.Spec})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Contains(stderrString, "Error parsing value: 1:15: expected a value")
+}
+
+func (s *nomsCommitTestSuite) TestNomsCommitValueFile() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir, "commitValueFile"))
+	s.NoError(err)
+	defer sp.Close()
+
+	expected := types.NewMap(types.String("list"), types.NewList(types.Number(1), types.Number(2), types.Number(3), types.Number(4)))
+	file := filepath.Join(s.TempDir, "value.txt")
+	s.NoError(ioutil.WriteFile(file, []byte(types.EncodedValue(expected)), 0644))
+
+	stdoutString, _ := s.MustRun(main, []string{"commit", "--value-file", file, sp.Spec})
+	s.Contains(stdoutString, "New head #")
+
+	sp, _ = spec.ForDataset(sp.Spec)
+	defer sp.Close()
+	s.True(expected.Equals(sp.GetDataset().HeadValue()))
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/nbs"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsCompact = &util.Command{
+	Run:       runCompact,
+	UsageLine: "compact [--codec <codec>] [--dict <file>] <db-spec>",
+	Short:     "Conjoins the small tables of a database into larger ones",
+	Long:      "Conjoins tables of similar size into larger ones, as is done in the background after each commit, until there is nothing left to do, and prints how many tables and chunks there were before and after. Unlike gc, it doesn't drop any chunks.\n\n--codec makes the database write new tables with snappy, the default, or zstd, and --dict makes it compress them with a zstd dictionary, such as one trained by `zstd --train` on a sample of chunks. The choice is recorded in the database, so it applies to everything that writes to it from then on. Tables that have already been written keep their compression until they are conjoined with tables of another. Only NBS-backed databases (nbs: and aws: with a bucket) are supported.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupCompactFlags,
+	Nargs:     1,
+}
+
+var (
+	compactCodec string
+	compactDict  string
+)
+
+func setupCompactFlags() *flag.FlagSet {
+	compactFlagSet := flag.NewFlagSet("compact", flag.ExitOnError)
+	compactFlagSet.StringVar(&compactCodec, "codec", "", "compress new tables with this codec: snappy or zstd")
+	compactFlagSet.StringVar(&compactDict, "dict", "", "compress new tables with the zstd dictionary in this file")
+	return compactFlagSet
+}
+
+func runCompact(args []string) int {
+	cfg := config.NewResolver()
+	cs, err := cfg.GetChunkStore(args[0])
+	d.CheckErrorNoUsage(err)
+
+	store, ok := cs.(*nbs.NomsBlockStore)
+	if !ok {
+		if cs != nil {
+			cs.Close()
+		}
+		d.CheckErrorNoUsage(fmt.Errorf("compact is not supported for %s", args[0]))
+	}
+	defer store.Close()
+
+	if compactCodec != "" || compactDict != "" {
+		codec, dict := parseCompression(compactCodec, compactDict)
+		store.SetCompression(codec, dict)
+		if dict != nil {
+			fmt.Printf("Compressing new tables with %s and dictionary %08x\n", codec, dict.ID())
+		} else {
+			fmt.Printf("Compressing new tables with %s\n", codec)
+		}
+	}
+	fmt.Println(store.Compact())
+	return 0
+}
+
+// parseCompression returns the codec called |name|, which defaults to zstd if
+// there is a dictionary, and the dictionary in |dictFile|, if it's given.
+func parseCompression(name, dictFile string) (nbs.Codec, *nbs.Dictionary) {
+	if dictFile == "" {
+		codec, err := nbs.ParseCodec(name)
+		d.CheckErrorNoUsage(err)
+		return codec, nil
+	}
+	if name == "" {
+		name = nbs.ZstdCodec.String()
+	}
+	codec, err := nbs.ParseCodec(name)
+	d.CheckErrorNoUsage(err)
+	if codec != nbs.ZstdCodec {
+		d.CheckErrorNoUsage(fmt.Errorf("--dict can only be used with zstd, not %s", codec))
+	}
+	data, err := ioutil.ReadFile(dictFile)
+	d.CheckErrorNoUsage(err)
+	dict, err := nbs.ParseDictionary(data)
+	d.CheckErrorNoUsage(err)
+	return codec, dict
+}
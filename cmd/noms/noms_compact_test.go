@@ -0,0 +1,89 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsCompact(t *testing.T) {
+	suite.Run(t, &nomsCompactTestSuite{})
+}
+
+type nomsCompactTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsCompactTestSuite) TestNomsCompact() {
+	dir := s.LdbDir + "/nbs"
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	for i := 0; i < 4; i++ {
+		_, err := db.CommitValue(db.GetDataset(fmt.Sprintf("ds%d", i)), types.Number(i))
+		s.NoError(err)
+	}
+	s.NoError(db.Close())
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", dir)
+	// The four tables written by the commits may already have been conjoined in the background, but either way there's one left.
+	rtnVal, _ := s.MustRun(main, []string{"compact", dbSpec})
+	s.Regexp(`^Tables: [14] before, 1 after\nChunks: 8 before, 8 after\nWrote [01] tables in `, rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", dir, "ds3.value")})
+	s.Equal("3\n", rtnVal)
+}
+
+func (s *nomsCompactTestSuite) TestNomsCompactCompression() {
+	dir := s.LdbDir + "/nbs"
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	samples := [][]byte{}
+	for i := 0; i < 100; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("struct Person {name: \"person %d\", age: %d}", i, i)))
+	}
+	_, err := db.CommitValue(db.GetDataset("ds"), types.Number(42))
+	s.NoError(err)
+	s.NoError(db.Close())
+	dict, err := nbs.TrainDictionary(samples, 1024)
+	s.NoError(err)
+	dictFile := filepath.Join(s.TempDir, "dict")
+	s.NoError(ioutil.WriteFile(dictFile, dict.Bytes(), 0644))
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", dir)
+	rtnVal, _ := s.MustRun(main, []string{"compact", "--dict", dictFile, dbSpec})
+	s.Contains(rtnVal, fmt.Sprintf("Compressing new tables with zstd and dictionary %08x\n", dict.ID()))
+
+	// The compression is recorded in the database, so it's used by whatever opens it next.
+	store := nbs.NewLocalStore(dir, 1<<20)
+	codec, dictID := store.Compression()
+	s.Equal(nbs.ZstdCodec, codec)
+	s.Equal(dict.ID(), dictID)
+	s.NoError(store.Close())
+
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", dir, "ds.value")})
+	s.Equal("42\n", rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"compact", "--codec", "snappy", dbSpec})
+	s.Contains(rtnVal, "Compressing new tables with snappy\n")
+
+	_, stderr, exitErr := s.Run(main, []string{"compact", "--codec", "snappy", "--dict", dictFile, dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Contains(stderr, "--dict can only be used with zstd")
+}
+
+func (s *nomsCompactTestSuite) TestNomsCompactUnsupported() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	_, stderr, err := s.Run(main, []string{"compact", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "compact is not supported")
+}
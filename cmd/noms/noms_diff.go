@@ -11,18 +11,23 @@ import (
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/diff"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/outputpager"
 	"github.com/attic-labs/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
-var summarize bool
+var (
+	summarize  bool
+	diffFormat string
+)
 
 var nomsDiff = &util.Command{
 	Run:       runDiff,
-	UsageLine: "diff [--summarize] <object1> <object2>",
+	UsageLine: "diff [--summarize] [--format=text|json] <object1> <object2>",
 	Short:     "Shows the difference between two objects",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object arguments.",
+	Long:      "With --format=json, the difference is written as a patch that can be applied to another dataset with noms apply.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object arguments.",
 	Flags:     setupDiffFlags,
 	Nargs:     2,
 }
@@ -30,6 +35,7 @@ var nomsDiff = &util.Command{
 func setupDiffFlags() *flag.FlagSet {
 	diffFlagSet := flag.NewFlagSet("diff", flag.ExitOnError)
 	diffFlagSet.BoolVar(&summarize, "summarize", false, "Writes a summary of the changes instead")
+	diffFlagSet.StringVar(&diffFormat, "format", "text", "output format: text or json")
 	outputpager.RegisterOutputpagerFlags(diffFlagSet)
 	verbose.RegisterVerboseFlags(diffFlagSet)
 
@@ -37,6 +43,13 @@ func setupDiffFlags() *flag.FlagSet {
 }
 
 func runDiff(args []string) int {
+	if diffFormat != "text" && diffFormat != "json" {
+		d.CheckErrorNoUsage(fmt.Errorf("Unknown format %s, expected text or json", diffFormat))
+	}
+	if summarize && diffFormat != "text" {
+		d.CheckErrorNoUsage(fmt.Errorf("--summarize cannot be used with --format=%s", diffFormat))
+	}
+
 	cfg := config.NewResolver()
 	db1, value1, err := cfg.GetPath(args[0])
 	d.CheckErrorNoUsage(err)
@@ -60,6 +73,32 @@ func runDiff(args []string) int {
 	pgr := outputpager.Start()
 	defer pgr.Stop()
 
+	if diffFormat == "json" {
+		d.CheckErrorNoUsage(diff.WritePatch(pgr.Writer, value1, value2, valueReaders{db1, db2}))
+		return 0
+	}
+
 	diff.PrintDiff(pgr.Writer, value1, value2, false)
 	return 0
 }
+
+// valueReaders reads each Value from the first of its ValueReaders that has
+// it, so that a diff between two databases can read from both.
+type valueReaders []types.ValueReader
+
+func (vrs valueReaders) ReadValue(h hash.Hash) types.Value {
+	for _, vr := range vrs {
+		if v := vr.ReadValue(h); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func (vrs valueReaders) ReadManyValues(hashes hash.HashSet, foundValues chan<- types.Value) {
+	for h := range hashes {
+		if v := vrs.ReadValue(h); v != nil {
+			foundValues <- v
+		}
+	}
+}
@@ -10,18 +10,23 @@ import (
 	"github.com/attic-labs/noms/cmd/util"
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
-var toDelete string
+var (
+	toDelete  string
+	showTags  bool
+	tagToMake string
+)
 
 var nomsDs = &util.Command{
 	Run:       runDs,
-	UsageLine: "ds [<database> | -d <dataset>]",
+	UsageLine: "ds [<database> | -d <dataset> | --tags <database> | --create-tag <name> <dataset>]",
 	Short:     "Noms dataset management",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
+	Long:      "Lists the datasets in a database, or with --tags, its tags. Tags are immutable names for commits, created with --create-tag from the current head of a dataset and addressable as tag:<name> (e.g. db::tag:v1.2).\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
 	Flags:     setupDsFlags,
 	Nargs:     0,
 }
@@ -29,6 +34,8 @@ var nomsDs = &util.Command{
 func setupDsFlags() *flag.FlagSet {
 	dsFlagSet := flag.NewFlagSet("ds", flag.ExitOnError)
 	dsFlagSet.StringVar(&toDelete, "d", "", "dataset to delete")
+	dsFlagSet.BoolVar(&showTags, "tags", false, "list tags instead of datasets")
+	dsFlagSet.StringVar(&tagToMake, "create-tag", "", "create a tag with the given name pointing at the head of <dataset>")
 	verbose.RegisterVerboseFlags(dsFlagSet)
 	return dsFlagSet
 }
@@ -46,9 +53,29 @@ func runDs(args []string) int {
 		}
 
 		_, err = set.Database().Delete(set)
-		d.CheckError(err)
+		d.CheckErrorNoUsage(err)
 
 		fmt.Printf("Deleted %v (was #%v)\n", toDelete, oldCommitRef.TargetHash().String())
+	} else if tagToMake != "" {
+		if len(args) < 1 {
+			d.CheckError(fmt.Errorf("Missing dataset to tag"))
+		}
+		if !datas.IsValidTagName(tagToMake) {
+			d.CheckErrorNoUsage(fmt.Errorf("Invalid tag name %s, must match %s", tagToMake, datas.TagFullRe.String()))
+		}
+		db, set, err := cfg.GetDataset(args[0])
+		d.CheckError(err)
+		defer db.Close()
+
+		headRef, ok := set.MaybeHeadRef()
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Dataset %v not found", set.ID()))
+		}
+
+		_, err = db.Tag(tagToMake, headRef)
+		d.CheckErrorNoUsage(err)
+
+		fmt.Printf("Tagged %v (#%v) as %v\n", args[0], headRef.TargetHash().String(), tagToMake)
 	} else {
 		dbSpec := ""
 		if len(args) >= 1 {
@@ -59,7 +86,12 @@ func runDs(args []string) int {
 		defer store.Close()
 
 		store.Datasets().IterAll(func(k, v types.Value) {
-			fmt.Println(k)
+			id := string(k.(types.String))
+			if isTag := datas.IsTag(id); showTags && isTag {
+				fmt.Println(datas.TagName(id))
+			} else if !showTags && !isTag {
+				fmt.Println(id)
+			}
 		})
 	}
 	return 0
@@ -83,3 +83,44 @@ func (s *nomsDsTestSuite) TestNomsDs() {
 	rtnVal, _ = s.MustRun(main, []string{"ds", dbSpec})
 	s.Equal("", rtnVal)
 }
+
+func (s *nomsDsTestSuite) TestNomsDsTags() {
+	dir := s.LdbDir
+
+	cs := chunks.NewLevelDBStore(dir+"/name", "", 24, false)
+	db := datas.NewDatabase(cs)
+	set, err := db.CommitValue(db.GetDataset("release"), types.String("Commit Value"))
+	s.NoError(err)
+	headHash := set.HeadRef().TargetHash().String()
+	s.NoError(db.Close())
+
+	dbSpec := spec.CreateDatabaseSpecString("ldb", dir+"/name")
+	datasetName := spec.CreateValueSpecString("ldb", dir+"/name", "release")
+
+	rtnVal, _ := s.MustRun(main, []string{"ds", "--tags", dbSpec})
+	s.Equal("", rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--create-tag", "v1.2", datasetName})
+	s.Equal("Tagged "+datasetName+" (#"+headHash+") as v1.2\n", rtnVal)
+
+	// Tags are listed separately from datasets
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--tags", dbSpec})
+	s.Equal("v1.2\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"ds", dbSpec})
+	s.Equal("release\n", rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("ldb", dir+"/name", "tag:v1.2.value")})
+	s.Equal("\"Commit Value\"\n", rtnVal)
+
+	// Tags can't be re-created
+	_, stderr, recoveredErr := s.Run(main, []string{"ds", "--create-tag", "v1.2", datasetName})
+	s.Equal(clienttest.ExitError{Code: 1}, recoveredErr)
+	s.Equal("error: "+datas.ErrTagExists.Error()+"\n", stderr)
+
+	// or deleted
+	_, stderr, recoveredErr = s.Run(main, []string{"ds", "-d", spec.CreateValueSpecString("ldb", dir+"/name", "tag:v1.2")})
+	s.Equal(clienttest.ExitError{Code: 1}, recoveredErr)
+	s.Equal("error: "+datas.ErrTagImmutable.Error()+"\n", stderr)
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--tags", dbSpec})
+	s.Equal("v1.2\n", rtnVal)
+}
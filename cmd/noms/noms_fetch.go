@@ -0,0 +1,114 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	localDB string
+
+	nomsFetch = &util.Command{
+		Run:       runFetch,
+		UsageLine: "fetch [options] <remote> [<dataset>...]",
+		Short:     "Copies the heads of datasets in a remote into remote-tracking datasets",
+		Long:      "Remotes are named in .nomsconfig, e.g.\n\n  [remote.origin]\n    url = \"http://demo.noms.io/cli-tour\"\n\nFor each dataset given, or every dataset in the remote if none are, fetch copies the head of the dataset in the remote into the dataset <remote>/<dataset> of the local database, replacing whatever was there. Tags are not fetched. Local datasets are never changed; use noms pull to merge fetched changes into them.",
+		Flags:     setupFetchFlags,
+		Nargs:     1,
+	}
+
+	remoteNameRe = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+)
+
+func setupFetchFlags() *flag.FlagSet {
+	fetchFlagSet := flag.NewFlagSet("fetch", flag.ExitOnError)
+	registerRemoteFlags(fetchFlagSet)
+	verbose.RegisterVerboseFlags(fetchFlagSet)
+	return fetchFlagSet
+}
+
+// registerRemoteFlags registers the flags shared by fetch, pull and push.
+func registerRemoteFlags(flags *flag.FlagSet) {
+	flags.StringVar(&localDB, "db", "", "the local database; defaults to the default database in .nomsconfig")
+	flags.IntVar(&p, "p", 512, "parallelism")
+}
+
+func runFetch(args []string) int {
+	cfg := config.NewResolver()
+	local, remote := openRemote(cfg, args[0])
+	defer local.Close()
+	defer remote.Close()
+
+	ids := args[1:]
+	if len(ids) == 0 {
+		remote.Datasets().IterAll(func(k, v types.Value) {
+			if id := string(k.(types.String)); !strings.HasPrefix(id, datas.TagPrefix) {
+				ids = append(ids, id)
+			}
+		})
+	}
+	for _, id := range ids {
+		fetchDataset(local, remote, args[0], id)
+	}
+	return 0
+}
+
+// openRemote opens the local database named by --db and the database of
+// the remote called |name|.
+func openRemote(cfg *config.Resolver, name string) (local, remote datas.Database) {
+	checkIfTrue(!remoteNameRe.MatchString(name), "Invalid remote name %s, must match %s", name, remoteNameRe.String())
+	checkIfTrue(cfg.ResolveDbSpec(localDB) == "", "No local database; use --db, or add a [db.%s] section to %s", config.DefaultDbAlias, config.NomsConfigFile)
+
+	remote, err := cfg.GetRemoteDatabase(name)
+	d.CheckErrorNoUsage(err)
+	local, err = cfg.GetDatabase(localDB)
+	if err != nil {
+		remote.Close()
+		d.CheckErrorNoUsage(err)
+	}
+	return
+}
+
+// remoteTrackingID returns the ID of the local dataset that holds the head
+// of dataset |id| in |remote| as of the last fetch.
+func remoteTrackingID(remote, id string) string {
+	return remote + "/" + id
+}
+
+// fetchDataset copies the head of dataset |id| in |remote| into its
+// remote-tracking dataset in |local|, and returns the updated dataset.
+func fetchDataset(local, remote datas.Database, remoteName, id string) datas.Dataset {
+	remoteRef, ok := remote.GetDataset(id).MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s does not exist in %s", id, remoteName)
+
+	tracking := local.GetDataset(remoteTrackingID(remoteName, id))
+	trackingRef, ok := tracking.MaybeHeadRef()
+	if ok && trackingRef.Equals(remoteRef) {
+		return tracking
+	}
+
+	datas.ResumablePull(remote, local, remoteRef, trackingRef, p, nil)
+	tracking, err := local.SetHead(tracking, remoteRef)
+	d.PanicIfError(err)
+
+	if ok {
+		fmt.Fprintf(os.Stdout, "%s -> %s (#%s..#%s)\n", id, tracking.ID(), trackingRef.TargetHash(), remoteRef.TargetHash())
+	} else {
+		fmt.Fprintf(os.Stdout, "%s -> %s (new, #%s)\n", id, tracking.ID(), remoteRef.TargetHash())
+	}
+	return tracking
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsRemotes(t *testing.T) {
+	suite.Run(t, &nomsRemotesTestSuite{})
+}
+
+type nomsRemotesTestSuite struct {
+	clienttest.ClientTestSuite
+	dir    string
+	oldCwd string
+}
+
+// SetupTest creates fresh "local" and "remote" databases, writes a
+// .nomsconfig whose default database is "local" and which names "remote" as
+// the remote origin, and runs each test from the directory containing it.
+func (s *nomsRemotesTestSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir(s.TempDir, "remotes")
+	s.NoError(err)
+	cfg := fmt.Sprintf("[db.%s]\n\turl = %q\n[remote.origin]\n\turl = %q\n",
+		config.DefaultDbAlias, spec.CreateDatabaseSpecString("ldb", s.dir+"/local"), spec.CreateDatabaseSpecString("ldb", s.dir+"/remote"))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.dir, config.NomsConfigFile), []byte(cfg), 0644))
+
+	s.oldCwd, err = os.Getwd()
+	s.NoError(err)
+	s.NoError(os.Chdir(s.dir))
+}
+
+func (s *nomsRemotesTestSuite) TearDownTest() {
+	s.NoError(os.Chdir(s.oldCwd))
+}
+
+func (s *nomsRemotesTestSuite) withDB(name string, f func(db datas.Database)) {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.dir+"/"+name))
+	s.NoError(err)
+	defer sp.Close()
+	f(sp.GetDatabase())
+}
+
+func (s *nomsRemotesTestSuite) commit(dbName, dsName string, v types.Value) (head types.Ref) {
+	s.withDB(dbName, func(db datas.Database) {
+		ds, err := db.CommitValue(db.GetDataset(dsName), v)
+		s.NoError(err)
+		head = ds.HeadRef()
+	})
+	return
+}
+
+func (s *nomsRemotesTestSuite) head(dbName, dsName string) (head types.Ref, ok bool) {
+	s.withDB(dbName, func(db datas.Database) {
+		head, ok = db.GetDataset(dsName).MaybeHeadRef()
+	})
+	return
+}
+
+func (s *nomsRemotesTestSuite) TestFetch() {
+	r1 := s.commit("remote", "foo", types.Number(1))
+	s.commit("remote", "bar", types.Number(2))
+
+	stdout, _ := s.MustRun(main, []string{"fetch", "origin"})
+	s.Contains(stdout, "foo -> origin/foo (new")
+	s.Contains(stdout, "bar -> origin/bar (new")
+	tracking, ok := s.head("local", "origin/foo")
+	s.True(ok)
+	s.True(r1.Equals(tracking))
+	_, ok = s.head("local", "foo")
+	s.False(ok, "fetch must not touch local datasets")
+
+	r2 := s.commit("remote", "foo", types.Number(3))
+	stdout, _ = s.MustRun(main, []string{"fetch", "origin", "foo"})
+	s.Equal(fmt.Sprintf("foo -> origin/foo (#%s..#%s)\n", r1.TargetHash(), r2.TargetHash()), stdout)
+
+	_, stderr, err := s.Run(main, []string{"fetch", "upstream"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Unknown remote upstream")
+	_, stderr, err = s.Run(main, []string{"fetch", "origin", "baz"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Dataset baz does not exist in origin")
+}
+
+func (s *nomsRemotesTestSuite) TestPushRefusesNonFastForward() {
+	l1 := s.commit("local", "foo", types.Number(1))
+	stdout, _ := s.MustRun(main, []string{"push", "origin", "foo"})
+	s.Contains(stdout, "foo -> origin (new")
+	head, _ := s.head("remote", "foo")
+	s.True(l1.Equals(head))
+	tracking, _ := s.head("local", "origin/foo")
+	s.True(l1.Equals(tracking))
+
+	l2 := s.commit("local", "foo", types.Number(2))
+	s.MustRun(main, []string{"push", "origin", "foo"})
+	head, _ = s.head("remote", "foo")
+	s.True(l2.Equals(head))
+
+	// Someone else pushes to the remote, so the local head no longer descends from it.
+	r3 := s.commit("remote", "foo", types.Number(3))
+	l3 := s.commit("local", "foo", types.Number(4))
+	_, stderr, err := s.Run(main, []string{"push", "origin", "foo"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Rejected non-fast-forward push")
+	head, _ = s.head("remote", "foo")
+	s.True(r3.Equals(head))
+
+	stdout, _ = s.MustRun(main, []string{"push", "--force", "origin", "foo"})
+	s.Contains(stdout, "forced update")
+	head, _ = s.head("remote", "foo")
+	s.True(l3.Equals(head))
+}
+
+func (s *nomsRemotesTestSuite) TestPull() {
+	base := types.NewStruct("", types.StructData{"a": types.Number(1), "b": types.Number(1)})
+	r1 := s.commit("remote", "foo", base)
+
+	stdout, _ := s.MustRun(main, []string{"pull", "origin", "foo"})
+	s.Contains(stdout, "Created dataset foo")
+	head, _ := s.head("local", "foo")
+	s.True(r1.Equals(head))
+
+	r2 := s.commit("remote", "foo", base.Set("a", types.Number(2)))
+	stdout, _ = s.MustRun(main, []string{"pull", "origin", "foo"})
+	s.Contains(stdout, "Fast-forwarded foo")
+	head, _ = s.head("local", "foo")
+	s.True(r2.Equals(head))
+
+	// Divergent, but non-conflicting, changes on both sides are merged.
+	s.commit("remote", "foo", base.Set("a", types.Number(2)).Set("b", types.Number(3)))
+	s.commit("local", "foo", base.Set("a", types.Number(2)).Set("c", types.Number(4)))
+	stdout, _ = s.MustRun(main, []string{"pull", "origin", "foo"})
+	s.Contains(stdout, "Merged origin/foo into foo")
+	s.withDB("local", func(db datas.Database) {
+		expected := base.Set("a", types.Number(2)).Set("b", types.Number(3)).Set("c", types.Number(4))
+		s.True(expected.Equals(db.GetDataset("foo").HeadValue()))
+		s.Equal(uint64(2), db.GetDataset("foo").Head().Get(datas.ParentsField).(types.Set).Len())
+	})
+	stdout, _ = s.MustRun(main, []string{"pull", "origin", "foo"})
+	s.Contains(stdout, "already up to date")
+
+	// Conflicting changes are left for noms merge.
+	s.commit("remote", "foo", base.Set("a", types.Number(5)))
+	s.commit("local", "foo", base.Set("a", types.Number(6)))
+	_, stderr, err := s.Run(main, []string{"pull", "origin", "foo"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Use noms merge")
+	stdout, _ = s.MustRun(main, []string{"pull", "--policy=r", "origin", "foo"})
+	s.Contains(stdout, "Merged origin/foo into foo")
+}
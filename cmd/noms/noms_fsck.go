@@ -0,0 +1,107 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsFsck = &util.Command{
+	Run:       runFsck,
+	UsageLine: "fsck [--repair] <db-spec>",
+	Short:     "Checks a database for missing and corrupt data",
+	Long:      "Reads every table of a database in full, checking its index and the checksum and hash of each chunk in it, and that each table its manifest names exists. Then walks every chunk reachable from the root of the database, reporting each one that is missing or can't be decoded, along with the path that reached it, as #<hash of the value that refers to it><path within that value>. With --repair, the damaged tables are dropped from the database, and the walk reports what was lost with them. Exits with status 1 if anything is wrong. Only NBS-backed databases (nbs: and aws: with a bucket) are supported.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupFsckFlags,
+	Nargs:     1,
+}
+
+var repairFsck bool
+
+func setupFsckFlags() *flag.FlagSet {
+	fsckFlagSet := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fsckFlagSet.BoolVar(&repairFsck, "repair", false, "drop damaged tables from the database, losing the chunks in them")
+	return fsckFlagSet
+}
+
+func runFsck(args []string) int {
+	cfg := config.NewResolver()
+	sc, err := cfg.GetStoreChecker(args[0])
+	d.CheckErrorNoUsage(err)
+	if sc == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("fsck is not supported for %s", args[0]))
+	}
+
+	root, checks := sc.CheckTables()
+	bad := []string{}
+	for _, check := range checks {
+		if check.Err != nil {
+			bad = append(bad, check.Name)
+			fmt.Printf("Table %s: %s\n", check.Name, check.Err)
+		} else {
+			fmt.Printf("Table %s: OK, %d chunks\n", check.Name, check.Chunks)
+		}
+	}
+	if repairFsck && len(bad) > 0 {
+		// DropTables fails if another writer changed the database after CheckTables read it.
+		d.CheckErrorNoUsage(d.Unwrap(d.Try(func() { sc.DropTables(bad) })))
+		fmt.Printf("Dropped %d damaged tables\n", len(bad))
+	}
+
+	cs := sc.ChunkStore(bad)
+	defer cs.Close()
+	reached, missing, damaged := 0, 0, 0
+	if !root.IsEmpty() {
+		vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+		report := func(from hash.Hash, p types.Path, h hash.Hash, problem string) {
+			fmt.Printf("#%s%s: chunk %s %s\n", from, p, h, problem)
+		}
+		// read returns the value in chunk |h|, or nil if it's missing or damaged, in which case it reports that it was reached from |from| via |p|.
+		read := func(h, from hash.Hash, p types.Path) (v types.Value) {
+			reached++
+			c := cs.Get(h)
+			if c.IsEmpty() {
+				missing++
+				report(from, p, h, "is missing")
+				return nil
+			}
+			if hash.Of(c.Data()) != h {
+				damaged++
+				report(from, p, h, "doesn't match its hash")
+				return nil
+			}
+			defer func() {
+				if r := recover(); r != nil {
+					damaged++
+					report(from, p, h, fmt.Sprintf("can't be decoded: %v", r))
+					v = nil
+				}
+			}()
+			return types.DecodeValue(c, vs)
+		}
+
+		if v := read(root, root, types.Path{}); v != nil {
+			types.WalkRefPaths(v, func(r types.Ref, from hash.Hash, p types.Path) types.Value {
+				return read(r.TargetHash(), from, p)
+			})
+		}
+	}
+
+	fmt.Printf("Checked %d tables: %d damaged\n", len(checks), len(bad))
+	fmt.Printf("Reached %d chunks from root %s: %d missing, %d damaged\n", reached, root, missing, damaged)
+	if repairFsck && len(bad) > 0 && missing > 0 {
+		fmt.Printf("%d chunks, and any reachable only through them, were lost with the damaged tables\n", missing)
+	}
+	if missing > 0 || damaged > 0 || (len(bad) > 0 && !repairFsck) {
+		d.CheckErrorNoUsage(fmt.Errorf("%s is damaged", args[0]))
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsFsck(t *testing.T) {
+	suite.Run(t, &nomsFsckTestSuite{})
+}
+
+type nomsFsckTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// tableFiles returns the names of the table files in |dir|.
+func (s *nomsFsckTestSuite) tableFiles(dir string) map[string]bool {
+	infos, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	tables := map[string]bool{}
+	for _, info := range infos {
+		if len(info.Name()) == 32 { // the length of an encoded table name
+			tables[info.Name()] = true
+		}
+	}
+	return tables
+}
+
+func (s *nomsFsckTestSuite) TestNomsFsck() {
+	dir := s.LdbDir + "/nbs"
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	_, err := db.CommitValue(db.GetDataset("ds1"), types.NewList(types.String("foo"), types.String("bar")))
+	s.NoError(err)
+	s.NoError(db.Close())
+	first := s.tableFiles(dir)
+	s.Len(first, 1)
+
+	db = datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	_, err = db.CommitValue(db.GetDataset("ds2"), types.Number(42))
+	s.NoError(err)
+	s.NoError(db.Close())
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", dir)
+	rtnVal, _ := s.MustRun(main, []string{"fsck", dbSpec})
+	s.Regexp(`Checked 2 tables: 0 damaged\nReached \d+ chunks from root \w+: 0 missing, 0 damaged\n$`, rtnVal)
+
+	// Damage the table written by the first commit, which the second one refers to.
+	for name := range first {
+		path := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(path)
+		s.NoError(err)
+		data[10] ^= 0xff
+		s.NoError(ioutil.WriteFile(path, data, 0644))
+	}
+	rtnVal, stderr, exitErr := s.Run(main, []string{"fsck", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Contains(stderr, "is damaged")
+	s.Regexp(`Table \w+: Chunk record for \w+ fails its CRC check\n`, rtnVal)
+	s.Regexp(`\n#\w+\["ds1"\]: chunk \w+ is missing\n`, rtnVal)
+	s.Contains(rtnVal, "Checked 2 tables: 1 damaged\n")
+
+	rtnVal, _, exitErr = s.Run(main, []string{"fsck", "--repair", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Contains(rtnVal, "Dropped 1 damaged tables\n")
+	s.Contains(rtnVal, "1 chunks, and any reachable only through them, were lost with the damaged tables\n")
+
+	// The database can be opened again, and what's left of it is intact.
+	rtnVal, _, exitErr = s.Run(main, []string{"fsck", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Contains(rtnVal, "Checked 1 tables: 0 damaged\n")
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", dir, "ds2.value")})
+	s.Equal("42\n", rtnVal)
+}
+
+func (s *nomsFsckTestSuite) TestNomsFsckUnsupported() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	_, stderr, err := s.Run(main, []string{"fsck", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "fsck is not supported")
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsGC = &util.Command{
+	Run:       runGC,
+	UsageLine: "gc [options] <db-spec>",
+	Short:     "Removes chunks that are not reachable from the root of a database",
+	Long:      "Copies every chunk reachable from the current root, or from any root set within --keep-roots (see noms reflog), into new tables and discards the rest. Only NBS-backed databases (nbs: and aws: with a bucket) are supported.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupGCFlags,
+	Nargs:     1,
+}
+
+var keepRoots time.Duration
+
+func setupGCFlags() *flag.FlagSet {
+	gcFlagSet := flag.NewFlagSet("gc", flag.ExitOnError)
+	gcFlagSet.DurationVar(&keepRoots, "keep-roots", nbs.DefaultRootLogRetention, "keep data reachable from roots the database has had within this long")
+	return gcFlagSet
+}
+
+func runGC(args []string) int {
+	cfg := config.NewResolver()
+	cs, err := cfg.GetChunkStore(args[0])
+	d.CheckErrorNoUsage(err)
+
+	store, ok := cs.(*nbs.NomsBlockStore)
+	if !ok {
+		if cs != nil {
+			cs.Close()
+		}
+		d.CheckErrorNoUsage(fmt.Errorf("gc is not supported for %s", args[0]))
+	}
+	db := datas.NewDatabase(store)
+	defer db.Close()
+
+	before := store.Count()
+	// Chunks that shallow syncs have left out of the database are missing on purpose; any others that are missing mean it's damaged.
+	d.CheckErrorNoUsage(store.GCKeepingRoots(keepRoots, datas.PrunedRefs(db)))
+	after := store.Count()
+	fmt.Printf("Collected %d of %d chunks, %d remaining\n", before-after, before, after)
+	return 0
+}
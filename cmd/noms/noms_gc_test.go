@@ -0,0 +1,117 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsGC(t *testing.T) {
+	suite.Run(t, &nomsGCTestSuite{})
+}
+
+type nomsGCTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsGCTestSuite) TestNomsGC() {
+	dir := s.LdbDir + "/nbs"
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+
+	_, err := db.CommitValue(db.GetDataset("keep"), types.String("keep me"))
+	s.NoError(err)
+	drop, err := db.CommitValue(db.GetDataset("drop"), types.NewList(types.String("drop"), types.String("me")))
+	s.NoError(err)
+	_, err = db.Delete(drop)
+	s.NoError(err)
+	s.NoError(db.Close())
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", dir)
+	// The dropped dataset is still in the root log, so by default it is kept.
+	rtnVal, _ := s.MustRun(main, []string{"gc", dbSpec})
+	s.Equal("Collected 0 of 4 chunks, 4 remaining\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"gc", "--keep-roots=0", dbSpec})
+	s.Equal("Collected 2 of 4 chunks, 2 remaining\n", rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"ds", dbSpec})
+	s.Equal("keep\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", dir, "keep.value")})
+	s.Equal("\"keep me\"\n", rtnVal)
+}
+
+func (s *nomsGCTestSuite) TestNomsGCShallow() {
+	srcDir, sinkDir := s.LdbDir+"/shallow-src", s.LdbDir+"/shallow-sink"
+	db := datas.NewDatabase(nbs.NewLocalStore(srcDir, 1<<20))
+	ds := db.GetDataset("ds")
+	for i := 0; i < 3; i++ {
+		var err error
+		ds, err = db.CommitValue(ds, types.Number(i))
+		s.NoError(err)
+	}
+	s.NoError(db.Close())
+
+	sinkSpec := spec.CreateValueSpecString("nbs", sinkDir, "ds")
+	s.MustRun(main, []string{"sync", "--depth", "1", spec.CreateValueSpecString("nbs", srcDir, "ds"), sinkSpec})
+	// A dataset that happens to have the name that shallow pulls once recorded their gaps under isn't mistaken for that record.
+	sink := datas.NewDatabase(nbs.NewLocalStore(sinkDir, 1<<20))
+	_, err := sink.CommitValue(sink.GetDataset("pruned-refs"), types.Number(42))
+	s.NoError(err)
+	s.NoError(sink.Close())
+	// The parents that the shallow sync left out are missing on purpose, so GC doesn't treat them as damage.
+	s.MustRun(main, []string{"gc", "--keep-roots=0", spec.CreateDatabaseSpecString("nbs", sinkDir)})
+	rtnVal, _ := s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", sinkDir, "ds.value")})
+	s.Equal("2\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", sinkDir, "pruned-refs.value")})
+	s.Equal("42\n", rtnVal)
+}
+
+func (s *nomsGCTestSuite) TestNomsGCDamaged() {
+	dir := s.LdbDir + "/damaged"
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	_, err := db.CommitValue(db.GetDataset("ds1"), types.NewList(types.String("foo"), types.String("bar")))
+	s.NoError(err)
+	s.NoError(db.Close())
+	infos, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	first := []string{}
+	for _, info := range infos {
+		if len(info.Name()) == 32 { // the length of an encoded table name
+			first = append(first, info.Name())
+		}
+	}
+	s.Len(first, 1)
+
+	db = datas.NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	_, err = db.CommitValue(db.GetDataset("ds2"), types.Number(42))
+	s.NoError(err)
+	s.NoError(db.Close())
+
+	// Lose the chunks written by the first commit, which the second one refers to.
+	nbs.NewLocalStoreChecker(dir, nil).DropTables(first)
+	before, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+
+	_, stderr, exitErr := s.Run(main, []string{"gc", spec.CreateDatabaseSpecString("nbs", dir)})
+	s.Equal(clienttest.ExitError{Code: 1}, exitErr)
+	s.Regexp(`error: Chunk \w+ is reachable but missing from the store\n`, stderr)
+	after, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.Equal(len(before), len(after))
+}
+
+func (s *nomsGCTestSuite) TestNomsGCUnsupported() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	_, stderr, err := s.Run(main, []string{"gc", dbSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "gc is not supported")
+}
@@ -297,7 +297,11 @@ func writeDiffLines(node LogNode, db datas.Database, maxLines, lineno int, w io.
 		return 1, err
 	}
 
-	parentCommit := parent.(types.Ref).TargetValue(db).(types.Struct)
+	var parentCommit types.Struct
+	if d.Try(func() { parentCommit = parent.(types.Ref).TargetValue(db).(types.Struct) }, datas.ShallowError{}) != nil {
+		_, err = fmt.Fprint(pw, "(no diff, the parent commit was left out of this shallow copy)\n")
+		return int(pw.NumLines), err
+	}
 	err = diff.PrintDiff(pw, parentCommit.Get(datas.ValueField), node.commit.Get(datas.ValueField), true)
 	mlw.MaxLines = 0
 	if err != nil {
@@ -22,22 +22,32 @@ import (
 )
 
 var (
-	resolver string
+	resolver      string
+	continueMerge bool
 
 	nomsMerge = &util.Command{
 		Run:       runMerge,
 		UsageLine: "merge [options] <database> <left-dataset-name> <right-dataset-name> <output-dataset-name>",
 		Short:     "Merges and commits the head values of two named datasets",
-		Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.\nYu must provide a working database and the names of two Datasets you want to merge. The values at the heads of these Datasets will be merged, put into a new Commit object, and set as the Head of the third provided Dataset name.",
+		Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.\nYu must provide a working database and the names of two Datasets you want to merge. The values at the heads of these Datasets will be merged, put into a new Commit object, and set as the Head of the third provided Dataset name.\n\nIf the merge runs into conflicts that --policy can't resolve, they are all recorded in the dataset " + datas.MergeStatePrefix + "<output-dataset-name> and the merge stops. Each conflict is keyed by its path and records the ours (left), theirs (right) and ancestor values found there. Resolve a conflict by adding a 'resolved' field to it, holding a struct Resolution with the merged value in its 'value' field (or no fields, to remove the path), and commit the result back to that dataset. Then run 'noms merge --continue <database> <output-dataset-name>' to finish the merge, using --policy for any conflicts left unresolved.",
 		Flags:     setupMergeFlags,
 		Nargs:     1, // if absolute-path not present we read it from stdin
 	}
 	datasetRe = regexp.MustCompile("^" + datas.DatasetRe.String() + "$")
 )
 
+const (
+	mergeStateName = "MergeState"
+	leftField      = "left"
+	rightField     = "right"
+	ancestorField  = "ancestor"
+	conflictsField = "conflicts"
+)
+
 func setupMergeFlags() *flag.FlagSet {
 	commitFlagSet := flag.NewFlagSet("merge", flag.ExitOnError)
 	commitFlagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy for merging. Defaults to 'n', which means no resolution strategy will be applied. Supported values are 'l' (left), 'r' (right) and 'p' (prompt). 'prompt' will bring up a simple command-line prompt allowing you to resolve conflicts by choosing between 'l' or 'r' on a case-by-case basis.")
+	commitFlagSet.BoolVar(&continueMerge, "continue", false, "finishes a merge whose conflicts have been recorded and resolved. Takes only <database> and <output-dataset-name> as arguments.")
 	verbose.RegisterVerboseFlags(commitFlagSet)
 	return commitFlagSet
 }
@@ -49,6 +59,9 @@ func checkIfTrue(b bool, format string, args ...interface{}) {
 }
 
 func runMerge(args []string) int {
+	if continueMerge {
+		return runContinueMerge(args)
+	}
 	cfg := config.NewResolver()
 
 	if len(args) != 4 {
@@ -59,59 +72,109 @@ func runMerge(args []string) int {
 	defer db.Close()
 
 	leftDS, rightDS, outDS := resolveDatasets(db, args[1], args[2], args[3])
-	left, right, ancestor := getMergeCandidates(db, leftDS, rightDS)
-	policy := decidePolicy(resolver)
+	stateDS := db.GetDataset(datas.MergeStateID(outDS.ID()))
+	_, inProgress := stateDS.MaybeHeadRef()
+	checkIfTrue(inProgress, "A merge into %s is already in progress. Finish it with --continue, or delete %s to abandon it", outDS.ID(), stateDS.ID())
+
+	left, right, ancestorRef := getMergeCandidates(db, leftDS, rightDS)
+	ancestor := ancestorRef.TargetValue(db).(types.Struct).Get(datas.ValueField)
+	collector := merge.NewConflictCollector(ancestor, db, decideResolveFunc(resolver))
 	pc := newMergeProgressChan()
-	merged, err := policy(left, right, ancestor, db, pc)
+	merged, err := merge.ThreeWay(left, right, ancestor, db, collector.Resolve, pc)
 	d.CheckErrorNoUsage(err)
 	close(pc)
 
-	_, err = db.SetHead(outDS, db.WriteValue(datas.NewCommit(merged, types.NewSet(leftDS.HeadRef(), rightDS.HeadRef()), types.EmptyStruct)))
+	if len(collector.Conflicts) > 0 {
+		state := types.NewStruct(mergeStateName, types.StructData{
+			leftField:      leftDS.HeadRef(),
+			rightField:     rightDS.HeadRef(),
+			ancestorField:  ancestorRef,
+			conflictsField: merge.ConflictsToMap(collector.Conflicts),
+		})
+		_, err = db.CommitValue(stateDS, state)
+		d.PanicIfError(err)
+		d.CheckErrorNoUsage(fmt.Errorf("Merge stopped with %d conflicts, which have been recorded in %s. Resolve them, then run noms merge --continue %s %s", len(collector.Conflicts), stateDS.ID(), args[0], outDS.ID()))
+	}
+
+	commitMerge(db, outDS, merged, leftDS.HeadRef(), rightDS.HeadRef())
+	return 0
+}
+
+func runContinueMerge(args []string) int {
+	cfg := config.NewResolver()
+
+	if len(args) != 2 {
+		d.CheckErrorNoUsage(fmt.Errorf("Incorrect number of arguments"))
+	}
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	outDS := getMergeDataset(db, args[1])
+	stateDS := db.GetDataset(datas.MergeStateID(outDS.ID()))
+	state, ok := stateDS.MaybeHeadValue()
+	checkIfTrue(!ok, "No merge into %s is in progress", outDS.ID())
+
+	getField := func(name string) types.Value {
+		s, ok := state.(types.Struct)
+		checkIfTrue(!ok || s.Type().Desc.(types.StructDesc).Name != mergeStateName, "%s does not hold a %s", stateDS.ID(), mergeStateName)
+		v, ok := s.MaybeGet(name)
+		checkIfTrue(!ok, "%s is missing field %s", stateDS.ID(), name)
+		return v
+	}
+	leftRef, rightRef := getField(leftField).(types.Ref), getField(rightField).(types.Ref)
+	left := leftRef.TargetValue(db).(types.Struct).Get(datas.ValueField)
+	right := rightRef.TargetValue(db).(types.Struct).Get(datas.ValueField)
+	ancestor := getField(ancestorField).(types.Ref).TargetValue(db).(types.Struct).Get(datas.ValueField)
+	conflicts, ok := getField(conflictsField).(types.Map)
+	checkIfTrue(!ok, "%s.%s must be a Map", stateDS.ID(), conflictsField)
+
+	resolve, err := merge.NewConflictResolver(conflicts, decideResolveFunc(resolver))
+	checkIfTrue(err != nil, "%s.%s is malformed: %s", stateDS.ID(), conflictsField, err)
+
+	pc := newMergeProgressChan()
+	merged, err := merge.ThreeWay(left, right, ancestor, db, resolve, pc)
+	d.CheckErrorNoUsage(err)
+	close(pc)
+
+	commitMerge(db, outDS, merged, leftRef, rightRef)
+	_, err = db.Delete(stateDS)
+	d.PanicIfError(err)
+	return 0
+}
+
+func commitMerge(db datas.Database, outDS datas.Dataset, merged types.Value, leftRef, rightRef types.Ref) {
+	_, err := db.SetHead(outDS, db.WriteValue(datas.NewCommit(merged, types.NewSet(leftRef, rightRef), types.EmptyStruct)))
 	d.PanicIfError(err)
 	if !verbose.Quiet() {
 		status.Printf("Done")
 		status.Done()
 	}
-	return 0
 }
 
-func resolveDatasets(db datas.Database, leftName, rightName, outName string) (leftDS, rightDS, outDS datas.Dataset) {
-	makeDS := func(dsName string) datas.Dataset {
-		if !datasetRe.MatchString(dsName) {
-			d.CheckErrorNoUsage(fmt.Errorf("Invalid dataset %s, must match %s", dsName, datas.DatasetRe.String()))
-		}
-		return db.GetDataset(dsName)
+func getMergeDataset(db datas.Database, dsName string) datas.Dataset {
+	if !datasetRe.MatchString(dsName) {
+		d.CheckErrorNoUsage(fmt.Errorf("Invalid dataset %s, must match %s", dsName, datas.DatasetRe.String()))
 	}
-	leftDS = makeDS(leftName)
-	rightDS = makeDS(rightName)
-	outDS = makeDS(outName)
+	return db.GetDataset(dsName)
+}
+
+func resolveDatasets(db datas.Database, leftName, rightName, outName string) (leftDS, rightDS, outDS datas.Dataset) {
+	leftDS = getMergeDataset(db, leftName)
+	rightDS = getMergeDataset(db, rightName)
+	outDS = getMergeDataset(db, outName)
 	return
 }
 
-func getMergeCandidates(db datas.Database, leftDS, rightDS datas.Dataset) (left, right, ancestor types.Value) {
+func getMergeCandidates(db datas.Database, leftDS, rightDS datas.Dataset) (left, right types.Value, ancestorRef types.Ref) {
 	leftRef, ok := leftDS.MaybeHeadRef()
 	checkIfTrue(!ok, "Dataset %s has no data", leftDS.ID())
 	rightRef, ok := rightDS.MaybeHeadRef()
 	checkIfTrue(!ok, "Dataset %s has no data", rightDS.ID())
-	ancestorCommit, ok := getCommonAncestor(leftRef, rightRef, db)
+	ancestorRef, ok = datas.FindCommonAncestor(leftRef, rightRef, db)
 	checkIfTrue(!ok, "Datasets %s and %s have no common ancestor", leftDS.ID(), rightDS.ID())
 
-	return leftDS.HeadValue(), rightDS.HeadValue(), ancestorCommit.Get(datas.ValueField)
-}
-
-func getCommonAncestor(r1, r2 types.Ref, vr types.ValueReader) (a types.Struct, found bool) {
-	aRef, found := datas.FindCommonAncestor(r1, r2, vr)
-	if !found {
-		return
-	}
-	v := vr.ReadValue(aRef.TargetHash())
-	if v == nil {
-		panic(aRef.TargetHash().String() + " not found")
-	}
-	if !datas.IsCommitType(v.Type()) {
-		panic("Not a commit: " + types.EncodedValueMaxLines(v, 10) + "  ...")
-	}
-	return v.(types.Struct), true
+	return leftDS.HeadValue(), rightDS.HeadValue(), ancestorRef
 }
 
 func newMergeProgressChan() chan struct{} {
@@ -129,7 +192,10 @@ func newMergeProgressChan() chan struct{} {
 }
 
 func decidePolicy(policy string) merge.Policy {
-	var resolve merge.ResolveFunc
+	return merge.NewThreeWay(decideResolveFunc(policy))
+}
+
+func decideResolveFunc(policy string) (resolve merge.ResolveFunc) {
 	switch policy {
 	case "n", "N":
 		resolve = merge.None
@@ -144,7 +210,7 @@ func decidePolicy(policy string) merge.Policy {
 	default:
 		d.CheckErrorNoUsage(fmt.Errorf("Unsupported merge policy: %s. Choices are n, l, r and a.", policy))
 	}
-	return merge.NewThreeWay(resolve)
+	return
 }
 
 func cliResolve(in io.Reader, out io.Writer, aType, bType types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
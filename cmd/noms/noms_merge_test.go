@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/merge"
 	"github.com/attic-labs/noms/go/spec"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/clienttest"
@@ -141,6 +142,23 @@ func (s *nomsMergeTestSuite) TestNomsMerge_Right() {
 	}
 }
 
+func (s *nomsMergeTestSuite) TestNomsMerge_MergeStateIsReserved() {
+	left, right := "left", "right"
+	p := s.setupMergeDataset("parent", types.StructData{"num": types.Number(42)}, types.NewSet())
+	l := s.setupMergeDataset(left, types.StructData{"num": types.Number(43)}, types.NewSet(p))
+	r := s.setupMergeDataset(right, types.StructData{"num": types.Number(44)}, types.NewSet(p))
+
+	// An ordinary dataset can't be mistaken for the state of a merge.
+	other := types.StructData{"other": types.Bool(true)}
+	s.setupMergeDataset("merge-state/output", other, types.NewSet())
+
+	_, stderr, err := s.Run(main, []string{"merge", "--policy=l", s.LdbDir, left, right, "output"})
+	s.Nil(err)
+	s.Equal("", stderr)
+	s.validateDataset("output", types.NewStruct("", types.StructData{"num": types.Number(43)}), l, r)
+	s.validateDataset("merge-state/output", types.NewStruct("", other))
+}
+
 func (s *nomsMergeTestSuite) TestNomsMerge_Conflict() {
 	left, right := "left", "right"
 	p := s.setupMergeDataset("parent", types.StructData{"num": types.Number(42)}, types.NewSet())
@@ -150,6 +168,66 @@ func (s *nomsMergeTestSuite) TestNomsMerge_Conflict() {
 	s.Panics(func() { s.MustRun(main, []string{"merge", s.LdbDir, left, right, "output"}) })
 }
 
+func (s *nomsMergeTestSuite) TestNomsMerge_RecordConflictsAndContinue() {
+	left, right := "left", "right"
+	p := s.setupMergeDataset("parent", types.StructData{"num": types.Number(42), "str": types.String("a"), "same": types.Bool(true)}, types.NewSet())
+	l := s.setupMergeDataset(left, types.StructData{"num": types.Number(43), "str": types.String("b"), "same": types.Bool(false)}, types.NewSet(p))
+	r := s.setupMergeDataset(right, types.StructData{"num": types.Number(44), "str": types.String("c"), "same": types.Bool(false)}, types.NewSet(p))
+
+	_, stderr, err := s.Run(main, []string{"merge", s.LdbDir, left, right, "output"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Merge stopped with 2 conflicts, which have been recorded in merge-state:output")
+
+	sp, err2 := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir))
+	s.NoError(err2)
+	db := sp.GetDatabase()
+	stateDS := db.GetDataset("merge-state:output")
+	state := stateDS.HeadValue().(types.Struct)
+	s.True(l.Equals(state.Get("left")))
+	s.True(r.Equals(state.Get("right")))
+	s.True(p.Equals(state.Get("ancestor")))
+	conflicts := state.Get("conflicts").(types.Map)
+	s.Equal(uint64(2), conflicts.Len())
+	num := conflicts.Get(types.String(".num")).(types.Struct)
+	s.Equal(types.Number(43), num.Get(merge.OursField))
+	s.Equal(types.Number(44), num.Get(merge.TheirsField))
+	s.Equal(types.Number(42), num.Get(merge.AncestorField))
+
+	// A resolution that isn't a Resolution struct is reported, rather than crashing.
+	malformed := conflicts.Set(types.String(".num"), num.Set(merge.ResolvedField, types.Number(50)))
+	_, err2 = db.CommitValue(stateDS, state.Set("conflicts", malformed))
+	s.NoError(err2)
+	sp.Close()
+	_, stderr, err = s.Run(main, []string{"merge", "--continue", s.LdbDir, "output"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "merge-state:output.conflicts is malformed: Resolution of conflict at .num must be a struct, not Number")
+
+	// Resolve one conflict by hand, leaving the other for --policy.
+	sp, err2 = spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir))
+	s.NoError(err2)
+	db = sp.GetDatabase()
+	stateDS = db.GetDataset("merge-state:output")
+	conflicts = conflicts.Set(types.String(".num"), num.Set(merge.ResolvedField, merge.NewResolution(types.Number(50))))
+	_, err2 = db.CommitValue(stateDS, state.Set("conflicts", conflicts))
+	s.NoError(err2)
+	sp.Close()
+
+	_, stderr, err = s.Run(main, []string{"merge", s.LdbDir, left, right, "output"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "A merge into output is already in progress")
+
+	_, stderr, err = s.Run(main, []string{"merge", "--continue", s.LdbDir, "output"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Conflict")
+
+	s.MustRun(main, []string{"merge", "--continue", "--policy=r", s.LdbDir, "output"})
+	s.validateDataset("output", types.NewStruct("", types.StructData{"num": types.Number(50), "str": types.String("c"), "same": types.Bool(false)}), l, r)
+
+	_, stderr, err = s.Run(main, []string{"merge", "--continue", s.LdbDir, "output"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "No merge into output is in progress")
+}
+
 func (s *nomsMergeTestSuite) TestBadInput() {
 	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir))
 	s.NoError(err)
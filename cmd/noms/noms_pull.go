@@ -0,0 +1,86 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsPull = &util.Command{
+	Run:       runPull,
+	UsageLine: "pull [options] <remote> <dataset>",
+	Short:     "Fetches a dataset from a remote and merges it into the local dataset of the same name",
+	Long:      "Fetches dataset from remote into <remote>/<dataset>, as noms fetch does, and then brings the local dataset up to date with it. If the local dataset doesn't exist it is created, if it is an ancestor of the fetched head it is fast-forwarded, and otherwise the two are merged and the result committed with both heads as parents. Conflicts are resolved according to --policy; if any are left, nothing is committed and noms merge can be used to finish the job.\n\nSee noms fetch for how to name remotes.",
+	Flags:     setupPullFlags,
+	Nargs:     2,
+}
+
+func setupPullFlags() *flag.FlagSet {
+	pullFlagSet := flag.NewFlagSet("pull", flag.ExitOnError)
+	registerRemoteFlags(pullFlagSet)
+	pullFlagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy for merging; see noms merge")
+	spec.RegisterCommitMetaFlags(pullFlagSet)
+	verbose.RegisterVerboseFlags(pullFlagSet)
+	return pullFlagSet
+}
+
+func runPull(args []string) int {
+	cfg := config.NewResolver()
+	local, remote := openRemote(cfg, args[0])
+	defer local.Close()
+	defer remote.Close()
+
+	ds := getMergeDataset(local, args[1])
+	resolve := decideResolveFunc(resolver)
+	tracking := fetchDataset(local, remote, args[0], args[1])
+	remoteRef := tracking.HeadRef()
+
+	localRef, ok := ds.MaybeHeadRef()
+	if !ok {
+		_, err := local.SetHead(ds, remoteRef)
+		d.PanicIfError(err)
+		fmt.Fprintf(os.Stdout, "Created dataset %s at #%s\n", ds.ID(), remoteRef.TargetHash())
+		return 0
+	}
+
+	ancestorRef, ok := datas.FindCommonAncestor(localRef, remoteRef, local)
+	checkIfTrue(!ok, "Datasets %s and %s have no common ancestor", ds.ID(), tracking.ID())
+	if ancestorRef.Equals(remoteRef) {
+		fmt.Fprintf(os.Stdout, "Dataset %s is already up to date.\n", ds.ID())
+		return 0
+	}
+	if ancestorRef.Equals(localRef) {
+		_, err := local.FastForward(ds, remoteRef)
+		d.CheckErrorNoUsage(err)
+		fmt.Fprintf(os.Stdout, "Fast-forwarded %s to #%s\n", ds.ID(), remoteRef.TargetHash())
+		return 0
+	}
+
+	ancestor := ancestorRef.TargetValue(local).(types.Struct).Get(datas.ValueField)
+	pc := newMergeProgressChan()
+	merged, err := merge.ThreeWay(ds.HeadValue(), tracking.HeadValue(), ancestor, local, resolve, pc)
+	close(pc)
+	if err != nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Could not merge %s into %s: %s\nUse noms merge to resolve the conflicts", tracking.ID(), ds.ID(), err))
+	}
+
+	meta, err := spec.CreateCommitMetaStruct(local, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+	ds, err = local.Commit(ds, merged, datas.CommitOptions{Parents: types.NewSet(localRef, remoteRef), Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Fprintf(os.Stdout, "Merged %s into %s, new head #%s\n", tracking.ID(), ds.ID(), ds.HeadRef().TargetHash())
+	return 0
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var forcePush bool
+
+var nomsPush = &util.Command{
+	Run:       runPush,
+	UsageLine: "push [options] <remote> <dataset>",
+	Short:     "Copies a local dataset to the dataset of the same name in a remote",
+	Long:      "Copies the head of dataset to remote and makes it the head of the remote dataset of the same name, as long as that is a fast-forward. If the remote dataset has commits that the local one doesn't, the push is refused; pull them first, or use --force to replace the remote head anyway. On success the remote-tracking dataset <remote>/<dataset> is updated too.\n\nSee noms fetch for how to name remotes.",
+	Flags:     setupPushFlags,
+	Nargs:     2,
+}
+
+func setupPushFlags() *flag.FlagSet {
+	pushFlagSet := flag.NewFlagSet("push", flag.ExitOnError)
+	registerRemoteFlags(pushFlagSet)
+	pushFlagSet.BoolVar(&forcePush, "force", false, "replace the remote head even if it isn't an ancestor of the local one")
+	verbose.RegisterVerboseFlags(pushFlagSet)
+	return pushFlagSet
+}
+
+func runPush(args []string) int {
+	cfg := config.NewResolver()
+	local, remote := openRemote(cfg, args[0])
+	defer local.Close()
+	defer remote.Close()
+
+	ds := getMergeDataset(local, args[1])
+	localRef, ok := ds.MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s has no data", ds.ID())
+
+	remoteDS := remote.GetDataset(ds.ID())
+	remoteRef, remoteExists := remoteDS.MaybeHeadRef()
+	if remoteExists && remoteRef.Equals(localRef) {
+		fmt.Fprintf(os.Stdout, "Dataset %s is already up to date in %s.\n", ds.ID(), args[0])
+		return 0
+	}
+	rejected := func() {
+		d.CheckErrorNoUsage(fmt.Errorf("Rejected non-fast-forward push to %s in %s: its head #%s is not an ancestor of #%s. Run noms pull to merge the remote changes, or use --force to replace them", ds.ID(), args[0], remoteRef.TargetHash(), localRef.TargetHash()))
+	}
+	// Check up front, where possible, so that a doomed push doesn't copy any data.
+	if remoteExists && !forcePush && !isAncestor(local, remoteRef, localRef) {
+		rejected()
+	}
+
+	datas.PullWithFlush(local, remote, localRef, remoteRef, p, nil)
+	_, err := remote.FastForward(remoteDS, localRef)
+	forced := false
+	if err == datas.ErrMergeNeeded {
+		if !forcePush {
+			// The remote head moved on since we looked.
+			remoteRef = remote.GetDataset(ds.ID()).HeadRef()
+			rejected()
+		}
+		_, err = remote.SetHead(remoteDS, localRef)
+		forced = true
+	}
+	d.CheckErrorNoUsage(err)
+
+	_, err = local.SetHead(local.GetDataset(remoteTrackingID(args[0], ds.ID())), localRef)
+	d.PanicIfError(err)
+
+	switch {
+	case !remoteExists:
+		fmt.Fprintf(os.Stdout, "%s -> %s (new, #%s)\n", ds.ID(), args[0], localRef.TargetHash())
+	case forced:
+		fmt.Fprintf(os.Stdout, "%s -> %s (#%s...#%s, forced update)\n", ds.ID(), args[0], remoteRef.TargetHash(), localRef.TargetHash())
+	default:
+		fmt.Fprintf(os.Stdout, "%s -> %s (#%s..#%s)\n", ds.ID(), args[0], remoteRef.TargetHash(), localRef.TargetHash())
+	}
+	return 0
+}
+
+// isAncestor returns true if the commit |ancestor| is known to |db| and is an
+// ancestor of, or the same as, |descendant|.
+func isAncestor(db datas.Database, ancestor, descendant types.Ref) bool {
+	if db.ReadValue(ancestor.TargetHash()) == nil {
+		return false
+	}
+	common, ok := datas.FindCommonAncestor(ancestor, descendant, db)
+	return ok && common.Equals(ancestor)
+}
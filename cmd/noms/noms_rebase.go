@@ -0,0 +1,64 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsRebase = &util.Command{
+	Run:       runRebase,
+	UsageLine: "rebase [options] <onto> <dataset>",
+	Short:     "Replays the commits made to a dataset on top of another commit",
+	Long:      "Finds the common ancestor of <onto> and the head of <dataset>, then replays each commit made to <dataset> since that ancestor on top of <onto>, keeping the meta of the original commits. The last replayed commit becomes the new head of <dataset>, so its history is linear rather than ending in a merge commit. Conflicts are resolved using --policy. <onto> may be a commit or a dataset, and must be in the same database as <dataset>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the onto and dataset arguments.",
+	Flags:     setupRebaseFlags,
+	Nargs:     2,
+}
+
+func setupRebaseFlags() *flag.FlagSet {
+	rebaseFlagSet := flag.NewFlagSet("rebase", flag.ExitOnError)
+	rebaseFlagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy for replaying commits. Supported values are 'n' (none), 'l' (keep the value from <onto>), 'r' (take the value from the replayed commit) and 'p' (prompt).")
+	verbose.RegisterVerboseFlags(rebaseFlagSet)
+	return rebaseFlagSet
+}
+
+func runRebase(args []string) int {
+	policy := decidePolicy(resolver)
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(args[1])
+	d.CheckError(err)
+	defer db.Close()
+
+	headRef, ok := ds.MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s has no data", ds.ID())
+
+	ontoDB, value, err := cfg.GetPath(args[0])
+	d.CheckErrorNoUsage(err)
+	defer ontoDB.Close()
+	checkIfTrue(value == nil, "Object not found: %s", args[0])
+	checkIfTrue(!datas.IsCommitType(value.Type()), "%s does not reference a Commit object", args[0])
+
+	onto, ok := db.ReadValue(value.Hash()).(types.Struct)
+	checkIfTrue(!ok, "Commit %s is not in the same database as %s", args[0], args[1])
+
+	ds, err = datas.Rebase(db, ds, types.NewRef(onto), policy)
+	d.CheckErrorNoUsage(err)
+
+	if ds.HeadRef().Equals(headRef) {
+		fmt.Printf("Dataset %s is up to date at #%v\n", ds.ID(), headRef.TargetHash().String())
+		return 0
+	}
+	fmt.Printf("New head #%v (was #%v)\n", ds.HeadRef().TargetHash().String(), headRef.TargetHash().String())
+	return 0
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsRebase(t *testing.T) {
+	suite.Run(t, &nomsRebaseTestSuite{})
+}
+
+type nomsRebaseTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// setup creates "master" and "feature" datasets that diverge from a common
+// root, with "b" changed on both sides.
+func (s *nomsRebaseTestSuite) setup(dbName string) {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir+"/"+dbName))
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	master, err := db.CommitValue(db.GetDataset("master"), types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2)))
+	s.NoError(err)
+	root := master.HeadRef()
+	master, err = db.CommitValue(master, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(3)))
+	s.NoError(err)
+
+	feature, err := db.SetHead(db.GetDataset("feature"), root)
+	s.NoError(err)
+	feature, err = db.Commit(feature, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2), types.String("c"), types.Number(4)), datas.CommitOptions{
+		Meta: types.NewStruct("Meta", types.StructData{"message": types.String("add c")}),
+	})
+	s.NoError(err)
+	_, err = db.Commit(feature, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(5), types.String("c"), types.Number(4)), datas.CommitOptions{
+		Meta: types.NewStruct("Meta", types.StructData{"message": types.String("change b")}),
+	})
+	s.NoError(err)
+}
+
+func (s *nomsRebaseTestSuite) head(dbName, dsName string) types.Struct {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir+"/"+dbName, dsName))
+	s.NoError(err)
+	defer sp.Close()
+	return sp.GetDataset().Head()
+}
+
+func (s *nomsRebaseTestSuite) TestRebase() {
+	s.setup("rebase")
+	masterSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/rebase", "master")
+	featureSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/rebase", "feature")
+
+	_, stderr, err := s.Run(main, []string{"rebase", masterSpec, featureSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "Conflict")
+
+	stdout, _ := s.MustRun(main, []string{"rebase", "--policy", "r", masterSpec, featureSpec})
+	s.Contains(stdout, "New head #")
+
+	head := s.head("rebase", "feature")
+	s.True(types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(5), types.String("c"), types.Number(4)).Equals(head.Get(datas.ValueField)))
+	s.Equal(types.String("change b"), head.Get(datas.MetaField).(types.Struct).Get("message"))
+
+	parents := head.Get(datas.ParentsField).(types.Set)
+	s.Equal(uint64(1), parents.Len())
+	sp, specErr := spec.ForDatabase(spec.CreateDatabaseSpecString("ldb", s.LdbDir+"/rebase"))
+	s.NoError(specErr)
+	defer sp.Close()
+	parent := parents.First().(types.Ref).TargetValue(sp.GetDatabase()).(types.Struct)
+	s.Equal(types.String("add c"), parent.Get(datas.MetaField).(types.Struct).Get("message"))
+	s.True(types.NewSet(types.NewRef(s.head("rebase", "master"))).Equals(parent.Get(datas.ParentsField)))
+
+	stdout, _ = s.MustRun(main, []string{"rebase", masterSpec, featureSpec})
+	s.Contains(stdout, "is up to date")
+}
+
+func (s *nomsRebaseTestSuite) TestRebaseBadInput() {
+	s.setup("bad")
+	featureSpec := spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "feature")
+
+	_, stderr, err := s.Run(main, []string{"rebase", spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "master.value"), featureSpec})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "does not reference a Commit object")
+
+	_, stderr, err = s.Run(main, []string{"rebase", spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "master"), spec.CreateValueSpecString("ldb", s.LdbDir+"/bad", "empty")})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "has no data")
+}
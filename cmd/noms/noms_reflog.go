@@ -0,0 +1,64 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	flag "github.com/juju/gnuflag"
+)
+
+var maxReflogEntries int
+
+var nomsReflog = &util.Command{
+	Run:       runReflog,
+	UsageLine: "reflog [options] <db-spec>",
+	Short:     "Shows the history of the root hash of a database",
+	Long:      "Lists the roots the database has had, most recent first, along with when each was set and the root it replaced. NBS-backed databases keep about the last megabyte of this history, which is a few thousand roots. A root that is no longer current can be restored with noms root --update, as long as it hasn't been collected by noms gc.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupReflogFlags,
+	Nargs:     1,
+}
+
+func setupReflogFlags() *flag.FlagSet {
+	reflogFlagSet := flag.NewFlagSet("reflog", flag.ExitOnError)
+	reflogFlagSet.IntVar(&maxReflogEntries, "n", 0, "max number of entries to display (0 for all)")
+	return reflogFlagSet
+}
+
+func runReflog(args []string) int {
+	cfg := config.NewResolver()
+	rt, err := cfg.GetRootTracker(args[0])
+	d.CheckErrorNoUsage(err)
+	if c, ok := rt.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	rl, ok := rt.(chunks.RootLogger)
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("reflog is not supported for %s", args[0]))
+	}
+	var entries []chunks.RootLogEntry
+	d.CheckErrorNoUsage(d.Try(func() { entries = rl.RootLog() }))
+
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stdout, "No root changes recorded for %s\n", args[0])
+		return 0
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if maxReflogEntries > 0 && len(entries)-i > maxReflogEntries {
+			break
+		}
+		e := entries[i]
+		fmt.Fprintf(os.Stdout, "#%s  %s  (was #%s)\n", e.Root, e.Time.Format(time.RFC3339), e.Previous)
+	}
+	return 0
+}
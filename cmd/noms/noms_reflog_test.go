@@ -0,0 +1,72 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsReflog(t *testing.T) {
+	suite.Run(t, &nomsReflogTestSuite{})
+}
+
+type nomsReflogTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsReflogTestSuite) TestNomsReflog() {
+	dir := s.LdbDir + "/nbs"
+	cs := nbs.NewLocalStore(dir, 1<<20)
+	db := datas.NewDatabase(cs)
+	dbSpec := spec.CreateDatabaseSpecString("nbs", dir)
+
+	rtnVal, _ := s.MustRun(main, []string{"reflog", dbSpec})
+	s.Equal("No root changes recorded for "+dbSpec+"\n", rtnVal)
+
+	_, err := db.CommitValue(db.GetDataset("ds"), types.String("one"))
+	s.NoError(err)
+	first := cs.Root()
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("two"))
+	s.NoError(err)
+	second := cs.Root()
+	s.NoError(db.Close())
+
+	rtnVal, _ = s.MustRun(main, []string{"reflog", dbSpec})
+	lines := strings.Split(strings.TrimSpace(rtnVal), "\n")
+	s.Len(lines, 2)
+	s.True(strings.HasPrefix(lines[0], "#"+second.String()))
+	s.True(strings.HasSuffix(lines[0], "(was #"+first.String()+")"))
+	s.True(strings.HasPrefix(lines[1], "#"+first.String()))
+
+	rtnVal, _ = s.MustRun(main, []string{"reflog", "-n", "1", dbSpec})
+	s.Equal(lines[0]+"\n", rtnVal)
+}
+
+func (s *nomsReflogTestSuite) TestNomsReflogLevelDB() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("ldb", s.LdbDir, "ds"))
+	s.NoError(err)
+	db := sp.GetDatabase()
+	_, err = db.CommitValue(sp.GetDataset(), types.Number(1))
+	s.NoError(err)
+	sp.Close()
+
+	rtnVal, _ := s.MustRun(main, []string{"reflog", spec.CreateDatabaseSpecString("ldb", s.LdbDir)})
+	s.Equal(1, strings.Count(rtnVal, "\n"))
+	s.Contains(rtnVal, "(was #00000000000000000000000000000000)")
+}
+
+func (s *nomsReflogTestSuite) TestNomsReflogUnsupported() {
+	_, stderr, err := s.Run(main, []string{"reflog", "mem"})
+	s.Equal(clienttest.ExitError{Code: 1}, err)
+	s.Contains(stderr, "reflog is not supported")
+}
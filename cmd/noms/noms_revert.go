@@ -0,0 +1,27 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"github.com/attic-labs/noms/cmd/util"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsRevert = &util.Command{
+	Run:       runRevert,
+	UsageLine: "revert [options] <commit> <dataset>",
+	Short:     "Undoes the changes made by a commit to the head of a dataset",
+	Long:      "Computes the difference between <commit> and its parent, applies the inverse to the head value of <dataset> and commits the result. If the changes don't apply cleanly, they are three-way merged using --policy to resolve conflicts. <commit> must be in the same database as <dataset>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the commit and dataset arguments.",
+	Flags:     setupRevertFlags,
+	Nargs:     2,
+}
+
+func setupRevertFlags() *flag.FlagSet {
+	return setupPickFlags("revert")
+}
+
+func runRevert(args []string) int {
+	return pickCommit(args[0], args[1], true)
+}
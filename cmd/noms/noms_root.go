@@ -72,7 +72,8 @@ func runRoot(args []string) int {
 	fmt.Println(`WARNING
 
 This operation replaces the entire database with the instance having the given
-hash. The old database becomes eligible for GC.
+hash. The old database becomes eligible for GC once it is no longer in the
+root log (see noms reflog).
 
 ANYTHING NOT SAVED WILL BE LOST
 
@@ -0,0 +1,47 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestServeRequireType(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { reqTypes = nil }()
+	assert.NoError(setupServeFlags().Parse(true, []string{"--require-type", "people/*=List<String>"}))
+
+	server := datas.NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	server.Hooks = serveHooks()
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	db := datas.NewRemoteDatabase(fmt.Sprintf("http://localhost:%d", <-portChan), "")
+	defer db.Close()
+
+	_, err := db.CommitValue(db.GetDataset("people/alice"), types.NewList(types.Number(1)))
+	assert.Equal(datas.CommitRejectedError{Reason: "The value of a commit to people/alice must be of type List<String>, not List<Number>"}, err)
+	_, err = db.CommitValue(db.GetDataset("people/alice"), types.NewList(types.String("a")))
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("places"), types.Number(1))
+	assert.NoError(err)
+}
+
+func TestServeRequireTypeErrors(t *testing.T) {
+	assert := assert.New(t)
+	rules := typeRules{}
+	assert.Error(rules.Set("people/*"))
+	assert.Error(rules.Set("people/*=List<"))
+	assert.Error(rules.Set("people/*=42"))
+	assert.NoError(rules.Set("people/*=Map<String, Number>"))
+	assert.Equal("people/*=Map<String, Number>", rules.String())
+}
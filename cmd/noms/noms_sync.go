@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/attic-labs/noms/cmd/util"
@@ -23,14 +24,16 @@ import (
 )
 
 var (
-	p int
+	p         int
+	syncDepth int
+	syncPath  string
 )
 
 var nomsSync = &util.Command{
 	Run:       runSync,
 	UsageLine: "sync [options] <source-object> <dest-dataset>",
 	Short:     "Moves datasets between or within databases",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.",
+	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.\n\nWhen the destination is a local database, progress is checkpointed into it as the sync goes, and an interrupted sync of the same object picks up from the last checkpoint when run again. Checkpoints are kept apart from the datasets that noms ds lists, and removed once the sync completes. Syncs to a remote database can't be checkpointed, and start over if interrupted.\n\nIf the source object is a commit, --depth and --path make a shallow copy of it in a local database: --depth copies only the given number of generations of history, and --path copies only the part of each commit's value that the path leads to. Reading something that was left out fails with an error that says so. A later sync that asks for more fills in what was left out.",
 	Flags:     setupSyncFlags,
 	Nargs:     2,
 }
@@ -38,6 +41,8 @@ var nomsSync = &util.Command{
 func setupSyncFlags() *flag.FlagSet {
 	syncFlagSet := flag.NewFlagSet("sync", flag.ExitOnError)
 	syncFlagSet.IntVar(&p, "p", 512, "parallelism")
+	syncFlagSet.IntVar(&syncDepth, "depth", 0, "copy only this many generations of commits; 0 copies them all")
+	syncFlagSet.StringVar(&syncPath, "path", "", "copy only the part of each commit's value reachable from this path, e.g. .foo[\"bar\"]; implies --depth=1 unless --depth is given")
 	spec.RegisterDatabaseFlags(syncFlagSet)
 	verbose.RegisterVerboseFlags(syncFlagSet)
 	profile.RegisterProfileFlags(syncFlagSet)
@@ -58,6 +63,25 @@ func runSync(args []string) int {
 	d.CheckError(err)
 	defer sinkDB.Close()
 
+	opts := datas.ShallowOptions{Depth: syncDepth}
+	if syncPath != "" {
+		opts.Path, err = types.ParsePath(syncPath)
+		d.CheckErrorNoUsage(err)
+		if opts.Depth == 0 {
+			opts.Depth = 1
+		}
+	}
+	if !opts.IsZero() {
+		checkIfTrue(opts.Depth < 0, "--depth must not be negative")
+		checkIfTrue(!datas.IsCommitType(sourceObj.Type()), "--depth and --path need the source to be a commit, but %s is a %s", args[0], sourceObj.Type().Describe())
+		_, isLocal := sinkDB.(*datas.LocalDatabase)
+		checkIfTrue(!isLocal, "--depth and --path need the destination to be a local database")
+	}
+
+	if opts.IsZero() && !datas.CanCheckpoint(sinkDB) {
+		fmt.Fprintf(os.Stderr, "Progress can't be checkpointed into %s, so if this sync is interrupted, it will start over.\n", args[1])
+	}
+
 	start := time.Now()
 	progressCh := make(chan datas.PullProgress)
 	lastProgressCh := make(chan datas.PullProgress)
@@ -86,10 +110,17 @@ func runSync(args []string) int {
 	nonFF := false
 	err = d.Try(func() {
 		defer profile.MaybeStartProfile().Stop()
-		datas.PullWithFlush(sourceStore, sinkDB, sourceRef, sinkRef, p, progressCh)
+		if opts.IsZero() {
+			datas.ResumablePull(sourceStore, sinkDB, sourceRef, sinkRef, p, progressCh)
+		} else {
+			datas.ShallowPull(sourceStore, sinkDB, sourceRef, sinkRef, opts, p, progressCh)
+		}
 
 		var err error
-		sinkDataset, err = sinkDB.FastForward(sinkDataset, sourceRef)
+		// If the old head is older than the history that was copied, there's no telling whether this is a fast-forward.
+		if d.Try(func() { sinkDataset, err = sinkDB.FastForward(sinkDataset, sourceRef) }, datas.ShallowError{}) != nil {
+			err = datas.ErrMergeNeeded
+		}
 		if err == datas.ErrMergeNeeded {
 			sinkDataset, err = sinkDB.SetHead(sinkDataset, sourceRef)
 			nonFF = true
@@ -5,8 +5,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/attic-labs/noms/go/chunks"
@@ -81,6 +83,47 @@ func (s *nomsSyncTestSuite) TestSync() {
 	s.Regexp("up to date", sout)
 }
 
+func (s *nomsSyncTestSuite) TestSyncShallow() {
+	ldb2dir := path.Join(s.TempDir, "ldb2")
+	defer s.NoError(os.RemoveAll(ldb2dir))
+	ldb3dir := path.Join(s.TempDir, "ldb3")
+	defer s.NoError(os.RemoveAll(ldb3dir))
+
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	source := sourceDB.GetDataset("shallow")
+	var err error
+	for i := 0; i < 3; i++ {
+		source, err = sourceDB.CommitValue(source, types.NewStruct("", types.StructData{
+			"a": sourceDB.WriteValue(types.NewList(types.Number(i))),
+			"b": sourceDB.WriteValue(types.NewList(types.String("b"))),
+		}))
+		s.NoError(err)
+	}
+	head := source.HeadValue().(types.Struct)
+	sourceDB.Close()
+
+	sourceDataset := spec.CreateValueSpecString("ldb", s.LdbDir, "shallow")
+	sinkDatasetSpec := spec.CreateValueSpecString("ldb", ldb2dir, "dest")
+	s.MustRun(main, []string{"sync", "--depth", "1", sourceDataset, sinkDatasetSpec})
+	sout, _ := s.MustRun(main, []string{"log", "--oneline", sinkDatasetSpec})
+	s.Equal(1, strings.Count(sout, "\n"))
+	sout, _ = s.MustRun(main, []string{"log", sinkDatasetSpec})
+	s.Contains(sout, "left out of this shallow copy")
+
+	s.MustRun(main, []string{"sync", sourceDataset, sinkDatasetSpec})
+	sout, _ = s.MustRun(main, []string{"log", "--oneline", sinkDatasetSpec})
+	s.Equal(3, strings.Count(sout, "\n"))
+
+	pathSinkSpec := spec.CreateValueSpecString("ldb", ldb3dir, "dest")
+	s.MustRun(main, []string{"sync", "--path", ".a", sourceDataset, pathSinkSpec})
+	db := datas.NewDatabase(chunks.NewLevelDBStore(ldb3dir, "", 1, false))
+	s.NotNil(db.ReadValue(head.Get("a").(types.Ref).TargetHash()))
+	db.Close()
+	bSpec := spec.CreateValueSpecString("ldb", ldb3dir, "#"+head.Get("b").(types.Ref).TargetHash().String())
+	_, _, recovered := s.Run(main, []string{"show", bSpec})
+	s.Contains(fmt.Sprint(recovered), "shallow copy")
+}
+
 func (s *nomsSyncTestSuite) TestSync_Issue2598() {
 	ldb2dir := path.Join(s.TempDir, "ldb2")
 	defer s.NoError(os.RemoveAll(ldb2dir))
@@ -29,6 +29,12 @@ type Factory interface {
 	Shutter()
 }
 
+// NamespaceChecker is implemented by Factories that can tell whether a
+// namespace exists without creating it.
+type NamespaceChecker interface {
+	HasNamespace(ns string) bool
+}
+
 // RootTracker allows querying and management of the root of an entire tree of
 // references. The "root" is the single mutable variable in a ChunkStore. It
 // can store any hash, but it is typically used by higher layers (such as
@@ -39,6 +45,15 @@ type RootTracker interface {
 	UpdateRoot(current, last hash.Hash) bool
 }
 
+// RootRefresher is implemented by ChunkStores whose root can be updated by
+// others sharing their backing storage, e.g. other processes. Root() returns
+// the root as of the last time the store read or updated it.
+type RootRefresher interface {
+	// RefreshRoot re-reads the root from the backing storage, picking up any
+	// update made by others, and returns it.
+	RefreshRoot() hash.Hash
+}
+
 // ChunkSource is a place to get chunks from.
 type ChunkSource interface {
 	// Get the Chunk for the value of the hash in the store. If the hash is
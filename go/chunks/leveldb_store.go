@@ -5,10 +5,12 @@
 package chunks
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
@@ -20,12 +22,14 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
-	rootKeyConst     = "/root"
-	versionKeyConst  = "/vers"
-	chunkPrefixConst = "/chunk/"
+	rootKeyConst       = "/root"
+	versionKeyConst    = "/vers"
+	chunkPrefixConst   = "/chunk/"
+	rootLogPrefixConst = "/rootlog/"
 )
 
 type LevelDBStoreFlags struct {
@@ -65,6 +69,7 @@ func newLevelDBStore(store *internalLevelDBStore, ns []byte, closeBackingStore b
 		rootKey:              copyNsAndAppend(rootKeyConst),
 		versionKey:           copyNsAndAppend(versionKeyConst),
 		chunkPrefix:          copyNsAndAppend(chunkPrefixConst),
+		rootLogPrefix:        copyNsAndAppend(rootLogPrefixConst),
 		closeBackingStore:    closeBackingStore,
 	}
 }
@@ -74,6 +79,7 @@ type LevelDBStore struct {
 	rootKey           []byte
 	versionKey        []byte
 	chunkPrefix       []byte
+	rootLogPrefix     []byte
 	closeBackingStore bool
 	versionSetOnce    sync.Once
 }
@@ -90,7 +96,15 @@ func (l *LevelDBStore) UpdateRoot(current, last hash.Hash) bool {
 		d.Panic("Cannot use LevelDBStore after Close().")
 	}
 	l.versionSetOnce.Do(l.setVersIfUnset)
-	return l.updateRootByKey(l.rootKey, current, last)
+	return l.updateRootByKey(l.rootKey, l.rootLogPrefix, current, last)
+}
+
+// RootLog returns every root this store has had, oldest first.
+func (l *LevelDBStore) RootLog() []RootLogEntry {
+	if l.internalLevelDBStore == nil {
+		d.Panic("Cannot use LevelDBStore after Close().")
+	}
+	return l.rootLogByPrefix(l.rootLogPrefix)
 }
 
 func (l *LevelDBStore) Get(ref hash.Hash) Chunk {
@@ -207,19 +221,47 @@ func (l *internalLevelDBStore) rootByKey(key []byte) hash.Hash {
 	return hash.Parse(string(val))
 }
 
-func (l *internalLevelDBStore) updateRootByKey(key []byte, current, last hash.Hash) bool {
+// updateRootByKey moves the root stored at |key| from |last| to |current|
+// and, in the same batch, appends an entry to the root log stored under
+// |logPrefix|. Log keys are the time of the update, big-endian, followed by
+// the new root, so iterating the prefix yields the log in order.
+func (l *internalLevelDBStore) updateRootByKey(key, logPrefix []byte, current, last hash.Hash) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if last != l.rootByKey(key) {
 		return false
 	}
 
+	b := new(leveldb.Batch)
+	b.Put(key, []byte(current.String()))
+	if current != last {
+		now := time.Now()
+		logKey := make([]byte, len(logPrefix), len(logPrefix)+8+hash.ByteLen)
+		copy(logKey, logPrefix)
+		logKey = append(logKey, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(logKey[len(logPrefix):], uint64(now.UnixNano()))
+		logKey = append(logKey, current[:]...)
+		b.Put(logKey, []byte(RootLogEntry{now, last, current}.String()))
+	}
+
 	// Sync: true write option should fsync memtable data to disk
-	err := l.db.Put(key, []byte(current.String()), &opt.WriteOptions{Sync: true})
+	err := l.db.Write(b, &opt.WriteOptions{Sync: true})
 	d.Chk.NoError(err)
 	return true
 }
 
+func (l *internalLevelDBStore) rootLogByPrefix(prefix []byte) (entries []RootLogEntry) {
+	iter := l.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		e, err := ParseRootLogEntry(string(iter.Value()))
+		d.Chk.NoError(err)
+		entries = append(entries, e)
+	}
+	d.Chk.NoError(iter.Error())
+	return
+}
+
 func (l *internalLevelDBStore) getByKey(key []byte, ref hash.Hash) Chunk {
 	compressed, err := l.db.Get(key, nil)
 	l.getCount++
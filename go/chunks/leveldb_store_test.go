@@ -10,6 +10,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/attic-labs/noms/go/hash"
 	"github.com/attic-labs/testify/suite"
 )
 
@@ -55,4 +56,29 @@ func (suite *LevelDBStoreTestSuite) TestReservedKeys() {
 	suite.True(bytes.HasSuffix(ldb.rootKey, []byte(rootKeyConst)))
 	suite.True(bytes.HasSuffix(ldb.versionKey, []byte(versionKeyConst)))
 	suite.True(bytes.HasSuffix(ldb.chunkPrefix, []byte(chunkPrefixConst)))
+	suite.True(bytes.HasSuffix(ldb.rootLogPrefix, []byte(rootLogPrefixConst)))
+}
+
+func (suite *LevelDBStoreTestSuite) TestRootLog() {
+	store := suite.Store.(*LevelDBStore)
+	suite.Empty(store.RootLog())
+
+	h1, h2 := NewChunk([]byte("abc")).Hash(), NewChunk([]byte("def")).Hash()
+	suite.True(store.UpdateRoot(h1, hash.Hash{}))
+	suite.False(store.UpdateRoot(h2, hash.Hash{}))
+	suite.True(store.UpdateRoot(h1, h1)) // Not a change, so not logged
+	suite.True(store.UpdateRoot(h2, h1))
+
+	log := store.RootLog()
+	suite.Len(log, 2)
+	suite.Equal(hash.Hash{}, log[0].Previous)
+	suite.Equal(h1, log[0].Root)
+	suite.Equal(h1, log[1].Previous)
+	suite.Equal(h2, log[1].Root)
+	suite.False(log[1].Time.Before(log[0].Time))
+
+	// Stores in other namespaces have their own logs.
+	other := suite.factory.CreateStore("other").(*LevelDBStore)
+	defer other.Close()
+	suite.Empty(other.RootLog())
 }
@@ -0,0 +1,88 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// RootLogEntry records a single successful call to RootTracker.UpdateRoot():
+// the time at which it happened, the root it replaced and the new root.
+type RootLogEntry struct {
+	Time     time.Time
+	Previous hash.Hash
+	Root     hash.Hash
+}
+
+// String returns the serialized form of e, which is read back by
+// ParseRootLogEntry().
+func (e RootLogEntry) String() string {
+	return fmt.Sprintf("%d %s %s", e.Time.UnixNano(), e.Previous, e.Root)
+}
+
+// ParseRootLogEntry parses a RootLogEntry serialized by
+// RootLogEntry.String().
+func ParseRootLogEntry(s string) (RootLogEntry, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return RootLogEntry{}, fmt.Errorf("Invalid root log entry: %q", s)
+	}
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return RootLogEntry{}, fmt.Errorf("Invalid root log entry: %q", s)
+	}
+	prev, ok := hash.MaybeParse(fields[1])
+	if !ok {
+		return RootLogEntry{}, fmt.Errorf("Invalid root log entry: %q", s)
+	}
+	root, ok := hash.MaybeParse(fields[2])
+	if !ok {
+		return RootLogEntry{}, fmt.Errorf("Invalid root log entry: %q", s)
+	}
+	return RootLogEntry{time.Unix(0, nanos), prev, root}, nil
+}
+
+// WriteRootLog writes |entries| to |w|, one per line.
+func WriteRootLog(w io.Writer, entries []RootLogEntry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, e.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRootLog reads entries written by WriteRootLog() from |r| until EOF.
+func ReadRootLog(r io.Reader) (entries []RootLogEntry, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		e, err := ParseRootLogEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// RootLogger is implemented by ChunkStores that keep an append-only history
+// of every root they have had, so that a root that is no longer reachable
+// from the current one (e.g. after a bad `noms root --update` or a forced
+// push) can still be found and restored.
+type RootLogger interface {
+	// RootLog returns every entry in the store's root log, oldest first.
+	RootLog() []RootLogEntry
+}
@@ -6,6 +6,8 @@ package config
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -13,18 +15,66 @@ import (
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
+	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/spec"
 )
 
 type Config struct {
-	File string
-	Db   map[string]DbConfig
+	File       string
+	Db         map[string]DbConfig
+	Remote     map[string]RemoteConfig
+	TLS        TLSConfig
+	Encryption EncryptionConfig
 }
 
 type DbConfig struct {
 	Url string
 }
 
+// RemoteConfig describes a named remote database, e.g. [remote.origin]. Heads
+// fetched from a remote are kept in remote-tracking datasets named
+// <remote>/<dataset> in the local database.
+type RemoteConfig struct {
+	Url string
+}
+
+// TLSConfig says how to make https connections to databases, e.g.
+//
+//	[tls]
+//	  ca = "ca.pem"
+//	  cert = "me.pem"
+//	  key = "me-key.pem"
+//
+// CA is a PEM file of certificates to trust as well as the system's. Cert and
+// Key, if given, are the PEM files of a certificate and its key to present
+// to servers that ask for one.
+type TLSConfig struct {
+	CA   string
+	Cert string
+	Key  string
+}
+
+// EncryptionConfig says where to find the key with which to encrypt nbs and
+// aws databases at rest, e.g.
+//
+//	[encryption]
+//	  keyfile = "noms.key"
+//
+// KeyFile is a file, and KeyEnv the name of an environment variable, that
+// holds the key as 64 hex digits, as generated by `openssl rand -hex 32`.
+// At most one of them may be given.
+//
+// Databases opened with the key refuse anything written without
+// encryption. To encrypt an existing database, set migrate = true as well:
+// it can then still be read, and everything written to it from then on is
+// encrypted. Syncing it into a new database, and using that one instead,
+// encrypts all of it. Leave migrate unset once that's done.
+type EncryptionConfig struct {
+	KeyFile string
+	KeyEnv  string
+	Migrate bool
+}
+
 const (
 	NomsConfigFile = ".nomsconfig"
 	DefaultDbAlias = "default"
@@ -119,9 +169,78 @@ func qualifyPaths(configPath string, c *Config) (*Config, error) {
 	for k, r := range c.Db {
 		qc.Db[k] = DbConfig{absDbSpec(dir, r.Url)}
 	}
+	for k, r := range c.Remote {
+		qc.Remote[k] = RemoteConfig{absDbSpec(dir, r.Url)}
+	}
+	for _, path := range []*string{&qc.TLS.CA, &qc.TLS.Cert, &qc.TLS.Key, &qc.Encryption.KeyFile} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
 	return &qc, nil
 }
 
+// ClientTLSConfig returns the tls.Config to make https connections with, or
+// nil if the config doesn't have a [tls] section.
+func (c *Config) ClientTLSConfig() (*tls.Config, error) {
+	if c.TLS == (TLSConfig{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if c.TLS.CA != "" {
+		pem, err := ioutil.ReadFile(c.TLS.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", c.TLS.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.TLS.Cert != "" || c.TLS.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// EncryptionKey returns the key to encrypt databases with, or nil if the
+// config doesn't have an [encryption] section.
+func (c *Config) EncryptionKey() (*nbs.EncryptionKey, error) {
+	var hex string
+	switch {
+	case c.Encryption == (EncryptionConfig{}):
+		return nil, nil
+	case c.Encryption.KeyFile == "" && c.Encryption.KeyEnv == "":
+		return nil, errors.New("One of keyfile and keyenv must be given")
+	case c.Encryption.KeyFile != "" && c.Encryption.KeyEnv != "":
+		return nil, errors.New("Only one of keyfile and keyenv may be given")
+	case c.Encryption.KeyFile != "":
+		data, err := ioutil.ReadFile(c.Encryption.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		hex = string(data)
+	default:
+		hex = os.Getenv(c.Encryption.KeyEnv)
+		if hex == "" {
+			return nil, fmt.Errorf("%s is not set", c.Encryption.KeyEnv)
+		}
+	}
+	key, err := nbs.ParseEncryptionKey(hex)
+	if err != nil || !c.Encryption.Migrate {
+		return key, err
+	}
+	return key.ReadingUnencrypted(), nil
+}
+
 func (c *Config) String() string {
 	var buffer bytes.Buffer
 	if c.File != "" {
@@ -137,5 +256,28 @@ func (c *Config) writeableString() string {
 		buffer.WriteString(fmt.Sprintf("[db.%s]\n", k))
 		buffer.WriteString(fmt.Sprintf("\t"+`url = "%s"`+"\n", r.Url))
 	}
+	for k, r := range c.Remote {
+		buffer.WriteString(fmt.Sprintf("[remote.%s]\n", k))
+		buffer.WriteString(fmt.Sprintf("\t"+`url = "%s"`+"\n", r.Url))
+	}
+	if c.TLS != (TLSConfig{}) {
+		buffer.WriteString("[tls]\n")
+		for _, kv := range [][2]string{{"ca", c.TLS.CA}, {"cert", c.TLS.Cert}, {"key", c.TLS.Key}} {
+			if kv[1] != "" {
+				buffer.WriteString(fmt.Sprintf("\t"+`%s = "%s"`+"\n", kv[0], kv[1]))
+			}
+		}
+	}
+	if c.Encryption != (EncryptionConfig{}) {
+		buffer.WriteString("[encryption]\n")
+		for _, kv := range [][2]string{{"keyfile", c.Encryption.KeyFile}, {"keyenv", c.Encryption.KeyEnv}} {
+			if kv[1] != "" {
+				buffer.WriteString(fmt.Sprintf("\t"+`%s = "%s"`+"\n", kv[0], kv[1]))
+			}
+		}
+		if c.Encryption.Migrate {
+			buffer.WriteString("\tmigrate = true\n")
+		}
+	}
 	return buffer.String()
 }
@@ -5,12 +5,21 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/spec"
 	"github.com/attic-labs/testify/assert"
 )
@@ -32,6 +41,12 @@ var (
 			DefaultDbAlias: {ldbSpec},
 			remoteAlias:    {httpSpec},
 		},
+		map[string]RemoteConfig{
+			remoteAlias: {httpSpec},
+			"backup":    {ldbAbsSpec},
+		},
+		TLSConfig{},
+		EncryptionConfig{},
 	}
 
 	httpConfig = &Config{
@@ -40,6 +55,9 @@ var (
 			DefaultDbAlias: {httpSpec},
 			remoteAlias:    {ldbSpec},
 		},
+		nil,
+		TLSConfig{},
+		EncryptionConfig{},
 	}
 
 	memConfig = &Config{
@@ -48,6 +66,9 @@ var (
 			DefaultDbAlias: {memSpec},
 			remoteAlias:    {httpSpec},
 		},
+		nil,
+		TLSConfig{},
+		EncryptionConfig{},
 	}
 
 	ldbAbsConfig = &Config{
@@ -56,6 +77,9 @@ var (
 			DefaultDbAlias: {ldbAbsSpec},
 			remoteAlias:    {httpSpec},
 		},
+		nil,
+		TLSConfig{},
+		EncryptionConfig{},
 	}
 )
 
@@ -109,6 +133,12 @@ func validateConfig(assert *assert.Assertions, file string, e *Config, a *Config
 		assert.True(ok)
 		assertDbSpecsEquiv(assert, er.Url, ar.Url)
 	}
+	assert.Equal(len(e.Remote), len(a.Remote))
+	for k, er := range e.Remote {
+		ar, ok := a.Remote[k]
+		assert.True(ok)
+		assertDbSpecsEquiv(assert, er.Url, ar.Url)
+	}
 }
 
 func writeConfig(assert *assert.Assertions, c *Config, home string) string {
@@ -189,6 +219,91 @@ func TestQualifyingPaths(t *testing.T) {
 	}
 }
 
+func TestTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+	path := getPaths(assert, "home.tls")
+	assert.NoError(os.MkdirAll(path.home, os.ModePerm))
+	assert.NoError(os.Chdir(path.home))
+
+	// A self-signed certificate serves as both the CA and the client certificate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "me"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NoError(ioutil.WriteFile("cert.pem", certPEM, os.ModePerm))
+	assert.NoError(ioutil.WriteFile("key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), os.ModePerm))
+
+	writeConfig(assert, &Config{TLS: TLSConfig{CA: "cert.pem", Cert: "cert.pem", Key: "key.pem"}}, path.home)
+	c, err := FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal(filepath.Join(path.home, "cert.pem"), c.TLS.CA)
+	tlsConfig, err := c.ClientTLSConfig()
+	assert.NoError(err)
+	assert.NotNil(tlsConfig.RootCAs)
+	assert.Len(tlsConfig.Certificates, 1)
+
+	c.TLS.CA = filepath.Join(path.home, "missing.pem")
+	_, err = c.ClientTLSConfig()
+	assert.Error(err)
+
+	tlsConfig, err = (&Config{}).ClientTLSConfig()
+	assert.NoError(err)
+	assert.Nil(tlsConfig)
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	assert := assert.New(t)
+	path := getPaths(assert, "home.encryption")
+	assert.NoError(os.MkdirAll(path.home, os.ModePerm))
+	assert.NoError(os.Chdir(path.home))
+
+	hexKey := strings.Repeat("ab", nbs.EncryptionKeySize)
+	assert.NoError(ioutil.WriteFile("noms.key", []byte(hexKey+"\n"), os.ModePerm))
+	writeConfig(assert, &Config{Encryption: EncryptionConfig{KeyFile: "noms.key"}}, path.home)
+	c, err := FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal(filepath.Join(path.home, "noms.key"), c.Encryption.KeyFile)
+	key, err := c.EncryptionKey()
+	assert.NoError(err)
+	expected, err := nbs.ParseEncryptionKey(hexKey)
+	assert.NoError(err)
+	assert.Equal(expected.ID(), key.ID())
+
+	os.Setenv("NOMS_TEST_KEY", hexKey)
+	defer os.Unsetenv("NOMS_TEST_KEY")
+	key, err = (&Config{Encryption: EncryptionConfig{KeyEnv: "NOMS_TEST_KEY"}}).EncryptionKey()
+	assert.NoError(err)
+	assert.Equal(expected.ID(), key.ID())
+
+	_, err = (&Config{Encryption: EncryptionConfig{KeyEnv: "NOMS_TEST_MISSING_KEY"}}).EncryptionKey()
+	assert.Error(err)
+	_, err = (&Config{Encryption: EncryptionConfig{KeyFile: c.Encryption.KeyFile, KeyEnv: "NOMS_TEST_KEY"}}).EncryptionKey()
+	assert.Error(err)
+
+	key, err = (&Config{}).EncryptionKey()
+	assert.NoError(err)
+	assert.Nil(key)
+
+	writeConfig(assert, &Config{Encryption: EncryptionConfig{KeyFile: "noms.key", Migrate: true}}, path.home)
+	c, err = FindNomsConfig()
+	assert.NoError(err)
+	assert.True(c.Encryption.Migrate)
+	key, err = c.EncryptionKey()
+	assert.NoError(err)
+	assert.Equal(expected.ID(), key.ID())
+	_, err = (&Config{Encryption: EncryptionConfig{Migrate: true}}).EncryptionKey()
+	assert.Error(err)
+}
+
 func TestCwd(t *testing.T) {
 	assert := assert.New(t)
 	cwd, err := os.Getwd()
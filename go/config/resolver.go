@@ -10,6 +10,7 @@ import (
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/spec"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
@@ -18,6 +19,7 @@ import (
 type Resolver struct {
 	config      *Config
 	dotDatapath string // set to the first datapath that was resolved
+	opts        spec.SpecOptions
 }
 
 // A Resolver enables using db defaults, db aliases and dataset '.' replacement in command
@@ -32,7 +34,21 @@ func NewResolver() *Resolver {
 		}
 		return &Resolver{}
 	}
-	return &Resolver{c, ""}
+	tlsConfig, err := c.ClientTLSConfig()
+	if err != nil {
+		panic(fmt.Errorf("Failed to read the [tls] section of .nomsconfig due to: %v", err))
+	}
+	key, err := c.EncryptionKey()
+	if err != nil {
+		panic(fmt.Errorf("Failed to read the [encryption] section of .nomsconfig due to: %v", err))
+	}
+	return &Resolver{c, "", spec.SpecOptions{TLSConfig: tlsConfig, EncryptionKey: key}}
+}
+
+// EncryptionKey returns the key that databases are encrypted with, or nil if
+// the config doesn't have an [encryption] section.
+func (r *Resolver) EncryptionKey() *nbs.EncryptionKey {
+	return r.opts.EncryptionKey
 }
 
 // Print replacement if one occurred
@@ -61,6 +77,17 @@ func (r *Resolver) ResolveDbSpec(str string) string {
 	return str
 }
 
+// ResolveRemote returns the database url of the remote named |name| in the
+// config.
+func (r *Resolver) ResolveRemote(name string) (string, error) {
+	if r.config != nil {
+		if val, ok := r.config.Remote[name]; ok {
+			return val.Url, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown remote %s, add a [remote.%s] section to %s", name, name, NomsConfigFile)
+}
+
 // Resolve string to dataset or path name.
 //   - replace database name as described in ResolveDatabase
 //   - if this is the first call to ResolvePath, remember the
@@ -88,7 +115,20 @@ func (r *Resolver) ResolvePathSpec(str string) string {
 //   - resolve a db alias to its db spec
 //   - resolve "" to the default db spec
 func (r *Resolver) GetDatabase(str string) (datas.Database, error) {
-	sp, err := spec.ForDatabase(r.verbose(str, r.ResolveDbSpec(str)))
+	sp, err := spec.ForDatabaseOpts(r.verbose(str, r.ResolveDbSpec(str)), r.opts)
+	if err != nil {
+		return nil, err
+	}
+	return sp.GetDatabase(), nil
+}
+
+// GetRemoteDatabase opens the database of the remote named |name|.
+func (r *Resolver) GetRemoteDatabase(name string) (datas.Database, error) {
+	url, err := r.ResolveRemote(name)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := spec.ForDatabaseOpts(r.verbose(name, url), r.opts)
 	if err != nil {
 		return nil, err
 	}
@@ -97,22 +137,32 @@ func (r *Resolver) GetDatabase(str string) (datas.Database, error) {
 
 // Resolve string to a chunkstore. Like ResolveDatabase, but returns the underlying ChunkStore
 func (r *Resolver) GetChunkStore(str string) (chunks.ChunkStore, error) {
-	sp, err := spec.ForDatabase(r.verbose(str, r.ResolveDbSpec(str)))
+	sp, err := spec.ForDatabaseOpts(r.verbose(str, r.ResolveDbSpec(str)), r.opts)
 	if err != nil {
 		return nil, err
 	}
 	return sp.NewChunkStore(), nil
 }
 
+// Resolve string to an nbs.StoreChecker, which checks the database's tables without opening
+// it. Returns nil if the database isn't NBS-backed.
+func (r *Resolver) GetStoreChecker(str string) (*nbs.StoreChecker, error) {
+	sp, err := spec.ForDatabaseOpts(r.verbose(str, r.ResolveDbSpec(str)), r.opts)
+	if err != nil {
+		return nil, err
+	}
+	return sp.NewStoreChecker(), nil
+}
+
 // Resolve string to a RootTracker. Like ResolveDatabase, but returns a RootTracker instead
 func (r *Resolver) GetRootTracker(str string) (chunks.RootTracker, error) {
-	sp, err := spec.ForDatabase(r.verbose(str, r.ResolveDbSpec(str)))
+	sp, err := spec.ForDatabaseOpts(r.verbose(str, r.ResolveDbSpec(str)), r.opts)
 	if err != nil {
 		return nil, err
 	}
 	var rt chunks.RootTracker = sp.NewChunkStore()
 	if rt == nil {
-		rt = datas.NewHTTPBatchStore(sp.Spec, "")
+		rt = datas.NewHTTPBatchStoreTLS(sp.Spec, "", r.opts.TLSConfig)
 	}
 	return rt, nil
 }
@@ -121,7 +171,7 @@ func (r *Resolver) GetRootTracker(str string) (chunks.RootTracker, error) {
 //  - if no db prefix is present, assume the default db
 //  - if the db prefix is an alias, replace it
 func (r *Resolver) GetDataset(str string) (datas.Database, datas.Dataset, error) {
-	sp, err := spec.ForDataset(r.verbose(str, r.ResolvePathSpec(str)))
+	sp, err := spec.ForDatasetOpts(r.verbose(str, r.ResolvePathSpec(str)), r.opts)
 	if err != nil {
 		return nil, datas.Dataset{}, err
 	}
@@ -132,7 +182,7 @@ func (r *Resolver) GetDataset(str string) (datas.Database, datas.Dataset, error)
 //  - if no db spec is present, assume the default db
 //  - if the db spec is an alias, replace it
 func (r *Resolver) GetPath(str string) (datas.Database, types.Value, error) {
-	sp, err := spec.ForPath(r.verbose(str, r.ResolvePathSpec(str)))
+	sp, err := spec.ForPathOpts(r.verbose(str, r.ResolvePathSpec(str)), r.opts)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -35,6 +35,11 @@ var (
 			DefaultDbAlias: {localSpec},
 			remoteAlias:    {remoteSpec},
 		},
+		map[string]RemoteConfig{
+			remoteAlias: {remoteSpec},
+		},
+		TLSConfig{},
+		EncryptionConfig{},
 	}
 
 	dbTestsNoAliases = []testData{
@@ -152,3 +157,18 @@ func TestResolveDestPathWithDot(t *testing.T) {
 	}
 
 }
+
+func TestResolveRemote(t *testing.T) {
+	assert := assert.New(t)
+
+	r := withConfig(t)
+	url, err := r.ResolveRemote(remoteAlias)
+	assert.NoError(err)
+	assert.Equal(remoteSpec, url)
+	_, err = r.ResolveRemote("upstream")
+	assert.Error(err)
+
+	r = withoutConfig(t)
+	_, err = r.ResolveRemote(remoteAlias)
+	assert.Error(err)
+}
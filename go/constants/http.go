@@ -6,11 +6,17 @@ package constants
 
 const (
 	RootPath       = "/root/"
+	RootLogPath    = "/rootlog/"
 	GetRefsPath    = "/getRefs/"
 	GetBlobPath    = "/getBlob/"
 	HasRefsPath    = "/hasRefs/"
 	WriteValuePath = "/writeValue/"
+	CommitPath     = "/commit/"
+	WatchPath      = "/watch/"
 	BasePath       = "/"
 
+	// DatabasesPath prefixes the paths above when a server serves more than one database, e.g. /db/<name>/root/.
+	DatabasesPath = "/db/"
+
 	GraphQLPath = "/graphql/"
 )
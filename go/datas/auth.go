@@ -0,0 +1,364 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AnonymousPrincipal is the principal of requests that carry no
+	// credentials.
+	AnonymousPrincipal = "anonymous"
+
+	// AnyPrincipal matches every principal in an ACLRule, except for
+	// AnonymousPrincipal.
+	AnyPrincipal = "*"
+
+	// aclDatabaseSeparator separates the database and dataset in an ACL
+	// pattern, as in a spec.
+	aclDatabaseSeparator = "::"
+)
+
+// ErrBadCredentials is returned by an Authenticator when a request carries
+// credentials that it doesn't accept.
+var ErrBadCredentials = errors.New("Invalid credentials")
+
+// Authenticator works out which principal made a request to a
+// RemoteDatabaseServer.
+type Authenticator interface {
+	// Authenticate returns the principal whose credentials |req| carries, or
+	// "" if req doesn't carry the kind of credentials that this Authenticator
+	// checks. It returns ErrBadCredentials if the credentials are wrong.
+	Authenticate(req *http.Request) (string, error)
+}
+
+// Authenticators tries each of its Authenticators in turn, and returns the
+// first principal found.
+type Authenticators []Authenticator
+
+func (as Authenticators) Authenticate(req *http.Request) (string, error) {
+	for _, a := range as {
+		if principal, err := a.Authenticate(req); principal != "" || err != nil {
+			return principal, err
+		}
+	}
+	return "", nil
+}
+
+// TokenAuthenticator authenticates requests that carry a bearer token, either
+// in an "Authorization: Bearer <token>" header or in an access_token query
+// parameter. It maps each token to the principal it belongs to.
+type TokenAuthenticator map[string]string
+
+// ReadTokenFile reads a TokenAuthenticator from a file with a line of the
+// form <principal>:<token> for each token. Blank lines and lines starting
+// with # are ignored.
+func ReadTokenFile(path string) (TokenAuthenticator, error) {
+	ta := TokenAuthenticator{}
+	err := readCredentialsFile(path, func(principal, token string) error {
+		ta[token] = principal
+		return nil
+	})
+	return ta, err
+}
+
+func (ta TokenAuthenticator) Authenticate(req *http.Request) (string, error) {
+	token := req.URL.Query().Get("access_token")
+	if scheme, credentials := splitAuthorization(req); scheme == "bearer" {
+		token = credentials
+	}
+	if token == "" {
+		return "", nil
+	}
+	// Compare against every token, so that the time taken doesn't give away how much of a token was right.
+	found := ""
+	for t, principal := range ta {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			found = principal
+		}
+	}
+	if found == "" {
+		return "", ErrBadCredentials
+	}
+	return found, nil
+}
+
+// BasicAuthenticator authenticates requests that carry an "Authorization:
+// Basic" header, by checking the password against a hash. It maps each user
+// name to the hash of their password.
+type BasicAuthenticator map[string]string
+
+// ReadHtpasswdFile reads a BasicAuthenticator from a file in the format
+// written by Apache's htpasswd. Only bcrypt (htpasswd -B) and SHA-1
+// (htpasswd -s) hashes are supported.
+func ReadHtpasswdFile(path string) (BasicAuthenticator, error) {
+	ba := BasicAuthenticator{}
+	err := readCredentialsFile(path, func(user, hash string) error {
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return fmt.Errorf("Unsupported password hash for %s, use htpasswd -B", user)
+		}
+		ba[user] = hash
+		return nil
+	})
+	return ba, err
+}
+
+func (ba BasicAuthenticator) Authenticate(req *http.Request) (string, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", nil
+	}
+	hash, ok := ba[user]
+	if !ok {
+		return "", ErrBadCredentials
+	}
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		ok = subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	} else {
+		ok = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	if !ok {
+		return "", ErrBadCredentials
+	}
+	return user, nil
+}
+
+// ClientCertAuthenticator authenticates requests made over connections on
+// which the client presented a certificate that the server verified, as the
+// common name of the certificate's subject.
+type ClientCertAuthenticator struct{}
+
+func (ClientCertAuthenticator) Authenticate(req *http.Request) (string, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return "", nil
+	}
+	principal := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if principal == "" || principal == AnonymousPrincipal || principal == AnyPrincipal {
+		return "", ErrBadCredentials
+	}
+	return principal, nil
+}
+
+// splitAuthorization returns the lower-cased scheme and the credentials in
+// the Authorization header of |req|.
+func splitAuthorization(req *http.Request) (scheme, credentials string) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return strings.ToLower(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// readCredentialsFile calls |f| with the two halves of each <principal>:<secret>
+// line of the file at |path|.
+func readCredentialsFile(path string, f func(principal, secret string) error) error {
+	return readConfigLines(path, func(line string) error {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("Expected <name>:<secret>")
+		}
+		if parts[0] == AnonymousPrincipal || parts[0] == AnyPrincipal {
+			return fmt.Errorf("%s can't be used as a name", parts[0])
+		}
+		return f(parts[0], parts[1])
+	})
+}
+
+// readConfigLines calls |f| with each line of the file at |path|, skipping
+// blank lines and lines starting with #.
+func readConfigLines(path string, f func(line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return scanConfigLines(path, file, f)
+}
+
+func scanConfigLines(name string, r io.Reader, f func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := f(line); err != nil {
+			return fmt.Errorf("%s:%d: %s", name, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// ACL says which principals may read the databases served by a
+// RemoteDatabaseServer, and which datasets they may update. Anything that no
+// rule allows is forbidden.
+type ACL []ACLRule
+
+// ACLRule allows Principal, which may be AnyPrincipal or AnonymousPrincipal,
+// to read, or if Write is true, to read and update. Rules with patterns are
+// made by NewACLRule.
+type ACLRule struct {
+	Principal string
+	Write     bool
+	patterns  []aclPattern
+}
+
+// aclPattern is a compiled pattern of an ACLRule. |db| is nil if the pattern
+// doesn't restrict the database, and |ds| is nil in a read rule.
+type aclPattern struct {
+	db, ds *regexp.Regexp
+}
+
+// NewACLRule returns an ACLRule restricted by |patterns|.
+//
+// The patterns of a read rule restrict it to the databases whose names match
+// one of them. Those of a write rule restrict it to the datasets whose IDs
+// match one of them; a pattern of the form <database>::<dataset> also
+// restricts the database. In a pattern, * matches any run of characters. A
+// rule without patterns applies to everything. The database served by a
+// server that serves only one has the name "".
+func NewACLRule(principal string, write bool, patterns ...string) ACLRule {
+	rule := ACLRule{Principal: principal, Write: write}
+	for _, p := range patterns {
+		if !write {
+			rule.patterns = append(rule.patterns, aclPattern{db: globRegexp(p)})
+		} else if parts := strings.SplitN(p, aclDatabaseSeparator, 2); len(parts) == 2 {
+			rule.patterns = append(rule.patterns, aclPattern{db: globRegexp(parts[0]), ds: globRegexp(parts[1])})
+		} else {
+			rule.patterns = append(rule.patterns, aclPattern{ds: globRegexp(p)})
+		}
+	}
+	return rule
+}
+
+// ReadACLFile reads an ACL from a file with a rule on each line, of the form
+// <principal> read|write [<pattern>...]. Blank lines and lines starting with
+// # are ignored. For example:
+//
+//	anonymous read public
+//	*         read
+//	alice     write photos::* music::alice/*
+func ReadACLFile(path string) (ACL, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseACL(path, file)
+}
+
+func parseACL(name string, r io.Reader) (ACL, error) {
+	acl := ACL{}
+	err := scanConfigLines(name, r, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[1] != "read" && fields[1] != "write") {
+			return fmt.Errorf("Expected <principal> read|write [<pattern>...]")
+		}
+		acl = append(acl, NewACLRule(fields[0], fields[1] == "write", fields[2:]...))
+		return nil
+	})
+	return acl, err
+}
+
+// CanRead returns true if |principal| may read the database called |db|.
+func (acl ACL) CanRead(principal, db string) bool {
+	for _, rule := range acl {
+		if !rule.matchesPrincipal(principal) {
+			continue
+		}
+		if rule.Write {
+			if rule.matchesDatabase(db) {
+				return true
+			}
+		} else if rule.matches(func(p aclPattern) bool { return p.db.MatchString(db) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanWrite returns true if |principal| may update the dataset with ID |ds| in
+// the database called |db|.
+func (acl ACL) CanWrite(principal, db, ds string) bool {
+	for _, rule := range acl {
+		if rule.Write && rule.matchesPrincipal(principal) && rule.matches(func(p aclPattern) bool {
+			return (p.db == nil || p.db.MatchString(db)) && p.ds.MatchString(ds)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanWriteAny returns true if |principal| may update at least one dataset in
+// the database called |db|.
+func (acl ACL) CanWriteAny(principal, db string) bool {
+	for _, rule := range acl {
+		if rule.Write && rule.matchesPrincipal(principal) && rule.matchesDatabase(db) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule ACLRule) matchesPrincipal(principal string) bool {
+	return rule.Principal == principal || (rule.Principal == AnyPrincipal && principal != AnonymousPrincipal)
+}
+
+// matchesDatabase returns true if the write rule could allow updating a
+// dataset in |db|.
+func (rule ACLRule) matchesDatabase(db string) bool {
+	return rule.matches(func(p aclPattern) bool {
+		return p.db == nil || p.db.MatchString(db)
+	})
+}
+
+func (rule ACLRule) matches(f func(p aclPattern) bool) bool {
+	if len(rule.patterns) == 0 {
+		return true
+	}
+	for _, p := range rule.patterns {
+		if f(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles |pattern|, in which * matches any run of characters,
+// into a regexp that matches the whole of the strings that it does.
+func globRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+}
+
+type authContextKey struct{}
+
+// withDatasetAuthorizer returns a copy of |req| that carries |canWrite|, to
+// be checked by handleRootPost for each dataset that a new root changes.
+func withDatasetAuthorizer(req *http.Request, canWrite func(ds string) bool) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), authContextKey{}, canWrite))
+}
+
+// datasetAuthorizer returns the function that says whether the sender of
+// |req| may update a dataset, or nil if any dataset may be updated.
+func datasetAuthorizer(req *http.Request) func(ds string) bool {
+	canWrite, _ := req.Context().Value(authContextKey{}).(func(ds string) bool)
+	return canWrite
+}
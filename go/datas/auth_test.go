@@ -0,0 +1,122 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeTempFile(assert *assert.Assertions, contents string) string {
+	f, err := ioutil.TempFile("", "")
+	assert.NoError(err)
+	_, err = f.WriteString(contents)
+	assert.NoError(err)
+	assert.NoError(f.Close())
+	return f.Name()
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+	path := writeTempFile(assert, "# tokens\nalice:secret\n\nbob:other:token\n")
+	defer os.Remove(path)
+	ta, err := ReadTokenFile(path)
+	assert.NoError(err)
+
+	authenticate := func(url, header string) (string, error) {
+		req, _ := http.NewRequest("GET", url, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		return ta.Authenticate(req)
+	}
+	p, err := authenticate("http://host/root/", "Bearer secret")
+	assert.NoError(err)
+	assert.Equal("alice", p)
+	p, err = authenticate("http://host/root/?access_token=other:token", "")
+	assert.NoError(err)
+	assert.Equal("bob", p)
+	p, err = authenticate("http://host/root/", "")
+	assert.NoError(err)
+	assert.Equal("", p)
+	_, err = authenticate("http://host/root/", "Bearer wrong")
+	assert.Equal(ErrBadCredentials, err)
+
+	for _, bad := range []string{"alice\n", ":secret\n", "anonymous:secret\n"} {
+		path := writeTempFile(assert, bad)
+		defer os.Remove(path)
+		_, err := ReadTokenFile(path)
+		assert.Error(err, bad)
+	}
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(err)
+	// htpasswd -nbs bob secret
+	path := writeTempFile(assert, "alice:"+string(hash)+"\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	defer os.Remove(path)
+	ba, err := ReadHtpasswdFile(path)
+	assert.NoError(err)
+
+	authenticate := func(user, password string) (string, error) {
+		req, _ := http.NewRequest("GET", "http://host/root/", nil)
+		req.SetBasicAuth(user, password)
+		return ba.Authenticate(req)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		p, err := authenticate(user, "secret")
+		assert.NoError(err)
+		assert.Equal(user, p)
+		_, err = authenticate(user, "wrong")
+		assert.Equal(ErrBadCredentials, err)
+	}
+	_, err = authenticate("carol", "secret")
+	assert.Equal(ErrBadCredentials, err)
+
+	path = writeTempFile(assert, "carol:$apr1$abc$def\n")
+	defer os.Remove(path)
+	_, err = ReadHtpasswdFile(path)
+	assert.Error(err)
+}
+
+func TestACL(t *testing.T) {
+	assert := assert.New(t)
+	acl, err := parseACL("acl", strings.NewReader(`
+# Everyone can read the public database.
+anonymous read public
+*         read
+alice     write photos::* music::alice/*
+bob       write shared
+`))
+	assert.NoError(err)
+
+	assert.True(acl.CanRead(AnonymousPrincipal, "public"))
+	assert.False(acl.CanRead(AnonymousPrincipal, "photos"))
+	assert.False(acl.CanWriteAny(AnonymousPrincipal, "public"))
+	assert.True(acl.CanRead("carol", "photos"))
+	assert.False(acl.CanWriteAny("carol", "photos"))
+
+	assert.True(acl.CanWrite("alice", "photos", "anything/at/all"))
+	assert.True(acl.CanWrite("alice", "music", "alice/mix"))
+	assert.False(acl.CanWrite("alice", "music", "bob/mix"))
+	assert.False(acl.CanWrite("alice", "public", "x"))
+	assert.True(acl.CanWriteAny("alice", "music"))
+	assert.False(acl.CanWriteAny("alice", "public"))
+
+	assert.True(acl.CanWrite("bob", "", "shared"))
+	assert.True(acl.CanWrite("bob", "music", "shared"))
+	assert.False(acl.CanWrite("bob", "", "shared2"))
+
+	_, err = parseACL("acl", strings.NewReader("alice admin\n"))
+	assert.Error(err)
+}
@@ -5,6 +5,7 @@
 package datas
 
 import (
+	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/merge"
 	"github.com/attic-labs/noms/go/types"
 )
@@ -24,4 +25,19 @@ type CommitOptions struct {
 	// be attempted. Note that because Commit() retries in some cases, Policy
 	// might also be called multiple times with different values.
 	Policy merge.Policy
+
+	// PolicyName, if Policy is nil, names the Policy to merge with, as
+	// understood by merge.NamedPolicy(). A RemoteDatabaseClient asks the
+	// server to merge with it, rather than merging itself.
+	PolicyName string
+}
+
+// policy returns the Policy that opts asks for.
+func (opts CommitOptions) policy() merge.Policy {
+	if opts.Policy != nil || opts.PolicyName == "" {
+		return opts.Policy
+	}
+	policy, err := merge.NamedPolicy(opts.PolicyName)
+	d.PanicIfError(err)
+	return policy
 }
@@ -69,7 +69,8 @@ type Database interface {
 	// The returned Dataset is always the newest snapshot, regardless of
 	// success or failure, and Datasets() is updated to match backing storage
 	// upon return as well. If the update cannot be performed, e.g., because
-	// of a conflict, Delete returns an 'ErrMergeNeeded' error.
+	// of a conflict, Delete returns an 'ErrMergeNeeded' error. Tags can't be
+	// deleted, so Delete returns ErrTagImmutable for them.
 	Delete(ds Dataset) (Dataset, error)
 
 	// SetHead ignores any lineage constraints (e.g. the current Head being in
@@ -94,6 +95,20 @@ type Database interface {
 	// Regardless, Datasets() is updated to match backing storage upon return.
 	FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error)
 
+	// Tag creates an immutable tag called name, pointing at the Commit
+	// commitRef. The tag is stored as a Dataset with ID TagID(name), which
+	// Commit(), SetHead(), FastForward() and Delete() will refuse to update,
+	// returning ErrTagImmutable. If a tag called name already exists, Tag
+	// returns ErrTagExists.
+	// Regardless, Datasets() is updated to match backing storage upon return.
+	Tag(name string, commitRef types.Ref) (Dataset, error)
+
+	// Hooks returns the Hooks run on every update of the head of a Dataset
+	// made through this Database, to which validators and callbacks can be
+	// added. A validator that rejects a Commit makes the update fail with a
+	// CommitRejectedError.
+	Hooks() *Hooks
+
 	// validatingBatchStore returns the BatchStore used to read and write
 	// groups of values to the database efficiently. This interface is a low-
 	// level detail of the database that should infrequently be needed by
@@ -101,6 +116,18 @@ type Database interface {
 	validatingBatchStore() types.BatchStore
 
 	has(h hash.Hash) bool
+
+	// root returns the current root Map, including the entries under
+	// reserved keys that Datasets() leaves out.
+	root() types.Map
+
+	// swapHead implements the final step of Rebase(), making newHeadRef the
+	// Head of ds iff its Head is still oldHeadRef, and returning
+	// ErrRebaseHeadModified otherwise.
+	swapHead(ds Dataset, oldHeadRef, newHeadRef types.Ref) (Dataset, error)
+
+	// watch implements Watch().
+	watch(datasetID string) <-chan Dataset
 }
 
 func NewDatabase(cs chunks.ChunkStore) Database {
@@ -6,6 +6,7 @@ package datas
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/d"
@@ -20,6 +21,8 @@ type databaseCommon struct {
 	rt       chunks.RootTracker
 	rootHash hash.Hash
 	datasets *types.Map
+	watchers *watchers
+	hooks    *Hooks
 }
 
 var (
@@ -28,7 +31,8 @@ var (
 )
 
 func newDatabaseCommon(cch *cachingChunkHaver, vs *types.ValueStore, rt chunks.RootTracker) databaseCommon {
-	return databaseCommon{ValueStore: vs, cch: cch, rt: rt, rootHash: rt.Root()}
+	rootHash := rt.Root()
+	return databaseCommon{ValueStore: vs, cch: cch, rt: rt, rootHash: rootHash, watchers: newWatchers(rootHash), hooks: &Hooks{}}
 }
 
 func (dbc *databaseCommon) Datasets() types.Map {
@@ -44,11 +48,101 @@ func (dbc *databaseCommon) Datasets() types.Map {
 	return *dbc.datasets
 }
 
-func (dbc *databaseCommon) datasetsFromRef(datasetsRef hash.Hash) *types.Map {
-	c := dbc.ReadValue(datasetsRef).(types.Map)
+// datasetsFromRef returns the Datasets in the root |rootRef|, which may also
+// hold the checkpoints of unfinished pulls.
+func (dbc *databaseCommon) datasetsFromRef(rootRef hash.Hash) *types.Map {
+	c := rootDatasets(dbc.ReadValue(rootRef).(types.Map))
 	return &c
 }
 
+// reservedRootPrefixes are the prefixes of the keys of the entries in the
+// root Map that aren't Datasets, such as PrunedRefsKey and the keys of pull
+// checkpoints. None of them can begin a Dataset ID.
+var reservedRootPrefixes = []string{PrunedRefsKey, PullCheckpointPrefix}
+
+// isReservedRootKey returns true if |key| is the key of an entry in the root
+// Map that isn't a Dataset.
+func isReservedRootKey(key string) bool {
+	for _, prefix := range reservedRootPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedEntries returns the keys and values of the entries of the root Map
+// |root| whose keys begin with one of |prefixes|, or with any of
+// reservedRootPrefixes if none are given, alternately, as taken by
+// Map.SetM().
+func reservedEntries(root types.Map, prefixes ...string) (kv []types.Value) {
+	if len(prefixes) == 0 {
+		prefixes = reservedRootPrefixes
+	}
+	for _, prefix := range prefixes {
+		root.IterFrom(types.String(prefix), func(k, v types.Value) bool {
+			if !strings.HasPrefix(string(k.(types.String)), prefix) {
+				return true
+			}
+			kv = append(kv, k, v)
+			return false
+		})
+	}
+	return
+}
+
+// rootDatasets returns the root Map |root| without its reserved entries.
+func rootDatasets(root types.Map) types.Map {
+	kv := reservedEntries(root)
+	for i := 0; i < len(kv); i += 2 {
+		root = root.Remove(kv[i])
+	}
+	return root
+}
+
+func (dbc *databaseCommon) root() types.Map {
+	rootHash := dbc.rt.Root()
+	if rootHash.IsEmpty() {
+		return types.NewMap()
+	}
+	return dbc.ReadValue(rootHash).(types.Map)
+}
+
+// rootEntry returns the Commit held by the root Map under the reserved key
+// |key|, if there is one.
+func (dbc *databaseCommon) rootEntry(key string) (types.Ref, bool) {
+	r, ok := dbc.root().MaybeGet(types.String(key))
+	if !ok {
+		return types.Ref{}, false
+	}
+	return r.(types.Ref), true
+}
+
+// setRootEntry makes the root Map hold |commitRef| under the reserved key
+// |key|, or removes the entry if |remove| is true. Like doSetHead(), it is
+// optimistic, but unlike it, it doesn't run Hooks(), since the entry isn't a
+// Dataset.
+func (dbc *databaseCommon) setRootEntry(key string, commitRef types.Ref, remove bool) error {
+	if !isReservedRootKey(key) {
+		d.Panic("Not a reserved key: %s", key)
+	}
+	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, root := dbc.rt.Root(), types.NewMap()
+		if !currentRootHash.IsEmpty() {
+			root = dbc.ReadValue(currentRootHash).(types.Map)
+		}
+		if remove {
+			root = root.Remove(types.String(key))
+		} else {
+			root = root.Set(types.String(key), types.ToRefOfValue(commitRef))
+		}
+		err = dbc.tryUpdateRootMap(root, currentRootHash)
+	}
+	return err
+}
+
 func getDataset(db Database, datasetID string) Dataset {
 	if !DatasetFullRe.MatchString(datasetID) {
 		d.Panic("Invalid dataset ID: %s", datasetID)
@@ -61,11 +155,29 @@ func getDataset(db Database, datasetID string) Dataset {
 	return Dataset{store: db, id: datasetID}
 }
 
+func (dbc *databaseCommon) Hooks() *Hooks {
+	return dbc.hooks
+}
+
+// updated runs the callbacks in Hooks() if an update of the head of the
+// dataset |datasetID| in |db| succeeded, i.e. |err| is nil, and returns the
+// dataset along with err. It also tells the watchers of db about the new
+// root.
+func (dbc *databaseCommon) updated(db Database, datasetID string, err error) (Dataset, error) {
+	dbc.watchers.setRoot(dbc.rootHash)
+	ds := getDataset(db, datasetID)
+	if err == nil {
+		dbc.hooks.committed(ds)
+	}
+	return ds, err
+}
+
 func (dbc *databaseCommon) has(h hash.Hash) bool {
 	return dbc.cch.Has(h)
 }
 
 func (dbc *databaseCommon) Close() error {
+	dbc.watchers.close()
 	return dbc.ValueStore.Close()
 }
 
@@ -73,7 +185,13 @@ func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref) error {
 	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
 		return nil
 	}
+	if IsTag(ds.ID()) {
+		return ErrTagImmutable
+	}
 	commit := dbc.validateRefAsCommit(newHeadRef)
+	if err := dbc.hooks.validate(dbc, ds.ID(), commit); err != nil {
+		return err
+	}
 	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
 
 	currentRootHash, currentDatasets := dbc.getRootAndDatasets()
@@ -83,6 +201,32 @@ func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref) error {
 	return dbc.tryUpdateRoot(currentDatasets, currentRootHash)
 }
 
+// doSwapHead makes |newHeadRef| the head of |ds| iff its head is still |oldHeadRef|. Like doCommit, it is optimistic, retrying if another writer changes the Root out from under it, but it returns ErrRebaseHeadModified if the head of |ds| itself has moved.
+func (dbc *databaseCommon) doSwapHead(ds Dataset, oldHeadRef, newHeadRef types.Ref) error {
+	if IsTag(ds.ID()) {
+		return ErrTagImmutable
+	}
+	commit := dbc.validateRefAsCommit(newHeadRef)
+	if err := dbc.hooks.validate(dbc, ds.ID(), commit); err != nil {
+		return err
+	}
+	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+
+	datasetID := types.String(ds.ID())
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
+		if r, hasHead := currentDatasets.MaybeGet(datasetID); !hasHead || r.(types.Ref).TargetHash() != oldHeadRef.TargetHash() {
+			return ErrRebaseHeadModified
+		}
+		commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
+
+		currentDatasets = currentDatasets.Set(datasetID, types.ToRefOfValue(commitRef))
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+	}
+	return err
+}
+
 func (dbc *databaseCommon) doFastForward(ds Dataset, newHeadRef types.Ref) error {
 	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
 		return nil
@@ -99,6 +243,9 @@ func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct, merge
 	if !IsCommitType(commit.Type()) {
 		d.Panic("Can't commit a non-Commit struct to dataset %s", datasetID)
 	}
+	if IsTag(datasetID) {
+		return ErrTagImmutable
+	}
 	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
 
 	// This could loop forever, given enough simultaneous committers. BUG 2565
@@ -106,6 +253,7 @@ func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct, merge
 	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
 		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
 		commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
+		newHead := commit
 
 		// If there's nothing in the DB yet, skip all this logic.
 		if !currentRootHash.IsEmpty() {
@@ -133,18 +281,51 @@ func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct, merge
 					if err != nil {
 						return err
 					}
-					commitRef = dbc.WriteValue(NewCommit(merged, types.NewSet(commitRef, currentHeadRef), types.EmptyStruct))
+					newHead = NewCommit(merged, types.NewSet(commitRef, currentHeadRef), types.EmptyStruct)
+					commitRef = dbc.WriteValue(newHead)
 				}
 			}
 		}
+		if err := dbc.hooks.validate(dbc, datasetID, newHead); err != nil {
+			return err
+		}
 		currentDatasets = currentDatasets.Set(types.String(datasetID), types.ToRefOfValue(commitRef))
 		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
 	}
 	return err
 }
 
+// doTag creates the tag |name|, pointing at |commitRef|. Like doCommit, it is optimistic, retrying if another writer changes the Root out from under it, but it will never overwrite an existing tag.
+func (dbc *databaseCommon) doTag(name string, commitRef types.Ref) error {
+	if !IsValidTagName(name) {
+		d.Panic("Invalid tag name: %s", name)
+	}
+	commit := dbc.validateRefAsCommit(commitRef)
+	if err := dbc.hooks.validate(dbc, TagID(name), commit); err != nil {
+		return err
+	}
+	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+
+	tagID := types.String(TagID(name))
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
+		if currentDatasets.Has(tagID) {
+			return ErrTagExists
+		}
+		commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
+
+		currentDatasets = currentDatasets.Set(tagID, types.ToRefOfValue(commitRef))
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+	}
+	return err
+}
+
 // doDelete manages concurrent access the single logical piece of mutable state: the current Root. doDelete is optimistic in that it is attempting to update head making the assumption that currentRootHash is the hash of the current head. The call to UpdateRoot below will return an 'ErrOptimisticLockFailed' error if that assumption fails (e.g. because of a race with another writer) and the entire algorithm must be tried again.
 func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
+	if IsTag(datasetIDstr) {
+		return ErrTagImmutable
+	}
 	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
 
 	datasetID := types.String(datasetIDstr)
@@ -177,19 +358,34 @@ func (dbc *databaseCommon) getRootAndDatasets() (currentRootHash hash.Hash, curr
 	currentRootHash = dbc.rt.Root()
 	currentDatasets = dbc.Datasets()
 
-	if currentRootHash != currentDatasets.Hash() && !currentRootHash.IsEmpty() {
+	if currentRootHash != dbc.rootHash && !currentRootHash.IsEmpty() {
 		// The root has been advanced.
 		currentDatasets = *dbc.datasetsFromRef(currentRootHash)
 	}
 	return
 }
 
-func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash) (err error) {
+func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash) error {
+	root := currentDatasets
+	if !currentRootHash.IsEmpty() {
+		// The entries under reserved keys aren't Datasets, but they're kept in the same Map, and mustn't be dropped when a Dataset changes.
+		if kv := reservedEntries(dbc.ReadValue(currentRootHash).(types.Map)); len(kv) > 0 {
+			root = root.SetM(kv...)
+		}
+	}
+	return dbc.tryUpdateRootMap(root, currentRootHash)
+}
+
+// tryUpdateRootMap writes |root| and makes it the Root, iff the Root is still
+// |currentRootHash|.
+func (dbc *databaseCommon) tryUpdateRootMap(root types.Map, currentRootHash hash.Hash) (err error) {
 	// TODO: This Map will be orphaned if the UpdateRoot below fails
-	newRootHash := dbc.WriteValue(currentDatasets).TargetHash()
+	newRootHash := dbc.WriteValue(root).TargetHash()
 	dbc.Flush(newRootHash)
 	// If the root has been updated by another process in the short window since we read it, this call will fail. See issue #404
-	if !dbc.rt.UpdateRoot(newRootHash, currentRootHash) {
+	// A server may also reject the update, if its hooks reject a commit.
+	ok := false
+	if err = d.Try(func() { ok = dbc.rt.UpdateRoot(newRootHash, currentRootHash) }, CommitRejectedError{}); err == nil && !ok {
 		err = ErrOptimisticLockFailed
 	}
 	return
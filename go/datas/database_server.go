@@ -5,10 +5,13 @@
 package datas
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/constants"
@@ -21,14 +24,39 @@ type connectionState struct {
 	cs http.ConnState
 }
 
+// DatabaseNameRe is the pattern that the names of the databases served by a
+// RemoteDatabaseServer created with NewRemoteDatabaseServerForFactory must
+// match.
+var DatabaseNameRe = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+
 type RemoteDatabaseServer struct {
-	cs      chunks.ChunkStore
+	cs      chunks.ChunkStore // nil if serving the databases of factory
+	factory chunks.Factory
+	stores  map[string]chunks.ChunkStore
+	mu      sync.Mutex // protects stores
 	port    int
 	l       *net.Listener
 	csChan  chan *connectionState
 	closing bool
 	// Called just before the server is started.
 	Ready func()
+
+	// Auth, if not nil, works out who sent each request, so that ACL can be
+	// checked. Requests without credentials are made by AnonymousPrincipal.
+	Auth Authenticator
+	// ACL, if not nil, says who may read and update what. If it is nil but
+	// Auth isn't, any principal but AnonymousPrincipal may do anything.
+	ACL ACL
+
+	// Hooks, if not nil, are run on each update of the head of a Dataset
+	// made through the server. A validator that rejects a Commit makes the
+	// update fail, which the client sees as a CommitRejectedError.
+	Hooks *Hooks
+
+	// TLS, if not nil, makes the server serve https rather than http.
+	// Setting its ClientCAs and ClientAuth verifies client certificates,
+	// whose subjects can then be authenticated by ClientCertAuthenticator.
+	TLS *tls.Config
 }
 
 func NewRemoteDatabaseServer(cs chunks.ChunkStore, port int) *RemoteDatabaseServer {
@@ -37,7 +65,19 @@ func NewRemoteDatabaseServer(cs chunks.ChunkStore, port int) *RemoteDatabaseServ
 		d.Panic("SDK version %s is incompatible with data of version %s", constants.NomsVersion, dataVersion)
 	}
 	return &RemoteDatabaseServer{
-		cs, port, nil, make(chan *connectionState, 16), false, func() {},
+		cs: cs, port: port, csChan: make(chan *connectionState, 16), Ready: func() {},
+	}
+}
+
+// NewRemoteDatabaseServerForFactory returns a RemoteDatabaseServer that
+// serves many databases, each of which is a namespace of |f|. The database
+// called name is served under /db/<name>/, e.g. its root is at
+// /db/<name>/root/. Databases are created on the first write to them. If f
+// implements chunks.NamespaceChecker, reading from a database that hasn't
+// been created finds it empty, without creating it.
+func NewRemoteDatabaseServerForFactory(f chunks.Factory, port int) *RemoteDatabaseServer {
+	return &RemoteDatabaseServer{
+		factory: f, stores: map[string]chunks.ChunkStore{}, port: port, csChan: make(chan *connectionState, 16), Ready: func() {},
 	}
 }
 
@@ -51,29 +91,45 @@ func (s *RemoteDatabaseServer) Run() {
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	d.Chk.NoError(err)
-	s.l = &l
 	_, port, err := net.SplitHostPort(l.Addr().String())
 	d.Chk.NoError(err)
 	s.port, err = strconv.Atoi(port)
 	d.Chk.NoError(err)
-	fmt.Printf("Listening on port %d...\n", s.port)
+	if s.TLS != nil {
+		l = tls.NewListener(l, s.TLS)
+		fmt.Printf("Listening on port %d (https)...\n", s.port)
+	} else {
+		fmt.Printf("Listening on port %d...\n", s.port)
+	}
+	s.l = &l
 
 	router := httprouter.New()
+	prefix := ""
+	if s.factory != nil {
+		prefix = constants.DatabasesPath + ":" + databaseNameParam
+	}
+	route := func(method, path string, hndlr Handler, write bool) {
+		router.Handle(method, prefix+path, s.corsHandle(s.makeHandle(hndlr, write)))
+	}
+
+	route("POST", constants.GetRefsPath, HandleGetRefs, false)
+	route("GET", constants.GetBlobPath, HandleGetBlob, false)
+	router.OPTIONS(prefix+constants.GetRefsPath, s.corsHandle(noopHandle))
+	route("POST", constants.HasRefsPath, HandleHasRefs, false)
+	router.OPTIONS(prefix+constants.HasRefsPath, s.corsHandle(noopHandle))
+	route("GET", constants.RootPath, HandleRootGet, false)
+	route("POST", constants.RootPath, HandleRootPost, true)
+	router.OPTIONS(prefix+constants.RootPath, s.corsHandle(noopHandle))
+	route("GET", constants.RootLogPath, HandleRootLogGet, false)
+	route("POST", constants.WriteValuePath, HandleWriteValue, true)
+	router.OPTIONS(prefix+constants.WriteValuePath, s.corsHandle(noopHandle))
+	route("POST", constants.CommitPath, HandleCommit, true)
+	router.OPTIONS(prefix+constants.CommitPath, s.corsHandle(noopHandle))
+	route("GET", constants.WatchPath, HandleWatch, false)
+	route("GET", constants.BasePath, HandleBaseGet, false)
 
-	router.POST(constants.GetRefsPath, s.corsHandle(s.makeHandle(HandleGetRefs)))
-	router.GET(constants.GetBlobPath, s.corsHandle(s.makeHandle(HandleGetBlob)))
-	router.OPTIONS(constants.GetRefsPath, s.corsHandle(noopHandle))
-	router.POST(constants.HasRefsPath, s.corsHandle(s.makeHandle(HandleHasRefs)))
-	router.OPTIONS(constants.HasRefsPath, s.corsHandle(noopHandle))
-	router.GET(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootGet)))
-	router.POST(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootPost)))
-	router.OPTIONS(constants.RootPath, s.corsHandle(noopHandle))
-	router.POST(constants.WriteValuePath, s.corsHandle(s.makeHandle(HandleWriteValue)))
-	router.OPTIONS(constants.WriteValuePath, s.corsHandle(noopHandle))
-	router.GET(constants.BasePath, s.corsHandle(s.makeHandle(HandleBaseGet)))
-
-	router.GET(constants.GraphQLPath, s.corsHandle(s.makeHandle(HandleGraphQL)))
-	router.OPTIONS(constants.GraphQLPath, s.corsHandle(noopHandle))
+	route("GET", constants.GraphQLPath, HandleGraphQL, false)
+	router.OPTIONS(prefix+constants.GraphQLPath, s.corsHandle(noopHandle))
 
 	srv := &http.Server{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -101,12 +157,112 @@ func (s *RemoteDatabaseServer) Run() {
 	srv.Serve(l)
 }
 
-func (s *RemoteDatabaseServer) makeHandle(hndlr Handler) httprouter.Handle {
+const databaseNameParam = "database"
+
+// makeHandle returns a Handle that calls |hndlr| with the ChunkStore of the
+// database the request is for. If |write| is true, hndlr may write to the
+// ChunkStore, so the database is created if need be.
+func (s *RemoteDatabaseServer) makeHandle(hndlr Handler, write bool) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-		hndlr(w, req, ps, s.cs)
+		// Clients check this before looking at the status of the response.
+		w.Header().Set(NomsVersionHeader, constants.NomsVersion)
+		name := ""
+		if s.factory != nil {
+			name = ps.ByName(databaseNameParam)
+			if !DatabaseNameRe.MatchString(name) {
+				http.Error(w, fmt.Sprintf("Invalid database name %s, must match %s", name, DatabaseNameRe.String()), http.StatusBadRequest)
+				return
+			}
+		}
+		req, ok := s.authorize(w, req, name, write)
+		if !ok {
+			return
+		}
+		if s.Hooks != nil {
+			req = withHooks(req, s.Hooks)
+		}
+		if s.factory == nil {
+			hndlr(w, req, ps, s.cs)
+			return
+		}
+		cs := s.getStore(name, write)
+		if cs == nil {
+			// Nothing has been written to the database yet, so it's empty.
+			cs = chunks.NewMemoryStore()
+		}
+		hndlr(w, req, ps, cs)
 	}
 }
 
+// authorize checks that the sender of |req| may read the database called
+// |db|, or if |write| is true, update at least one dataset in it. If not, it
+// writes an error response and returns false. Otherwise it returns req with
+// the permissions needed by handleRootPost attached.
+func (s *RemoteDatabaseServer) authorize(w http.ResponseWriter, req *http.Request, db string, write bool) (*http.Request, bool) {
+	if s.Auth == nil && s.ACL == nil {
+		return req, true
+	}
+	principal := AnonymousPrincipal
+	if s.Auth != nil {
+		p, err := s.Auth.Authenticate(req)
+		if err != nil {
+			s.unauthorized(w, err.Error())
+			return req, false
+		}
+		if p != "" {
+			principal = p
+		}
+	}
+	acl := s.ACL
+	if acl == nil {
+		acl = ACL{{Principal: AnyPrincipal, Write: true}}
+	}
+
+	allowed := acl.CanRead(principal, db)
+	if write {
+		allowed = acl.CanWriteAny(principal, db)
+	}
+	if !allowed {
+		if principal == AnonymousPrincipal {
+			s.unauthorized(w, "Credentials required")
+		} else if write {
+			http.Error(w, fmt.Sprintf("%s may not write to this database", principal), http.StatusForbidden)
+		} else {
+			http.Error(w, fmt.Sprintf("%s may not read this database", principal), http.StatusForbidden)
+		}
+		return req, false
+	}
+	return withDatasetAuthorizer(req, func(ds string) bool {
+		return acl.CanWrite(principal, db, ds)
+	}), true
+}
+
+func (s *RemoteDatabaseServer) unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="noms"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="noms"`)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// getStore returns the ChunkStore for the database called |name|, creating
+// the database if |create| is true. Otherwise, it returns nil if the
+// database doesn't exist yet.
+func (s *RemoteDatabaseServer) getStore(name string, create bool) chunks.ChunkStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cs, ok := s.stores[name]; ok {
+		return cs
+	}
+	if nc, ok := s.factory.(chunks.NamespaceChecker); ok && !create && !nc.HasNamespace(name) {
+		return nil
+	}
+	cs := s.factory.CreateStore(name)
+	if dataVersion := cs.Version(); constants.NomsVersion != dataVersion {
+		d.Panic("SDK version %s is incompatible with data of version %s in database %s", constants.NomsVersion, dataVersion, name)
+	}
+	s.stores[name] = cs
+	return cs
+}
+
 func noopHandle(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 }
 
@@ -136,6 +292,15 @@ func (s *RemoteDatabaseServer) connState(c net.Conn, cs http.ConnState) {
 func (s *RemoteDatabaseServer) Stop() {
 	s.closing = true
 	(*s.l).Close()
-	(s.cs).Close()
+	if s.factory != nil {
+		s.mu.Lock()
+		for _, cs := range s.stores {
+			cs.Close()
+		}
+		s.mu.Unlock()
+		s.factory.Shutter()
+	} else {
+		(s.cs).Close()
+	}
 	close(s.csChan)
 }
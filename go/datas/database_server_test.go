@@ -0,0 +1,251 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestServeManyDatabases(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	server := NewRemoteDatabaseServerForFactory(nbs.NewLocalStoreFactory(dir, 0), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	a := NewRemoteDatabase(url+"/db/a", "")
+	_, err = a.CommitValue(a.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	a.Close()
+
+	// Reading a database that hasn't been written to finds it empty, and doesn't create it.
+	b := NewRemoteDatabase(url+"/db/b", "")
+	assert.Equal(uint64(0), b.Datasets().Len())
+	b.Close()
+	_, err = os.Stat(filepath.Join(dir, "b"))
+	assert.True(os.IsNotExist(err))
+
+	a = NewRemoteDatabase(url+"/db/a", "")
+	assert.True(types.String("a").Equals(a.GetDataset("ds").HeadValue()))
+	a.Close()
+
+	res, err := http.Get(url + "/db/a.b/root/")
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	server.Stop()
+
+	local := NewDatabase(nbs.NewLocalStore(filepath.Join(dir, "a"), 0))
+	defer local.Close()
+	assert.True(types.String("a").Equals(local.GetDataset("ds").HeadValue()))
+}
+
+func TestServeWithAuth(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	server.Auth = TokenAuthenticator{"alice-token": "alice", "bob-token": "bob"}
+	server.ACL = ACL{
+		NewACLRule("alice", true, "a"),
+		{Principal: "bob"},
+	}
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	alice := NewRemoteDatabase(url, "alice-token")
+	_, err := alice.CommitValue(alice.GetDataset("a"), types.String("a"))
+	assert.NoError(err)
+	assert.Panics(func() { alice.CommitValue(alice.GetDataset("b"), types.String("b")) })
+	alice.Close()
+
+	bob := NewRemoteDatabase(url, "bob-token")
+	assert.True(types.String("a").Equals(bob.GetDataset("a").HeadValue()))
+	_, ok := bob.GetDataset("b").MaybeHeadRef()
+	assert.False(ok)
+	assert.Panics(func() { bob.CommitValue(bob.GetDataset("a"), types.String("b")) })
+	bob.Close()
+
+	res, err := http.Get(url + "/root/")
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+// newTestCert makes a certificate for |name|, signed by |parent|, or
+// self-signed if parent is nil, in which case it can sign others.
+func newTestCert(assert *assert.Assertions, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServeTLS(t *testing.T) {
+	assert := assert.New(t)
+	ca := newTestCert(assert, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCert(assert, "localhost", &ca)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	server.Auth = ClientCertAuthenticator{}
+	server.ACL = ACL{{Principal: "alice", Write: true}}
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("https://localhost:%d", <-portChan)
+
+	alice := NewRemoteDatabaseTLS(url, "", &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{newTestCert(assert, "alice", &ca)}})
+	_, err := alice.CommitValue(alice.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	alice.Close()
+
+	// Without a client certificate, the server is anonymous, which the ACL doesn't allow.
+	assert.Panics(func() { NewRemoteDatabaseTLS(url, "", &tls.Config{RootCAs: pool}) })
+
+	// Without trusting the CA, the server's certificate is refused.
+	assert.Panics(func() { NewRemoteDatabase(url, "") })
+}
+
+func TestServerCommit(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	a, b := NewRemoteDatabase(url, ""), NewRemoteDatabase(url, "")
+	defer a.Close()
+	defer b.Close()
+	ds, err := a.CommitValue(a.GetDataset("ds"), types.NewSet(types.Number(1)))
+	assert.NoError(err)
+
+	// b hasn't seen a's commit, but that doesn't matter when committing to another dataset.
+	_, err = b.CommitValue(b.GetDataset("other"), types.String("other"))
+	assert.NoError(err)
+
+	bds := b.GetDataset("ds")
+	_, err = a.CommitValue(ds, types.NewSet(types.Number(1), types.Number(2)))
+	assert.NoError(err)
+	_, err = b.CommitValue(bds, types.NewSet(types.Number(1), types.Number(3)))
+	assert.Equal(ErrMergeNeeded, err)
+	bds, err = b.Commit(bds, types.NewSet(types.Number(1), types.Number(3)), CommitOptions{PolicyName: "none"})
+	assert.NoError(err)
+	assert.True(types.NewSet(types.Number(1), types.Number(2), types.Number(3)).Equals(bds.HeadValue()))
+	assert.True(types.String("other").Equals(b.GetDataset("other").HeadValue()))
+}
+
+func TestServeWatch(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	watcher, writer := NewRemoteDatabase(url, ""), NewRemoteDatabase(url, "")
+	defer writer.Close()
+	ch := Watch(watcher, "ds")
+	_, ok := nextHead(assert, ch).MaybeHeadRef()
+	assert.False(ok)
+
+	ds, err := writer.CommitValue(writer.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	assert.True(ds.HeadRef().Equals(nextHead(assert, ch).HeadRef()))
+	ds, err = writer.CommitValue(ds, types.String("b"))
+	assert.NoError(err)
+	assert.True(types.String("b").Equals(nextHead(assert, ch).HeadValue()))
+
+	// Closing the watcher ends the stream.
+	watcher.Close()
+	_, ok = <-ch
+	assert.False(ok)
+}
+
+func TestServeWithHooks(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewTestStore(), 0)
+	server.Hooks = &Hooks{}
+	server.Hooks.AddValidator(ValueTypeValidator(types.NumberType))
+	updated := []string{}
+	server.Hooks.AddCallback(func(ds Dataset) {
+		updated = append(updated, ds.ID())
+	})
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	db := NewRemoteDatabase(url, "")
+	defer db.Close()
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.Number(1))
+	assert.NoError(err)
+	_, err = db.CommitValue(ds, types.String("a"))
+	assert.Equal(CommitRejectedError{"The value of a commit to ds must be of type Number, not String"}, err)
+
+	// SetHead() updates the root directly, rather than having the server commit.
+	commitRef := db.WriteValue(NewCommit(types.String("a"), types.NewSet(ds.HeadRef()), types.EmptyStruct))
+	_, err = db.SetHead(ds, commitRef)
+	assert.Equal(CommitRejectedError{"The value of a commit to ds must be of type Number, not String"}, err)
+	_, err = db.Delete(ds)
+	assert.NoError(err)
+
+	assert.Equal([]string{"ds", "ds"}, updated)
+}
@@ -199,17 +199,17 @@ func (suite *DatabaseSuite) TestDatasetsMapType() {
 	datasets := suite.db.Datasets()
 	ds, err := suite.db.CommitValue(suite.db.GetDataset(dsID1), types.String("a"))
 	suite.NoError(err)
-	suite.NotPanics(func() { assertMapOfStringToRefOfCommit(suite.db.Datasets(), datasets, suite.db) })
+	suite.NotPanics(func() { checkRootChanges(suite.db.Datasets(), datasets, suite.db, nil, nil) })
 
 	datasets = suite.db.Datasets()
 	_, err = suite.db.CommitValue(suite.db.GetDataset(dsID2), types.Number(42))
 	suite.NoError(err)
-	suite.NotPanics(func() { assertMapOfStringToRefOfCommit(suite.db.Datasets(), datasets, suite.db) })
+	suite.NotPanics(func() { checkRootChanges(suite.db.Datasets(), datasets, suite.db, nil, nil) })
 
 	datasets = suite.db.Datasets()
 	_, err = suite.db.Delete(ds)
 	suite.NoError(err)
-	suite.NotPanics(func() { assertMapOfStringToRefOfCommit(suite.db.Datasets(), datasets, suite.db) })
+	suite.NotPanics(func() { checkRootChanges(suite.db.Datasets(), datasets, suite.db, nil, nil) })
 }
 
 func newOpts(parents ...types.Value) CommitOptions {
@@ -489,6 +489,50 @@ func (suite *DatabaseSuite) TestFastForward() {
 	suite.True(ds.HeadValue().Equals(c))
 }
 
+func (suite *DatabaseSuite) TestTag() {
+	ds := suite.db.GetDataset("ds1")
+	ds, err := suite.db.CommitValue(ds, types.String("a"))
+	suite.NoError(err)
+	aCommitRef := ds.HeadRef()
+	ds, err = suite.db.CommitValue(ds, types.String("b"))
+	suite.NoError(err)
+	bCommitRef := ds.HeadRef()
+
+	tag, err := suite.db.Tag("v1.2", aCommitRef)
+	suite.NoError(err)
+	suite.Equal("tag:v1.2", tag.ID())
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+	suite.True(suite.db.GetDataset(TagID("v1.2")).HeadValue().Equals(types.String("a")))
+	suite.True(suite.db.Datasets().Has(types.String("tag:v1.2")))
+
+	// Tags can't be re-created, moved or committed to...
+	tag, err = suite.db.Tag("v1.2", bCommitRef)
+	suite.Equal(ErrTagExists, err)
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+	tag, err = suite.db.SetHead(tag, bCommitRef)
+	suite.Equal(ErrTagImmutable, err)
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+	tag, err = suite.db.FastForward(tag, bCommitRef)
+	suite.Equal(ErrTagImmutable, err)
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+	tag, err = suite.db.CommitValue(tag, types.String("c"))
+	suite.Equal(ErrTagImmutable, err)
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+
+	// ...or created by committing to a new tag dataset.
+	_, err = suite.db.CommitValue(suite.db.GetDataset(TagID("v2")), types.String("c"))
+	suite.Equal(ErrTagImmutable, err)
+	suite.False(suite.db.Datasets().Has(types.String("tag:v2")))
+
+	// Nor can they be deleted, and then re-created elsewhere.
+	tag, err = suite.db.Delete(tag)
+	suite.Equal(ErrTagImmutable, err)
+	suite.True(tag.HeadRef().Equals(aCommitRef))
+	suite.True(suite.db.Datasets().Has(types.String("tag:v1.2")))
+
+	suite.Panics(func() { suite.db.Tag("v1.x", aCommitRef) })
+}
+
 func (suite *DatabaseSuite) TestDatabaseHeightOfRefs() {
 	r1 := suite.db.WriteValue(types.String("hello"))
 	suite.Equal(uint64(1), r1.Height())
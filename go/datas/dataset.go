@@ -16,8 +16,9 @@ import (
 var DatasetRe = regexp.MustCompile(`[a-zA-Z0-9\-_/]+`)
 
 // DatasetFullRe is a regexp that matches a only a target string that is
-// entirely legal Dataset name.
-var DatasetFullRe = regexp.MustCompile("^" + DatasetRe.String() + "$")
+// entirely legal Dataset name. This includes the IDs of tags, see TagIDRe,
+// and of merge states, see MergeStateIDRe.
+var DatasetFullRe = regexp.MustCompile("^(?:" + TagIDRe.String() + "|" + MergeStateIDRe.String() + "|" + DatasetRe.String() + ")$")
 
 // Dataset is a named Commit within a Database.
 type Dataset struct {
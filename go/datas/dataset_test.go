@@ -181,6 +181,13 @@ func TestIsValidDatasetName(t *testing.T) {
 		{"1f", true},
 		{"", false},
 		{"f!!", false},
+		{"tag:v1", true},
+		{"tag:v1.2", true},
+		{"tag:", false},
+		{"tag:v1.x", false},
+		{"merge-state:foo/bar", true},
+		{"merge-state:", false},
+		{"foo:bar", false},
 	}
 	for _, c := range cases {
 		assert.Equal(c.valid, IsValidDatasetName(c.name),
@@ -0,0 +1,138 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/attic-labs/noms/go/types"
+)
+
+// CommitValidator is called with each Commit that is about to become the
+// head of the Dataset with ID |datasetID|, and rejects it by returning an
+// error. |vr| reads from the database being updated.
+type CommitValidator func(vr types.ValueReader, datasetID string, commit types.Struct) error
+
+// CommitCallback is called with each Dataset whose head has been updated,
+// after the update has been made. If the Dataset was deleted, it has no head.
+type CommitCallback func(ds Dataset)
+
+// CommitRejectedError is returned when a CommitValidator rejects a Commit.
+type CommitRejectedError struct {
+	Reason string
+}
+
+func (e CommitRejectedError) Error() string {
+	return "Commit rejected: " + e.Reason
+}
+
+// Hooks holds the CommitValidators and CommitCallbacks to run when the head
+// of a Dataset is updated. The zero value, and nil, have none.
+type Hooks struct {
+	mu         sync.RWMutex // protects the following
+	validators []CommitValidator
+	callbacks  []CommitCallback
+}
+
+// AddValidator adds |v| to the validators run before each head update. It
+// is safe to call while updates are being made.
+func (h *Hooks) AddValidator(v CommitValidator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.validators = append(h.validators, v)
+}
+
+// AddCallback adds |c| to the callbacks run after each head update. They are
+// run in turn by the goroutine that made the update, so shouldn't take long.
+// It is safe to call while updates are being made.
+func (h *Hooks) AddCallback(c CommitCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.callbacks = append(h.callbacks, c)
+}
+
+// validate runs each validator on |commit|, and returns a
+// CommitRejectedError for the first that rejects it.
+func (h *Hooks) validate(vr types.ValueReader, datasetID string, commit types.Struct) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	validators := h.validators
+	h.mu.RUnlock()
+	for _, v := range validators {
+		if err := v(vr, datasetID, commit); err != nil {
+			if _, ok := err.(CommitRejectedError); ok {
+				return err
+			}
+			return CommitRejectedError{err.Error()}
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) committed(ds Dataset) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	callbacks := h.callbacks
+	h.mu.RUnlock()
+	for _, c := range callbacks {
+		c(ds)
+	}
+}
+
+// ValueTypeValidator returns a CommitValidator that rejects Commits whose
+// value isn't a subtype of |t|.
+func ValueTypeValidator(t *types.Type) CommitValidator {
+	return func(vr types.ValueReader, datasetID string, commit types.Struct) error {
+		if vt := commit.Get(ValueField).Type(); !types.IsSubtype(t, vt) {
+			return fmt.Errorf("The value of a commit to %s must be of type %s, not %s", datasetID, t.Describe(), vt.Describe())
+		}
+		return nil
+	}
+}
+
+// MetaFieldValidator returns a CommitValidator that rejects Commits whose
+// meta doesn't have a field called |name|, e.g. "author".
+func MetaFieldValidator(name string) CommitValidator {
+	return func(vr types.ValueReader, datasetID string, commit types.Struct) error {
+		if _, ok := commit.Get(MetaField).(types.Struct).MaybeGet(name); !ok {
+			return fmt.Errorf("The meta of a commit to %s must have the field %s", datasetID, name)
+		}
+		return nil
+	}
+}
+
+// DatasetValidator returns a CommitValidator that runs |v| on Commits to the
+// Datasets whose IDs match |pattern|, in which * matches any run of
+// characters, and accepts all others.
+func DatasetValidator(pattern string, v CommitValidator) CommitValidator {
+	re := globRegexp(pattern)
+	return func(vr types.ValueReader, datasetID string, commit types.Struct) error {
+		if !re.MatchString(datasetID) {
+			return nil
+		}
+		return v(vr, datasetID, commit)
+	}
+}
+
+type hooksContextKey struct{}
+
+// withHooks returns a copy of |req| that carries |hooks|, to be run by the
+// handlers that update the Root.
+func withHooks(req *http.Request, hooks *Hooks) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), hooksContextKey{}, hooks))
+}
+
+// requestHooks returns the Hooks carried by |req|, or nil if there are none.
+func requestHooks(req *http.Request) *Hooks {
+	hooks, _ := req.Context().Value(hooksContextKey{}).(*Hooks)
+	return hooks
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	db.Hooks().AddValidator(DatasetValidator("people/*", ValueTypeValidator(types.MakeListType(types.StringType))))
+	db.Hooks().AddValidator(func(vr types.ValueReader, datasetID string, commit types.Struct) error {
+		if commit.Get(ValueField).Equals(types.String("bad")) {
+			return errors.New("bad value")
+		}
+		return nil
+	})
+	updated := []string{}
+	db.Hooks().AddCallback(func(ds Dataset) {
+		updated = append(updated, ds.ID())
+	})
+
+	ds, err := db.CommitValue(db.GetDataset("people/us"), types.NewList(types.String("alice")))
+	assert.NoError(err)
+	_, err = db.CommitValue(ds, types.NewList(types.Number(1)))
+	assert.IsType(CommitRejectedError{}, err)
+	_, ok := db.GetDataset("people/us").HeadValue().(types.List).Get(0).(types.String)
+	assert.True(ok)
+
+	// Validators apply to every kind of head update, but the type is only required of people/*.
+	other, err := db.CommitValue(db.GetDataset("other"), types.Number(1))
+	assert.NoError(err)
+	bad, err := db.CommitValue(db.GetDataset("bad"), types.String("ok"))
+	assert.NoError(err)
+	badRef := db.WriteValue(NewCommit(types.String("bad"), types.NewSet(bad.HeadRef()), types.EmptyStruct))
+	_, err = db.SetHead(bad, badRef)
+	assert.Equal(CommitRejectedError{"bad value"}, err)
+	_, err = db.FastForward(bad, badRef)
+	assert.Equal(CommitRejectedError{"bad value"}, err)
+	_, err = db.Tag("v1", badRef)
+	assert.Equal(CommitRejectedError{"bad value"}, err)
+	_, err = db.Delete(other)
+	assert.NoError(err)
+
+	assert.Equal([]string{"people/us", "other", "bad", "other"}, updated)
+}
+
+func TestMetaFieldValidator(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+	db.Hooks().AddValidator(MetaFieldValidator("author"))
+
+	_, err := db.CommitValue(db.GetDataset("ds"), types.Number(1))
+	assert.Equal(CommitRejectedError{"The meta of a commit to ds must have the field author"}, err)
+	_, err = db.Commit(db.GetDataset("ds"), types.Number(1), CommitOptions{Meta: types.NewStruct("Meta", types.StructData{"author": types.String("alice")})})
+	assert.NoError(err)
+}
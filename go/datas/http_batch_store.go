@@ -8,6 +8,9 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -54,6 +57,12 @@ type httpBatchStore struct {
 }
 
 func NewHTTPBatchStore(baseURL, auth string) *httpBatchStore {
+	return NewHTTPBatchStoreTLS(baseURL, auth, nil)
+}
+
+// NewHTTPBatchStoreTLS is like NewHTTPBatchStore, but makes https
+// connections with |tlsConfig|.
+func NewHTTPBatchStoreTLS(baseURL, auth string, tlsConfig *tls.Config) *httpBatchStore {
 	u, err := url.Parse(baseURL)
 	d.PanicIfError(err)
 	if u.Scheme != "http" && u.Scheme != "https" {
@@ -61,7 +70,7 @@ func NewHTTPBatchStore(baseURL, auth string) *httpBatchStore {
 	}
 	buffSink := &httpBatchStore{
 		host:          u,
-		httpClient:    makeHTTPClient(httpChunkSinkConcurrency),
+		httpClient:    makeHTTPClient(httpChunkSinkConcurrency, tlsConfig),
 		auth:          auth,
 		getQueue:      make(chan chunks.ReadRequest, readBufferSize),
 		hasQueue:      make(chan chunks.ReadRequest, readBufferSize),
@@ -90,13 +99,17 @@ type writeRequest struct {
 }
 
 // Use a custom http client rather than http.DefaultClient. We limit ourselves to a maximum of |requestLimit| concurrent http requests, the custom httpClient ups the maxIdleConnsPerHost value so that one connection stays open for each concurrent request.
-func makeHTTPClient(requestLimit int) *http.Client {
-	t := http.Transport(*http.DefaultTransport.(*http.Transport))
+func makeHTTPClient(requestLimit int, tlsConfig *tls.Config) *http.Client {
+	// Clone, rather than copy, the default Transport, so as not to share its pool of connections, which may have been made with a different tlsConfig.
+	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.MaxIdleConnsPerHost = requestLimit
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
 	// This sets, essentially, an idle-timeout. The timer starts counting AFTER the client has finished sending the entire request to the server. As soon as the client receives the server's response headers, the timeout is canceled.
 	t.ResponseHeaderTimeout = time.Duration(4) * time.Minute
 
-	return &http.Client{Transport: &t}
+	return &http.Client{Transport: t}
 }
 
 func (bhcs *httpBatchStore) SetReverseFlushOrder() {
@@ -435,7 +448,7 @@ func (bhcs *httpBatchStore) Root() hash.Hash {
 
 // UpdateRoot flushes outstanding writes to the backing ChunkStore before updating its Root, because it's almost certainly the case that the caller wants to point that root at some recently-Put Chunk.
 func (bhcs *httpBatchStore) UpdateRoot(current, last hash.Hash) bool {
-	// POST http://<host>/root?current=<ref>&last=<ref>. Response will be 200 on success, 409 if current is outdated.
+	// POST http://<host>/root?current=<ref>&last=<ref>. Response will be 200 on success, 409 if current is outdated, 422 if the server's hooks rejected a commit.
 	bhcs.Flush()
 
 	res := bhcs.requestRoot("POST", current, last)
@@ -447,6 +460,8 @@ func (bhcs *httpBatchStore) UpdateRoot(current, last hash.Hash) bool {
 		return true
 	case http.StatusConflict:
 		return false
+	case http.StatusUnprocessableEntity:
+		panic(d.Wrap(CommitRejectedError{readErrorResponse(res)}))
 	default:
 		buf := bytes.Buffer{}
 		buf.ReadFrom(res.Body)
@@ -459,6 +474,123 @@ func (bhcs *httpBatchStore) UpdateRoot(current, last hash.Hash) bool {
 	}
 }
 
+// Commit asks the server to commit |commit|, which must have been written, to
+// the Dataset |datasetID|, merging with the merge.NamedPolicy() called
+// |policyName| if it isn't empty. It returns false if the server is too old
+// to do this, in which case the caller has to do it itself.
+func (bhcs *httpBatchStore) Commit(datasetID string, commit hash.Hash, policyName string) (ok bool, err error) {
+	// POST http://<host>/commit?ds=<id>&commit=<ref>&policy=<name>. Response will be 200 on success, 409 with the error if the commit couldn't be made, 422 with the reason if the server's hooks rejected it.
+	bhcs.Flush()
+
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.CommitPath)
+	params := u.Query()
+	params.Add("ds", datasetID)
+	params.Add("commit", commit.String())
+	if policyName != "" {
+		params.Add("policy", policyName)
+	}
+	u.RawQuery = params.Encode()
+	res, err := bhcs.httpClient.Do(newRequest("POST", bhcs.auth, u.String(), nil, nil))
+	d.PanicIfError(err)
+	defer closeResponse(res.Body)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		expectVersion(res)
+		return true, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return false, nil
+	case http.StatusUnprocessableEntity:
+		expectVersion(res)
+		return true, CommitRejectedError{readErrorResponse(res)}
+	case http.StatusConflict:
+		expectVersion(res)
+		msg := readErrorResponse(res)
+		for _, known := range []error{ErrMergeNeeded, ErrTagImmutable} {
+			if msg == known.Error() {
+				return true, known
+			}
+		}
+		return true, errors.New(msg)
+	default:
+		expectVersion(res)
+		d.Panic("Unexpected response: %s", formatErrorResponse(res))
+		return
+	}
+}
+
+// WatchHead calls |send| with each head of the Dataset |datasetID| that the
+// server streams from its watch/ endpoint, reconnecting if the connection is
+// lost, until send returns false or |closed| is closed. It returns false
+// straight away if the server is too old to have the endpoint.
+func (bhcs *httpBatchStore) WatchHead(datasetID string, closed <-chan struct{}, send func(head hash.Hash) bool) bool {
+	// GET http://<host>/watch?ds=<id>. Response will be a stream of server-sent events, each with the hash of the head as its data.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.WatchPath)
+	params := u.Query()
+	params.Add("ds", datasetID)
+	u.RawQuery = params.Encode()
+	for {
+		res, err := bhcs.httpClient.Do(newRequest("GET", bhcs.auth, u.String(), nil, nil).WithContext(ctx))
+		if err == nil {
+			switch res.StatusCode {
+			case http.StatusOK:
+				expectVersion(res)
+				scanner := bufio.NewScanner(res.Body)
+				for scanner.Scan() {
+					if line := scanner.Text(); strings.HasPrefix(line, "data: ") && !send(hash.Parse(line[len("data: "):])) {
+						closeResponse(res.Body)
+						return true
+					}
+				}
+				closeResponse(res.Body)
+			case http.StatusNotFound, http.StatusMethodNotAllowed:
+				closeResponse(res.Body)
+				return false
+			default:
+				expectVersion(res)
+				d.Panic("Unexpected response: %s", formatErrorResponse(res))
+			}
+		}
+		// The connection was lost, so try again after a while. The server starts by sending the current head, so nothing is missed.
+		select {
+		case <-time.After(watchInterval):
+		case <-closed:
+			return true
+		}
+	}
+}
+
+// RootLog fetches the root log of the backing ChunkStore. It panics if the
+// server doesn't keep one.
+func (bhcs *httpBatchStore) RootLog() []chunks.RootLogEntry {
+	// GET http://<host>/rootlog. Response will be the log, one entry per line.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.RootLogPath)
+	res, err := bhcs.httpClient.Do(newRequest("GET", bhcs.auth, u.String(), nil, nil))
+	d.PanicIfError(err)
+	expectVersion(res)
+	defer closeResponse(res.Body)
+
+	if http.StatusOK != res.StatusCode {
+		d.Panic("Unexpected response: %s", formatErrorResponse(res))
+	}
+	entries, err := chunks.ReadRootLog(res.Body)
+	d.PanicIfError(err)
+	return entries
+}
+
 func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash) *http.Response {
 	u := *bhcs.host
 	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.RootPath)
@@ -490,11 +622,22 @@ func newRequest(method, auth, url string, body io.Reader, header http.Header) *h
 		}
 	}
 	if auth != "" {
+		if !strings.Contains(auth, " ") {
+			// A bare token, rather than <scheme> <credentials>.
+			auth = "Bearer " + auth
+		}
 		req.Header.Set("Authorization", auth)
 	}
 	return req
 }
 
+// readErrorResponse returns the message in the body of an error response.
+func readErrorResponse(res *http.Response) string {
+	data, err := ioutil.ReadAll(res.Body)
+	d.PanicIfError(err)
+	return strings.TrimSpace(string(data))
+}
+
 func formatErrorResponse(res *http.Response) string {
 	data, err := ioutil.ReadAll(res.Body)
 	d.Chk.NoError(err)
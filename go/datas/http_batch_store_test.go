@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/attic-labs/noms/go/chunks"
@@ -84,6 +85,12 @@ func NewHTTPBatchStoreForTest(cs chunks.ChunkStore) *httpBatchStore {
 			HandleRootGet(w, req, ps, cs)
 		},
 	)
+	serv.GET(
+		constants.RootLogPath,
+		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			HandleRootLogGet(w, req, ps, cs)
+		},
+	)
 	hcs := NewHTTPBatchStore("http://localhost:9000", "")
 	hcs.httpClient = serv
 	return hcs
@@ -261,6 +268,28 @@ func (suite *HTTPBatchStoreSuite) TestUpdateRootWithParams() {
 	suite.Equal(c.Hash(), suite.cs.Root())
 }
 
+func (suite *HTTPBatchStoreSuite) TestRootLog() {
+	// TestStore doesn't keep a root log.
+	suite.Panics(func() { suite.store.RootLog() })
+
+	dir, err := ioutil.TempDir("", "")
+	suite.NoError(err)
+	defer os.RemoveAll(dir)
+	cs := chunks.NewLevelDBStore(dir, "", 24, false)
+	defer cs.Close()
+	store := NewHTTPBatchStoreForTest(cs)
+	defer store.Close()
+
+	c := types.EncodeValue(types.NewMap(), nil)
+	cs.Put(c)
+	suite.True(store.UpdateRoot(c.Hash(), hash.Hash{}))
+	entries := store.RootLog()
+	if suite.Len(entries, 1) {
+		suite.Equal(hash.Hash{}, entries[0].Previous)
+		suite.Equal(c.Hash(), entries[0].Root)
+	}
+}
+
 func (suite *HTTPBatchStoreSuite) TestGet() {
 	chnx := []chunks.Chunk{
 		chunks.NewChunk([]byte("abc")),
@@ -125,6 +125,24 @@ func (lbs *localBatchStore) Flush() {
 	lbs.hints = types.Hints{}
 }
 
+// WriteIncomplete validates each of |chunx| and writes it to the backing ChunkStore, without checking that the chunks it refers to are present. It's used by pulls that checkpoint their progress, which write chunks before those they refer to have been copied.
+func (lbs *localBatchStore) WriteIncomplete(chunx []chunks.Chunk) {
+	lbs.once.Do(lbs.expectVersion)
+
+	var bpe chunks.BackpressureError
+	for i := 0; i < len(chunx) && bpe == nil; i++ {
+		if dc := lbs.vbs.DecodeUnqueued(&chunx[i]); dc.Chunk != nil {
+			bpe = lbs.vbs.EnqueueIncomplete(*dc.Chunk, *dc.Value)
+		}
+	}
+	if bpe == nil {
+		bpe = lbs.vbs.Flush()
+	}
+	if bpe != nil {
+		d.PanicIfError(bpe)
+	}
+}
+
 // FlushAndDestroyWithoutClose flushes lbs and destroys its cache of unwritten chunks. It's needed because LocalDatabase wraps a localBatchStore around a ChunkStore that's used by a separate BatchStore, so calling Close() on one is semantically incorrect while it still wants to use the other.
 func (lbs *localBatchStore) FlushAndDestroyWithoutClose() {
 	lbs.Flush()
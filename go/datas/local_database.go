@@ -6,6 +6,7 @@ package datas
 
 import (
 	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
 	"github.com/attic-labs/noms/go/types"
 )
 
@@ -17,7 +18,7 @@ type LocalDatabase struct {
 }
 
 func newLocalDatabase(cs chunks.ChunkStore) *LocalDatabase {
-	bs := types.NewBatchStoreAdaptor(cs)
+	bs := newShallowBatchStore(cs)
 	return &LocalDatabase{
 		newDatabaseCommon(newCachingChunkHaver(cs), types.NewValueStore(bs), bs),
 		cs,
@@ -32,7 +33,7 @@ func (ldb *LocalDatabase) GetDataset(datasetID string) Dataset {
 func (ldb *LocalDatabase) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
 	return ldb.doHeadUpdate(
 		ds,
-		func(ds Dataset) error { return ldb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy) },
+		func(ds Dataset) error { return ldb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.policy()) },
 	)
 }
 
@@ -52,13 +53,30 @@ func (ldb *LocalDatabase) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset
 	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doFastForward(ds, newHeadRef) })
 }
 
+func (ldb *LocalDatabase) swapHead(ds Dataset, oldHeadRef, newHeadRef types.Ref) (Dataset, error) {
+	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doSwapHead(ds, oldHeadRef, newHeadRef) })
+}
+
+func (ldb *LocalDatabase) Tag(name string, commitRef types.Ref) (Dataset, error) {
+	return ldb.doHeadUpdate(Dataset{store: ldb, id: TagID(name)}, func(ds Dataset) error { return ldb.doTag(name, commitRef) })
+}
+
 func (ldb *LocalDatabase) doHeadUpdate(ds Dataset, updateFunc func(ds Dataset) error) (Dataset, error) {
 	if ldb.vbs != nil {
 		ldb.vbs.FlushAndDestroyWithoutClose()
 		ldb.vbs = nil
 	}
-	err := updateFunc(ds)
-	return ldb.GetDataset(ds.ID()), err
+	return ldb.updated(ldb, ds.ID(), updateFunc(ds))
+}
+
+func (ldb *LocalDatabase) watch(datasetID string) <-chan Dataset {
+	return ldb.databaseCommon.watch(ldb, datasetID, func(datasetID string, closed <-chan struct{}, send func(head hash.Hash) bool) {
+		root := ldb.watchers.root
+		if rr, ok := ldb.cs.(chunks.RootRefresher); ok {
+			root = rr.RefreshRoot
+		}
+		pollHead(ldb, root, datasetID, closed, send)
+	})
 }
 
 func (ldb *LocalDatabase) validatingBatchStore() types.BatchStore {
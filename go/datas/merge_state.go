@@ -0,0 +1,32 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MergeStatePrefix is prepended to the ID of a Dataset to form the ID of the
+// Dataset that holds the state of an unfinished merge into it, e.g. the
+// conflicts recorded by noms merge. Like TagPrefix, it can't begin the name
+// of an ordinary Dataset, so merge states can't collide with those.
+const MergeStatePrefix = "merge-state:"
+
+// MergeStateIDRe is a regexp that matches the ID of a merge state Dataset
+// anywhere within the target string.
+var MergeStateIDRe = regexp.MustCompile(MergeStatePrefix + DatasetRe.String())
+
+// MergeStateID returns the ID of the Dataset that holds the state of an
+// unfinished merge into the Dataset |datasetID|.
+func MergeStateID(datasetID string) string {
+	return MergeStatePrefix + datasetID
+}
+
+// IsMergeState returns true if |datasetID| names the state of a merge rather
+// than an ordinary Dataset.
+func IsMergeState(datasetID string) bool {
+	return strings.HasPrefix(datasetID, MergeStatePrefix)
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
 	"github.com/attic-labs/noms/go/types"
@@ -51,6 +52,17 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		sinkQ.PopBack()
 	}
 
+	hints := pull(srcDB, sinkDB, srcQ, sinkQ, sinkHeadRef, concurrency, progressCh, nil, nil)
+	sinkDB.validatingBatchStore().AddHints(hints)
+}
+
+// pull does the work of Pull() and ResumablePull(), copying every chunk
+// reachable from the refs in srcQ that isn't already in sinkDB, and returns
+// hints for validating the chunks it wrote. If |cp| is nil, chunks are written via
+// sinkDB's validating BatchStore. Otherwise, they're handed to |cp|, which is
+// given the chance to checkpoint after each round of work. If |f| isn't nil,
+// it decides which of the refs in the chunks read are followed.
+func pull(srcDB, sinkDB Database, srcQ, sinkQ *types.RefByHeight, sinkHeadRef types.Ref, concurrency int, progressCh chan PullProgress, cp *pullCheckpointer, f *pullFilter) types.Hints {
 	// Since we expect sinkHeadRef to descend from sourceRef, we assume srcDB has a superset of the data in sinkDB. There are some cases where, logically, the code wants to read data it knows to be in sinkDB. In this case, it doesn't actually matter which Database the data comes from, so as an optimization we use whichever is a LocalDatabase -- if either is.
 	mostLocalDB := srcDB
 	if _, ok := sinkDB.(*LocalDatabase); ok {
@@ -90,7 +102,7 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 					// There's no immediately observable performance benefit to sampling here, but there's
 					// also no appreciable loss in accuracy, so we'll keep it around.
 					takeSample := rand.Float64() < bytesWrittenSampleRate
-					srcResChan <- traverseSource(srcRef, srcDB, sinkDB, takeSample)
+					srcResChan <- traverseSource(srcRef, srcDB, sinkDB, takeSample, cp != nil)
 				case sinkRef := <-sinkChan:
 					sinkResChan <- traverseSink(sinkRef, mostLocalDB)
 				case comRef := <-comChan:
@@ -137,6 +149,10 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 			select {
 			case res := <-srcResChan:
 				for _, reachable := range res.reachables {
+					if f != nil && !f.follow(res.readHash, reachable) {
+						f.prune(reachable, res.ref)
+						continue
+					}
 					srcQ.PushBack(reachable)
 					reachableChunks.Insert(reachable.TargetHash())
 				}
@@ -147,6 +163,9 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 				if !res.readHash.IsEmpty() {
 					reachableChunks.Remove(res.readHash)
 				}
+				if !res.chunk.IsEmpty() {
+					cp.add(res.chunk, res.ref)
+				}
 				srcWork--
 
 				updateProgress(1, 0, uint64(res.readBytes), sampleSize/uint64(math.Max(1, float64(sampleCount))))
@@ -173,6 +192,9 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		sort.Sort(srcQ)
 		sinkQ.Unique()
 		srcQ.Unique()
+		if cp != nil && cp.due() {
+			cp.save(*srcQ)
+		}
 	}
 
 	hints := types.Hints{}
@@ -181,7 +203,7 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 			hints[hint] = struct{}{}
 		}
 	}
-	sinkDB.validatingBatchStore().AddHints(hints)
+	return hints
 }
 
 type traverseResult struct {
@@ -193,6 +215,8 @@ type traverseResult struct {
 type traverseSourceResult struct {
 	traverseResult
 	writeBytes int
+	chunk      chunks.Chunk // set only if the chunk was read but not written
+	ref        types.Ref
 }
 
 // planWork deals with three possible situations:
@@ -256,7 +280,10 @@ func getChunks(v types.Value) (chunks []types.Ref) {
 	return
 }
 
-func traverseSource(srcRef types.Ref, srcDB, sinkDB Database, estimateBytesWritten bool) traverseSourceResult {
+// traverseSource copies the chunk srcRef points to from srcDB to sinkDB,
+// unless sinkDB already has it. If |keepChunk| is
+// true, the chunk is returned in the result for the caller to write instead.
+func traverseSource(srcRef types.Ref, srcDB, sinkDB Database, estimateBytesWritten bool, keepChunk bool) traverseSourceResult {
 	h := srcRef.TargetHash()
 	if !sinkDB.has(h) {
 		srcBS := srcDB.validatingBatchStore()
@@ -265,14 +292,19 @@ func traverseSource(srcRef types.Ref, srcDB, sinkDB Database, estimateBytesWritt
 		if v == nil {
 			d.Panic("Expected decoded chunk to be non-nil.")
 		}
-		sinkDB.validatingBatchStore().SchedulePut(c, srcRef.Height(), types.Hints{})
+		if !keepChunk {
+			sinkDB.validatingBatchStore().SchedulePut(c, srcRef.Height(), types.Hints{})
+		}
 		bytesWritten := 0
 		if estimateBytesWritten {
 			// TODO: Probably better to hide this behind the BatchStore abstraction since
 			// write size is implementation specific.
 			bytesWritten = len(snappy.Encode(nil, c.Data()))
 		}
-		ts := traverseSourceResult{traverseResult{h, getChunks(v), len(c.Data())}, bytesWritten}
+		ts := traverseSourceResult{traverseResult{h, getChunks(v), len(c.Data())}, bytesWritten, chunks.EmptyChunk, srcRef}
+		if keepChunk {
+			ts.chunk = c
+		}
 		return ts
 	}
 	return traverseSourceResult{}
@@ -0,0 +1,255 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// PullCheckpointPrefix is prepended to a hash of the source Ref and options
+// of an unfinished ResumablePull() or ShallowPull() to form the key under
+// which the sink's root Map holds its checkpoint. The key is removed once the
+// pull completes. Like PrunedRefsKey, it isn't a legal Dataset ID, and
+// checkpoints are left out of Datasets(), so they can't be read or written as
+// Datasets, and the hooks of a Database aren't run when they change.
+const PullCheckpointPrefix = "pull-checkpoint:"
+
+// IsPullCheckpoint returns true if |key| is the key of the checkpoint of a
+// pull in the root Map of a Database.
+func IsPullCheckpoint(key string) bool {
+	return strings.HasPrefix(key, PullCheckpointPrefix)
+}
+
+const (
+	pullCheckpointName = "PullCheckpoint"
+	frontierField      = "frontier"
+	pendingField       = "pending"
+	prunedField        = "pruned"
+)
+
+// pullCheckpointBytes is roughly how much chunk data ResumablePull() buffers
+// in memory between checkpoints.
+var pullCheckpointBytes = uint64(1 << 26) // 64MB
+
+// ResumablePull is like PullWithFlush(), but it checkpoints its progress into
+// sinkDB as it goes, so that if it is interrupted, calling it again with the
+// same sourceRef carries on from the last checkpoint instead of starting
+// over. Chunks that a previous attempt wrote are recognized by checking
+// sinkDB for them, so neither graph needs to be re-walked. As with Pull(),
+// sinkHeadRef is used to find the chunks that sinkDB already has.
+//
+// Checkpoints can only be written to a database for which CanCheckpoint()
+// is true; for any other sinkDB ResumablePull just calls PullWithFlush().
+// Chunks copied by ResumablePull() are validated as they're written, but
+// since a checkpoint can be written before the chunks they refer to have been
+// copied, those are not checked for, the way they are by Pull().
+func ResumablePull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency int, progressCh chan PullProgress) {
+	if !CanCheckpoint(sinkDB) {
+		PullWithFlush(srcDB, sinkDB, sourceRef, sinkHeadRef, concurrency, progressCh)
+		return
+	}
+	ShallowPull(srcDB, sinkDB, sourceRef, sinkHeadRef, ShallowOptions{}, concurrency, progressCh)
+}
+
+// CanCheckpoint returns whether ResumablePull() can checkpoint its progress
+// into |db|, which is only true of a LocalDatabase. Pulls into any other
+// database start over if they're interrupted.
+func CanCheckpoint(db Database) bool {
+	_, ok := db.(*LocalDatabase)
+	return ok
+}
+
+// ShallowPull is like ResumablePull(), but copies only the parts of the graph
+// that |opts| selects. The refs it doesn't follow are recorded in the sink
+// under PrunedRefsKey, so that reading them fails with a ShallowError, and so
+// that a later pull that selects more of the graph fills them in. sinkDB must
+// be a LocalDatabase.
+func ShallowPull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, opts ShallowOptions, concurrency int, progressCh chan PullProgress) {
+	ldb, ok := sinkDB.(*LocalDatabase)
+	if !ok {
+		d.Panic("Shallow pulls can only be made into a local database")
+	}
+
+	f := newPullFilter(srcDB, sourceRef, opts)
+	old := readPrunedRefs(ldb.root(), ldb)
+	cp := newPullCheckpointer(ldb, sourceRef, opts, f)
+	srcQ := &types.RefByHeight{}
+	if frontier, pending, resuming := cp.load(); resuming {
+		*srcQ = types.RefByHeight(append(frontier, pending...))
+	} else {
+		if !sinkDB.has(sourceRef.TargetHash()) {
+			srcQ.PushBack(sourceRef)
+		}
+		// Earlier shallow pulls of commits that this one copies may have left out parts of the graph that it wants.
+		if len(old) > 0 {
+			roots := commitsToDepth(srcDB, sourceRef, opts.Depth)
+			for _, p := range old {
+				if roots.Has(p.root.TargetHash()) && f.follow(p.parent.TargetHash(), p.ref) && srcDB.has(p.ref.TargetHash()) {
+					srcQ.PushBack(p.ref)
+				}
+			}
+		}
+		if srcQ.Empty() {
+			return
+		}
+	}
+	sort.Sort(srcQ)
+	srcQ.Unique()
+
+	// Like Pull(), walk down from sinkHeadRef to find the parts of the graph the sink already has, unless some of the sink's graph was left out by a shallow pull.
+	sinkQ := &types.RefByHeight{}
+	if opts.IsZero() && len(old) == 0 && !sinkHeadRef.TargetHash().IsEmpty() && srcDB.has(sinkHeadRef.TargetHash()) {
+		sinkQ.PushBack(sinkHeadRef)
+	}
+	pull(srcDB, sinkDB, srcQ, sinkQ, sinkHeadRef, concurrency, progressCh, cp, f)
+	cp.finish(old)
+}
+
+// pullCheckpointer buffers the chunks copied by ResumablePull() and
+// periodically writes them, along with a checkpoint, to the sink.
+//
+// A checkpoint records the refs that remain to be pulled (the frontier), the
+// refs of the chunks that are about to be written (pending) and the refs
+// that have been pruned so far. It is committed before the pending chunks
+// are written, so that if the pull is interrupted part way through writing
+// them, the resumed pull re-queues the pending chunks and picks up whichever
+// of them didn't make it. Everything reachable from a chunk in the sink is
+// then either in the sink too, pruned, or in the resumed pull's queue.
+type pullCheckpointer struct {
+	db            *LocalDatabase
+	source        types.Ref
+	f             *pullFilter
+	key           string
+	buffered      []chunks.Chunk
+	bufferedRefs  types.RefSlice
+	bufferedBytes uint64
+}
+
+func newPullCheckpointer(db *LocalDatabase, source types.Ref, opts ShallowOptions, f *pullFilter) *pullCheckpointer {
+	key := source.TargetHash()
+	if !opts.IsZero() {
+		key = hash.Of([]byte(fmt.Sprintf("%s %d %s", source.TargetHash(), opts.Depth, opts.Path)))
+	}
+	return &pullCheckpointer{db: db, source: source, f: f, key: PullCheckpointPrefix + key.String()}
+}
+
+// load returns the frontier and pending refs of the checkpoint left by an
+// earlier attempt at the same pull, and adds the refs it had pruned to cp.f.
+// It ignores checkpoints whose chunks are no longer in the sink, e.g. because
+// they have been garbage collected.
+func (cp *pullCheckpointer) load() (frontier, pending types.RefSlice, ok bool) {
+	r, ok := cp.db.rootEntry(cp.key)
+	if !ok {
+		return nil, nil, false
+	}
+	s, ok := cp.db.validateRefAsCommit(r).Get(ValueField).(types.Struct)
+	if !ok || s.Type().Desc.(types.StructDesc).Name != pullCheckpointName {
+		d.Panic("%s does not hold a %s", cp.key, pullCheckpointName)
+	}
+	frontier = decodeRefs(s.Get(frontierField).(types.Blob))
+	pending = decodeRefs(s.Get(pendingField).(types.Blob))
+
+	if !cp.db.has(cp.source.TargetHash()) {
+		// The source chunk is written first, so it can only be missing if the checkpoint still has it queued.
+		found := false
+		for _, r := range append(frontier, pending...) {
+			found = found || r.Equals(cp.source)
+		}
+		if !found {
+			return nil, nil, false
+		}
+	}
+	cp.f.pruned.decode(s.Get(prunedField).(types.Blob))
+	return frontier, pending, true
+}
+
+func (cp *pullCheckpointer) add(c chunks.Chunk, r types.Ref) {
+	cp.buffered = append(cp.buffered, c)
+	cp.bufferedRefs = append(cp.bufferedRefs, r)
+	cp.bufferedBytes += uint64(len(c.Data()))
+}
+
+func (cp *pullCheckpointer) due() bool {
+	return cp.bufferedBytes >= pullCheckpointBytes
+}
+
+// save commits a checkpoint with the given frontier and the buffered chunks
+// as pending, and then writes the buffered chunks.
+func (cp *pullCheckpointer) save(frontier types.RefByHeight) {
+	checkpoint := types.NewStruct(pullCheckpointName, types.StructData{
+		frontierField: encodeRefs(cp.db, types.RefSlice(frontier)),
+		pendingField:  encodeRefs(cp.db, cp.bufferedRefs),
+		prunedField:   cp.f.pruned.encode(cp.db),
+	})
+	d.PanicIfError(cp.db.setRootEntry(cp.key, cp.db.WriteValue(NewCommit(checkpoint, types.NewSet(), types.EmptyStruct)), false))
+
+	cp.db.validatingBatchStore().(*localBatchStore).WriteIncomplete(cp.buffered)
+	for _, c := range cp.buffered {
+		// The sink will have been asked about c before it was pulled, and mustn't go on thinking it's missing.
+		setCache(cp.db.cch, c.Hash(), true)
+	}
+	cp.buffered, cp.bufferedRefs, cp.bufferedBytes = nil, nil, 0
+}
+
+// finish writes any remaining buffered chunks, updates the sink's record of
+// pruned refs, which was |old| when the pull started, and removes the
+// checkpoint. Updating the sink's root makes all of the chunks durable.
+func (cp *pullCheckpointer) finish(old prunedRefs) {
+	if len(cp.buffered) > 0 {
+		cp.save(nil)
+	}
+
+	pruned := prunedRefs{}
+	for _, refs := range []prunedRefs{old, cp.f.pruned} {
+		for h, p := range refs {
+			if !cp.db.cs.Has(h) {
+				pruned[h] = p
+			}
+		}
+	}
+	if len(pruned) > 0 || len(old) > 0 {
+		writePrunedRefs(cp.db, pruned)
+	}
+
+	if _, ok := cp.db.rootEntry(cp.key); ok {
+		d.PanicIfError(cp.db.setRootEntry(cp.key, types.Ref{}, true))
+	}
+}
+
+// encodeRefs writes |refs| into a Blob in vrw. The targets of the refs
+// needn't be present, which wouldn't be allowed if they were stored as a
+// List<Ref>.
+func encodeRefs(vrw types.ValueReadWriter, refs types.RefSlice) types.Blob {
+	buf := &bytes.Buffer{}
+	for _, r := range refs {
+		chunks.Serialize(types.EncodeValue(r, nil), buf)
+	}
+	return types.NewStreamingBlob(vrw, buf)
+}
+
+func decodeRefs(b types.Blob) (refs types.RefSlice) {
+	chunkChan := make(chan *chunks.Chunk, 16)
+	var err error
+	go func() {
+		defer close(chunkChan)
+		err = chunks.Deserialize(b.Reader(), chunkChan)
+	}()
+	for c := range chunkChan {
+		refs = append(refs, types.DecodeValue(*c, nil).(types.Ref))
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		d.PanicIfError(err)
+	}
+	return
+}
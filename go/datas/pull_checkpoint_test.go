@@ -0,0 +1,227 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// crashingStore panics once it has been asked to Put() |putsLeft| chunks,
+// to simulate a process dying part way through a pull.
+type crashingStore struct {
+	*chunks.TestStore
+	putsLeft int
+}
+
+func (s *crashingStore) Put(c chunks.Chunk) {
+	if s.putsLeft == 0 {
+		panic("crash")
+	}
+	s.putsLeft--
+	s.TestStore.Put(c)
+}
+
+func (s *crashingStore) PutMany(chunks []chunks.Chunk) (e chunks.BackpressureError) {
+	for _, c := range chunks {
+		s.Put(c)
+	}
+	return
+}
+
+func withPullCheckpointBytes(n uint64, f func()) {
+	old := pullCheckpointBytes
+	pullCheckpointBytes = n
+	defer func() { pullCheckpointBytes = old }()
+	f()
+}
+
+// assertComplete checks that every chunk reachable from |r| is in |db|.
+func assertComplete(assert *assert.Assertions, db Database, r types.Ref) {
+	seen := hash.HashSet{}
+	q := types.RefSlice{r}
+	for len(q) > 0 {
+		r, q = q[0], q[1:]
+		if seen.Has(r.TargetHash()) {
+			continue
+		}
+		seen.Insert(r.TargetHash())
+		v := db.ReadValue(r.TargetHash())
+		if !assert.NotNil(v, "missing chunk %s", r.TargetHash()) {
+			return
+		}
+		q = append(q, getChunks(v)...)
+	}
+}
+
+func TestResumablePull(t *testing.T) {
+	assert := assert.New(t)
+	source := NewDatabase(chunks.NewTestStore())
+	defer source.Close()
+	ds, err := source.CommitValue(source.GetDataset(datasetID), buildListOfHeight(6, source))
+	assert.NoError(err)
+	sourceRef := ds.HeadRef()
+
+	sinkCS := chunks.NewTestStore()
+	sink := NewDatabase(sinkCS)
+	defer sink.Close()
+	withPullCheckpointBytes(1, func() {
+		ResumablePull(source, sink, sourceRef, types.Ref{}, 2, nil)
+	})
+	assertComplete(assert, sink, sourceRef)
+	assert.Equal(uint64(0), sink.Datasets().Len())
+}
+
+func TestResumablePullAfterCrash(t *testing.T) {
+	assert := assert.New(t)
+	sourceCS := chunks.NewTestStore()
+	source := NewDatabase(sourceCS)
+	defer source.Close()
+	ds, err := source.CommitValue(source.GetDataset(datasetID), buildListOfHeight(6, source))
+	assert.NoError(err)
+	sourceRef := ds.HeadRef()
+	sourceCS.Reads = 0
+
+	sinkCS := chunks.NewTestStore()
+	withPullCheckpointBytes(1, func() {
+		ResumablePull(source, NewDatabase(sinkCS), sourceRef, types.Ref{}, 2, nil)
+	})
+	fullReads, fullWrites := sourceCS.Reads, sinkCS.Writes
+
+	// Crash after every possible number of writes, and check that resuming always finishes the job, and doesn't always start over.
+	resumedPart := false
+	for puts := 0; puts < fullWrites; puts++ {
+		sinkCS := chunks.NewTestStore()
+		withPullCheckpointBytes(1, func() {
+			sink := NewDatabase(&crashingStore{sinkCS, puts})
+			assert.Panics(func() { ResumablePull(source, sink, sourceRef, types.Ref{}, 2, nil) })
+		})
+
+		sourceCS.Reads = 0
+		sink := NewDatabase(sinkCS)
+		withPullCheckpointBytes(1, func() {
+			ResumablePull(source, sink, sourceRef, types.Ref{}, 2, nil)
+		})
+		resumedPart = resumedPart || sourceCS.Reads < fullReads
+		assertComplete(assert, sink, sourceRef)
+		assert.Equal(uint64(0), sink.Datasets().Len())
+		sink.Close()
+	}
+	assert.True(resumedPart)
+}
+
+// corruptingStore returns a chunk holding the wrong data for |bad|.
+type corruptingStore struct {
+	*chunks.TestStore
+	bad hash.Hash
+}
+
+func (s *corruptingStore) Get(h hash.Hash) chunks.Chunk {
+	if h == s.bad {
+		return chunks.NewChunkWithHash(h, types.EncodeValue(types.String("corrupt"), nil).Data())
+	}
+	return s.TestStore.Get(h)
+}
+
+func TestResumablePullValidates(t *testing.T) {
+	assert := assert.New(t)
+	sourceCS := chunks.NewTestStore()
+	source := NewDatabase(sourceCS)
+	defer source.Close()
+	ds, err := source.CommitValue(source.GetDataset(datasetID), buildListOfHeight(6, source))
+	assert.NoError(err)
+	bad := types.Number(2).Hash()
+
+	sinkCS := chunks.NewTestStore()
+	sink := NewDatabase(sinkCS)
+	defer sink.Close()
+	withPullCheckpointBytes(1, func() {
+		corrupt := NewDatabase(&corruptingStore{sourceCS, bad})
+		assert.Panics(func() { ResumablePull(corrupt, sink, ds.HeadRef(), types.Ref{}, 2, nil) })
+	})
+	assert.False(sinkCS.Has(bad))
+}
+
+func TestPullCheckpointsAreNotDatasets(t *testing.T) {
+	assert := assert.New(t)
+	source := NewDatabase(chunks.NewTestStore())
+	defer source.Close()
+	ds, err := source.CommitValue(source.GetDataset(datasetID), buildListOfHeight(6, source))
+	assert.NoError(err)
+
+	// Checkpoints have no meta, so they'd be rejected if they were validated like commits to Datasets.
+	committed := []string{}
+	addHooks := func(db Database) {
+		db.Hooks().AddValidator(MetaFieldValidator("author"))
+		db.Hooks().AddCallback(func(ds Dataset) { committed = append(committed, ds.ID()) })
+	}
+	checkpoints := func(cs chunks.ChunkStore, db Database) []types.Value {
+		return reservedEntries(db.ReadValue(cs.Root()).(types.Map), PullCheckpointPrefix)
+	}
+
+	sinkCS := chunks.NewTestStore()
+	withPullCheckpointBytes(1, func() {
+		sink := NewDatabase(&crashingStore{sinkCS, 10})
+		addHooks(sink)
+		assert.Panics(func() { ResumablePull(source, sink, ds.HeadRef(), types.Ref{}, 2, nil) })
+	})
+
+	sink := NewDatabase(sinkCS)
+	defer sink.Close()
+	addHooks(sink)
+	assert.Equal(uint64(0), sink.Datasets().Len())
+	kv := checkpoints(sinkCS, sink)
+	if !assert.Len(kv, 2) {
+		return
+	}
+	id := string(kv[0].(types.String))
+	assert.True(IsPullCheckpoint(id))
+	assert.False(IsValidDatasetName(id))
+
+	// Updating a Dataset leaves the checkpoint alone.
+	meta := types.NewStruct("Meta", types.StructData{"author": types.String("alice")})
+	_, err = sink.Commit(sink.GetDataset("other"), types.Number(1), CommitOptions{Meta: meta})
+	assert.NoError(err)
+	assert.Equal(kv, checkpoints(sinkCS, sink))
+
+	withPullCheckpointBytes(1, func() {
+		ResumablePull(source, sink, ds.HeadRef(), types.Ref{}, 2, nil)
+	})
+	assertComplete(assert, sink, ds.HeadRef())
+	assert.Empty(checkpoints(sinkCS, sink))
+	assert.Equal(uint64(1), sink.Datasets().Len())
+	assert.Equal([]string{"other"}, committed)
+}
+
+func TestResumablePullUsesSinkHead(t *testing.T) {
+	assert := assert.New(t)
+	source := NewDatabase(chunks.NewTestStore())
+	defer source.Close()
+	ds, err := source.CommitValue(source.GetDataset(datasetID), buildListOfHeight(6, source))
+	assert.NoError(err)
+	sinkHeadRef := ds.HeadRef()
+	ds, err = source.CommitValue(ds, buildListOfHeight(7, source))
+	assert.NoError(err)
+
+	// Walking down from the sink's head finds the chunks the sink already has without asking it about each of them.
+	pullHases := func(hint types.Ref) int {
+		sinkCS := chunks.NewTestStore()
+		sink := NewDatabase(sinkCS)
+		ResumablePull(source, sink, sinkHeadRef, types.Ref{}, 2, nil)
+		sink.Close()
+
+		sink = NewDatabase(sinkCS)
+		defer sink.Close()
+		sinkCS.Hases = 0
+		ResumablePull(source, sink, ds.HeadRef(), hint, 2, nil)
+		assertComplete(assert, sink, ds.HeadRef())
+		return sinkCS.Hases
+	}
+	assert.True(pullHases(sinkHeadRef) < pullHases(types.Ref{}))
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+)
+
+var (
+	ErrNoCommonAncestor   = errors.New("Dataset head and rebase target have no common ancestor")
+	ErrRebaseMergeCommit  = errors.New("Cannot rebase across a commit with more than one parent")
+	ErrRebaseHeadModified = errors.New("Dataset head moved during rebase")
+)
+
+// Rebase replays each Commit made to ds since its common ancestor with onto,
+// oldest first, on top of onto, and makes the last replayed Commit the new
+// Head of ds. This produces a linear history in place of the merge Commit
+// that FastForward() would otherwise require. Each replayed Commit keeps the
+// meta of the Commit it was made from, and its value is computed by using
+// policy to merge the current base with the original value, taking the
+// original parent's value as the common ancestor.
+//
+// If ds's Head is already an ancestor of onto, Rebase simply fast-forwards
+// ds; if onto is an ancestor of ds's Head, there is nothing to replay and ds
+// is returned unchanged. Rebase refuses to replay merge Commits, returning
+// ErrRebaseMergeCommit, and returns ErrRebaseHeadModified if the Head of ds
+// changes before the rebased Commits can be swapped in. On error, ds is
+// returned unchanged.
+func Rebase(db Database, ds Dataset, onto types.Ref, policy merge.Policy) (Dataset, error) {
+	headRef := ds.HeadRef()
+	if !IsRefOfCommitType(onto.Type()) {
+		d.Panic("Rebase() called on %s", onto.Type().Describe())
+	}
+
+	ancestorRef, ok := FindCommonAncestor(headRef, onto, db)
+	if !ok {
+		return ds, ErrNoCommonAncestor
+	}
+	if ancestorRef.TargetHash() == onto.TargetHash() {
+		return ds, nil
+	}
+	if ancestorRef.TargetHash() == headRef.TargetHash() {
+		return db.FastForward(ds, onto)
+	}
+
+	toReplay, err := commitsSince(headRef, ancestorRef, db)
+	if err != nil {
+		return ds, err
+	}
+
+	baseRef := onto
+	baseValue := onto.TargetValue(db).(types.Struct).Get(ValueField)
+	for i := len(toReplay) - 1; i >= 0; i-- {
+		commit := toReplay[i]
+		parentValue := singleParent(commit).TargetValue(db).(types.Struct).Get(ValueField)
+		merged, err := policy(baseValue, commit.Get(ValueField), parentValue, db, nil)
+		if err != nil {
+			return ds, err
+		}
+		newCommit := NewCommit(merged, types.NewSet(baseRef), commit.Get(MetaField).(types.Struct))
+		baseRef, baseValue = db.WriteValue(newCommit), merged
+	}
+
+	rebased, err := db.swapHead(ds, headRef, baseRef)
+	if err != nil {
+		return ds, err
+	}
+	return rebased, nil
+}
+
+// commitsSince returns the Commits reachable from head that descend from
+// ancestor, newest first. Every such Commit must have exactly one parent.
+func commitsSince(head, ancestor types.Ref, vr types.ValueReader) (commits []types.Struct, err error) {
+	for r := head; r.TargetHash() != ancestor.TargetHash(); {
+		commit := r.TargetValue(vr).(types.Struct)
+		if commit.Get(ParentsField).(types.Set).Len() != 1 {
+			return nil, ErrRebaseMergeCommit
+		}
+		commits = append(commits, commit)
+		r = singleParent(commit)
+	}
+	return commits, nil
+}
+
+func singleParent(commit types.Struct) types.Ref {
+	return commit.Get(ParentsField).(types.Set).First().(types.Ref)
+}
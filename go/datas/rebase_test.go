@@ -0,0 +1,139 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func commitWithMessage(assert *assert.Assertions, db Database, ds Dataset, v types.Value, msg string, parents ...types.Ref) Dataset {
+	meta := types.NewStruct("Meta", types.StructData{"message": types.String(msg)})
+	opts := CommitOptions{Meta: meta}
+	if len(parents) > 0 {
+		vals := make([]types.Value, len(parents))
+		for i, r := range parents {
+			vals[i] = r
+		}
+		opts.Parents = types.NewSet(vals...)
+	}
+	ds, err := db.Commit(ds, v, opts)
+	assert.NoError(err)
+	return ds
+}
+
+func TestRebase(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	kv := func(kvs ...string) types.Map {
+		vals := make([]types.Value, len(kvs))
+		for i, s := range kvs {
+			vals[i] = types.String(s)
+		}
+		return types.NewMap(vals...)
+	}
+
+	base := commitWithMessage(assert, db, db.GetDataset("base"), kv("a", "1"), "root")
+	master := commitWithMessage(assert, db, db.GetDataset("master"), kv("a", "1", "b", "2"), "add b", base.HeadRef())
+	feature := commitWithMessage(assert, db, db.GetDataset("feature"), kv("a", "1", "c", "3"), "add c", base.HeadRef())
+	feature = commitWithMessage(assert, db, feature, kv("a", "10", "c", "3"), "change a")
+
+	rebased, err := Rebase(db, feature, master.HeadRef(), merge.NewThreeWay(nil))
+	assert.NoError(err)
+	assert.True(kv("a", "10", "b", "2", "c", "3").Equals(rebased.HeadValue()))
+	assert.True(rebased.Head().Equals(db.GetDataset("feature").Head()))
+
+	// History is now linear: change a -> add c -> add b -> root.
+	messages := []string{}
+	for c := rebased.Head(); ; {
+		messages = append(messages, string(c.Get(MetaField).(types.Struct).Get("message").(types.String)))
+		parents := c.Get(ParentsField).(types.Set)
+		if parents.Len() == 0 {
+			break
+		}
+		assert.Equal(uint64(1), parents.Len())
+		c = parents.First().(types.Ref).TargetValue(db).(types.Struct)
+	}
+	assert.Equal([]string{"change a", "add c", "add b", "root"}, messages)
+
+	// Rebasing onto an ancestor does nothing.
+	again, err := Rebase(db, rebased, master.HeadRef(), merge.NewThreeWay(nil))
+	assert.NoError(err)
+	assert.True(rebased.HeadRef().Equals(again.HeadRef()))
+
+	// Rebasing a dataset that is behind fast-forwards it.
+	behind, err := Rebase(db, base, rebased.HeadRef(), merge.NewThreeWay(nil))
+	assert.NoError(err)
+	assert.True(rebased.HeadRef().Equals(behind.HeadRef()))
+}
+
+func TestRebaseConflict(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	base := commitWithMessage(assert, db, db.GetDataset("base"), types.NewMap(types.String("a"), types.Number(1)), "root")
+	master := commitWithMessage(assert, db, db.GetDataset("master"), types.NewMap(types.String("a"), types.Number(2)), "two", base.HeadRef())
+	feature := commitWithMessage(assert, db, db.GetDataset("feature"), types.NewMap(types.String("a"), types.Number(3)), "three", base.HeadRef())
+
+	rebased, err := Rebase(db, feature, master.HeadRef(), merge.NewThreeWay(nil))
+	assert.IsType(&merge.ErrMergeConflict{}, err)
+	assert.True(feature.HeadRef().Equals(rebased.HeadRef()))
+	assert.True(feature.HeadRef().Equals(db.GetDataset("feature").HeadRef()))
+
+	rebased, err = Rebase(db, feature, master.HeadRef(), merge.NewThreeWay(merge.Theirs))
+	assert.NoError(err)
+	assert.True(types.NewMap(types.String("a"), types.Number(3)).Equals(rebased.HeadValue()))
+}
+
+func TestRebaseRefusesMergeCommits(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	base := commitWithMessage(assert, db, db.GetDataset("base"), types.Number(1), "root")
+	other := commitWithMessage(assert, db, db.GetDataset("other"), types.Number(2), "other", base.HeadRef())
+	master := commitWithMessage(assert, db, db.GetDataset("master"), types.Number(3), "master", base.HeadRef())
+	feature := commitWithMessage(assert, db, db.GetDataset("feature"), types.Number(4), "merge", base.HeadRef(), other.HeadRef())
+
+	_, err := Rebase(db, feature, master.HeadRef(), merge.NewThreeWay(nil))
+	assert.Equal(ErrRebaseMergeCommit, err)
+
+	_, err = Rebase(db, feature, db.WriteValue(NewCommit(types.Number(5), types.NewSet(), types.EmptyStruct)), merge.NewThreeWay(nil))
+	assert.Equal(ErrNoCommonAncestor, err)
+}
+
+func TestRebaseHeadModified(t *testing.T) {
+	assert := assert.New(t)
+	storage := chunks.NewTestStore()
+	db := NewDatabase(storage)
+	defer db.Close()
+
+	base := commitWithMessage(assert, db, db.GetDataset("base"), types.NewMap(), "root")
+	master := commitWithMessage(assert, db, db.GetDataset("master"), types.NewMap(types.String("a"), types.Number(1)), "add a", base.HeadRef())
+	feature := commitWithMessage(assert, db, db.GetDataset("feature"), types.NewMap(types.String("b"), types.Number(2)), "add b", base.HeadRef())
+
+	// Another writer moves feature after the rebased Commits are validated, but before they're swapped in.
+	other := NewDatabase(storage)
+	defer other.Close()
+	var moved Dataset
+	db.Hooks().AddValidator(func(vr types.ValueReader, datasetID string, commit types.Struct) error {
+		if moved.ID() == "" {
+			moved = commitWithMessage(assert, other, other.GetDataset("feature"), types.Number(4), "moved")
+		}
+		return nil
+	})
+
+	rebased, err := Rebase(db, feature, master.HeadRef(), merge.NewThreeWay(nil))
+	assert.Equal(ErrRebaseHeadModified, err)
+	assert.True(feature.HeadRef().Equals(rebased.HeadRef()))
+	assert.True(moved.HeadRef().Equals(db.GetDataset("feature").HeadRef()))
+}
@@ -5,6 +5,11 @@
 package datas
 
 import (
+	"crypto/tls"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/merge"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/julienschmidt/httprouter"
 )
@@ -15,7 +20,14 @@ type RemoteDatabaseClient struct {
 }
 
 func NewRemoteDatabase(baseURL, auth string) *RemoteDatabaseClient {
-	httpBS := NewHTTPBatchStore(baseURL, auth)
+	return NewRemoteDatabaseTLS(baseURL, auth, nil)
+}
+
+// NewRemoteDatabaseTLS is like NewRemoteDatabase, but makes https
+// connections with |tlsConfig|, e.g. to trust a private CA, or to present a
+// client certificate.
+func NewRemoteDatabaseTLS(baseURL, auth string, tlsConfig *tls.Config) *RemoteDatabaseClient {
+	httpBS := NewHTTPBatchStoreTLS(baseURL, auth, tlsConfig)
 	return &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(httpBS), types.NewValueStore(httpBS), httpBS)}
 }
 
@@ -26,13 +38,55 @@ func (rdb *RemoteDatabaseClient) validatingBatchStore() types.BatchStore {
 	return hbs
 }
 
+// watch streams heads from the server's watch/ endpoint, or if the server is
+// too old to have one, polls its root.
+func (rdb *RemoteDatabaseClient) watch(datasetID string) <-chan Dataset {
+	return rdb.databaseCommon.watch(rdb, datasetID, func(datasetID string, closed <-chan struct{}, send func(head hash.Hash) bool) {
+		if !rdb.BatchStore().(*httpBatchStore).WatchHead(datasetID, closed, send) {
+			pollHead(rdb, rdb.rt.Root, datasetID, closed, send)
+		}
+	})
+}
+
 func (rdb *RemoteDatabaseClient) GetDataset(datasetID string) Dataset {
 	return getDataset(rdb, datasetID)
 }
 
+// Commit has the server make the commit, and do any merge that
+// opts.PolicyName asks for, unless opts.Policy is set or the server is too
+// old to do so, in which case the merge is done here.
 func (rdb *RemoteDatabaseClient) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
-	err := rdb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy)
-	return rdb.GetDataset(ds.ID()), err
+	commit := buildNewCommit(ds, v, opts)
+	if opts.Policy == nil && !IsTag(ds.ID()) {
+		if ok, err := rdb.doServerCommit(ds.ID(), commit, opts.PolicyName); ok {
+			return rdb.updated(rdb, ds.ID(), err)
+		}
+	}
+	return rdb.updated(rdb, ds.ID(), rdb.doCommit(ds.ID(), commit, opts.policy()))
+}
+
+// doServerCommit asks the server to commit |commit| to the dataset
+// |datasetID|, which saves retrying here when other writers update the Root
+// at the same time, and downloading what is needed to merge. It returns false
+// if the server can't do so.
+func (rdb *RemoteDatabaseClient) doServerCommit(datasetID string, commit types.Struct, policyName string) (bool, error) {
+	if policyName != "" {
+		_, err := merge.NamedPolicy(policyName)
+		d.PanicIfError(err)
+	}
+	// The server runs its own hooks, possibly on a merged commit, but commit had better be acceptable here too.
+	if err := rdb.hooks.validate(rdb, datasetID, commit); err != nil {
+		return true, err
+	}
+	// Writing commit needs its parents to be known to the ValueStore, which they usually are from being the heads of Datasets.
+	rdb.getRootAndDatasets()
+	commitRef := rdb.WriteValue(commit)
+	rdb.Flush(commitRef.TargetHash())
+	ok, err := rdb.BatchStore().(*httpBatchStore).Commit(datasetID, commitRef.TargetHash(), policyName)
+	if ok {
+		rdb.rootHash, rdb.datasets = rdb.rt.Root(), nil
+	}
+	return ok, err
 }
 
 func (rdb *RemoteDatabaseClient) CommitValue(ds Dataset, v types.Value) (Dataset, error) {
@@ -40,18 +94,23 @@ func (rdb *RemoteDatabaseClient) CommitValue(ds Dataset, v types.Value) (Dataset
 }
 
 func (rdb *RemoteDatabaseClient) Delete(ds Dataset) (Dataset, error) {
-	err := rdb.doDelete(ds.ID())
-	return rdb.GetDataset(ds.ID()), err
+	return rdb.updated(rdb, ds.ID(), rdb.doDelete(ds.ID()))
 }
 
 func (rdb *RemoteDatabaseClient) SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
-	err := rdb.doSetHead(ds, newHeadRef)
-	return rdb.GetDataset(ds.ID()), err
+	return rdb.updated(rdb, ds.ID(), rdb.doSetHead(ds, newHeadRef))
 }
 
 func (rdb *RemoteDatabaseClient) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
-	err := rdb.doFastForward(ds, newHeadRef)
-	return rdb.GetDataset(ds.ID()), err
+	return rdb.updated(rdb, ds.ID(), rdb.doFastForward(ds, newHeadRef))
+}
+
+func (rdb *RemoteDatabaseClient) swapHead(ds Dataset, oldHeadRef, newHeadRef types.Ref) (Dataset, error) {
+	return rdb.updated(rdb, ds.ID(), rdb.doSwapHead(ds, oldHeadRef, newHeadRef))
+}
+
+func (rdb *RemoteDatabaseClient) Tag(name string, commitRef types.Ref) (Dataset, error) {
+	return rdb.updated(rdb, TagID(name), rdb.doTag(name, commitRef))
 }
 
 func (f RemoteStoreFactory) CreateStore(ns string) Database {
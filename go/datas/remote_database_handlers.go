@@ -19,6 +19,7 @@ import (
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/merge"
 	"github.com/attic-labs/noms/go/ngql"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
@@ -80,6 +81,34 @@ var (
 	// format, and error responses.
 	HandleRootPost = createHandler(handleRootPost, true)
 
+	// HandleCommit is meant to handle HTTP POST requests to the commit/
+	// server endpoint. It commits the Commit whose hash is the "commit" query
+	// param, which must already have been written, to the Dataset whose ID is
+	// the "ds" query param, as Database.Commit() would. If the "policy" query
+	// param names a merge.NamedPolicy(), the Commit is merged with the
+	// Dataset's head if need be. Either way, the server retries if another
+	// writer updates the Root at the same time. The response is 200 on
+	// success, 409 with the error as its body if the Commit couldn't be made,
+	// e.g. because a merge was needed, or 422 with the reason as its body if
+	// the server's Hooks rejected it.
+	HandleCommit = createHandler(handleCommit, true)
+
+	// HandleWatch is meant to handle HTTP GET requests to the watch/ server
+	// endpoint. The response is a stream of server-sent events, whose data
+	// is the hash of the head of the Dataset whose ID is the "ds" query
+	// param, or an empty hash if it has none. The current head is sent
+	// straight away, and each new head within a second or so of the Root
+	// being updated. It doesn't check the version header, so that browsers
+	// can use EventSource.
+	HandleWatch = createHandler(handleWatch, false)
+
+	// HandleRootLogGet is meant to handle HTTP GET requests to the rootlog/
+	// server endpoint. The response body is the root log of the backing
+	// ChunkStore, oldest entry first, in the format written by
+	// chunks.WriteRootLog(). It is an error if the ChunkStore doesn't keep a
+	// root log.
+	HandleRootLogGet = createHandler(handleRootLogGet, true)
+
 	// HandleBaseGet is meant to handle HTTP GET requests to the / server
 	// endpoint. This is used to give a friendly message to users.
 	// TODO: Nice comment about what headers it expects/honors, payload
@@ -360,6 +389,19 @@ func handleRootGet(w http.ResponseWriter, req *http.Request, ps URLParams, rt ch
 	w.Header().Add("content-type", "text/plain")
 }
 
+func handleRootLogGet(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	if req.Method != "GET" {
+		d.Panic("Expected get method.")
+	}
+
+	rl, ok := cs.(chunks.RootLogger)
+	if !ok {
+		d.Panic("Database does not keep a root log")
+	}
+	w.Header().Add("content-type", "text/plain")
+	chunks.WriteRootLog(w, rl.RootLog())
+}
+
 func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
 	if req.Method != "POST" {
 		d.Panic("Expected post method.")
@@ -398,16 +440,102 @@ func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs c
 
 	// Ensure that proposed new Root is a Map and, if it has anything in it, that it's <String, <Ref<Commit>>
 
-	if m, ok := proposed.(types.Map); !ok {
+	m, ok := proposed.(types.Map)
+	if !ok {
 		d.Panic("Root of a Database must be a Map")
-	} else if !m.Empty() {
-		assertMapOfStringToRefOfCommit(m, datasets, vs)
+	}
+
+	hooks := requestHooks(req)
+	changed, err := checkRootChanges(m, datasets, vs, datasetAuthorizer(req), hooks)
+	if err != nil {
+		rce := err.(rootChangeError)
+		http.Error(w, rce.msg, rce.status)
+		return
 	}
 
 	if !cs.UpdateRoot(current, last) {
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
+
+	if len(changed) > 0 {
+		db := newLocalDatabase(cs)
+		for _, ds := range changed {
+			hooks.committed(db.GetDataset(ds))
+		}
+	}
+}
+
+func handleCommit(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	if req.Method != "POST" {
+		d.Panic("Expected post method.")
+	}
+
+	params := req.URL.Query()
+	datasetID := params.Get("ds")
+	if !DatasetFullRe.MatchString(datasetID) {
+		d.Panic("Invalid dataset ID: %s", datasetID)
+	}
+	tokens := params["commit"]
+	if len(tokens) != 1 {
+		d.Panic(`Expected "commit" query param value`)
+	}
+	h := hash.Parse(tokens[0])
+	var policy merge.Policy
+	if name := params.Get("policy"); name != "" {
+		var err error
+		policy, err = merge.NamedPolicy(name)
+		d.PanicIfError(err)
+	}
+	if canWrite := datasetAuthorizer(req); canWrite != nil && !canWrite(datasetID) {
+		http.Error(w, fmt.Sprintf("Not allowed to update dataset %s", datasetID), http.StatusForbidden)
+		return
+	}
+
+	db := newLocalDatabase(cs)
+	db.hooks = requestHooks(req)
+	commit, ok := db.ReadValue(h).(types.Struct)
+	if !ok || !IsCommitType(commit.Type()) {
+		d.Panic("%s is not a Commit", h)
+	}
+	if err := db.doCommit(datasetID, commit, policy); err != nil {
+		if rejected, ok := err.(CommitRejectedError); ok {
+			http.Error(w, rejected.Reason, http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+		return
+	}
+	db.hooks.committed(db.GetDataset(datasetID))
+}
+
+func handleWatch(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	if req.Method != "GET" {
+		d.Panic("Expected get method.")
+	}
+
+	datasetID := req.URL.Query().Get("ds")
+	if !DatasetFullRe.MatchString(datasetID) {
+		d.Panic("Invalid dataset ID: %s", datasetID)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		d.Panic("Streaming is not supported")
+	}
+
+	w.Header().Add("content-type", "text/event-stream")
+	w.Header().Add("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	db := newLocalDatabase(cs)
+	pollHead(db, func() hash.Hash { return refreshRoot(cs) }, datasetID, req.Context().Done(), func(head hash.Hash) bool {
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", head); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	})
 }
 
 func handleGraphQL(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
@@ -457,7 +585,25 @@ func handleBaseGet(w http.ResponseWriter, req *http.Request, ps URLParams, rt ch
 	fmt.Fprintf(w, nomsBaseHTML)
 }
 
-func assertMapOfStringToRefOfCommit(proposed, datasets types.Map, vr types.ValueReader) {
+// rootChangeError is why checkRootChanges() turned down a new root, along
+// with the HTTP status to respond with.
+type rootChangeError struct {
+	status int
+	msg    string
+}
+
+func (e rootChangeError) Error() string {
+	return e.msg
+}
+
+// checkRootChanges diffs |proposed| against |datasets| and checks each entry
+// that is added, changed or removed, in a single pass. It panics if one
+// doesn't map to a Ref<Commit>, and returns a rootChangeError if |canWrite|,
+// when not nil, doesn't allow it, if it moves or deletes a tag, or if its new
+// head is rejected by the validators in |hooks|. Otherwise, if |hooks| isn't
+// nil, it returns the IDs of the datasets that were changed, other than the
+// entries under reserved keys.
+func checkRootChanges(proposed, datasets types.Map, vr types.ValueReader, canWrite func(ds string) bool, hooks *Hooks) (changed []string, err error) {
 	stopChan := make(chan struct{})
 	defer close(stopChan)
 	changes := make(chan types.ValueChanged)
@@ -466,18 +612,40 @@ func assertMapOfStringToRefOfCommit(proposed, datasets types.Map, vr types.Value
 		proposed.Diff(datasets, changes, stopChan)
 	}()
 	for change := range changes {
-		switch change.ChangeType {
-		case types.DiffChangeAdded, types.DiffChangeModified:
-			// Since this is a Map Diff, change.V is the key at which a change was detected.
-			// Go get the Value there, which should be a Ref<Value>, deref it, and then ensure the target is a Commit.
+		ds := string(change.V.(types.String))
+
+		// Even though the root's type is Map<String, Ref<Value>>, each new entry must be a Ref<Commit>.
+		var commit types.Struct
+		if change.ChangeType != types.DiffChangeRemoved {
 			val := proposed.Get(change.V)
 			ref, ok := val.(types.Ref)
 			if !ok {
-				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but key %s maps to a %s", change.V.(types.String), val.Type().Describe())
+				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but key %s maps to a %s", ds, val.Type().Describe())
+			}
+			target := ref.TargetValue(vr)
+			if !IsCommitType(target.Type()) {
+				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, not the ref at key %s points to a %s", ds, target.Type().Describe())
 			}
-			if targetType := ref.TargetValue(vr).Type(); !IsCommitType(targetType) {
-				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, not the ref at key %s points to a %s", change.V.(types.String), targetType.Describe())
+			commit = target.(types.Struct)
+		}
+
+		if canWrite != nil && !canWrite(ds) {
+			return nil, rootChangeError{http.StatusForbidden, fmt.Sprintf("Not allowed to update dataset %s", ds)}
+		}
+		// Clients refuse to move or delete tags, but one that doesn't mustn't be able to either.
+		if change.ChangeType != types.DiffChangeAdded && IsTag(ds) {
+			return nil, rootChangeError{http.StatusUnprocessableEntity, fmt.Sprintf("%s: %s", ErrTagImmutable, TagName(ds))}
+		}
+		if hooks == nil || isReservedRootKey(ds) {
+			// Entries under reserved keys aren't Datasets, so hooks don't apply to them.
+			continue
+		}
+		if change.ChangeType != types.DiffChangeRemoved {
+			if err := hooks.validate(vr, ds, commit); err != nil {
+				return nil, rootChangeError{http.StatusUnprocessableEntity, err.(CommitRejectedError).Reason}
 			}
 		}
+		changed = append(changed, ds)
 	}
+	return changed, nil
 }
@@ -7,14 +7,17 @@ package datas
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/hash"
@@ -365,6 +368,34 @@ func TestHandleGetRoot(t *testing.T) {
 	}
 }
 
+func TestHandleGetRootLog(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cs := chunks.NewLevelDBStore(dir, "", 24, false)
+	defer cs.Close()
+	c1, c2 := chunks.NewChunk([]byte("abc")), chunks.NewChunk([]byte("def"))
+	cs.PutMany([]chunks.Chunk{c1, c2})
+	assert.True(cs.UpdateRoot(c1.Hash(), hash.Hash{}))
+	assert.True(cs.UpdateRoot(c2.Hash(), c1.Hash()))
+
+	w := httptest.NewRecorder()
+	HandleRootLogGet(w, newRequest("GET", "", "", nil, nil), params{}, cs)
+
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		entries, err := chunks.ReadRootLog(w.Body)
+		assert.NoError(err)
+		assert.Equal(cs.RootLog(), entries)
+	}
+
+	// Stores that don't keep a root log can't serve one.
+	w = httptest.NewRecorder()
+	HandleRootLogGet(w, newRequest("GET", "", "", nil, nil), params{}, chunks.NewTestStore())
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
+
 func TestHandleGetBase(t *testing.T) {
 	assert := assert.New(t)
 	cs := chunks.NewTestStore()
@@ -415,6 +446,102 @@ func TestHandlePostRoot(t *testing.T) {
 	assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes()))
 }
 
+func TestHandlePostRootRejectsTagChanges(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("first"))
+	assert.NoError(err)
+	first := ds.HeadRef()
+	_, err = db.Tag("v1", first)
+	assert.NoError(err)
+	ds, err = db.CommitValue(ds, types.String("second"))
+	assert.NoError(err)
+
+	// A client that ignores tag immutability posts a root with the tag moved.
+	last := cs.Root()
+	moved := db.Datasets().Set(types.String(TagID("v1")), types.ToRefOfValue(ds.HeadRef()))
+	movedRef := db.WriteValue(moved)
+	db.(*LocalDatabase).Flush(movedRef.TargetHash())
+
+	post := func(current hash.Hash) *httptest.ResponseRecorder {
+		queryParams := url.Values{}
+		queryParams.Add("last", last.String())
+		queryParams.Add("current", current.String())
+		w := httptest.NewRecorder()
+		HandleRootPost(w, newRequest("POST", "", (&url.URL{RawQuery: queryParams.Encode()}).String(), nil, nil), params{}, cs)
+		return w
+	}
+	w := post(movedRef.TargetHash())
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(w.Body.String(), ErrTagImmutable.Error())
+	assert.Equal(last, cs.Root())
+
+	// Nor can it delete the tag.
+	deleted := db.Datasets().Remove(types.String(TagID("v1")))
+	deletedRef := db.WriteValue(deleted)
+	db.(*LocalDatabase).Flush(deletedRef.TargetHash())
+	w = post(deletedRef.TargetHash())
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(w.Body.String(), ErrTagImmutable.Error())
+	assert.Equal(last, cs.Root())
+}
+
+func TestHandleCommit(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.NewStruct("", types.StructData{"x": types.Number(1), "y": types.Number(1)}))
+	assert.NoError(err)
+	ancestor := ds.HeadRef()
+	_, err = db.CommitValue(ds, types.NewStruct("", types.StructData{"x": types.Number(2), "y": types.Number(1)}))
+	assert.NoError(err)
+
+	// A commit that was made against the old head.
+	commitRef := db.WriteValue(buildTestCommit(types.NewStruct("", types.StructData{"x": types.Number(1), "y": types.Number(2)}), ancestor))
+	db.(*LocalDatabase).Flush(commitRef.TargetHash())
+
+	post := func(policy string) *httptest.ResponseRecorder {
+		queryParams := url.Values{}
+		queryParams.Add("ds", "ds")
+		queryParams.Add("commit", commitRef.TargetHash().String())
+		if policy != "" {
+			queryParams.Add("policy", policy)
+		}
+		w := httptest.NewRecorder()
+		HandleCommit(w, newRequest("POST", "", (&url.URL{RawQuery: queryParams.Encode()}).String(), nil, nil), params{}, cs)
+		return w
+	}
+
+	w := post("")
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Equal(ErrMergeNeeded.Error(), strings.TrimSpace(w.Body.String()))
+
+	w = post("none")
+	assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes()))
+	db = NewDatabase(cs)
+	head := db.GetDataset("ds").Head()
+	assert.True(types.NewStruct("", types.StructData{"x": types.Number(2), "y": types.Number(2)}).Equals(head.Get(ValueField)))
+	assert.True(head.Get(ParentsField).(types.Set).Has(commitRef))
+}
+
+func TestHandleWatch(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+
+	// The handler streams until the request is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	HandleWatch(w, newRequest("GET", "", "?ds=ds", nil, nil).WithContext(ctx), params{}, cs)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("text/event-stream", w.Header().Get("content-type"))
+	assert.Equal(fmt.Sprintf("data: %s\n\n", ds.HeadRef().TargetHash()), w.Body.String())
+}
+
 func buildTestCommit(v types.Value, parents ...types.Value) types.Struct {
 	return NewCommit(v, types.NewSet(parents...), types.NewStruct("Meta", types.StructData{}))
 }
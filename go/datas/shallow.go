@@ -0,0 +1,280 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// PrunedRefsKey is the key under which the root Map of a database that has
+// been the sink of a shallow pull records the refs that were left out of it.
+// It isn't a legal Dataset ID, so the record can't be read or written as a
+// Dataset, and it is left out of Datasets().
+const PrunedRefsKey = "pruned-refs:"
+
+const (
+	prunedRefsName = "PrunedRefs"
+	refsField      = "refs"
+)
+
+// ShallowOptions restricts the part of the graph that ShallowPull() copies.
+// The zero value copies everything.
+type ShallowOptions struct {
+	// Depth is the number of generations of commits to copy, starting with
+	// the one being pulled. Parents beyond that are left out. 0 means all.
+	Depth int
+
+	// Path, if not empty, is resolved against the value of each commit that
+	// is copied, and only the chunks needed to resolve it and the chunks
+	// reachable from the value it resolves to are copied.
+	Path types.Path
+}
+
+// IsZero returns true if opts doesn't leave anything out.
+func (opts ShallowOptions) IsZero() bool {
+	return opts.Depth == 0 && len(opts.Path) == 0
+}
+
+// ShallowError is the cause of the panic that results from reading a chunk
+// that a shallow pull left out of a database.
+type ShallowError struct {
+	Hash hash.Hash
+}
+
+func (e ShallowError) Error() string {
+	return fmt.Sprintf("#%s is not in this database because it is a shallow copy; sync it again with a greater --depth, or without --path, to read it", e.Hash)
+}
+
+// prunedRef is a ref that a shallow pull didn't follow, along with the ref
+// of the chunk it was found in and the ref that was being pulled.
+type prunedRef struct {
+	ref, parent, root types.Ref
+}
+
+type prunedRefs map[hash.Hash]prunedRef
+
+// readPrunedRefs returns the refs recorded under PrunedRefsKey in the root
+// Map |root|.
+func readPrunedRefs(root types.Map, vr types.ValueReader) prunedRefs {
+	pruned := prunedRefs{}
+	r, ok := root.MaybeGet(types.String(PrunedRefsKey))
+	if !ok {
+		return pruned
+	}
+	commit := r.(types.Ref).TargetValue(vr).(types.Struct)
+	pruned.decode(commit.Get(ValueField).(types.Struct).Get(refsField).(types.Blob))
+	return pruned
+}
+
+// PrunedRefs returns the hashes of the chunks that shallow pulls into |db|
+// have left out of it, and which it therefore doesn't hold on purpose.
+func PrunedRefs(db Database) hash.HashSet {
+	hashes := hash.HashSet{}
+	for h := range readPrunedRefs(db.root(), db) {
+		hashes.Insert(h)
+	}
+	return hashes
+}
+
+// writePrunedRefs records |pruned| under PrunedRefsKey in |db|, replacing
+// whatever was there, or removes the record if |pruned| is empty.
+func writePrunedRefs(db *LocalDatabase, pruned prunedRefs) {
+	var err error
+	if len(pruned) == 0 {
+		if _, ok := db.rootEntry(PrunedRefsKey); ok {
+			err = db.setRootEntry(PrunedRefsKey, types.Ref{}, true)
+		}
+	} else {
+		record := types.NewStruct(prunedRefsName, types.StructData{refsField: pruned.encode(db)})
+		err = db.setRootEntry(PrunedRefsKey, db.WriteValue(NewCommit(record, types.NewSet(), types.EmptyStruct)), false)
+	}
+	d.PanicIfError(err)
+}
+
+// encode writes each ref in |pruned|, followed by its parent and root, into a
+// Blob.
+func (pruned prunedRefs) encode(vrw types.ValueReadWriter) types.Blob {
+	refs := make(types.RefSlice, 0, 3*len(pruned))
+	for _, p := range pruned {
+		refs = append(refs, p.ref, p.parent, p.root)
+	}
+	return encodeRefs(vrw, refs)
+}
+
+func (pruned prunedRefs) decode(b types.Blob) {
+	refs := decodeRefs(b)
+	d.PanicIfFalse(len(refs)%3 == 0)
+	for i := 0; i < len(refs); i += 3 {
+		pruned[refs[i].TargetHash()] = prunedRef{refs[i], refs[i+1], refs[i+2]}
+	}
+}
+
+// pullFilter decides which refs a pull follows. Its decisions depend only on
+// the ref and the chunk it was found in, so that a pull can be resumed from a
+// checkpoint without knowing how it got there.
+type pullFilter struct {
+	// commits, if not nil, is the set of commits to copy.
+	commits hash.HashSet
+	// partial, if not nil, is the set of chunks needed to resolve the path in
+	// each commit copied. The refs in these chunks are only followed if they
+	// are in partial or full.
+	partial hash.HashSet
+	// full is the set of refs under which everything is copied.
+	full hash.HashSet
+	// pruned is every ref that hasn't been followed.
+	pruned prunedRefs
+	root   types.Ref
+}
+
+// newPullFilter returns a pullFilter that copies the parts of the graph
+// reachable from |sourceRef| in |srcDB| that |opts| asks for. Unless opts
+// is zero, sourceRef must be a commit.
+func newPullFilter(srcDB Database, sourceRef types.Ref, opts ShallowOptions) *pullFilter {
+	f := &pullFilter{pruned: prunedRefs{}, root: sourceRef}
+	if opts.IsZero() {
+		return f
+	}
+	if !IsRefOfCommitType(sourceRef.Type()) {
+		d.Panic("Shallow pulls can only be made of commits")
+	}
+
+	commits := commitsToDepth(srcDB, sourceRef, opts.Depth)
+	if opts.Depth > 0 {
+		f.commits = commits
+	}
+	if len(opts.Path) > 0 {
+		rr := &recordingReader{db: srcDB, read: hash.HashSet{}}
+		f.full = hash.HashSet{}
+		for h := range commits {
+			commit := rr.ReadValue(h).(types.Struct)
+			if v := opts.Path.Resolve(commit.Get(ValueField)); v != nil {
+				v.WalkRefs(func(r types.Ref) {
+					f.full.Insert(r.TargetHash())
+				})
+			}
+		}
+		f.partial = rr.read
+	}
+	return f
+}
+
+// follow returns true if the pull should follow |r|, which is in the chunk
+// with hash |parent|.
+func (f *pullFilter) follow(parent hash.Hash, r types.Ref) bool {
+	h := r.TargetHash()
+	if f.commits != nil && IsRefOfCommitType(r.Type()) && !f.commits.Has(h) {
+		return false
+	}
+	if f.partial == nil || f.partial.Has(h) || f.full.Has(h) {
+		return true
+	}
+	// Chunks that aren't in partial were only followed because they're under something in full.
+	return f.full.Has(parent) || !f.partial.Has(parent)
+}
+
+func (f *pullFilter) prune(r, parent types.Ref) {
+	f.pruned[r.TargetHash()] = prunedRef{r, parent, f.root}
+}
+
+// commitsToDepth returns the commits that are at most |depth| generations
+// back from |r|, or all of the commits reachable from |r| if depth is 0. If
+// |r| isn't a commit, it returns just r.
+func commitsToDepth(db Database, r types.Ref, depth int) hash.HashSet {
+	commits := hash.HashSet{}
+	for gen, i := (types.RefSlice{r}), 0; len(gen) > 0 && (depth == 0 || i < depth); i++ {
+		next := types.RefSlice{}
+		for _, r := range gen {
+			if commits.Has(r.TargetHash()) {
+				continue
+			}
+			commits.Insert(r.TargetHash())
+			commit, ok := r.TargetValue(db).(types.Struct)
+			if !ok || !IsCommitType(commit.Type()) {
+				continue
+			}
+			commit.Get(ParentsField).(types.Set).IterAll(func(v types.Value) {
+				next = append(next, v.(types.Ref))
+			})
+		}
+		gen = next
+	}
+	return commits
+}
+
+// recordingReader reads Values from |db|, and remembers the hashes of all of
+// the chunks read, both directly and while navigating the Values it returns.
+type recordingReader struct {
+	db   Database
+	mu   sync.Mutex
+	read hash.HashSet
+}
+
+func (rr *recordingReader) ReadValue(h hash.Hash) types.Value {
+	rr.mu.Lock()
+	rr.read.Insert(h)
+	rr.mu.Unlock()
+	c := rr.db.validatingBatchStore().Get(h)
+	if c.IsEmpty() {
+		return nil
+	}
+	return types.DecodeValue(c, rr)
+}
+
+func (rr *recordingReader) ReadManyValues(hashes hash.HashSet, foundValues chan<- types.Value) {
+	for h := range hashes {
+		if v := rr.ReadValue(h); v != nil {
+			foundValues <- v
+		}
+	}
+}
+
+// shallowBatchStore wraps the BatchStore that a LocalDatabase reads Values
+// through, so that reading a chunk that a shallow pull left out panics with a
+// ShallowError rather than returning nothing. The pruned refs are only looked
+// up when a chunk is missing, so this costs nothing otherwise.
+type shallowBatchStore struct {
+	types.BatchStore
+	cs chunks.ChunkStore
+
+	mu     sync.Mutex
+	vs     *types.ValueStore
+	root   hash.Hash
+	pruned prunedRefs
+}
+
+func newShallowBatchStore(cs chunks.ChunkStore) *shallowBatchStore {
+	return &shallowBatchStore{BatchStore: types.NewBatchStoreAdaptor(cs), cs: cs}
+}
+
+func (sbs *shallowBatchStore) Get(h hash.Hash) chunks.Chunk {
+	c := sbs.BatchStore.Get(h)
+	if c.IsEmpty() && sbs.isPruned(h) {
+		d.PanicIfError(ShallowError{h})
+	}
+	return c
+}
+
+func (sbs *shallowBatchStore) isPruned(h hash.Hash) bool {
+	sbs.mu.Lock()
+	defer sbs.mu.Unlock()
+	if root := sbs.cs.Root(); sbs.pruned == nil || root != sbs.root {
+		if sbs.vs == nil {
+			// Read the record through a ValueStore of our own, since reading it through this one would come back here if it were missing. It's never closed, as that would close cs.
+			sbs.vs = types.NewValueStore(types.NewBatchStoreAdaptor(sbs.cs))
+		}
+		sbs.root, sbs.pruned = root, prunedRefs{}
+		if !root.IsEmpty() {
+			sbs.pruned = readPrunedRefs(sbs.vs.ReadValue(root).(types.Map), sbs.vs)
+		}
+	}
+	_, ok := sbs.pruned[h]
+	return ok
+}
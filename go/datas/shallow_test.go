@@ -0,0 +1,129 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestShallowPull(t *testing.T) {
+	suite.Run(t, &ShallowPullSuite{})
+}
+
+type ShallowPullSuite struct {
+	suite.Suite
+	source  Database
+	sinkCS  *chunks.TestStore
+	sink    Database
+	commits []types.Ref
+}
+
+// SetupTest makes a history of four commits, each of which has two large
+// Lists in its value.
+func (suite *ShallowPullSuite) SetupTest() {
+	suite.source = NewDatabase(chunks.NewTestStore())
+	suite.sinkCS = chunks.NewTestStore()
+	suite.sink = NewDatabase(suite.sinkCS)
+	ds := suite.source.GetDataset(datasetID)
+	suite.commits = nil
+	for i := 0; i < 4; i++ {
+		v := types.NewStruct("", types.StructData{
+			"a": suite.source.WriteValue(buildListOfHeight(i+2, suite.source)),
+			"b": suite.source.WriteValue(buildListOfHeight(i+3, suite.source)),
+		})
+		var err error
+		ds, err = suite.source.CommitValue(ds, v)
+		suite.NoError(err)
+		suite.commits = append(suite.commits, ds.HeadRef())
+	}
+}
+
+func (suite *ShallowPullSuite) TearDownTest() {
+	suite.sink.Close()
+	suite.source.Close()
+}
+
+func (suite *ShallowPullSuite) head() types.Ref {
+	return suite.commits[len(suite.commits)-1]
+}
+
+// assertShallow checks that reading |r| from the sink fails because it was left out.
+func (suite *ShallowPullSuite) assertShallow(r types.Ref) {
+	err := d.Try(func() { suite.sink.ReadValue(r.TargetHash()) }, ShallowError{})
+	suite.Equal(ShallowError{r.TargetHash()}, err)
+}
+
+func (suite *ShallowPullSuite) TestDepth() {
+	ShallowPull(suite.source, suite.sink, suite.head(), types.Ref{}, ShallowOptions{Depth: 2}, 2, nil)
+
+	assertComplete(suite.Assert(), suite.sink, suite.commits[3].TargetValue(suite.source).(types.Struct).Get(ValueField).(types.Struct).Get("a").(types.Ref))
+	suite.NotNil(suite.sink.ReadValue(suite.commits[2].TargetHash()))
+	suite.assertShallow(suite.commits[1])
+	suite.Nil(suite.sink.ReadValue(types.Number(42).Hash()))
+
+	// Pulling the whole thing fills in the rest, and there's nothing left to record.
+	ResumablePull(suite.source, suite.sink, suite.head(), types.Ref{}, 2, nil)
+	assertComplete(suite.Assert(), suite.sink, suite.head())
+	_, ok := suite.sink.(*LocalDatabase).rootEntry(PrunedRefsKey)
+	suite.False(ok)
+}
+
+func (suite *ShallowPullSuite) TestDeeper() {
+	ShallowPull(suite.source, suite.sink, suite.commits[2], types.Ref{}, ShallowOptions{Depth: 1}, 2, nil)
+	suite.assertShallow(suite.commits[1])
+
+	ShallowPull(suite.source, suite.sink, suite.head(), types.Ref{}, ShallowOptions{Depth: 3}, 2, nil)
+	suite.NotNil(suite.sink.ReadValue(suite.commits[1].TargetHash()))
+	suite.assertShallow(suite.commits[0])
+}
+
+func (suite *ShallowPullSuite) TestPath() {
+	path, err := types.ParsePath(".a")
+	suite.NoError(err)
+	ShallowPull(suite.source, suite.sink, suite.head(), types.Ref{}, ShallowOptions{Depth: 1, Path: path}, 2, nil)
+
+	v := suite.sink.ReadValue(suite.head().TargetHash()).(types.Struct).Get(ValueField).(types.Struct)
+	assertComplete(suite.Assert(), suite.sink, v.Get("a").(types.Ref))
+	suite.assertShallow(v.Get("b").(types.Ref))
+	suite.assertShallow(suite.commits[2])
+
+	ResumablePull(suite.source, suite.sink, suite.head(), types.Ref{}, 2, nil)
+	assertComplete(suite.Assert(), suite.sink, suite.head())
+}
+
+func (suite *ShallowPullSuite) TestUnrelatedPullLeavesGaps() {
+	ShallowPull(suite.source, suite.sink, suite.head(), types.Ref{}, ShallowOptions{Depth: 1}, 2, nil)
+
+	other, err := suite.source.CommitValue(suite.source.GetDataset("other"), types.String("other"))
+	suite.NoError(err)
+	sinkCS := suite.sinkCS.Writes
+	ResumablePull(suite.source, suite.sink, other.HeadRef(), types.Ref{}, 2, nil)
+	suite.True(suite.sinkCS.Writes-sinkCS < 10)
+	suite.assertShallow(suite.commits[2])
+}
+
+func (suite *ShallowPullSuite) TestPrunedRefsAreNotDatasets() {
+	committed := []string{}
+	suite.sink.Hooks().AddCallback(func(ds Dataset) { committed = append(committed, ds.ID()) })
+
+	// A Dataset with the name that the record of pruned refs used to have is just a Dataset.
+	_, err := suite.sink.CommitValue(suite.sink.GetDataset("pruned-refs"), types.Number(1))
+	suite.NoError(err)
+	suite.Empty(PrunedRefs(suite.sink))
+	suite.Nil(suite.sink.ReadValue(types.Number(42).Hash()))
+
+	ShallowPull(suite.source, suite.sink, suite.head(), types.Ref{}, ShallowOptions{Depth: 1}, 2, nil)
+	suite.assertShallow(suite.commits[2])
+	suite.NotEmpty(PrunedRefs(suite.sink))
+	suite.Nil(suite.sink.ReadValue(types.Number(42).Hash()))
+	suite.Equal(uint64(1), suite.sink.Datasets().Len())
+	suite.Equal([]string{"pruned-refs"}, committed)
+	suite.False(IsValidDatasetName(PrunedRefsKey))
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// TagPrefix is prepended to the name of a tag to form the ID of the Dataset
+// that holds it. Tags live in the root map alongside ordinary Datasets, so
+// e.g. the tag "v1.2" can be read via GetDataset("tag:v1.2").
+const TagPrefix = "tag:"
+
+// TagRe is a regexp that matches a legal tag name anywhere within the target
+// string. Dots are allowed in tag names so long as they are followed by a
+// digit (e.g. "v1.2"), since a dot followed by a letter begins a field path.
+var TagRe = regexp.MustCompile(`[a-zA-Z0-9\-_/]+(?:\.[0-9][a-zA-Z0-9\-_/]*)*`)
+
+// TagIDRe is a regexp that matches the ID of a tag Dataset anywhere within
+// the target string.
+var TagIDRe = regexp.MustCompile(TagPrefix + TagRe.String())
+
+// TagFullRe is a regexp that matches only a target string that is entirely a
+// legal tag name.
+var TagFullRe = regexp.MustCompile("^" + TagRe.String() + "$")
+
+var (
+	ErrTagImmutable = errors.New("Tags cannot be moved or deleted once created")
+	ErrTagExists    = errors.New("Tag already exists")
+)
+
+// TagID returns the ID of the Dataset that holds the tag called |name|.
+func TagID(name string) string {
+	return TagPrefix + name
+}
+
+// IsTag returns true if |datasetID| names a tag rather than an ordinary
+// Dataset.
+func IsTag(datasetID string) bool {
+	return strings.HasPrefix(datasetID, TagPrefix)
+}
+
+// TagName returns the name of the tag held by the Dataset |datasetID|.
+func TagName(datasetID string) string {
+	return strings.TrimPrefix(datasetID, TagPrefix)
+}
+
+func IsValidTagName(name string) bool {
+	return TagFullRe.MatchString(name)
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sync"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// watchInterval is how often the root of a database is checked for changes
+// when there is no better way to find out about them.
+var watchInterval = 250 * time.Millisecond
+
+// Watch returns a channel that receives the Dataset with ID |datasetID| in
+// |db| straight away, and again each time its head changes, until db is
+// closed, when the channel is closed. A receiver that falls behind may not
+// see every head in between.
+//
+// A remote db is told about changes by the server. A local one checks its
+// ChunkStore for them if the ChunkStore is a chunks.RootRefresher, as
+// NomsBlockStores are, and so sees changes made by other processes.
+// Otherwise, since a ChunkStore's root can't generally be read while it is
+// being updated, it only sees the changes made through db itself.
+func Watch(db Database, datasetID string) <-chan Dataset {
+	if !DatasetFullRe.MatchString(datasetID) {
+		d.Panic("Invalid dataset ID: %s", datasetID)
+	}
+	return db.watch(datasetID)
+}
+
+// headWatcher calls |send| with the hash of the head of the dataset with ID
+// |datasetID|, or an empty hash if there is none, and again whenever it may
+// have changed. It returns once send returns false, or |closed| is closed.
+type headWatcher func(datasetID string, closed <-chan struct{}, send func(head hash.Hash) bool)
+
+// watch implements Watch() for |db|, whose databaseCommon is dbc, by sending
+// a Dataset for each new head passed to send by |watchHead|.
+func (dbc *databaseCommon) watch(db Database, datasetID string, watchHead headWatcher) <-chan Dataset {
+	ch := make(chan Dataset)
+	closed, ok := dbc.watchers.add()
+	if !ok {
+		close(ch)
+		return ch
+	}
+	go func() {
+		defer dbc.watchers.done()
+		defer close(ch)
+		started, last := false, hash.Hash{}
+		watchHead(datasetID, closed, func(head hash.Hash) bool {
+			if started && head == last {
+				return true
+			}
+			started, last = true, head
+			ds := Dataset{store: db, id: datasetID}
+			if !head.IsEmpty() {
+				ds.headRef = types.NewRef(db.ReadValue(head))
+			}
+			select {
+			case ch <- ds:
+				return true
+			case <-closed:
+				return false
+			}
+		})
+	}()
+	return ch
+}
+
+// pollHead is a headWatcher that reads the root returned by |root| every
+// watchInterval, and looks up the head in the Datasets found there using
+// |vr|. It only calls send when the head has changed.
+func pollHead(vr types.ValueReader, root func() hash.Hash, datasetID string, closed <-chan struct{}, send func(head hash.Hash) bool) {
+	started, last := false, hash.Hash{}
+	for {
+		if head := headAt(vr, root(), datasetID); !started || head != last {
+			if !send(head) {
+				return
+			}
+			started, last = true, head
+		}
+		select {
+		case <-time.After(watchInterval):
+		case <-closed:
+			return
+		}
+	}
+}
+
+// headAt returns the hash of the head of the dataset with ID |datasetID| in
+// the Datasets whose hash is |root|, or an empty hash if there is none.
+func headAt(vr types.ValueReader, root hash.Hash, datasetID string) hash.Hash {
+	if root.IsEmpty() {
+		return hash.Hash{}
+	}
+	if r, ok := vr.ReadValue(root).(types.Map).MaybeGet(types.String(datasetID)); ok {
+		return r.(types.Ref).TargetHash()
+	}
+	return hash.Hash{}
+}
+
+// refreshRoot returns the latest root of |cs|, including updates made by
+// others if cs is a chunks.RootRefresher.
+func refreshRoot(cs chunks.ChunkStore) hash.Hash {
+	if rr, ok := cs.(chunks.RootRefresher); ok {
+		return rr.RefreshRoot()
+	}
+	return cs.Root()
+}
+
+// watchers keeps track of the goroutines started by Watch() for a database,
+// so that closing the database can stop them, and wait until they have
+// stopped using it.
+type watchers struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	closed   chan struct{}
+	rootHash hash.Hash
+}
+
+func newWatchers(rootHash hash.Hash) *watchers {
+	return &watchers{closed: make(chan struct{}), rootHash: rootHash}
+}
+
+// setRoot records the root of the database after an update made through it,
+// for watchers that can't read the root from its ChunkStore.
+func (w *watchers) setRoot(rootHash hash.Hash) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rootHash = rootHash
+}
+
+// root returns the root last passed to setRoot.
+func (w *watchers) root() hash.Hash {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rootHash
+}
+
+// add registers a new watcher, and returns the channel that is closed to
+// stop it, or false if the database has already been closed.
+func (w *watchers) add() (closed <-chan struct{}, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.closed:
+		return nil, false
+	default:
+	}
+	w.wg.Add(1)
+	return w.closed, true
+}
+
+func (w *watchers) done() {
+	w.wg.Done()
+}
+
+// close stops every watcher, and waits for them to return.
+func (w *watchers) close() {
+	w.mu.Lock()
+	select {
+	case <-w.closed:
+	default:
+		close(w.closed)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
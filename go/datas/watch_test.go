@@ -0,0 +1,75 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// nextHead waits for Watch() to send a Dataset on |ch|, and returns it.
+func nextHead(assert *assert.Assertions, ch <-chan Dataset) Dataset {
+	select {
+	case ds, ok := <-ch:
+		assert.True(ok)
+		return ds
+	case <-time.After(5 * time.Second):
+		assert.Fail("Timed out waiting for a new head")
+		return Dataset{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	ch := Watch(db, "ds")
+
+	_, ok := nextHead(assert, ch).MaybeHeadRef()
+	assert.False(ok)
+
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	assert.True(ds.HeadRef().Equals(nextHead(assert, ch).HeadRef()))
+
+	// Updates to other datasets aren't sent.
+	_, err = db.CommitValue(db.GetDataset("other"), types.String("other"))
+	assert.NoError(err)
+	ds, err = db.CommitValue(ds, types.String("b"))
+	assert.NoError(err)
+	assert.True(types.String("b").Equals(nextHead(assert, ch).HeadValue()))
+
+	db.Close()
+	_, ok = <-ch
+	assert.False(ok)
+	_, ok = <-Watch(db, "ds")
+	assert.False(ok)
+}
+
+func TestWatchOtherStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db := NewDatabase(nbs.NewLocalStore(dir, 0))
+	defer db.Close()
+	ch := Watch(db, "ds")
+	_, ok := nextHead(assert, ch).MaybeHeadRef()
+	assert.False(ok)
+
+	// Another store over the same files stands in for another process.
+	other := NewDatabase(nbs.NewLocalStore(dir, 0))
+	defer other.Close()
+	_, err = other.CommitValue(other.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	assert.True(types.String("a").Equals(nextHead(assert, ch).HeadValue()))
+}
@@ -0,0 +1,263 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+)
+
+const (
+	// maxTextDiffSize is the largest Blob that PrintBlobDiff will read in
+	// full in order to check whether it's text and print a line diff.
+	maxTextDiffSize = 16 << 20
+	// textDiffContext is the number of unchanged lines printed around each
+	// change in a line diff.
+	textDiffContext = 3
+)
+
+// BlobDifference describes a range of bytes that differs between two Blobs:
+// the OldLength bytes at OldOffset in the old Blob were replaced by the
+// NewLength bytes at NewOffset in the new Blob.
+type BlobDifference struct {
+	OldOffset, OldLength uint64
+	NewOffset, NewLength uint64
+}
+
+// DiffBlobs sends the ranges of bytes that differ between b1 and b2 over
+// changes, in order. It walks the prolly trees of both Blobs together and
+// skips any subtrees whose hashes match, so only the chunks that changed are
+// read. Adjacent ranges are coalesced into a single BlobDifference.
+// Like Diff(), DiffBlobs must be run concurrently with code that reads from
+// changes, and stops early if stopChan is closed.
+func DiffBlobs(b1, b2 types.Blob, changes chan<- BlobDifference, stopChan <-chan struct{}) {
+	spliceChan := make(chan types.Splice)
+	spliceStopChan := make(chan struct{}, 1) // buffer size of 1, so this won't block if diff already finished
+
+	go func() {
+		b2.Diff(b1, spliceChan, spliceStopChan)
+		close(spliceChan)
+	}()
+
+	send := func(dif BlobDifference) bool {
+		select {
+		case <-stopChan:
+			return false
+		case changes <- dif:
+			return true
+		}
+	}
+
+	var cur BlobDifference
+	hasCur, stop := false, false
+	delta := int64(0) // NewOffset - OldOffset for bytes after the last splice.
+	for splice := range spliceChan {
+		if stop {
+			continue
+		}
+		// Removals don't set SpFrom, so work out where they happened in b2 from the preceding splices.
+		dif := BlobDifference{splice.SpAt, splice.SpRemoved, uint64(int64(splice.SpAt) + delta), splice.SpAdded}
+		delta += int64(splice.SpAdded) - int64(splice.SpRemoved)
+		if hasCur && cur.OldOffset+cur.OldLength == dif.OldOffset {
+			cur.OldLength += dif.OldLength
+			cur.NewLength += dif.NewLength
+			continue
+		}
+		if hasCur && !send(cur) {
+			stop = true
+			spliceStopChan <- struct{}{}
+			continue
+		}
+		cur, hasCur = dif, true
+	}
+	if hasCur && !stop {
+		send(cur)
+	}
+}
+
+// PrintBlobDiff writes a description of the bytes that differ between b1 and
+// b2 to w. If both Blobs are valid UTF-8 text, and no bigger than
+// maxTextDiffSize, it writes a unified line diff. Otherwise it writes the
+// range of each change in the form "@@ bytes -offset,length +offset,length @@".
+func PrintBlobDiff(w io.Writer, b1, b2 types.Blob) error {
+	dChan := make(chan BlobDifference, 16)
+	stopChan := make(chan struct{})
+	go func() {
+		DiffBlobs(b1, b2, dChan, stopChan)
+		close(dChan)
+	}()
+	stopDiff := func() {
+		close(stopChan)
+		for range dChan {
+		}
+	}
+
+	if b1.Len() <= maxTextDiffSize && b2.Len() <= maxTextDiffSize {
+		oldText, newText := readBlob(b1), readBlob(b2)
+		if utf8.Valid(oldText) && utf8.Valid(newText) {
+			difs := []BlobDifference{}
+			for dif := range dChan {
+				difs = append(difs, dif)
+			}
+			return printLineDiff(w, oldText, newText, difs)
+		}
+	}
+
+	for dif := range dChan {
+		if err := write(w, []byte(fmt.Sprintf("@@ bytes -%d,%d +%d,%d @@\n", dif.OldOffset, dif.OldLength, dif.NewOffset, dif.NewLength))); err != nil {
+			stopDiff()
+			return err
+		}
+	}
+	return nil
+}
+
+func readBlob(b types.Blob) []byte {
+	buf := &bytes.Buffer{}
+	_, err := io.Copy(buf, b.Reader())
+	d.PanicIfError(err)
+	return buf.Bytes()
+}
+
+// lineHunk is a changed region of text, as line-aligned byte offsets into the old and new text.
+type lineHunk struct {
+	oldStart, oldEnd, newStart, newEnd uint64
+}
+
+// lineHunks widens each of difs out to whole lines. Since the bytes between two BlobDifferences are the same in both texts, a boundary found in the old text maps to the new text by a fixed offset, unless widening runs into the next BlobDifference, in which case the two are combined.
+func lineHunks(oldText, newText []byte, difs []BlobDifference) (hunks []lineHunk) {
+	atBoundary := func(text []byte, p uint64) bool {
+		return p == 0 || p == uint64(len(text)) || text[p-1] == '\n'
+	}
+	for i := 0; i < len(difs); {
+		dif := difs[i]
+		i++
+		back := dif.OldOffset - uint64(bytes.LastIndexByte(oldText[:dif.OldOffset], '\n')+1)
+		h := lineHunk{dif.OldOffset - back, dif.OldOffset + dif.OldLength, dif.NewOffset - back, dif.NewOffset + dif.NewLength}
+		for !atBoundary(oldText, h.oldEnd) || !atBoundary(newText, h.newEnd) {
+			fwd := uint64(len(oldText)) - h.oldEnd
+			if nl := bytes.IndexByte(oldText[h.oldEnd:], '\n'); nl >= 0 {
+				fwd = uint64(nl) + 1
+			}
+			if i < len(difs) && difs[i].OldOffset < h.oldEnd+fwd {
+				h.oldEnd, h.newEnd = difs[i].OldOffset+difs[i].OldLength, difs[i].NewOffset+difs[i].NewLength
+				i++
+				continue
+			}
+			h.oldEnd, h.newEnd = h.oldEnd+fwd, h.newEnd+fwd
+		}
+		hunks = append(hunks, h)
+	}
+	return
+}
+
+// splitLines returns the lines of text, each including its trailing newline, along with the byte offset at which each line starts.
+func splitLines(text []byte) (lines [][]byte, starts []uint64) {
+	for start := 0; start < len(text); {
+		end := len(text)
+		if nl := bytes.IndexByte(text[start:], '\n'); nl >= 0 {
+			end = start + nl + 1
+		}
+		lines = append(lines, text[start:end])
+		starts = append(starts, uint64(start))
+		start = end
+	}
+	return
+}
+
+func printLineDiff(w io.Writer, oldText, newText []byte, difs []BlobDifference) error {
+	oldLines, oldStarts := splitLines(oldText)
+	newLines, newStarts := splitLines(newText)
+	lineOf := func(starts []uint64, p uint64) int {
+		return sort.Search(len(starts), func(i int) bool { return starts[i] >= p })
+	}
+
+	// Each group of hunks whose context overlaps is printed under a single header.
+	type lineRange struct{ oldStart, oldEnd, newStart, newEnd int }
+	groups := [][]lineRange{}
+	for _, h := range lineHunks(oldText, newText, difs) {
+		r := lineRange{lineOf(oldStarts, h.oldStart), lineOf(oldStarts, h.oldEnd), lineOf(newStarts, h.newStart), lineOf(newStarts, h.newEnd)}
+		// A byte-level change can start or end part way through a line that is otherwise unchanged, so drop whole lines that match at either end.
+		for r.oldStart < r.oldEnd && r.newStart < r.newEnd && bytes.Equal(oldLines[r.oldStart], newLines[r.newStart]) {
+			r.oldStart, r.newStart = r.oldStart+1, r.newStart+1
+		}
+		for r.oldStart < r.oldEnd && r.newStart < r.newEnd && bytes.Equal(oldLines[r.oldEnd-1], newLines[r.newEnd-1]) {
+			r.oldEnd, r.newEnd = r.oldEnd-1, r.newEnd-1
+		}
+		if last := len(groups) - 1; last >= 0 && r.oldStart-groups[last][len(groups[last])-1].oldEnd <= 2*textDiffContext {
+			groups[last] = append(groups[last], r)
+		} else {
+			groups = append(groups, []lineRange{r})
+		}
+	}
+
+	min := func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}
+	hunkRange := func(start, count int) string {
+		switch count {
+		case 0:
+			return fmt.Sprintf("%d,0", start)
+		case 1:
+			return fmt.Sprintf("%d", start+1)
+		}
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+	printLine := func(prefix string, line []byte) error {
+		if err := write(w, append([]byte(prefix), line...)); err != nil {
+			return err
+		}
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			return write(w, []byte("\n\\ No newline at end of file\n"))
+		}
+		return nil
+	}
+
+	for _, group := range groups {
+		first, last := group[0], group[len(group)-1]
+		before := min(textDiffContext, first.oldStart)
+		after := min(textDiffContext, len(oldLines)-last.oldEnd)
+		oldStart, newStart := first.oldStart-before, first.newStart-before
+		oldCount := last.oldEnd + after - oldStart
+		newCount := last.newEnd + after - newStart
+		if err := write(w, []byte(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount)))); err != nil {
+			return err
+		}
+
+		oldLine := oldStart
+		for _, r := range group {
+			for ; oldLine < r.oldStart; oldLine++ {
+				if err := printLine(" ", oldLines[oldLine]); err != nil {
+					return err
+				}
+			}
+			for ; oldLine < r.oldEnd; oldLine++ {
+				if err := printLine("-", oldLines[oldLine]); err != nil {
+					return err
+				}
+			}
+			for _, line := range newLines[r.newStart:r.newEnd] {
+				if err := printLine("+", line); err != nil {
+					return err
+				}
+			}
+		}
+		for ; oldLine < last.oldEnd+after; oldLine++ {
+			if err := printLine(" ", oldLines[oldLine]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func blobDifferences(b1, b2 types.Blob) (difs []BlobDifference) {
+	dChan := make(chan BlobDifference)
+	go func() {
+		DiffBlobs(b1, b2, dChan, make(chan struct{}))
+		close(dChan)
+	}()
+	for dif := range dChan {
+		difs = append(difs, dif)
+	}
+	return
+}
+
+func TestDiffBlobs(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(0)).Read(data)
+	edited := append([]byte{}, data[:1000]...)
+	edited = append(edited, "inserted"...)
+	edited = append(edited, data[1000:500000]...)
+	edited = append(edited, data[500010:]...)
+
+	b1 := types.NewBlob(bytes.NewReader(data))
+	b2 := types.NewBlob(bytes.NewReader(edited))
+	assert.Equal([]BlobDifference{{1000, 0, 1000, 8}, {500000, 10, 500008, 0}}, blobDifferences(b1, b2))
+	assert.Equal([]BlobDifference{{1000, 8, 1000, 0}, {500008, 0, 500000, 10}}, blobDifferences(b2, b1))
+	assert.Empty(blobDifferences(b1, b1))
+}
+
+func TestPrintBlobDiffText(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d\n", i+1)
+	}
+	edited := append([]string{}, lines...)
+	edited[1] = "line two\n"
+	edited[4] = "line 5 and a bit\n"
+	edited = append(edited[:30], append([]string{"new line\n"}, edited[30:]...)...)
+
+	b1 := types.NewBlob(strings.NewReader(strings.Join(lines, "")))
+	b2 := types.NewBlob(strings.NewReader(strings.Join(edited, "")))
+	buf := &bytes.Buffer{}
+	assert.NoError(PrintBlobDiff(buf, b1, b2))
+	assert.Equal(`@@ -1,8 +1,8 @@
+ line 1
+-line 2
++line two
+ line 3
+ line 4
+-line 5
++line 5 and a bit
+ line 6
+ line 7
+ line 8
+@@ -28,6 +28,7 @@
+ line 28
+ line 29
+ line 30
++new line
+ line 31
+ line 32
+ line 33
+`, buf.String())
+}
+
+func TestPrintBlobDiffBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte{0xff, 0xfe, 0, 1, 2, 3, 4, 5}
+	b1 := types.NewBlob(bytes.NewReader(data))
+	b2 := types.NewBlob(bytes.NewReader(append(data[:2:2], 9, 9, 9)))
+	buf := &bytes.Buffer{}
+	assert.NoError(PrintBlobDiff(buf, b1, b2))
+	assert.Equal("@@ bytes -2,6 +2,3 @@\n", buf.String())
+}
+
+func TestNomsDiffPrintBlobInStruct(t *testing.T) {
+	assert := assert.New(t)
+
+	s1 := types.NewStruct("File", types.StructData{"content": types.NewBlob(strings.NewReader("a\nb\nc\n"))})
+	s2 := types.NewStruct("File", types.StructData{"content": types.NewBlob(strings.NewReader("a\nB\nc\n"))})
+	buf := &bytes.Buffer{}
+	assert.NoError(PrintDiff(buf, s1, s2, false))
+	assert.Equal(`(root) {
+-   content: Blob (6 B)
++   content: Blob (6 B)
+    @@ -1,3 +1,3 @@
+     a
+    -b
+    +B
+     c
+  }
+`, buf.String())
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// CherryPick returns the result of applying the changes made between parent
+// and picked to target. If the Patch computed by Diff() applies cleanly, that
+// is if target still holds the old value at every changed path, it is applied
+// directly using Apply(). Otherwise, CherryPick falls back to a three-way
+// merge of target and picked, with parent as the common ancestor, and uses
+// resolve to settle any conflicts.
+// To revert the changes made between parent and picked, swap the two.
+func CherryPick(target, parent, picked types.Value, vrw types.ValueReadWriter, resolve merge.ResolveFunc, progress chan struct{}) (types.Value, error) {
+	dChan := make(chan Difference)
+	sChan := make(chan struct{})
+	go func() {
+		Diff(parent, picked, dChan, sChan, true)
+		close(dChan)
+	}()
+	patch := Patch{}
+	for dif := range dChan {
+		patch = append(patch, dif)
+	}
+
+	if len(patch) == 0 {
+		return target, nil
+	}
+	if appliesCleanly(target, parent, patch) {
+		return Apply(target, patch), nil
+	}
+	return merge.ThreeWay(target, picked, parent, vrw, resolve, progress)
+}
+
+func appliesCleanly(target, parent types.Value, patch Patch) bool {
+	equals := func(v1, v2 types.Value) bool {
+		if v1 == nil || v2 == nil {
+			return v1 == v2
+		}
+		return v1.Equals(v2)
+	}
+	for _, dif := range patch {
+		if len(dif.Path) == 0 {
+			if !equals(target, dif.OldValue) {
+				return false
+			}
+			continue
+		}
+		// Changes to Lists are positional, so they can only be applied if the List they're changing is untouched.
+		container := dif.Path[:len(dif.Path)-1]
+		if l, ok := container.Resolve(parent).(types.List); ok {
+			if !equals(l, container.Resolve(target)) {
+				return false
+			}
+			continue
+		}
+		if !equals(dif.Path.Resolve(target), dif.OldValue) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func numberMap(kv ...interface{}) types.Map {
+	vals := make([]types.Value, len(kv))
+	for i, v := range kv {
+		if s, ok := v.(string); ok {
+			vals[i] = types.String(s)
+		} else {
+			vals[i] = types.Number(v.(int))
+		}
+	}
+	return types.NewMap(vals...)
+}
+
+func TestCherryPickClean(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	parent := numberMap("a", 1, "b", 2)
+	picked := numberMap("a", 1, "b", 3, "c", 4)
+	target := numberMap("a", 5, "b", 2)
+
+	merged, err := CherryPick(target, parent, picked, vs, merge.None, nil)
+	assert.NoError(err)
+	assert.True(numberMap("a", 5, "b", 3, "c", 4).Equals(merged))
+
+	// Reverting is cherry-picking the change in the other direction.
+	reverted, err := CherryPick(merged, picked, parent, vs, merge.None, nil)
+	assert.NoError(err)
+	assert.True(target.Equals(reverted))
+}
+
+func TestCherryPickNoChanges(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	parent := numberMap("a", 1)
+	target := numberMap("a", 5)
+	merged, err := CherryPick(target, parent, parent, vs, merge.None, nil)
+	assert.NoError(err)
+	assert.True(target.Equals(merged))
+}
+
+func TestCherryPickRoot(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	merged, err := CherryPick(types.String("a"), types.String("a"), types.Number(1), vs, merge.None, nil)
+	assert.NoError(err)
+	assert.True(types.Number(1).Equals(merged))
+
+	_, err = CherryPick(types.String("b"), types.String("a"), types.Number(1), vs, merge.None, nil)
+	assert.Error(err)
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	parent := numberMap("a", 1, "b", 2)
+	picked := numberMap("a", 1, "b", 3)
+	target := numberMap("a", 1, "b", 7)
+
+	_, err := CherryPick(target, parent, picked, vs, merge.None, nil)
+	assert.IsType(&merge.ErrMergeConflict{}, err)
+
+	merged, err := CherryPick(target, parent, picked, vs, merge.Ours, nil)
+	assert.NoError(err)
+	assert.True(target.Equals(merged))
+
+	merged, err = CherryPick(target, parent, picked, vs, merge.Theirs, nil)
+	assert.NoError(err)
+	assert.True(picked.Equals(merged))
+}
+
+func TestCherryPickListFallsBackToMerge(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	parent := types.NewList(types.Number(1), types.Number(2))
+	picked := types.NewList(types.Number(1), types.Number(2), types.Number(3))
+	target := types.NewList(types.Number(0), types.Number(1), types.Number(2))
+
+	merged, err := CherryPick(target, parent, picked, vs, merge.None, nil)
+	assert.NoError(err)
+	assert.True(types.NewList(types.Number(0), types.Number(1), types.Number(2), types.Number(3)).Equals(merged))
+}
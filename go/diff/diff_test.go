@@ -407,7 +407,13 @@ func TestNomsDiffPrintList(t *testing.T) {
 func TestNomsDiffPrintBlob(t *testing.T) {
 	assert := assert.New(t)
 
-	expected := "-   Blob (2.0 kB)\n+   Blob (11 B)\n"
+	// Both Blobs are text, so a line diff follows the summary.
+	expected := "-   Blob (2.0 kB)\n+   Blob (11 B)\n" +
+		"    @@ -1 +1 @@\n" +
+		"    -" + strings.Repeat("x", 2*1024) + "\n" +
+		"    \\ No newline at end of file\n" +
+		"    +Hello World\n" +
+		"    \\ No newline at end of file\n"
 	expectedPaths1 := []string{``}
 	b1 := types.NewBlob(strings.NewReader(strings.Repeat("x", 2*1024)))
 	b2 := types.NewBlob(strings.NewReader("Hello World"))
@@ -0,0 +1,309 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+const (
+	patchFileVersion = 1
+	// patchFileTextLines is the most lines of human-readable text written for
+	// any one Value in a patch file. The "data" field is always complete.
+	patchFileTextLines = 100
+)
+
+var changeTypeNames = map[types.DiffChangeType]string{
+	types.DiffChangeAdded:    "added",
+	types.DiffChangeRemoved:  "removed",
+	types.DiffChangeModified: "modified",
+}
+
+// patchFileJSON is the JSON form of a Patch written by WritePatch(). It looks
+// like:
+//
+// ```
+// {
+//   "version": 1,
+//   "from": "<hash of the old value>",
+//   "to": "<hash of the new value>",
+//   "differences": [{
+//     "path": ".foo[\"bar\"]",
+//     "pathParts": [{"field": "foo"}, {"index": "bar"}],
+//     "changeType": "modified",
+//     "oldValue": {"type": "Number", "text": "1", "data": "<base64>"},
+//     "newValue": {"type": "Number", "text": "2", "data": "<base64>"}
+//   }],
+//   "chunks": ["<base64>", ...]
+// }
+// ```
+//
+// "path" and "text" are only there for people and tools reading the diff.
+// The Difference is reconstructed from "pathParts" and from "data", the
+// Noms encoding of each Value. Since the new Values may refer to other
+// chunks, "chunks" holds every chunk reachable from them, ordered so that
+// each one comes after all the chunks it refers to. Applying a Patch never
+// reads the chunks of the old Values, so those aren't written.
+type patchFileJSON struct {
+	Version     int                   `json:"version"`
+	From        string                `json:"from"`
+	To          string                `json:"to"`
+	Differences []patchFileDifference `json:"differences"`
+	Chunks      [][]byte              `json:"chunks"`
+}
+
+type patchFileDifference struct {
+	Path        string              `json:"path"`
+	PathParts   []patchFilePathPart `json:"pathParts"`
+	ChangeType  string              `json:"changeType"`
+	OldValue    *patchFileValue     `json:"oldValue,omitempty"`
+	NewValue    *patchFileValue     `json:"newValue,omitempty"`
+	NewKeyValue *patchFileValue     `json:"newKeyValue,omitempty"`
+}
+
+// patchFilePathPart holds exactly one of Field, Index or Hash. Index is a
+// JSON bool, number or string, matching the Noms Value it stands for.
+type patchFilePathPart struct {
+	Field   string      `json:"field,omitempty"`
+	Index   interface{} `json:"index,omitempty"`
+	Hash    string      `json:"hash,omitempty"`
+	IntoKey bool        `json:"intoKey,omitempty"`
+}
+
+type patchFileValue struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Data []byte `json:"data"`
+}
+
+// WritePatch writes the Patch that turns v1 into v2, as computed by Diff()
+// using the left-right diff, to w in JSON. The Patch can be read back with
+// ReadPatch(), into this or any other database. Any chunks that the new
+// Values refer to are written along with them, and are read using vr.
+func WritePatch(w io.Writer, v1, v2 types.Value, vr types.ValueReader) error {
+	dChan := make(chan Difference)
+	sChan := make(chan struct{})
+	go func() {
+		Diff(v1, v2, dChan, sChan, true)
+		close(dChan)
+	}()
+
+	pf := patchFileJSON{Version: patchFileVersion, From: v1.Hash().String(), To: v2.Hash().String(), Differences: []patchFileDifference{}, Chunks: [][]byte{}}
+	seen := hash.HashSet{}
+	encodeValue := func(v types.Value, withChunks bool) *patchFileValue {
+		if v == nil {
+			return nil
+		}
+		if withChunks {
+			pf.Chunks = appendReachableChunks(pf.Chunks, v, vr, seen)
+		}
+		return &patchFileValue{Type: v.Type().Describe(), Text: types.EncodedValueMaxLines(v, patchFileTextLines), Data: types.EncodeValue(v, nil).Data()}
+	}
+	for dif := range dChan {
+		pf.Differences = append(pf.Differences, patchFileDifference{
+			Path:        dif.Path.String(),
+			PathParts:   encodePath(dif.Path),
+			ChangeType:  changeTypeNames[dif.ChangeType],
+			OldValue:    encodeValue(dif.OldValue, false),
+			NewValue:    encodeValue(dif.NewValue, true),
+			NewKeyValue: encodeValue(dif.NewKeyValue, true),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(pf)
+}
+
+// PatchFile is a Patch read by ReadPatch(), along with the hashes of the
+// values it was computed from, and the chunks that came with it.
+type PatchFile struct {
+	Patch    Patch
+	From, To hash.Hash
+	chunks   []types.Value
+}
+
+// WriteChunks writes the chunks that came with the Patch to vw, so that the
+// result of applying it can be committed there. Until it's called, the new
+// Values in the Patch may refer to chunks that vw doesn't have.
+func (pf PatchFile) WriteChunks(vw types.ValueWriter) {
+	for _, v := range pf.chunks {
+		vw.WriteValue(v)
+	}
+}
+
+// ReadPatch reads a Patch written by WritePatch() from r. Nothing is written
+// anywhere, so the Patch can be checked before its chunks are written with
+// WriteChunks(). The Values in it are decoded using vr.
+func ReadPatch(r io.Reader, vr types.ValueReader) (pf PatchFile, err error) {
+	pj := patchFileJSON{}
+	if err = json.NewDecoder(r).Decode(&pj); err != nil {
+		return
+	}
+	if pj.Version != patchFileVersion {
+		err = fmt.Errorf("Unsupported patch version %d", pj.Version)
+		return
+	}
+	var ok bool
+	if pf.From, ok = hash.MaybeParse(pj.From); !ok {
+		err = fmt.Errorf("Invalid hash: %s", pj.From)
+		return
+	}
+	if pf.To, ok = hash.MaybeParse(pj.To); !ok {
+		err = fmt.Errorf("Invalid hash: %s", pj.To)
+		return
+	}
+
+	pf.chunks = make([]types.Value, 0, len(pj.Chunks))
+	for i, data := range pj.Chunks {
+		var v types.Value
+		if v, err = decodeValueData(data, vr); err != nil {
+			err = fmt.Errorf("Invalid chunk %d: %s", i, err)
+			return
+		}
+		pf.chunks = append(pf.chunks, v)
+	}
+
+	changeTypes := map[string]types.DiffChangeType{}
+	for ct, name := range changeTypeNames {
+		changeTypes[name] = ct
+	}
+	var path string
+	decodeValue := func(v *patchFileValue) types.Value {
+		if v == nil || err != nil {
+			return nil
+		}
+		dv, e := decodeValueData(v.Data, vr)
+		if e != nil {
+			err = fmt.Errorf("Invalid value at %s: %s", path, e)
+		}
+		return dv
+	}
+	pf.Patch = make(Patch, 0, len(pj.Differences))
+	for _, pd := range pj.Differences {
+		path = pd.Path
+		ct, ok := changeTypes[pd.ChangeType]
+		if !ok {
+			err = fmt.Errorf("Invalid change type %q at %s", pd.ChangeType, pd.Path)
+			return
+		}
+		var p types.Path
+		if p, err = decodePath(pd.PathParts); err != nil {
+			return
+		}
+		pf.Patch = append(pf.Patch, Difference{
+			Path:        p,
+			ChangeType:  ct,
+			OldValue:    decodeValue(pd.OldValue),
+			NewValue:    decodeValue(pd.NewValue),
+			NewKeyValue: decodeValue(pd.NewKeyValue),
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decodeValueData decodes the Noms encoding of a Value, returning an error,
+// rather than panicking, if it's malformed.
+func decodeValueData(data []byte, vr types.ValueReader) (v types.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return types.DecodeValue(chunks.NewChunk(data), vr), nil
+}
+
+// appendReachableChunks appends the chunks reachable from the Refs in v that
+// aren't already in seen, each one after the chunks it refers to.
+func appendReachableChunks(cs [][]byte, v types.Value, vr types.ValueReader, seen hash.HashSet) [][]byte {
+	v.WalkRefs(func(r types.Ref) {
+		h := r.TargetHash()
+		if seen.Has(h) {
+			return
+		}
+		seen.Insert(h)
+		target := vr.ReadValue(h)
+		d.PanicIfTrue(target == nil)
+		cs = appendReachableChunks(cs, target, vr, seen)
+		cs = append(cs, types.EncodeValue(target, nil).Data())
+	})
+	return cs
+}
+
+func encodePath(p types.Path) []patchFilePathPart {
+	parts := make([]patchFilePathPart, 0, len(p))
+	for _, pp := range p {
+		switch pp := pp.(type) {
+		case types.FieldPath:
+			parts = append(parts, patchFilePathPart{Field: pp.Name})
+		case types.IndexPath:
+			var idx interface{}
+			switch v := pp.Index.(type) {
+			case types.Bool:
+				idx = bool(v)
+			case types.Number:
+				idx = float64(v)
+			case types.String:
+				idx = string(v)
+			default:
+				d.Panic("Unexpected path index %s", types.EncodedValue(v))
+			}
+			parts = append(parts, patchFilePathPart{Index: idx, IntoKey: pp.IntoKey})
+		case types.HashIndexPath:
+			parts = append(parts, patchFilePathPart{Hash: pp.Hash.String(), IntoKey: pp.IntoKey})
+		default:
+			d.Panic("Unexpected path part %s", pp)
+		}
+	}
+	return parts
+}
+
+func decodePath(parts []patchFilePathPart) (types.Path, error) {
+	var p types.Path
+	for _, part := range parts {
+		switch {
+		case part.Field != "":
+			p = append(p, types.NewFieldPath(part.Field))
+		case part.Hash != "":
+			h, ok := hash.MaybeParse(part.Hash)
+			if !ok {
+				return nil, fmt.Errorf("Invalid hash: %s", part.Hash)
+			}
+			if part.IntoKey {
+				p = append(p, types.NewHashIndexIntoKeyPath(h))
+			} else {
+				p = append(p, types.NewHashIndexPath(h))
+			}
+		default:
+			var idx types.Value
+			switch v := part.Index.(type) {
+			case bool:
+				idx = types.Bool(v)
+			case float64:
+				idx = types.Number(v)
+			case string:
+				idx = types.String(v)
+			default:
+				return nil, fmt.Errorf("Invalid path index: %v", part.Index)
+			}
+			if part.IntoKey {
+				p = append(p, types.NewIndexIntoKeyPath(idx))
+			} else {
+				p = append(p, types.NewIndexPath(idx))
+			}
+		}
+	}
+	return p, nil
+}
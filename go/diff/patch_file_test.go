@@ -0,0 +1,153 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func assertPatchesEqual(assert *assert.Assertions, expected, actual Patch, msgAndArgs ...interface{}) {
+	equals := func(v1, v2 types.Value) bool {
+		if v1 == nil || v2 == nil {
+			return v1 == v2
+		}
+		return v1.Equals(v2)
+	}
+	if !assert.Equal(len(expected), len(actual), msgAndArgs...) {
+		return
+	}
+	for i, dif := range expected {
+		act := actual[i]
+		assert.True(dif.Path.Equals(act.Path), msgAndArgs...)
+		assert.Equal(dif.ChangeType, act.ChangeType, msgAndArgs...)
+		assert.True(equals(dif.OldValue, act.OldValue), msgAndArgs...)
+		assert.True(equals(dif.NewValue, act.NewValue), msgAndArgs...)
+		assert.True(equals(dif.NewKeyValue, act.NewKeyValue), msgAndArgs...)
+	}
+}
+
+func TestPatchFileRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	for k1, v1 := range testValues() {
+		for k2, v2 := range testValues() {
+			if k1 == k2 {
+				continue
+			}
+			buf := &bytes.Buffer{}
+			assert.NoError(WritePatch(buf, v1, v2, vs))
+			pf, err := ReadPatch(buf, vs)
+			assert.NoError(err)
+			assert.Equal(v1.Hash(), pf.From)
+			assert.Equal(v2.Hash(), pf.To)
+			assertPatchesEqual(assert, getPatch(v1, v2), pf.Patch, "patch from %s to %s", k1, k2)
+			assert.True(v2.Equals(Apply(v1, pf.Patch)), "failed to apply patch from %s to %s", k1, k2)
+		}
+	}
+}
+
+func TestPatchFileUnusualPaths(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	v1 := types.NewMap(
+		types.String("line\nbreak"), types.Number(1),
+		types.Number(0.1), types.Bool(false),
+		types.NewList(types.Number(1)), types.String("struct key"),
+	)
+	v2 := v1.Set(types.String("line\nbreak"), types.Number(2)).
+		Set(types.Number(0.1), types.Bool(true)).
+		Set(types.NewList(types.Number(1)), types.String("changed"))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(WritePatch(buf, v1, v2, vs))
+	pf, err := ReadPatch(buf, vs)
+	assert.NoError(err)
+	assertPatchesEqual(assert, getPatch(v1, v2), pf.Patch)
+	assert.True(v2.Equals(Apply(v1, pf.Patch)))
+}
+
+func TestPatchFileBetweenDatabases(t *testing.T) {
+	assert := assert.New(t)
+
+	// The new value is big enough to be chunked, so its chunks must travel with the patch.
+	newValue := func(vs *types.ValueStore) types.Value {
+		items := make([]types.Value, 10000)
+		for i := range items {
+			items[i] = types.String(strings.Repeat("x", i%100))
+		}
+		l := vs.WriteValue(types.NewList(items...)).TargetValue(vs)
+		return types.NewStruct("S", types.StructData{"list": l, "ref": vs.WriteValue(types.Number(42))})
+	}
+	oldValue := types.NewStruct("S", types.StructData{})
+
+	src := types.NewTestValueStore()
+	v2 := newValue(src)
+	buf := &bytes.Buffer{}
+	assert.NoError(WritePatch(buf, oldValue, v2, src))
+
+	pj := patchFileJSON{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &pj))
+	assert.NotEmpty(pj.Chunks)
+
+	sink := types.NewTestValueStore()
+	pf, err := ReadPatch(buf, sink)
+	assert.NoError(err)
+	pf.WriteChunks(sink)
+	applied := Apply(oldValue, pf.Patch)
+	assert.Equal(pf.To, applied.Hash())
+	assert.True(sink.WriteValue(applied).TargetValue(sink).Equals(v2))
+}
+
+func TestPatchFileChunks(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	// Only the chunks of the new value travel with the patch, since applying it never reads the old one.
+	oldRef := vs.WriteValue(types.String("old"))
+	newRef := vs.WriteValue(types.String("new"))
+	v1 := types.NewStruct("S", types.StructData{"r": oldRef})
+	v2 := types.NewStruct("S", types.StructData{"r": newRef})
+	buf := &bytes.Buffer{}
+	assert.NoError(WritePatch(buf, v1, v2, vs))
+
+	pj := patchFileJSON{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &pj))
+	assert.Equal([][]byte{types.EncodeValue(types.String("new"), nil).Data()}, pj.Chunks)
+
+	// Nothing is written until the patch has been checked.
+	sink := types.NewTestValueStore()
+	pf, err := ReadPatch(buf, sink)
+	assert.NoError(err)
+	assert.Nil(sink.ReadValue(newRef.TargetHash()))
+	pf.WriteChunks(sink)
+	assert.True(v2.Equals(Apply(v1, pf.Patch)))
+	assert.True(sink.ReadValue(newRef.TargetHash()).Equals(types.String("new")))
+	assert.Nil(sink.ReadValue(oldRef.TargetHash()))
+}
+
+func TestPatchFileErrors(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	_, err := ReadPatch(strings.NewReader("not json"), vs)
+	assert.Error(err)
+	_, err = ReadPatch(strings.NewReader(`{"version": 99}`), vs)
+	assert.EqualError(err, "Unsupported patch version 99")
+
+	// Malformed Noms encodings are errors, rather than panics.
+	h := types.Number(1).Hash().String()
+	_, err = ReadPatch(strings.NewReader(`{"version": 1, "from": "`+h+`", "to": "`+h+`", "chunks": ["/w=="]}`), vs)
+	assert.Error(err)
+	_, err = ReadPatch(strings.NewReader(`{"version": 1, "from": "`+h+`", "to": "`+h+`", "differences": [{"path": ".x", "pathParts": [{"field": "x"}], "changeType": "added", "newValue": {"data": "/w=="}}]}`), vs)
+	assert.Error(err)
+}
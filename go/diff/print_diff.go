@@ -32,7 +32,10 @@ func PrintDiff(w io.Writer, v1, v2 types.Value, leftRight bool) (err error) {
 	// values being compared have a parent.
 	if !shouldDescend(v1, v2) {
 		line(w, DEL, nil, v1)
-		return line(w, ADD, nil, v2)
+		if err = line(w, ADD, nil, v2); err != nil {
+			return
+		}
+		return blobDiff(w, v1, v2)
 	}
 
 	dChan := make(chan Difference, 16)
@@ -100,6 +103,9 @@ func PrintDiff(w io.Writer, v1, v2 types.Value, leftRight bool) (err error) {
 		if d.NewValue != nil {
 			err = pfunc(w, ADD, key, d.NewValue)
 		}
+		if err == nil && d.OldValue != nil && d.NewValue != nil {
+			err = blobDiff(w, d.OldValue, d.NewValue)
+		}
 		if err != nil {
 			stopDiff()
 			break
@@ -162,6 +168,19 @@ func writeEncodedValue(w io.Writer, v types.Value) error {
 	return write(w, []byte(")"))
 }
 
+// blobDiff writes the differences between v1 and v2, indented under the lines describing them, if both are Blobs.
+func blobDiff(w io.Writer, v1, v2 types.Value) error {
+	b1, ok1 := v1.(types.Blob)
+	b2, ok2 := v2.(types.Blob)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	genPrefix := func(w *writers.PrefixWriter) []byte {
+		return []byte("    ")
+	}
+	return PrintBlobDiff(&writers.PrefixWriter{Dest: w, PrefixFunc: genPrefix, NeedsPrefix: true}, b1, b2)
+}
+
 func write(w io.Writer, b []byte) error {
 	_, err := w.Write(b)
 	return err
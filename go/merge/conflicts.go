@@ -0,0 +1,199 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/go/types"
+)
+
+const (
+	// ConflictStructName is the name of the Noms struct used to record a
+	// single Conflict. See ConflictsToMap() for the layout.
+	ConflictStructName = "Conflict"
+	// ResolutionStructName is the name of the Noms struct that settles a
+	// recorded Conflict. See NewConflictResolver().
+	ResolutionStructName = "Resolution"
+
+	OursField       = "ours"
+	TheirsField     = "theirs"
+	AncestorField   = "ancestor"
+	ResolvedField   = "resolved"
+	ResolutionField = "value"
+)
+
+// Conflict describes a change at Path that ThreeWay() could not merge on its
+// own. Ours, Theirs and Ancestor hold the Values found at Path in a, b and
+// the common ancestor respectively, or nil if there was no Value at Path.
+type Conflict struct {
+	Path                   types.Path
+	Ours, Theirs, Ancestor types.Value
+}
+
+// ConflictCollector gathers up conflicts encountered during a merge, rather
+// than failing on the first one. Pass its Resolve method to ThreeWay() as
+// the ResolveFunc. Every conflict the wrapped ResolveFunc cannot settle is
+// recorded and, so that the merge can carry on, tentatively resolved in
+// favor of a. Conflicts that ThreeWay() never hands to a ResolveFunc, such as
+// overlapping List splices, still cause the merge to fail.
+type ConflictCollector struct {
+	Conflicts []Conflict
+	ancestor  types.Value
+	vr        types.ValueReader
+	resolve   ResolveFunc
+}
+
+// NewConflictCollector returns a ConflictCollector for a merge whose common
+// ancestor is |ancestor|. Any Refs along a conflicting path in |ancestor| are
+// read via |vr|. If |resolve| is nil, every conflict is recorded.
+func NewConflictCollector(ancestor types.Value, vr types.ValueReader, resolve ResolveFunc) *ConflictCollector {
+	if resolve == nil {
+		resolve = None
+	}
+	return &ConflictCollector{ancestor: ancestor, vr: vr, resolve: resolve}
+}
+
+// Resolve is a ResolveFunc that records any conflict it can't resolve.
+func (cc *ConflictCollector) Resolve(aChange, bChange types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
+	if change, merged, ok = cc.resolve(aChange, bChange, a, b, path); ok {
+		return
+	}
+	path = append(types.Path{}, path...)
+	cc.Conflicts = append(cc.Conflicts, Conflict{path, a, b, resolvePath(path, cc.ancestor, cc.vr)})
+	return aChange, a, true
+}
+
+// ConflictsToMap encodes conflicts as a Noms Map from the String form of
+// each Conflict's Path to a struct of the form:
+//
+// ```
+// struct Conflict {
+//   ancestor?: Value,
+//   ours?: Value,
+//   theirs?: Value,
+// }
+// ```
+//
+// where a field is omitted if there was no Value on that side.
+func ConflictsToMap(conflicts []Conflict) types.Map {
+	kvs := make([]types.Value, 0, 2*len(conflicts))
+	for _, c := range conflicts {
+		data := types.StructData{}
+		for name, v := range map[string]types.Value{OursField: c.Ours, TheirsField: c.Theirs, AncestorField: c.Ancestor} {
+			if v != nil {
+				data[name] = v
+			}
+		}
+		kvs = append(kvs, types.String(c.Path.String()), types.NewStruct(ConflictStructName, data))
+	}
+	return types.NewMap(kvs...)
+}
+
+// NewConflictResolver returns a ResolveFunc that settles conflicts using
+// the resolutions recorded in |conflicts|, a Map in the form produced by
+// ConflictsToMap(). A conflict is resolved by adding a field named
+// "resolved" to its Conflict struct, holding a struct of the form:
+//
+// ```
+// struct Resolution {
+//   value?: Value,
+// }
+// ```
+//
+// If value is present, it becomes the merged value at the conflicting path.
+// Otherwise, the path is removed from the merged value. Conflicts that have
+// not been resolved this way, or that are not in |conflicts| at all, are
+// passed on to |fallback|. Since |conflicts| is meant to be edited by hand,
+// NewConflictResolver returns an error if it isn't in that form.
+func NewConflictResolver(conflicts types.Map, fallback ResolveFunc) (ResolveFunc, error) {
+	if err := checkConflicts(conflicts); err != nil {
+		return nil, err
+	}
+	if fallback == nil {
+		fallback = None
+	}
+	return func(aChange, bChange types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
+		if resolution, ok := lookupResolution(conflicts, path); ok {
+			if v, ok := resolution.MaybeGet(ResolutionField); ok {
+				if aChange != types.DiffChangeRemoved {
+					return aChange, v, true
+				}
+				return bChange, v, true
+			}
+			return types.DiffChangeRemoved, nil, true
+		}
+		return fallback(aChange, bChange, a, b, path)
+	}, nil
+}
+
+// NewResolution returns a Resolution struct that settles a conflict in
+// favor of |v| or, if |v| is nil, by removing the conflicting path.
+func NewResolution(v types.Value) types.Struct {
+	data := types.StructData{}
+	if v != nil {
+		data[ResolutionField] = v
+	}
+	return types.NewStruct(ResolutionStructName, data)
+}
+
+// checkConflicts returns an error if |conflicts| is not a Map in the form
+// that NewConflictResolver() describes.
+func checkConflicts(conflicts types.Map) (err error) {
+	conflicts.IterAll(func(k, c types.Value) {
+		if err != nil {
+			return
+		}
+		path, ok := k.(types.String)
+		if !ok {
+			err = fmt.Errorf("Conflicts must be keyed by path, not %s", k.Type().Describe())
+			return
+		}
+		conflict, ok := c.(types.Struct)
+		if !ok {
+			err = fmt.Errorf("Conflict at %s must be a struct, not %s", path, c.Type().Describe())
+			return
+		}
+		if r, ok := conflict.MaybeGet(ResolvedField); ok {
+			if _, ok := r.(types.Struct); !ok {
+				err = fmt.Errorf("Resolution of conflict at %s must be a struct, not %s", path, r.Type().Describe())
+			}
+		}
+	})
+	return
+}
+
+// lookupResolution returns the resolution of the conflict at |path| in
+// |conflicts|, which checkConflicts() has accepted, if it has one.
+func lookupResolution(conflicts types.Map, path types.Path) (resolution types.Struct, ok bool) {
+	c, ok := conflicts.MaybeGet(types.String(path.String()))
+	if !ok {
+		return
+	}
+	r, ok := c.(types.Struct).MaybeGet(ResolvedField)
+	if !ok {
+		return
+	}
+	return r.(types.Struct), true
+}
+
+// resolvePath is like path.Resolve(v), except that it reads through any Refs
+// it finds along the way, as ThreeWay() does.
+func resolvePath(path types.Path, v types.Value, vr types.ValueReader) types.Value {
+	for _, part := range path {
+		if v == nil {
+			return nil
+		}
+		for {
+			r, ok := v.(types.Ref)
+			if !ok {
+				break
+			}
+			v = r.TargetValue(vr)
+		}
+		v = part.Resolve(v)
+	}
+	return v
+}
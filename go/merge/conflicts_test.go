@@ -0,0 +1,94 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestConflictCollector(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	nested := func(n float64) types.Ref {
+		return vs.WriteValue(types.NewMap(types.String("n"), types.Number(n)))
+	}
+	parent := types.NewStruct("", types.StructData{"num": types.Number(1), "ref": nested(1), "str": types.String("a"), "gone": types.Bool(true)})
+	a := types.NewStruct("", types.StructData{"num": types.Number(2), "ref": nested(2), "str": types.String("b")})
+	b := types.NewStruct("", types.StructData{"num": types.Number(3), "ref": nested(3), "str": types.String("b"), "gone": types.Bool(false)})
+
+	cc := NewConflictCollector(parent, vs, nil)
+	merged, err := ThreeWay(a, b, parent, vs, cc.Resolve, nil)
+	assert.NoError(err)
+	// Conflicts are tentatively resolved in favor of a.
+	assert.True(a.Equals(merged))
+
+	conflicts := map[string]Conflict{}
+	for _, c := range cc.Conflicts {
+		conflicts[c.Path.String()] = c
+	}
+	assert.Len(conflicts, 3)
+	assert.Equal(Conflict{types.MustParsePath(".num"), types.Number(2), types.Number(3), types.Number(1)}, conflicts[".num"])
+	assert.Equal(Conflict{types.MustParsePath(`.ref["n"]`), types.Number(2), types.Number(3), types.Number(1)}, conflicts[`.ref["n"]`])
+	assert.Equal(Conflict{types.MustParsePath(".gone"), nil, types.Bool(false), types.Bool(true)}, conflicts[".gone"])
+
+	m := ConflictsToMap(cc.Conflicts)
+	assert.Equal(uint64(3), m.Len())
+	gone := m.Get(types.String(".gone")).(types.Struct)
+	_, hasOurs := gone.MaybeGet(OursField)
+	assert.False(hasOurs)
+	assert.Equal(types.Bool(false), gone.Get(TheirsField))
+	assert.Equal(types.Bool(true), gone.Get(AncestorField))
+
+	// Resolving only some of the conflicts leaves the rest to the fallback.
+	m = m.Set(types.String(".num"), m.Get(types.String(".num")).(types.Struct).Set(ResolvedField, NewResolution(types.Number(4))))
+	m = m.Set(types.String(".gone"), gone.Set(ResolvedField, NewResolution(nil)))
+	resolve, err := NewConflictResolver(m, nil)
+	assert.NoError(err)
+	_, err = ThreeWay(a, b, parent, vs, resolve, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	resolve, err = NewConflictResolver(m, Theirs)
+	assert.NoError(err)
+	merged, err = ThreeWay(a, b, parent, vs, resolve, nil)
+	assert.NoError(err)
+	assert.True(types.NewStruct("", types.StructData{"num": types.Number(4), "ref": nested(3), "str": types.String("b")}).Equals(merged))
+}
+
+func TestConflictCollectorUsesResolveFunc(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	parent := types.NewMap(types.String("k"), types.Number(1))
+	a := types.NewMap(types.String("k"), types.Number(2))
+	b := types.NewMap(types.String("k"), types.Number(3))
+
+	cc := NewConflictCollector(parent, vs, Theirs)
+	merged, err := ThreeWay(a, b, parent, vs, cc.Resolve, nil)
+	assert.NoError(err)
+	assert.True(b.Equals(merged))
+	assert.Empty(cc.Conflicts)
+}
+
+func TestConflictResolverRejectsMalformedConflicts(t *testing.T) {
+	assert := assert.New(t)
+	resolved := types.NewStruct(ConflictStructName, types.StructData{ResolvedField: NewResolution(types.Number(1))})
+
+	for _, m := range []types.Map{
+		types.NewMap(types.Number(1), resolved),
+		types.NewMap(types.String(".num"), types.Number(1)),
+		types.NewMap(types.String(".num"), types.NewStruct(ConflictStructName, types.StructData{ResolvedField: types.Number(1)})),
+	} {
+		_, err := NewConflictResolver(m, nil)
+		assert.Error(err)
+	}
+	_, err := NewConflictResolver(types.NewMap(types.String(".num"), resolved), nil)
+	assert.NoError(err)
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"sync"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// FieldResolveFunc is the type of the callbacks held in a Registry. When
+// both merge candidates make different changes to a registered field, the
+// callback is handed the field's value in each candidate and in their common
+// ancestor, any of which is nil if the field isn't present on that side. If
+// the changes can be merged, the callback should return the merged value, or
+// nil to remove the field, and true. Otherwise, ok should be false and the
+// conflict is passed on to the ResolveFunc given to ThreeWay().
+type FieldResolveFunc func(a, b, ancestor types.Value) (merged types.Value, ok bool)
+
+// Registry maps struct names and field paths to FieldResolveFuncs that know
+// how to merge those fields, e.g. by adding up the changes made to a counter
+// on either side. The field path is relative to the named struct, so it may
+// reach into nested values, e.g. `.stats.count` or `.tags["owner"]`.
+type Registry struct {
+	mu        sync.RWMutex
+	resolvers map[string]map[string]FieldResolveFunc
+}
+
+// DefaultRegistry is consulted by ThreeWay() and NewThreeWay().
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{resolvers: map[string]map[string]FieldResolveFunc{}}
+}
+
+// Register adds resolve to DefaultRegistry for the field at fieldPath within
+// structs named structName.
+func Register(structName string, fieldPath types.Path, resolve FieldResolveFunc) {
+	DefaultRegistry.Register(structName, fieldPath, resolve)
+}
+
+// Register makes resolve the FieldResolveFunc for the field at fieldPath
+// within structs named structName, replacing any that was registered before.
+func (r *Registry) Register(structName string, fieldPath types.Path, resolve FieldResolveFunc) {
+	d.PanicIfTrue(len(fieldPath) == 0)
+	d.PanicIfTrue(resolve == nil)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fields, ok := r.resolvers[structName]
+	if !ok {
+		fields = map[string]FieldResolveFunc{}
+		r.resolvers[structName] = fields
+	}
+	fields[fieldPath.String()] = resolve
+}
+
+// Unregister removes the FieldResolveFunc, if any, for the field at
+// fieldPath within structs named structName.
+func (r *Registry) Unregister(structName string, fieldPath types.Path) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fields, ok := r.resolvers[structName]; ok {
+		delete(fields, fieldPath.String())
+		if len(fields) == 0 {
+			delete(r.resolvers, structName)
+		}
+	}
+}
+
+func (r *Registry) lookup(structName string, fieldPath types.Path) FieldResolveFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolvers[structName][fieldPath.String()]
+}
+
+// ThreeWay is like the package-level ThreeWay(), but consults r rather than
+// DefaultRegistry.
+func (r *Registry) ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, resolve ResolveFunc, progress chan struct{}) (merged types.Value, err error) {
+	return threeWay(a, b, parent, vrw, r, resolve, progress)
+}
+
+// NewThreeWay is like the package-level NewThreeWay(), but consults r rather
+// than DefaultRegistry.
+func (r *Registry) NewThreeWay(resolve ResolveFunc) Policy {
+	return func(a, b, parent types.Value, vrw types.ValueReadWriter, progress chan struct{}) (merged types.Value, err error) {
+		return r.ThreeWay(a, b, parent, vrw, resolve, progress)
+	}
+}
+
+// AddDeltas is a FieldResolveFunc for counters. It merges two Numbers by
+// applying the change made on each side to the ancestor, e.g. a counter
+// incremented by 2 on one side and by 3 on the other ends up 5 larger. If
+// the field was added on both sides, the two values are summed.
+func AddDeltas(a, b, ancestor types.Value) (merged types.Value, ok bool) {
+	aNum, aOk := a.(types.Number)
+	bNum, bOk := b.(types.Number)
+	if !aOk || !bOk {
+		return nil, false
+	}
+	pNum := types.Number(0)
+	if ancestor != nil {
+		if pNum, ok = ancestor.(types.Number); !ok {
+			return nil, false
+		}
+	}
+	return aNum + bNum - pNum, true
+}
+
+// Max is a FieldResolveFunc that keeps the greater of two values, e.g. the
+// later of two timestamps for last-writer-wins fields. If the field was
+// removed on either side, the conflict is not resolved.
+func Max(a, b, ancestor types.Value) (merged types.Value, ok bool) {
+	if a == nil || b == nil {
+		return nil, false
+	}
+	if a.Less(b) {
+		return b, true
+	}
+	return a, true
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestRegistryFieldResolvers(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	r := NewRegistry()
+	r.Register("Counter", types.MustParsePath(".count"), AddDeltas)
+	r.Register("Counter", types.MustParsePath(".updatedAt"), Max)
+	r.Register("Doc", types.MustParsePath(`.stats["views"]`), AddDeltas)
+
+	counter := func(count, updatedAt float64, name string) types.Struct {
+		return types.NewStruct("Counter", types.StructData{
+			"count":     types.Number(count),
+			"updatedAt": types.Number(updatedAt),
+			"name":      types.String(name),
+		})
+	}
+	doc := func(views float64, c types.Struct) types.Struct {
+		return types.NewStruct("Doc", types.StructData{
+			"stats":   types.NewMap(types.String("views"), types.Number(views)),
+			"counter": c,
+		})
+	}
+
+	parent := doc(10, counter(5, 100, "x"))
+	a := doc(12, counter(7, 200, "x"))
+	b := doc(15, counter(8, 150, "x"))
+
+	merged, err := r.ThreeWay(a, b, parent, vs, nil, nil)
+	assert.NoError(err)
+	assert.True(doc(17, counter(10, 200, "x")).Equals(merged), types.EncodedValue(merged))
+
+	// Fields without a registered resolver still conflict.
+	_, err = r.ThreeWay(doc(12, counter(7, 200, "y")), doc(15, counter(8, 150, "z")), parent, vs, nil, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	merged, err = r.ThreeWay(doc(12, counter(7, 200, "y")), doc(15, counter(8, 150, "z")), parent, vs, Theirs, nil)
+	assert.NoError(err)
+	assert.True(doc(17, counter(10, 200, "z")).Equals(merged))
+
+	// The package-level ThreeWay() doesn't know about r.
+	_, err = ThreeWay(a, b, parent, vs, nil, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	r.Unregister("Doc", types.MustParsePath(`.stats["views"]`))
+	_, err = r.ThreeWay(a, b, parent, vs, nil, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+}
+
+func TestRegistryFallsBackWhenResolverDeclines(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	r := NewRegistry()
+	r.Register("Counter", types.MustParsePath(".count"), AddDeltas)
+
+	parent := types.NewStruct("Counter", types.StructData{"count": types.Number(1)})
+	a := types.NewStruct("Counter", types.StructData{"count": types.String("lots")})
+	b := types.NewStruct("Counter", types.StructData{"count": types.Number(3)})
+
+	_, err := r.ThreeWay(a, b, parent, vs, nil, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	merged, err := r.NewThreeWay(Ours)(a, b, parent, vs, nil)
+	assert.NoError(err)
+	assert.True(a.Equals(merged))
+}
+
+func TestBuiltinFieldResolvers(t *testing.T) {
+	assert := assert.New(t)
+
+	merged, ok := AddDeltas(types.Number(3), types.Number(4), nil)
+	assert.True(ok)
+	assert.Equal(types.Number(7), merged)
+	_, ok = AddDeltas(nil, types.Number(4), types.Number(1))
+	assert.False(ok)
+
+	merged, ok = Max(types.String("2017-01-02"), types.String("2017-01-01"), nil)
+	assert.True(ok)
+	assert.Equal(types.String("2017-01-02"), merged)
+	_, ok = Max(types.Number(1), nil, types.Number(0))
+	assert.False(ok)
+}
@@ -59,9 +59,22 @@ func newMergeConflict(format string, args ...interface{}) *ErrMergeConflict {
 
 // Creates a new Policy based on ThreeWay using the provided ResolveFunc.
 func NewThreeWay(resolve ResolveFunc) Policy {
-	return func(a, b, parent types.Value, vrw types.ValueReadWriter, progress chan struct{}) (merged types.Value, err error) {
-		return ThreeWay(a, b, parent, vrw, resolve, progress)
+	return DefaultRegistry.NewThreeWay(resolve)
+}
+
+// NamedPolicy returns the Policy called |name|. "none" merges, failing on any
+// conflict, while "ours" and "theirs" resolve conflicts with Ours and Theirs.
+// Unlike a Policy, a name can be sent to a server to merge with there.
+func NamedPolicy(name string) (Policy, error) {
+	switch name {
+	case "none":
+		return NewThreeWay(None), nil
+	case "ours":
+		return NewThreeWay(Ours), nil
+	case "theirs":
+		return NewThreeWay(Theirs), nil
 	}
+	return nil, fmt.Errorf("Unknown merge policy %s, must be none, ours or theirs", name)
 }
 
 // ThreeWay attempts a three-way merge between two _candidate_ values that
@@ -72,7 +85,9 @@ func NewThreeWay(resolve ResolveFunc) Policy {
 //
 // - If any of the three values have a different [kind](link): conflict
 // - If the two candidates are identical: the result is that value
-// - If the values are primitives or Blob: conflict
+// - If the values are primitives: conflict
+// - If the values are Blobs:
+//   - Apply blob-merge, which is list-merge on bytes (see below)
 // - If the values are maps:
 //   - if the same key was inserted or updated in both candidates:
 //     - first run this same algorithm on those two values to attempt to merge them
@@ -132,7 +147,21 @@ func NewThreeWay(resolve ResolveFunc) Policy {
 // a:      [a, d, e]
 // b:      [a, d, e]
 // merged: [a, d, e]
+//
+// Blobs are merged using the same splice-based rules, with each byte treated
+// as an element. Blob diffs skip over chunks that are unchanged, so two
+// edits to different parts of a large Blob can be merged without reading all
+// of it.
+//
+// Before calling resolve on a conflict within a struct, ThreeWay checks
+// DefaultRegistry for a FieldResolveFunc registered for the struct's name and
+// the path of the conflict relative to the struct. If there is one, it is
+// given the first chance to merge the conflicting changes.
 func ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, resolve ResolveFunc, progress chan struct{}) (merged types.Value, err error) {
+	return threeWay(a, b, parent, vrw, DefaultRegistry, resolve, progress)
+}
+
+func threeWay(a, b, parent types.Value, vrw types.ValueReadWriter, registry *Registry, resolve ResolveFunc, progress chan struct{}) (merged types.Value, err error) {
 	describe := func(v types.Value) string {
 		if v != nil {
 			return v.Type().Describe()
@@ -149,23 +178,36 @@ func ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, resolve Resol
 	if resolve == nil {
 		resolve = None
 	}
-	m := &merger{vrw, resolve, progress}
+	m := &merger{vrw: vrw, registry: registry, resolve: resolve, progress: progress}
 	return m.threeWay(a, b, parent, types.Path{})
 }
 
-// a and b cannot be merged if they are of different NomsKind, or if at least one of the two is nil, or if either is a Noms primitive.
+// a and b cannot be merged if they are of different NomsKind, or if at least one of the two is nil, or if either is a Noms primitive other than Blob.
 func unmergeable(a, b types.Value) bool {
 	if a != nil && b != nil {
 		aKind, bKind := a.Type().Kind(), b.Type().Kind()
-		return aKind != bKind || types.IsPrimitiveKind(aKind) || types.IsPrimitiveKind(bKind)
+		return aKind != bKind || isUnmergeableKind(aKind) || isUnmergeableKind(bKind)
 	}
 	return true
 }
 
+func isUnmergeableKind(k types.NomsKind) bool {
+	return k != types.BlobKind && types.IsPrimitiveKind(k)
+}
+
 type merger struct {
 	vrw      types.ValueReadWriter
+	registry *Registry
 	resolve  ResolveFunc
 	progress chan<- struct{}
+	// structs holds the structs currently being merged, outermost first.
+	structs []structFrame
+}
+
+// structFrame records the name of a struct being merged and the length of the path at which it was found.
+type structFrame struct {
+	name  string
+	depth int
 }
 
 func updateProgress(progress chan<- struct{}) {
@@ -182,6 +224,11 @@ func (m *merger) threeWay(a, b, parent types.Value, path types.Path) (merged typ
 	}
 
 	switch a.Type().Kind() {
+	case types.BlobKind:
+		if aBlob, bBlob, pBlob, ok := blobAssert(a, b, parent); ok {
+			return threeWayBlobMerge(aBlob, bBlob, pBlob)
+		}
+
 	case types.ListKind:
 		if aList, bList, pList, ok := listAssert(a, b, parent); ok {
 			return threeWayListMerge(aList, bList, pList)
@@ -250,6 +297,9 @@ func (m *merger) threeWaySetMerge(a, b, parent types.Set, path types.Path) (merg
 }
 
 func (m *merger) threeWayStructMerge(a, b, parent types.Struct, path types.Path) (merged types.Value, err error) {
+	m.structs = append(m.structs, structFrame{a.Type().Desc.(types.StructDesc).Name, len(path)})
+	defer func() { m.structs = m.structs[:len(m.structs)-1] }()
+
 	apply := func(target candidate, change types.ValueChanged, newVal types.Value) candidate {
 		defer updateProgress(m.progress)
 		// Right now, this always iterates over all fields to create a new Struct, because there's no API for adding/removing a field from an existing struct type.
@@ -0,0 +1,66 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// threeWayBlobMerge merges Blobs the same way threeWayListMerge merges Lists,
+// treating each byte as an element. Blob.Diff() skips over chunks that are
+// the same in both versions, so the splices it produces are computed at chunk
+// granularity and only compare individual bytes within chunks that changed.
+// Edits to different parts of a Blob therefore merge cleanly, while edits
+// whose byte ranges overlap are a conflict unless they are identical.
+func threeWayBlobMerge(a, b, parent types.Blob) (merged types.Blob, err error) {
+	merged = parent
+	err = threeWaySpliceMerge(
+		func(changes chan<- types.Splice, stop <-chan struct{}) { a.Diff(parent, changes, stop) },
+		func(changes chan<- types.Splice, stop <-chan struct{}) { b.Diff(parent, changes, stop) },
+		func(aSplice, bSplice types.Splice) bool {
+			return aSplice == bSplice && bytes.Equal(readBlobRange(a, aSplice.SpFrom, aSplice.SpAdded), readBlobRange(b, bSplice.SpFrom, bSplice.SpAdded))
+		},
+		func(fromA bool, offset uint64, splice types.Splice) {
+			source := b
+			if fromA {
+				source = a
+			}
+			merged = merged.Splice(splice.SpAt+offset, splice.SpRemoved, readBlobRange(source, splice.SpFrom, splice.SpAdded))
+		})
+	if err != nil {
+		return parent, err
+	}
+	return merged, nil
+}
+
+func readBlobRange(b types.Blob, from, length uint64) []byte {
+	if length == 0 {
+		return nil
+	}
+	data := make([]byte, length)
+	r := b.Reader()
+	_, err := r.Seek(int64(from), 0)
+	d.PanicIfError(err)
+	if _, err = io.ReadFull(r, data); err != nil {
+		d.Panic("Blob diff returned a splice that inserts nonexistent bytes: %s", err)
+	}
+	return data
+}
+
+func blobAssert(a, b, parent types.Value) (aBlob, bBlob, pBlob types.Blob, ok bool) {
+	var aOk, bOk, pOk bool
+	aBlob, aOk = a.(types.Blob)
+	bBlob, bOk = b.(types.Blob)
+	if parent != nil {
+		pBlob, pOk = parent.(types.Blob)
+	} else {
+		pBlob, pOk = types.NewEmptyBlob(), true
+	}
+	return aBlob, bBlob, pBlob, aOk && bOk && pOk
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestThreeWayBlobMerge(t *testing.T) {
+	suite.Run(t, &ThreeWayBlobMergeSuite{})
+}
+
+type ThreeWayBlobMergeSuite struct {
+	suite.Suite
+	vs     *types.ValueStore
+	parent []byte
+}
+
+func (s *ThreeWayBlobMergeSuite) SetupTest() {
+	s.vs = types.NewTestValueStore()
+	s.parent = make([]byte, 1<<18)
+	rand.New(rand.NewSource(0)).Read(s.parent)
+}
+
+func (s *ThreeWayBlobMergeSuite) TearDownTest() {
+	s.vs.Close()
+}
+
+func (s *ThreeWayBlobMergeSuite) blob(data []byte) types.Blob {
+	return s.vs.ReadValue(s.vs.WriteValue(types.NewBlob(bytes.NewReader(data))).TargetHash()).(types.Blob)
+}
+
+// edit returns a copy of data with the bytes at [at, at+removed) replaced by added.
+func (s *ThreeWayBlobMergeSuite) edit(data []byte, at, removed int, added string) []byte {
+	out := append([]byte{}, data[:at]...)
+	out = append(out, added...)
+	return append(out, data[at+removed:]...)
+}
+
+func (s *ThreeWayBlobMergeSuite) tryMerge(a, b, expected []byte) {
+	merged, err := ThreeWay(s.blob(a), s.blob(b), s.blob(s.parent), s.vs, nil, nil)
+	if s.NoError(err) {
+		buf := &bytes.Buffer{}
+		_, err = io.Copy(buf, merged.(types.Blob).Reader())
+		s.NoError(err)
+		s.True(bytes.Equal(expected, buf.Bytes()), "merged blob differs from expected")
+	}
+}
+
+func (s *ThreeWayBlobMergeSuite) TestFarApartEdits() {
+	a := s.edit(s.parent, 1000, 10, "hello")
+	b := s.edit(s.parent, 200000, 0, "world")
+	s.tryMerge(a, b, s.edit(a, 200000-5, 0, "world"))
+	s.tryMerge(b, a, s.edit(a, 200000-5, 0, "world"))
+}
+
+func (s *ThreeWayBlobMergeSuite) TestNearbyEditsInSameChunk() {
+	a := s.edit(s.parent, 100, 3, "AAAA")
+	b := s.edit(s.parent, 300, 0, "BB")
+	s.tryMerge(a, b, s.edit(a, 301, 0, "BB"))
+}
+
+func (s *ThreeWayBlobMergeSuite) TestIdenticalEdits() {
+	a := s.edit(s.parent, 5000, 20, "same")
+	s.tryMerge(a, a, a)
+}
+
+func (s *ThreeWayBlobMergeSuite) TestOverlappingEditsConflict() {
+	a := s.edit(s.parent, 5000, 20, "mine")
+	b := s.edit(s.parent, 5010, 20, "yours")
+	_, err := ThreeWay(s.blob(a), s.blob(b), s.blob(s.parent), s.vs, nil, nil)
+	if s.Error(err) {
+		s.IsType(&ErrMergeConflict{}, err)
+		s.Contains(err.Error(), "Overlapping splices")
+	}
+}
+
+func (s *ThreeWayBlobMergeSuite) TestBlobsInMap() {
+	a := s.edit(s.parent, 1000, 10, "hello")
+	b := s.edit(s.parent, 200000, 0, "world")
+	mapOf := func(data []byte) types.Map {
+		return types.NewMap(types.String("file"), s.blob(data))
+	}
+	merged, err := ThreeWay(mapOf(a), mapOf(b), mapOf(s.parent), s.vs, nil, nil)
+	if s.NoError(err) {
+		s.True(mapOf(s.edit(a, 200000-5, 0, "world")).Equals(merged))
+	}
+}
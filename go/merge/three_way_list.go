@@ -12,15 +12,38 @@ import (
 )
 
 func threeWayListMerge(a, b, parent types.List) (merged types.List, err error) {
+	merged = parent
+	err = threeWaySpliceMerge(
+		func(changes chan<- types.Splice, stop <-chan struct{}) { a.Diff(parent, changes, stop) },
+		func(changes chan<- types.Splice, stop <-chan struct{}) { b.Diff(parent, changes, stop) },
+		func(aSplice, bSplice types.Splice) bool { return canMerge(a, b, aSplice, bSplice) },
+		func(fromA bool, offset uint64, splice types.Splice) {
+			source := b
+			if fromA {
+				source = a
+			}
+			merged = apply(source, merged, offset, splice)
+		})
+	if err != nil {
+		return parent, err
+	}
+	return merged, nil
+}
+
+// spliceDiffFunc streams the splices that turn a merge candidate's parent into the candidate.
+type spliceDiffFunc func(changes chan<- types.Splice, stop <-chan struct{})
+
+// threeWaySpliceMerge walks the splices produced by aDiff and bDiff in index order, calling apply for each splice that should be applied to the merge result, along with the offset between indices in the parent and indices in the result so far. fromA indicates which candidate the spliced-in elements should be taken from. Overlapping splices are passed to canMerge; if they can't be merged, threeWaySpliceMerge returns a conflict.
+func threeWaySpliceMerge(aDiff, bDiff spliceDiffFunc, canMerge func(aSplice, bSplice types.Splice) bool, apply func(fromA bool, offset uint64, splice types.Splice)) error {
 	aSpliceChan, bSpliceChan := make(chan types.Splice), make(chan types.Splice)
 	aStopChan, bStopChan := make(chan struct{}, 1), make(chan struct{}, 1)
 
 	go func() {
-		a.Diff(parent, aSpliceChan, aStopChan)
+		aDiff(aSpliceChan, aStopChan)
 		close(aSpliceChan)
 	}()
 	go func() {
-		b.Diff(parent, bSpliceChan, bStopChan)
+		bDiff(bSpliceChan, bStopChan)
 		close(bSpliceChan)
 	}()
 
@@ -43,7 +66,6 @@ func threeWayListMerge(a, b, parent types.List) (merged types.List, err error) {
 	}
 	invalidSplice := zeroToInvalid(types.Splice{})
 
-	merged = parent
 	offset := uint64(0)
 	aSplice, bSplice := invalidSplice, invalidSplice
 	for {
@@ -59,27 +81,26 @@ func threeWayListMerge(a, b, parent types.List) (merged types.List, err error) {
 			break
 		}
 		if overlap(aSplice, bSplice) {
-			if canMerge(a, b, aSplice, bSplice) {
+			if canMerge(aSplice, bSplice) {
 				splice := merge(aSplice, bSplice)
-				merged = apply(a, merged, offset, splice)
+				apply(true, offset, splice)
 				offset += splice.SpAdded - splice.SpRemoved
 				aSplice, bSplice = invalidSplice, invalidSplice
 				continue
 			}
-			return parent, newMergeConflict("Overlapping splices: %s vs %s", describeSplice(aSplice), describeSplice(bSplice))
+			return newMergeConflict("Overlapping splices: %s vs %s", describeSplice(aSplice), describeSplice(bSplice))
 		}
 		if aSplice.SpAt < bSplice.SpAt {
-			merged = apply(a, merged, offset, aSplice)
+			apply(true, offset, aSplice)
 			offset += aSplice.SpAdded - aSplice.SpRemoved
 			aSplice = invalidSplice
 			continue
 		}
-		merged = apply(b, merged, offset, bSplice)
+		apply(false, offset, bSplice)
 		offset += bSplice.SpAdded - bSplice.SpRemoved
 		bSplice = invalidSplice
 	}
-
-	return merged, nil
+	return nil
 }
 
 func overlap(s1, s2 types.Splice) bool {
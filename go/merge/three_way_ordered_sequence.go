@@ -73,6 +73,17 @@ func (m *merger) threeWayOrderedSequenceMerge(a, b, parent candidate, apply appl
 func (m *merger) mergeChanges(aChange, bChange types.ValueChanged, a, b, p candidate, apply applyFunc, path types.Path) (change types.ValueChanged, mergedVal types.Value, err error) {
 	path = a.pathConcat(aChange, path)
 	aValue, bValue := a.get(aChange.V), b.get(bChange.V)
+	if aChange.ChangeType == bChange.ChangeType && (aChange.ChangeType == types.DiffChangeRemoved || aValue.Equals(bValue)) {
+		// If both diffs generated a remove, or if the new value is the same in both, merge is fine.
+		return aChange, aValue, nil
+	}
+
+	if resolve := m.registeredResolver(path); resolve != nil {
+		if mergedVal, ok := resolve(aValue, bValue, p.get(aChange.V)); ok {
+			return registeredChange(aChange, bChange, mergedVal), mergedVal, nil
+		}
+	}
+
 	// If the two diffs generate different kinds of changes at the same key, conflict.
 	if aChange.ChangeType != bChange.ChangeType {
 		if change, mergedVal, ok := m.resolve(aChange.ChangeType, bChange.ChangeType, aValue, bValue, path); ok {
@@ -81,11 +92,6 @@ func (m *merger) mergeChanges(aChange, bChange types.ValueChanged, a, b, p candi
 		return change, nil, newMergeConflict("Conflict:\n%s\nvs\n%s\n", describeChange(aChange), describeChange(bChange))
 	}
 
-	if aChange.ChangeType == types.DiffChangeRemoved || aValue.Equals(bValue) {
-		// If both diffs generated a remove, or if the new value is the same in both, merge is fine.
-		return aChange, aValue, nil
-	}
-
 	// There's one case that might still be OK even if aValue and bValue differ: different, but mergeable, compound values of the same type being added/modified at the same key, e.g. a Map being added to both a and b. If either is a primitive, or Values of different Kinds were added, though, we're in conflict.
 	if !unmergeable(aValue, bValue) {
 		// TODO: Add concurrency.
@@ -102,6 +108,28 @@ func (m *merger) mergeChanges(aChange, bChange types.ValueChanged, a, b, p candi
 	return change, nil, newMergeConflict("Conflict:\n%s = %s\nvs\n%s = %s", describeChange(aChange), types.EncodedValue(aValue), describeChange(bChange), types.EncodedValue(bValue))
 }
 
+// registeredResolver returns the FieldResolveFunc registered for path relative to the innermost enclosing struct that has one, or nil.
+func (m *merger) registeredResolver(path types.Path) FieldResolveFunc {
+	for i := len(m.structs) - 1; i >= 0; i-- {
+		frame := m.structs[i]
+		if resolve := m.registry.lookup(frame.name, path[frame.depth:]); resolve != nil {
+			return resolve
+		}
+	}
+	return nil
+}
+
+func registeredChange(aChange, bChange types.ValueChanged, mergedVal types.Value) types.ValueChanged {
+	switch {
+	case mergedVal == nil:
+		return types.ValueChanged{ChangeType: types.DiffChangeRemoved, V: aChange.V}
+	case aChange.ChangeType != types.DiffChangeRemoved:
+		return aChange
+	default:
+		return types.ValueChanged{ChangeType: bChange.ChangeType, V: aChange.V}
+	}
+}
+
 func stopAndDrain(stop chan<- struct{}, drain <-chan types.ValueChanged) {
 	close(stop)
 	for range drain {
@@ -106,6 +106,24 @@ func (src *dataSource) ReadChunks(chunkChan chan<- *chunks.Chunk) {
 	}
 }
 
+// SampleChunks returns the data of about |n| chunks, spread evenly through src.
+func (src *dataSource) SampleChunks(n int) (samples [][]byte) {
+	step := len(src.hashes)/n + 1
+	chunkChan := make(chan *chunks.Chunk, 1024)
+	go func() {
+		src.ReadChunks(chunkChan)
+		close(chunkChan)
+	}()
+	i := 0
+	for c := range chunkChan {
+		if i%step == 0 {
+			samples = append(samples, c.Data())
+		}
+		i++
+	}
+	return
+}
+
 func (src *dataSource) GetHashes() hashSlice {
 	out := make(hashSlice, len(src.hashes))
 	copy(out, src.hashes)
@@ -33,6 +33,8 @@ var (
 	useAWS   = flag.String("useAWS", "", "Name of existing Database to use for not-WriteNovel benchmarks")
 	toAWS    = flag.String("toAWS", "", "Write to an NBS store in AWS")
 	toFile   = flag.String("toFile", "", "Write to a file in the given directory")
+	codec    = flag.String("codec", "snappy", "Codec with which -toNBS and -toAWS compress chunks: snappy or zstd")
+	dictKiB  = flag.Int("dict", 0, "Size in KiB of a zstd dictionary to train from a sample of the input, or 0 for none")
 )
 
 const s3Bucket = "attic-nbs"
@@ -71,6 +73,20 @@ func main() {
 
 	bufSize := (*mtMiB) * humanize.MiByte
 
+	c, err := nbs.ParseCodec(*codec)
+	d.CheckErrorNoUsage(err)
+	var dict *nbs.Dictionary
+	if *dictKiB > 0 {
+		d.PanicIfFalse(c == nbs.ZstdCodec)
+		dict, err = nbs.TrainDictionary(src.SampleChunks(1000), *dictKiB*humanize.KiByte)
+		d.PanicIfError(err)
+		fmt.Printf("Trained a %s dictionary\n", humanize.IBytes(uint64(len(dict.Bytes()))))
+	}
+	withCompression := func(store *nbs.NomsBlockStore) types.BatchStore {
+		store.SetCompression(c, dict)
+		return store
+	}
+
 	open := newNullBlockStore
 	wrote := false
 	var writeDB func()
@@ -80,8 +96,13 @@ func main() {
 		if *toNBS != "" {
 			dir := makeTempDir(*toNBS, pb)
 			defer os.RemoveAll(dir)
-			open = func() types.BatchStore { return nbs.NewLocalStore(dir, bufSize) }
+			open = func() types.BatchStore { return withCompression(nbs.NewLocalStore(dir, bufSize)) }
 			reset = func() { os.RemoveAll(dir); os.MkdirAll(dir, 0777) }
+			defer func() {
+				if wrote {
+					reportCompression(dir, (*dataSize)*humanize.MiByte)
+				}
+			}()
 
 		} else if *toFile != "" {
 			dir := makeTempDir(*toFile, pb)
@@ -96,7 +117,7 @@ func main() {
 		} else if *toAWS != "" {
 			sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
 			open = func() types.BatchStore {
-				return nbs.NewAWSStore(dynamoTable, *toAWS, s3Bucket, sess, bufSize)
+				return withCompression(nbs.NewAWSStore(dynamoTable, *toAWS, s3Bucket, sess, bufSize))
 			}
 			reset = func() {
 				ddb := dynamodb.New(sess)
@@ -173,11 +194,24 @@ func main() {
 				trials = append(trials, trialDur)
 				dur += trialDur
 			}
-			fmt.Printf("%s\t%d\t%ss/iter %v\n", trialName, *count, humanize.FormatFloat("", (dur/time.Duration(*count)).Seconds()), formatTrials(trials))
+			perIter := (dur / time.Duration(*count)).Seconds()
+			fmt.Printf("%s\t%d\t%ss/iter %sMiB/s %v\n", trialName, *count, humanize.FormatFloat("", perIter), humanize.FormatFloat("", float64(*dataSize)/perIter), formatTrials(trials))
 		}
 	}
 }
 
+// reportCompression prints the size of the store in |dir|, and its ratio to
+// |dataSize|, the size of the data written to it.
+func reportCompression(dir string, dataSize uint64) {
+	infos, err := ioutil.ReadDir(dir)
+	d.PanicIfError(err)
+	size := uint64(0)
+	for _, info := range infos {
+		size += uint64(info.Size())
+	}
+	fmt.Printf("%s %s on disk for %s of data, ratio %s\n", *codec, humanize.IBytes(size), humanize.IBytes(dataSize), humanize.FormatFloat("", float64(dataSize)/float64(size)))
+}
+
 func makeTempDir(tmpdir string, t assert.TestingT) (dir string) {
 	dir, err := ioutil.TempDir(tmpdir, "")
 	assert.NoError(t, err)
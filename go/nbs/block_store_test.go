@@ -199,8 +199,9 @@ func (suite *BlockStoreSuite) TestChunkStoreFlushOptimisticLockFail() {
 
 func (suite *BlockStoreSuite) TestCompactOnUpdateRoot() {
 	testMaxTables := 5
-	mm := fileManifest{suite.dir}
-	smallTableStore := newNomsBlockStore(mm, newFSTableSet(suite.dir, nil), 2, testMaxTables)
+	mm := fileManifest{suite.dir, nil}
+	smallTableStore := newNomsBlockStore(mm, newFSTableSet(suite.dir, nil, nil), 2, testMaxTables)
+	defer smallTableStore.Close()
 	inputs := [][]byte{[]byte("ab"), []byte("cd"), []byte("ef"), []byte("gh"), []byte("ij"), []byte("kl")}
 	chunx := make([]chunks.Chunk, len(inputs))
 	for i, data := range inputs {
@@ -209,21 +210,55 @@ func (suite *BlockStoreSuite) TestCompactOnUpdateRoot() {
 
 	root := smallTableStore.Root()
 	suite.NoError(smallTableStore.PutMany(chunx[:testMaxTables]))
-	suite.True(smallTableStore.UpdateRoot(chunx[0].Hash(), root)) // Commit write
-
-	exists, _, mRoot, specs := mm.ParseIfExists(nil)
+	// Hold off compaction long enough to see which tables it'll conjoin.
+	smallTableStore.compactMu.Lock()
+	suite.True(smallTableStore.UpdateRoot(chunx[0].Hash(), root)) // Commit write, which should start compacting
+	compactees := smallTableStore.tables.ToSpecs()
+	smallTableStore.compactMu.Unlock()
+	smallTableStore.compactWg.Wait()
+
+	// The 5 one-chunk tables are all in the lowest tier, so they're conjoined into one, and their files pruned.
+	exists, contents := mm.ParseIfExists(nil)
 	suite.True(exists)
-	suite.Equal(chunx[0].Hash(), mRoot)
-	suite.Len(specs, testMaxTables)
+	suite.Equal(chunx[0].Hash(), contents.root)
+	if suite.Len(contents.specs, 1) {
+		suite.EqualValues(testMaxTables, contents.specs[0].chunkCount)
+	}
+	for _, spec := range compactees {
+		_, err := os.Stat(filepath.Join(suite.dir, spec.name.String()))
+		suite.True(os.IsNotExist(err), "%s wasn't pruned", spec.name)
+	}
 
 	root = smallTableStore.Root()
 	suite.NoError(smallTableStore.PutMany(chunx[testMaxTables:]))
-	suite.True(smallTableStore.UpdateRoot(chunx[testMaxTables].Hash(), root)) // Should compact
+	suite.True(smallTableStore.UpdateRoot(chunx[testMaxTables].Hash(), root))
+	smallTableStore.compactWg.Wait()
 
-	exists, _, mRoot, specs = mm.ParseIfExists(nil)
+	exists, contents = mm.ParseIfExists(nil)
 	suite.True(exists)
-	suite.Equal(chunx[testMaxTables].Hash(), mRoot)
-	suite.Len(specs, testMaxTables)
+	suite.Equal(chunx[testMaxTables].Hash(), contents.root)
+	suite.Len(contents.specs, 2)
+	for i, data := range inputs {
+		assertInputInStore(data, chunx[i].Hash(), smallTableStore, suite.Assert())
+	}
+}
+
+func (suite *BlockStoreSuite) TestCompact() {
+	inputs := [][]byte{[]byte("ab"), []byte("cd"), []byte("ef"), []byte("gh"), []byte("ij"), []byte("kl"), []byte("mn")}
+	for _, data := range inputs {
+		c := chunks.NewChunk(data)
+		suite.store.Put(c)
+		suite.True(suite.store.UpdateRoot(c.Hash(), suite.store.Root()))
+	}
+
+	// How much is left to do depends on how far background compaction has got, but afterwards the policy should be satisfied.
+	stats := suite.store.Compact()
+	suite.True(stats.TablesAfter <= stats.TablesBefore)
+	suite.EqualValues(len(inputs), stats.ChunksAfter)
+	suite.Nil(planCompaction(suite.store.tables.upstream.specs(), suite.store.maxTables))
+	for _, data := range inputs {
+		assertInputInStore(data, chunks.NewChunk(data).Hash(), suite.store, suite.Assert())
+	}
 }
 
 func assertInputInStore(input []byte, h hash.Hash, s chunks.ChunkStore, assert *assert.Assertions) {
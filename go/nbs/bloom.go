@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"encoding/binary"
+)
+
+const (
+	bloomBitsPerChunk = 10
+	bloomHashCount    = 7 // minimizes false positives for bloomBitsPerChunk, at about 1%
+	bloomMagic        = "\xdc\xbe\xaf\x99\xc1\xcf\xbd\x38"
+	bloomTrailerSize  = uint32Size + checksumSize + uint64(len(bloomMagic))
+)
+
+// bloomFilter records which addrs are in a table, so that has-checks for
+// most of those that aren't can be answered without searching the index.
+// The zero value is a filter that may contain anything, which stands in for
+// the filter of a table written before tables had them.
+type bloomFilter struct {
+	bits      []byte
+	hashCount uint32
+}
+
+// bloomFilterSize returns the size of the Bloom Filter section of a table
+// holding |numChunks| chunks. An empty table doesn't have one.
+func bloomFilterSize(numChunks uint32) uint64 {
+	if numChunks == 0 {
+		return 0
+	}
+	return bloomBitsSize(numChunks) + bloomTrailerSize
+}
+
+func bloomBitsSize(numChunks uint32) uint64 {
+	return (uint64(numChunks)*bloomBitsPerChunk + 7) / 8
+}
+
+func newBloomFilter(numChunks uint32) bloomFilter {
+	return bloomFilter{make([]byte, bloomBitsSize(numChunks)), bloomHashCount}
+}
+
+// bitIndexes calls |f| with the index of each of the bits of bf that
+// represent |h|. Since addrs are hashes, their first 16 bytes serve as the
+// two hashes from which the others are derived.
+func (bf bloomFilter) bitIndexes(h addr, f func(idx uint64) bool) bool {
+	numBits := uint64(len(bf.bits)) * 8
+	h1, h2 := binary.BigEndian.Uint64(h[:8]), binary.BigEndian.Uint64(h[8:16])
+	for i := uint64(0); i < uint64(bf.hashCount); i++ {
+		if !f((h1 + i*h2) % numBits) {
+			return false
+		}
+	}
+	return true
+}
+
+func (bf bloomFilter) add(h addr) {
+	bf.bitIndexes(h, func(idx uint64) bool {
+		bf.bits[idx/8] |= 1 << (idx % 8)
+		return true
+	})
+}
+
+// mayContain returns false if |h| is certainly not in the table.
+func (bf bloomFilter) mayContain(h addr) bool {
+	if len(bf.bits) == 0 {
+		return true
+	}
+	return bf.bitIndexes(h, func(idx uint64) bool {
+		return bf.bits[idx/8]&(1<<(idx%8)) != 0
+	})
+}
+
+// write writes the Bloom Filter section to |buff|, and returns its length.
+func (bf bloomFilter) write(buff []byte) uint64 {
+	pos := uint64(copy(buff, bf.bits))
+	binary.BigEndian.PutUint32(buff[pos:], bf.hashCount)
+	pos += uint32Size
+	binary.BigEndian.PutUint32(buff[pos:], crc(bf.bits))
+	pos += checksumSize
+	pos += uint64(copy(buff[pos:], bloomMagic))
+	return pos
+}
+
+// parseBloomFilter returns the filter in the Bloom Filter section that ends
+// |buff|, if there is one. Tables written before the section existed have
+// chunk data there instead, which the magic number and checksum rule out.
+func parseBloomFilter(buff []byte, numChunks uint32) (bf bloomFilter, ok bool) {
+	size := bloomFilterSize(numChunks)
+	if size == 0 || uint64(len(buff)) < size {
+		return
+	}
+	buff = buff[uint64(len(buff))-size:]
+	pos := uint64(len(buff)) - uint64(len(bloomMagic))
+	if string(buff[pos:]) != bloomMagic {
+		return
+	}
+	pos -= checksumSize
+	checksum := binary.BigEndian.Uint32(buff[pos:])
+	pos -= uint32Size
+	hashCount := binary.BigEndian.Uint32(buff[pos:])
+	bits := buff[:pos]
+	if crc(bits) != checksum || hashCount == 0 || len(bits) == 0 {
+		return
+	}
+	bf.bits = make([]byte, len(bits))
+	copy(bf.bits, bits)
+	bf.hashCount = hashCount
+	return bf, true
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	assert := assert.New(t)
+	const numChunks = 1000
+	bf := newBloomFilter(numChunks)
+	for i := 0; i < numChunks; i++ {
+		bf.add(computeAddr([]byte(fmt.Sprintf("in %d", i))))
+	}
+	for i := 0; i < numChunks; i++ {
+		assert.True(bf.mayContain(computeAddr([]byte(fmt.Sprintf("in %d", i)))))
+	}
+	falsePositives := 0
+	for i := 0; i < 10*numChunks; i++ {
+		if bf.mayContain(computeAddr([]byte(fmt.Sprintf("out %d", i)))) {
+			falsePositives++
+		}
+	}
+	assert.True(falsePositives < numChunks/10*3, "%d false positives", falsePositives) // about 1% expected
+
+	buff := make([]byte, bloomFilterSize(numChunks))
+	assert.EqualValues(len(buff), bf.write(buff))
+	parsed, ok := parseBloomFilter(append([]byte("chunk data"), buff...), numChunks)
+	assert.True(ok)
+	assert.Equal(bf, parsed)
+
+	// A corrupt filter isn't used.
+	buff[0] ^= 0xff
+	_, ok = parseBloomFilter(buff, numChunks)
+	assert.False(ok)
+
+	assert.True(bloomFilter{}.mayContain(computeAddr([]byte("anything"))))
+}
+
+// withoutBloomFilter returns a copy of |tableData| in the format that tables
+// were written in before they had bloom filters.
+func withoutBloomFilter(tableData []byte, chunkCount uint32) []byte {
+	bloomEnd := uint64(len(tableData)) - footerSize - indexSize(chunkCount)
+	bloomStart := bloomEnd - bloomFilterSize(chunkCount)
+	old := append([]byte{}, tableData[:bloomStart]...)
+	return append(old, tableData[bloomEnd:]...)
+}
+
+func TestTableWithoutBloomFilter(t *testing.T) {
+	assert := assert.New(t)
+	chunks := [][]byte{[]byte("hi")}
+	notPresent := [][]byte{[]byte("yo"), []byte("do"), []byte("so much to do")}
+
+	tableData, name := buildTable(chunks)
+	index := parseTableIndex(tableData, nil)
+	assert.NotEmpty(index.bloom.bits)
+	assert.True(index.bloom.mayContain(computeAddr(chunks[0])))
+
+	oldData := withoutBloomFilter(tableData, uint32(len(chunks)))
+	oldIndex := parseTableIndex(oldData, nil)
+	assert.Empty(oldIndex.bloom.bits)
+	index.bloom = bloomFilter{}
+	assert.Equal(index, oldIndex)
+
+	tr := newTableReader(oldIndex, bytes.NewReader(oldData), fileBlockSize, nil)
+	assertChunksInReader(chunks, tr, assert)
+	assertChunksNotInReader(notPresent, tr, assert)
+	for _, c := range chunks {
+		assert.Equal(c, tr.get(computeAddr(c)))
+	}
+
+	// The table is smaller than the tail that the readers read in case there's a bloom filter.
+	assert.True(uint64(len(oldData)) < bloomFilterSize(uint32(len(chunks)))+indexSize(uint32(len(chunks)))+footerSize)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, name.String()), oldData, 0666))
+	mmtr := newMmapTableReader(dir, name, uint32(len(chunks)), nil, nil)
+	defer mmtr.close()
+	assertChunksInReader(chunks, mmtr, assert)
+
+	s3svc := makeFakeS3(assert)
+	s3svc.data[name.String()] = oldData
+	s3tr := newS3TableReader(s3svc, "bucket", name, uint32(len(chunks)), nil, nil, nil)
+	assertChunksInReader(chunks, s3tr, assert)
+	assert.Equal(chunks[0], s3tr.get(computeAddr(chunks[0])))
+}
+
+func TestHasManyBloomFilter(t *testing.T) {
+	assert := assert.New(t)
+	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
+	tableData, _ := buildTable(chunks)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
+
+	addrs := addrSlice{computeAddr(chunks[0]), computeAddr([]byte("absent")), computeAddr(chunks[2])}
+	hasAddrs := []hasRecord{}
+	for i := range addrs {
+		hasAddrs = append(hasAddrs, hasRecord{&addrs[i], binary.BigEndian.Uint64(addrs[i][:addrPrefixSize]), i, false})
+	}
+	sort.Sort(hasRecordByPrefix(hasAddrs))
+
+	assert.True(tr.hasMany(hasAddrs))
+	for _, ha := range hasAddrs {
+		assert.Equal(*ha.a != addrs[1], ha.has)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression applied to each chunk record in a table. It is
+// recorded in the table's footer, so tables written with different codecs
+// can be read from the same store.
+type Codec uint8
+
+const (
+	// SnappyCodec is the default, and the only codec used by tables written
+	// before codecs were introduced.
+	SnappyCodec Codec = iota
+	// ZstdCodec compresses better than snappy, especially with a Dictionary,
+	// at some cost in speed.
+	ZstdCodec
+)
+
+func (c Codec) String() string {
+	switch c {
+	case SnappyCodec:
+		return "snappy"
+	case ZstdCodec:
+		return "zstd"
+	}
+	return fmt.Sprintf("Codec(%d)", uint8(c))
+}
+
+// ParseCodec returns the Codec called |name|, as returned by Codec.String().
+func ParseCodec(name string) (Codec, error) {
+	for _, c := range []Codec{SnappyCodec, ZstdCodec} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return SnappyCodec, fmt.Errorf("Unknown codec: %s", name)
+}
+
+// compression says how the chunk records of a table are encoded. dictID is
+// the ID of the Dictionary used by ZstdCodec, or 0 if there is none.
+type compression struct {
+	codec  Codec
+	dictID uint32
+}
+
+// String returns the name of c's codec, followed by the ID of its
+// dictionary in hex, if it has one, e.g. "zstd.0000abcd".
+func (c compression) String() string {
+	if c.dictID == 0 {
+		return c.codec.String()
+	}
+	return fmt.Sprintf("%s.%08x", c.codec, c.dictID)
+}
+
+// parseCompression returns the compression that |s| names, as returned by
+// compression.String().
+func parseCompression(s string) (comp compression, err error) {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		comp.codec, err = ParseCodec(s)
+		return
+	}
+	name, dictID := s[:i], s[i+1:]
+	if comp.codec, err = ParseCodec(name); err != nil {
+		return
+	}
+	id, err := strconv.ParseUint(dictID, 16, 32)
+	if err != nil || id == 0 || comp.codec != ZstdCodec {
+		return compression{}, fmt.Errorf("Malformed compression: %s", s)
+	}
+	comp.dictID = uint32(id)
+	return
+}
+
+// encoder returns a chunkEncoder for c.
+func (c compression) encoder() chunkEncoder {
+	switch c.codec {
+	case SnappyCodec:
+		return realSnappyEncoder{}
+	case ZstdCodec:
+		return zstdEncoder{dictionaries.encoder(c.dictID)}
+	}
+	panic(fmt.Errorf("Unknown codec: %s", c.codec))
+}
+
+func (c compression) decode(src []byte) ([]byte, error) {
+	switch c.codec {
+	case SnappyCodec:
+		return snappy.Decode(nil, src)
+	case ZstdCodec:
+		return dictionaries.decoder(c.dictID).DecodeAll(src, nil)
+	}
+	return nil, fmt.Errorf("Unknown codec: %s", c.codec)
+}
+
+// maxEncodedLen returns the most that c may take to encode |srcLen| bytes.
+func (c compression) maxEncodedLen(srcLen uint64) uint64 {
+	switch c.codec {
+	case SnappyCodec:
+		return uint64(snappy.MaxEncodedLen(int(srcLen)))
+	case ZstdCodec:
+		return srcLen + srcLen>>8 + 64 // ZSTD_COMPRESSBOUND, which includes the frame header
+	}
+	panic(fmt.Errorf("Unknown codec: %s", c.codec))
+}
+
+type zstdEncoder struct {
+	enc *zstd.Encoder
+}
+
+func (ze zstdEncoder) Encode(dst, src []byte) []byte {
+	return ze.enc.EncodeAll(src, dst[:0])
+}
+
+// Dictionary is a zstd dictionary, shared by the tables in a store that are
+// written with it. Noms chunks are small, and chunks of the same type are
+// similar, so a dictionary trained on a sample of them lets each chunk be
+// compressed as well as if it were part of a much larger stream.
+type Dictionary struct {
+	id   uint32
+	data []byte
+}
+
+// ID returns the ID of the dictionary, by which tables refer to it.
+func (dict *Dictionary) ID() uint32 {
+	return dict.id
+}
+
+// Bytes returns the dictionary in the zstd dictionary format, as read by
+// ParseDictionary and `zstd -D`.
+func (dict *Dictionary) Bytes() []byte {
+	return dict.data
+}
+
+// ParseDictionary reads a dictionary in the zstd dictionary format, such as
+// one trained by `zstd --train`.
+func ParseDictionary(data []byte) (*Dictionary, error) {
+	info, err := zstd.InspectDictionary(data)
+	if err != nil {
+		return nil, err
+	}
+	if info.ID() == 0 {
+		return nil, errors.New("Dictionary must have an ID")
+	}
+	return &Dictionary{info.ID(), data}, nil
+}
+
+const (
+	minDictionaryID = 1 << 15 // IDs below this are reserved for registered dictionaries
+	maxDictionaryID = 1 << 31 // as are IDs from this on
+)
+
+// TrainDictionary builds a dictionary of about |size| bytes from |samples|,
+// which should be typical of the chunks to be compressed with it. Its ID is
+// derived from its content.
+func TrainDictionary(samples [][]byte, size int) (*Dictionary, error) {
+	// The dictionary's content is the history that each chunk is compressed against. Later content is cheaper to refer to, so the first samples are the ones dropped.
+	history := []byte{}
+	for i := len(samples) - 1; i >= 0 && len(history) < size; i-- {
+		history = append(samples[i][:len(samples[i]):len(samples[i])], history...)
+	}
+	if len(history) > size {
+		history = history[len(history)-size:]
+	}
+	if len(history) < 8 {
+		return nil, errors.New("Not enough samples to train a dictionary")
+	}
+	id := minDictionaryID + crc(history)%(maxDictionaryID-minDictionaryID)
+	data, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:         id,
+		Contents:   samples,
+		History:    history,
+		Offsets:    [3]int{1, 4, 8},
+		CompatV155: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Dictionary{id, data}, nil
+}
+
+// dictionaries holds an encoder and a decoder for each Dictionary that
+// tables in this process have been written or read with, and for no
+// dictionary, under ID 0. Both are safe for concurrent use. The encoders
+// leave out zstd's frame checksum, since each chunk record has its own.
+var dictionaries = &dictionaryRegistry{
+	encoders: map[uint32]*zstd.Encoder{},
+	decoders: map[uint32]*zstd.Decoder{},
+}
+
+type dictionaryRegistry struct {
+	mu       sync.RWMutex
+	encoders map[uint32]*zstd.Encoder
+	decoders map[uint32]*zstd.Decoder
+
+	noDictionaryOnce sync.Once
+}
+
+// add makes |dict| available to encode and decode chunk records with, if it
+// isn't already.
+func (dr *dictionaryRegistry) add(dict *Dictionary) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if _, present := dr.decoders[dict.id]; present {
+		return
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderCRC(false), zstd.WithEncoderDict(dict.data))
+	d.PanicIfError(err)
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict.data))
+	d.PanicIfError(err)
+	dr.encoders[dict.id], dr.decoders[dict.id] = enc, dec
+}
+
+func (dr *dictionaryRegistry) has(id uint32) bool {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+	_, present := dr.decoders[id]
+	return present || id == 0
+}
+
+// ensure calls |load| to read the dictionary with ID |id| and adds it, if
+// the dictionary hasn't already been added.
+func (dr *dictionaryRegistry) ensure(id uint32, load func() []byte) {
+	if dr.has(id) {
+		return
+	}
+	dict, err := ParseDictionary(load())
+	d.PanicIfError(err)
+	d.PanicIfFalse(dict.id == id)
+	dr.add(dict)
+}
+
+func (dr *dictionaryRegistry) encoder(id uint32) *zstd.Encoder {
+	if id == 0 {
+		dr.noDictionaryOnce.Do(dr.initNoDictionary)
+	}
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+	enc, present := dr.encoders[id]
+	if !present {
+		d.Panic("Dictionary %d has not been loaded", id)
+	}
+	return enc
+}
+
+func (dr *dictionaryRegistry) decoder(id uint32) *zstd.Decoder {
+	if id == 0 {
+		dr.noDictionaryOnce.Do(dr.initNoDictionary)
+	}
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+	dec, present := dr.decoders[id]
+	if !present {
+		d.Panic("Dictionary %d has not been loaded", id)
+	}
+	return dec
+}
+
+func (dr *dictionaryRegistry) initNoDictionary() {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderCRC(false))
+	d.PanicIfError(err)
+	dec, err := zstd.NewReader(nil)
+	d.PanicIfError(err)
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.encoders[0], dr.decoders[0] = enc, dec
+}
+
+// dictionaryFileName returns the name of the file, or S3 object, in which a
+// store keeps the dictionary with ID |id|.
+func dictionaryFileName(id uint32) string {
+	return fmt.Sprintf("dict_%08x", id)
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/testify/assert"
+)
+
+// structChunks returns |n| small, similar chunks, like the leaves of a list
+// of structs.
+func structChunks(n int) [][]byte {
+	chunks := make([][]byte, n)
+	for i := range chunks {
+		chunks[i] = []byte(fmt.Sprintf(`{"name":"person %d","age":%d,"city":"Springfield","email":"person%d@example.com"}`, i, i%90, i))
+	}
+	return chunks
+}
+
+func writeTestTable(chunks [][]byte, comp compression) []byte {
+	mt := newMemTable(1 << 20)
+	mt.comp = comp
+	for _, c := range chunks {
+		mt.addChunk(computeAddr(c), c)
+	}
+	_, data, _ := mt.write(nil, nil)
+	return data
+}
+
+// forgetDictionary removes the dictionary with ID |id| from the registry, as
+// if this were another process.
+func forgetDictionary(id uint32) {
+	dictionaries.mu.Lock()
+	defer dictionaries.mu.Unlock()
+	delete(dictionaries.encoders, id)
+	delete(dictionaries.decoders, id)
+}
+
+func TestParseCodec(t *testing.T) {
+	assert := assert.New(t)
+	for _, c := range []Codec{SnappyCodec, ZstdCodec} {
+		parsed, err := ParseCodec(c.String())
+		assert.NoError(err)
+		assert.Equal(c, parsed)
+	}
+	_, err := ParseCodec("lz4")
+	assert.Error(err)
+}
+
+func TestZstdTable(t *testing.T) {
+	assert := assert.New(t)
+	chunks := structChunks(100)
+
+	snappyData := writeTestTable(chunks, compression{})
+	// Snappy tables keep the original footer.
+	assert.Equal(magicNumber, string(snappyData[uint64(len(snappyData))-magicNumberSize:]))
+
+	zstdData := writeTestTable(chunks, compression{codec: ZstdCodec})
+	assert.Equal(codecMagicNumber, string(zstdData[uint64(len(zstdData))-magicNumberSize:]))
+
+	for _, data := range [][]byte{snappyData, zstdData} {
+		index := parseTableIndex(data, nil)
+		assertChunksInReader(chunks, newTableReader(index, bytes.NewReader(data), fileBlockSize, nil), assert)
+	}
+	assert.Equal(compression{codec: ZstdCodec}, parseTableIndex(zstdData, nil).comp)
+}
+
+func TestTrainDictionary(t *testing.T) {
+	assert := assert.New(t)
+	chunks := structChunks(1000)
+	dict, err := TrainDictionary(chunks[:200], 4096)
+	assert.NoError(err)
+	assert.NotZero(dict.ID())
+
+	parsed, err := ParseDictionary(dict.Bytes())
+	assert.NoError(err)
+	assert.Equal(dict.ID(), parsed.ID())
+	_, err = TrainDictionary(nil, 4096)
+	assert.Error(err)
+
+	dictionaries.add(dict)
+	withDict := writeTestTable(chunks, compression{ZstdCodec, dict.ID()})
+	withoutDict := writeTestTable(chunks, compression{codec: ZstdCodec})
+	assert.True(len(withDict) < len(withoutDict), "%d >= %d", len(withDict), len(withoutDict))
+
+	index := parseTableIndex(withDict, nil)
+	assert.Equal(compression{ZstdCodec, dict.ID()}, index.comp)
+	assertChunksInReader(chunks, newTableReader(index, bytes.NewReader(withDict), fileBlockSize, nil), assert)
+}
+
+func TestStoreSetCompression(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	inputs := structChunks(300)
+	dict, err := TrainDictionary(inputs[:100], 2048)
+	assert.NoError(err)
+
+	store := newNomsBlockStore(fileManifest{dir, nil}, newFSTableSet(dir, nil, nil), 1<<12, maxTables)
+	putAll := func(inputs [][]byte) {
+		for _, data := range inputs {
+			store.Put(chunks.NewChunk(data))
+		}
+		assert.True(store.UpdateRoot(chunks.NewChunk(inputs[0]).Hash(), store.Root()))
+	}
+	putAll(inputs[:100])
+	store.SetCompression(ZstdCodec, dict)
+	putAll(inputs[100:])
+	store.Close()
+
+	_, err = os.Stat(filepath.Join(dir, dictionaryFileName(dict.ID())))
+	assert.NoError(err)
+
+	// A fresh store reads both the snappy tables and the zstd ones, loading the dictionary from dir.
+	forgetDictionary(dict.ID())
+	store = newNomsBlockStore(fileManifest{dir, nil}, newFSTableSet(dir, nil, nil), 1<<12, maxTables)
+	defer store.Close()
+	for _, data := range inputs {
+		assertInputInStore(data, chunks.NewChunk(data).Hash(), store, assert)
+	}
+	assert.True(dictionaries.has(dict.ID()))
+
+	// The codec and dictionary were recorded in the manifest, so the fresh store writes new tables with them too.
+	codec, dictID := store.Compression()
+	assert.Equal(ZstdCodec, codec)
+	assert.Equal(dict.ID(), dictID)
+
+	// Tables of either codec can be conjoined. Those of different codecs are conjoined into a table of the store's.
+	stats := store.Compact()
+	assert.EqualValues(len(inputs), stats.ChunksAfter)
+	for _, data := range inputs {
+		assertInputInStore(data, chunks.NewChunk(data).Hash(), store, assert)
+	}
+	for _, src := range store.tables.upstream {
+		assert.Equal(compression{ZstdCodec, dict.ID()}, src.encoding())
+	}
+}
+
+func TestConjoinedEncoding(t *testing.T) {
+	assert := assert.New(t)
+	inputs := structChunks(10)
+	zstd := compression{codec: ZstdCodec}
+	source := func(comp compression) chunkSource {
+		data := writeTestTable(inputs, comp)
+		return chunkSourceAdapter{newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil), computeAddr(data)}
+	}
+
+	// Conjoining tables that agree keeps their codec, whatever the store writes new tables with.
+	assert.Equal(zstd, conjoinedEncoding(chunkSources{source(zstd), source(zstd)}, compression{}))
+	assert.Equal(compression{}, conjoinedEncoding(chunkSources{source(compression{}), source(compression{})}, zstd))
+	assert.Equal(zstd, conjoinedEncoding(chunkSources{source(compression{}), source(zstd)}, zstd))
+}
+
+func TestCompressionString(t *testing.T) {
+	assert := assert.New(t)
+	for _, comp := range []compression{{}, {codec: ZstdCodec}, {ZstdCodec, 0xabcd}} {
+		parsed, err := parseCompression(comp.String())
+		assert.NoError(err)
+		assert.Equal(comp, parsed)
+	}
+	assert.Equal("zstd.0000abcd", compression{ZstdCodec, 0xabcd}.String())
+	for _, s := range []string{"", "lz4", "zstd.", "zstd.0", "zstd.xyz", "snappy.0000abcd"} {
+		_, err := parseCompression(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestS3TablePersisterDictionary(t *testing.T) {
+	assert := assert.New(t)
+	inputs := structChunks(100)
+	dict, err := TrainDictionary(inputs, 1024)
+	assert.NoError(err)
+	dictionaries.add(dict)
+
+	s3svc := makeFakeS3(assert)
+	s3p := s3TablePersister{s3: s3svc, bucket: "bucket", partSize: defaultS3PartSize, readRl: make(chan struct{}, 8)}
+	s3p.PersistDictionary(dict)
+	data := writeTestTable(inputs, compression{})
+	sources := chunkSources{chunkSourceAdapter{newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil), computeAddr(data)}}
+	src := s3p.CompactAll(sources, compression{ZstdCodec, dict.ID()})
+
+	forgetDictionary(dict.ID())
+	r := s3p.Open(src.hash(), src.count())
+	assertChunksInReader(inputs, r, assert)
+	assert.True(dictionaries.has(dict.ID()))
+}
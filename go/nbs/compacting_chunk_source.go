@@ -99,6 +99,12 @@ func (ccs *compactingChunkSource) calcReads(reqs []getRecord, blockSize uint64)
 	return ccs.cs.calcReads(reqs, blockSize)
 }
 
+func (ccs *compactingChunkSource) encoding() compression {
+	ccs.wg.Wait()
+	d.Chk.True(ccs.cs != nil)
+	return ccs.cs.encoding()
+}
+
 func (ccs *compactingChunkSource) extract(order EnumerationOrder, chunks chan<- extractRecord) {
 	ccs.wg.Wait()
 	d.Chk.True(ccs.cs != nil)
@@ -144,3 +150,7 @@ func (ecs emptyChunkSource) calcReads(reqs []getRecord, blockSize uint64) (reads
 }
 
 func (ecs emptyChunkSource) extract(order EnumerationOrder, chunks chan<- extractRecord) {}
+
+func (ecs emptyChunkSource) encoding() compression {
+	return compression{}
+}
@@ -0,0 +1,274 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attic-labs/noms/go/util/verbose"
+)
+
+// Tables are compacted by size tier. A table's tier is the number of times
+// its chunk count can be divided by compactionTierFactor, so each tier holds
+// tables up to compactionTierFactor times larger than those in the tier
+// below. Once a tier holds compactionTierFactor tables, they are conjoined
+// into a single table in the tier above, so small tables are merged often
+// and large ones rarely, and the number of tables grows only with the log of
+// the number of chunks.
+const (
+	compactionTierFactor = 4
+	maxConjoinedTables   = 32
+)
+
+// CompactionStats describes the work done by NomsBlockStore.Compact().
+type CompactionStats struct {
+	TablesBefore, TablesAfter int
+	ChunksBefore, ChunksAfter uint64
+	Conjoins                  int // number of tables written
+	Duration                  time.Duration
+}
+
+func (s CompactionStats) String() string {
+	return fmt.Sprintf("Tables: %d before, %d after\nChunks: %d before, %d after\nWrote %d tables in %s",
+		s.TablesBefore, s.TablesAfter, s.ChunksBefore, s.ChunksAfter, s.Conjoins, s.Duration)
+}
+
+func compactionTier(chunkCount uint32) (tier int) {
+	for ; chunkCount >= compactionTierFactor; chunkCount /= compactionTierFactor {
+		tier++
+	}
+	return
+}
+
+// planCompaction returns the tables in |specs| that should be conjoined next,
+// or none if no compaction is needed. It picks the smallest tables in the
+// lowest tier that is full, and failing that, if there are more than
+// |maxTables| tables, enough of the smallest to bring the count back down.
+func planCompaction(specs []tableSpec, maxTables int) []tableSpec {
+	sorted := make([]tableSpec, 0, len(specs))
+	for _, spec := range specs {
+		if spec.chunkCount > 0 {
+			sorted = append(sorted, spec)
+		}
+	}
+	sort.Sort(tableSpecsByAscendingCount(sorted))
+
+	for start := 0; start < len(sorted); {
+		tier := compactionTier(sorted[start].chunkCount)
+		end := start + 1
+		for end < len(sorted) && compactionTier(sorted[end].chunkCount) == tier {
+			end++
+		}
+		if end-start >= compactionTierFactor {
+			if end-start > maxConjoinedTables {
+				end = start + maxConjoinedTables
+			}
+			return sorted[start:end]
+		}
+		start = end
+	}
+
+	if len(sorted) > maxTables {
+		n := len(sorted) - maxTables + 1
+		if n > maxConjoinedTables {
+			n = maxConjoinedTables
+		}
+		return sorted[:n]
+	}
+	return nil
+}
+
+type tableSpecsByAscendingCount []tableSpec
+
+func (ts tableSpecsByAscendingCount) Len() int { return len(ts) }
+func (ts tableSpecsByAscendingCount) Less(i, j int) bool {
+	if ts[i].chunkCount == ts[j].chunkCount {
+		return bytes.Compare(ts[i].name[:], ts[j].name[:]) < 0
+	}
+	return ts[i].chunkCount < ts[j].chunkCount
+}
+func (ts tableSpecsByAscendingCount) Swap(i, j int) { ts[i], ts[j] = ts[j], ts[i] }
+
+// Compact conjoins tables according to the compaction policy until there is
+// nothing left to do, and returns a description of the work done. Unlike
+// GC(), it doesn't block other operations on the store while tables are
+// being written, but it waits for any compaction running in the background
+// to finish before it starts. Only tables that have been committed by
+// UpdateRoot() are compacted. Once it's done, the files of the tables that
+// were conjoined are pruned from the underlying persister, as by GC().
+func (nbs *NomsBlockStore) Compact() (stats CompactionStats) {
+	start := time.Now()
+	stats.TablesBefore, stats.ChunksBefore = nbs.upstreamStats()
+	var retired []addr
+	for {
+		compactees, ok := nbs.conjoinOnce()
+		if !ok {
+			break
+		}
+		stats.Conjoins++
+		for _, spec := range compactees {
+			retired = append(retired, spec.name)
+		}
+	}
+	stats.TablesAfter, stats.ChunksAfter = nbs.upstreamStats()
+	nbs.pruneCompactees(retired)
+	stats.Duration = time.Since(start)
+	return
+}
+
+// pruneCompactees removes the files of the |retired| tables, which
+// conjoinOnce() has swapped out of the manifest, from the underlying
+// persister.
+func (nbs *NomsBlockStore) pruneCompactees(retired []addr) {
+	if len(retired) == 0 {
+		return
+	}
+	nbs.mu.RLock()
+	keepers := map[addr]struct{}{}
+	for _, spec := range nbs.tables.ToSpecs() {
+		keepers[spec.name] = struct{}{}
+	}
+	p := nbs.tables.p
+	nbs.mu.RUnlock()
+	p.PruneTableFiles(keepers, retired)
+}
+
+func (nbs *NomsBlockStore) upstreamStats() (tables int, chunks uint64) {
+	nbs.mu.RLock()
+	defer nbs.mu.RUnlock()
+	for _, src := range nbs.tables.upstream {
+		tables++
+		chunks += uint64(src.count())
+	}
+	return
+}
+
+// maybeCompactLocked starts compacting in the background if the policy calls
+// for it and no compaction is already running. Like Compact(), it prunes
+// the files of the tables it conjoins. Must be called with nbs.mu held.
+func (nbs *NomsBlockStore) maybeCompactLocked() {
+	if nbs.compacting || nbs.closing || planCompaction(nbs.tables.upstream.specs(), nbs.maxTables) == nil {
+		return
+	}
+	nbs.compacting = true
+	nbs.compactWg.Add(1)
+	go func() {
+		defer nbs.compactWg.Done()
+		defer func() {
+			nbs.mu.Lock()
+			defer nbs.mu.Unlock()
+			nbs.compacting = false
+		}()
+		defer func() {
+			// A failed compaction loses nothing, since the tables it was conjoining are still in use, so it shouldn't take down the process.
+			if r := recover(); r != nil {
+				verbose.Log("Background compaction failed: %v", r)
+			}
+		}()
+		var retired []addr
+		for {
+			compactees, ok := nbs.conjoinOnce()
+			if !ok {
+				break
+			}
+			for _, spec := range compactees {
+				retired = append(retired, spec.name)
+			}
+		}
+		nbs.pruneCompactees(retired)
+	}()
+}
+
+// conjoinOnce conjoins the tables chosen by planCompaction() into one, and
+// swaps it into the manifest in their place. The new table is written
+// without holding nbs.mu, so the swap only happens if the manifest hasn't
+// changed in the meantime. It returns the tables that were conjoined, or
+// false if there was nothing to conjoin, or the swap didn't happen. The
+// files of the conjoined tables are left in place, since other processes
+// may still be reading them.
+func (nbs *NomsBlockStore) conjoinOnce() (compactees []tableSpec, ok bool) {
+	nbs.compactMu.Lock()
+	defer nbs.compactMu.Unlock()
+
+	nbs.mu.RLock()
+	compactees = planCompaction(nbs.tables.upstream.specs(), nbs.maxTables)
+	p, comp, closing := nbs.tables.p, nbs.comp, nbs.closing
+	nbs.mu.RUnlock()
+	if compactees == nil || closing {
+		return nil, false
+	}
+
+	t1 := time.Now()
+	// Open our own readers, since those in nbs.tables may be closed by a Rebase() while we're reading them.
+	sources := make(chunkSources, len(compactees))
+	for i, spec := range compactees {
+		sources[i] = p.Open(spec.name, spec.chunkCount)
+	}
+	conjoined := func() chunkSource {
+		defer sources.close()
+		return p.CompactAll(sources, conjoinedEncoding(sources, comp))
+	}()
+
+	retired, ok := nbs.swapConjoined(compactees, conjoined)
+	if !ok {
+		conjoined.close()
+		return nil, false
+	}
+	retired.close()
+	verbose.Log("Conjoined %d tables into %s (%d chunks) in %s", len(compactees), conjoined.hash(), conjoined.count(), time.Since(t1))
+	return compactees, true
+}
+
+// conjoinedEncoding returns how to encode the table that |sources| are
+// conjoined into: as they all are, if they agree, so that conjoining doesn't
+// change how any table is encoded, or as new tables are, |comp|, if not.
+func conjoinedEncoding(sources chunkSources, comp compression) compression {
+	if len(sources) == 0 {
+		return comp
+	}
+	for _, src := range sources[1:] {
+		if src.encoding() != sources[0].encoding() {
+			return comp
+		}
+	}
+	return sources[0].encoding()
+}
+
+// swapConjoined replaces |compactees| with |conjoined| in the manifest and
+// in nbs.tables, as long as the manifest still has the lock that nbs last
+// saw, so that it holds the same root and tables as nbs does. On success, it
+// returns the readers for the compactees so that the caller can close them.
+func (nbs *NomsBlockStore) swapConjoined(compactees []tableSpec, conjoined chunkSource) (retired chunkSources, ok bool) {
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+
+	isCompactee := map[addr]bool{}
+	for _, spec := range compactees {
+		isCompactee[spec.name] = true
+	}
+	upstream := chunkSources{conjoined}
+	for _, src := range nbs.tables.upstream {
+		if isCompactee[src.hash()] {
+			retired = append(retired, src)
+		} else {
+			upstream = append(upstream, src)
+		}
+	}
+	if len(retired) != len(compactees) {
+		return nil, false
+	}
+
+	candidate := tableSet{upstream: upstream, p: nbs.tables.p, rl: nbs.tables.rl}
+	newContents := newManifestContents(nbs.root, candidate.ToSpecs(), nbs.comp, nbs.gcGen)
+	if actual := nbs.mm.Update(nbs.lock, newContents, nil); actual.lock != newContents.lock {
+		return nil, false
+	}
+	nbs.tables = tableSet{novel: nbs.tables.novel, upstream: upstream, p: nbs.tables.p, rl: nbs.tables.rl}
+	nbs.nomsVersion, nbs.lock = newContents.vers, newContents.lock
+	return retired, true
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/constants"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/testify/assert"
+)
+
+func makeSpecs(counts ...uint32) []tableSpec {
+	specs := make([]tableSpec, len(counts))
+	for i, count := range counts {
+		specs[i] = tableSpec{computeAddr([]byte{byte(i)}), count}
+	}
+	return specs
+}
+
+func chunkCounts(specs []tableSpec) []uint32 {
+	counts := make([]uint32, len(specs))
+	for i, spec := range specs {
+		counts[i] = spec.chunkCount
+	}
+	return counts
+}
+
+func TestPlanCompaction(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(planCompaction(nil, maxTables))
+
+	// No tier is full.
+	assert.Nil(planCompaction(makeSpecs(1, 2, 3, 100, 20), maxTables))
+
+	// Tier 0 (fewer than 4 chunks) is full, so it's compacted, but not the larger tables.
+	assert.Equal([]uint32{1, 1, 2, 3}, chunkCounts(planCompaction(makeSpecs(100, 1, 3, 2, 20, 1), maxTables)))
+
+	// The lowest full tier goes first, and empty tables are ignored.
+	assert.Equal([]uint32{4, 5, 7, 15}, chunkCounts(planCompaction(makeSpecs(0, 1, 15, 4, 100, 7, 5, 2, 70, 80, 90), maxTables)))
+
+	// No more than maxConjoinedTables are conjoined at once.
+	counts := make([]uint32, 2*maxConjoinedTables)
+	for i := range counts {
+		counts[i] = 1
+	}
+	assert.Len(planCompaction(makeSpecs(counts...), maxTables), maxConjoinedTables)
+
+	// Too many tables, even though no tier is full.
+	assert.Equal([]uint32{1, 4}, chunkCounts(planCompaction(makeSpecs(16, 4, 1, 64), 3)))
+}
+
+func TestStreamingTableWriter(t *testing.T) {
+	assert := assert.New(t)
+	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
+
+	buff := make([]byte, maxTableSize(uint64(len(chunks)), 64, compression{}, nil))
+	tw := newTableWriter(buff, compression{}, nil, nil)
+	streamed := &bytes.Buffer{}
+	stw := newStreamingTableWriter(streamed, compression{}, nil)
+	for _, c := range chunks {
+		tw.addChunk(computeAddr(c), c)
+		stw.addChunk(computeAddr(c), c)
+	}
+	length, name := tw.finish()
+	streamedLength, streamedName := stw.finish()
+
+	assert.Equal(name, streamedName)
+	assert.Equal(length, streamedLength)
+	assert.Equal(buff[:length], streamed.Bytes())
+}
+
+func TestConjoinTables(t *testing.T) {
+	assert := assert.New(t)
+	rl := make(chan struct{}, 2)
+	defer close(rl)
+
+	sources := chunkSources{
+		bytesToChunkSource([]byte("hello2"), []byte("goodbye2")),
+		bytesToChunkSource([]byte("goodbye2"), []byte("badbye2")),
+	}
+	buff := &bytes.Buffer{}
+	name, length, chunkCount := conjoinTables(sources, compression{}, nil, buff, rl)
+	assert.EqualValues(3, chunkCount)
+	assert.EqualValues(buff.Len(), length)
+
+	data := buff.Bytes()
+	conjoined := chunkSourceAdapter{newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil), name}
+	assertChunksInReader([][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}, conjoined, assert)
+}
+
+func TestCompactInBackground(t *testing.T) {
+	assert := assert.New(t)
+	fm, tt, store := makeStoreWithFakes(t)
+	defer store.Close()
+
+	// Simulate another process having committed 4 small tables.
+	inputs := [][]byte{[]byte("ab"), []byte("cd"), []byte("ef"), []byte("gh")}
+	specs := []tableSpec{}
+	for _, data := range inputs {
+		src := tt.p.Compact(createMemTable([][]byte{data}), nil)
+		specs = append(specs, tableSpec{src.hash(), src.count()})
+	}
+	newRoot := hash.Of([]byte("new root"))
+	fm.set(constants.NomsVersion, newRoot, specs)
+	assert.Equal(newRoot, store.RefreshRoot())
+	assert.Len(store.tables.upstream, len(inputs))
+
+	// Committing kicks off a compaction, which conjoins the 4 small tables.
+	assert.True(store.UpdateRoot(hash.Of([]byte("newer root")), newRoot))
+	store.compactWg.Wait()
+	assert.Len(store.tables.upstream, 1)
+	assertDataInStore(inputs, store, assert)
+}
+
+func TestCompactStaleWriterCantRestoreCompactees(t *testing.T) {
+	assert := assert.New(t)
+	fm, tt, store := makeStoreWithFakes(t)
+	defer store.Close()
+
+	inputs := [][]byte{[]byte("ab"), []byte("cd"), []byte("ef"), []byte("gh")}
+	specs := []tableSpec{}
+	for _, data := range inputs {
+		src := tt.p.Compact(createMemTable([][]byte{data}), nil)
+		specs = append(specs, tableSpec{src.hash(), src.count()})
+	}
+	newRoot := hash.Of([]byte("new root"))
+	fm.set(constants.NomsVersion, newRoot, specs)
+	assert.Equal(newRoot, store.RefreshRoot())
+
+	// stale reads the manifest before the compaction, and commits after it, without the root having moved in between.
+	stale := newNomsBlockStore(fm, tableSet{p: tt.p, rl: tt.rl}, testMemTableSize, maxTables)
+	defer stale.Close()
+	stats := store.Compact()
+	assert.Equal(1, stats.Conjoins)
+
+	stale.Put(chunks.NewChunk([]byte("ij")))
+	assert.True(stale.UpdateRoot(hash.Of([]byte("newer root")), newRoot))
+	_, contents := fm.ParseIfExists(nil)
+	if assert.Len(contents.specs, 2) {
+		for _, spec := range specs {
+			assert.NotEqual(spec.name, contents.specs[0].name)
+			assert.NotEqual(spec.name, contents.specs[1].name)
+		}
+	}
+	assertDataInStore(append(inputs, []byte("ij")), stale, assert)
+}
@@ -5,7 +5,10 @@
 package nbs
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/attic-labs/noms/go/constants"
@@ -23,11 +26,16 @@ const (
 	versAttr       = "vers"
 	nbsVersAttr    = "nbsVers"
 	tableSpecsAttr = "specs"
+	lockAttr       = "lck"
+	compAttr       = "comp"
+	gcGenAttr      = "gcGen"
 )
 
 var (
-	valueEqualsExpression            = fmt.Sprintf("(%s = :prev) and (%s = :vers)", rootAttr, versAttr)
-	valueNotExistsOrEqualsExpression = fmt.Sprintf("attribute_not_exists("+rootAttr+") or %s", valueEqualsExpression)
+	lockEqualsExpression = fmt.Sprintf("(%s = :lock) and (%s = :vers)", lockAttr, versAttr)
+	notExistsExpression  = fmt.Sprintf("attribute_not_exists(%s)", rootAttr)
+	// legacyEqualsExpression matches a manifest written before there were locks, by its root and specs instead.
+	legacyEqualsExpression = fmt.Sprintf("attribute_not_exists(%s) and (%s = :prev) and (%s = :specs) and (%s = :vers)", lockAttr, rootAttr, tableSpecsAttr, versAttr)
 )
 
 type ddbsvc interface {
@@ -36,16 +44,29 @@ type ddbsvc interface {
 }
 
 // It assumes the existence of a DynamoDB table whose primary partition key is in String format and named `db`.
+// Updates are conditional on the lock attribute, which is generateLockHash() of the root, specs, compression and GC generation.
+// The compression that new tables are written with, as formatted by compression.String(), is only stored if it isn't the default, and the GC generation only if garbage has been collected.
+// If |key| is not nil, the table specs are sealed with it, as by sealFile(), and base64-encoded. The root is not, since updates of manifests written before there were locks are conditional on it.
 type dynamoManifest struct {
 	table, db string
 	ddbsvc    ddbsvc
+	key       *EncryptionKey
 }
 
-func newDynamoManifest(table, namespace string, ddb ddbsvc) *dynamoManifest {
-	return &dynamoManifest{table: table, db: namespace, ddbsvc: ddb}
+func newDynamoManifest(table, namespace string, ddb ddbsvc, key *EncryptionKey) *dynamoManifest {
+	return &dynamoManifest{table: table, db: namespace, ddbsvc: ddb, key: key}
 }
 
-func (dm dynamoManifest) ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec) {
+func (dm dynamoManifest) ParseIfExists(readHook func()) (exists bool, contents manifestContents) {
+	// !exists(dbAttr) => unitialized store
+	if item := dm.getItem(); item != nil {
+		exists, contents = true, dm.parseItem(item)
+	}
+	return
+}
+
+// getItem returns the manifest's item, or nil if there isn't one.
+func (dm dynamoManifest) getItem() map[string]*dynamodb.AttributeValue {
 	result, err := dm.ddbsvc.GetItem(&dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(true), // This doubles the cost :-(
 		TableName:      aws.String(dm.table),
@@ -54,23 +75,60 @@ func (dm dynamoManifest) ParseIfExists(readHook func()) (exists bool, vers strin
 		},
 	})
 	d.PanicIfError(err)
+	if len(result.Item) == 0 {
+		return nil
+	}
+	return result.Item
+}
 
-	// !exists(dbAttr) => unitialized store
-	if len(result.Item) > 0 {
-		if !validateManifest(result.Item) {
-			d.Panic("Malformed manifest for %s: %+v", dm.db, result.Item)
+func (dm dynamoManifest) parseItem(item map[string]*dynamodb.AttributeValue) manifestContents {
+	if !validateManifest(item) {
+		d.Panic("Malformed manifest for %s: %+v", dm.db, item)
+	}
+	root := hash.New(item[rootAttr].B)
+	specs := parseSpecs(strings.Split(dm.openSpecs(*item[tableSpecsAttr].S), ":"))
+	comp := compression{}
+	if item[compAttr] != nil {
+		var err error
+		if comp, err = parseCompression(*item[compAttr].S); err != nil {
+			d.Panic("Malformed manifest for %s: %s", dm.db, err)
 		}
-		exists = true
-		vers = *result.Item[versAttr].S
-		root = hash.New(result.Item[rootAttr].B)
-		tableSpecs = parseSpecs(strings.Split(*result.Item[tableSpecsAttr].S, ":"))
 	}
-
-	return
+	var gcGen uint64
+	if item[gcGenAttr] != nil {
+		var err error
+		if gcGen, err = strconv.ParseUint(*item[gcGenAttr].N, 10, 64); err != nil || gcGen == 0 {
+			d.Panic("Malformed manifest for %s: GC generation %s", dm.db, *item[gcGenAttr].N)
+		}
+	}
+	lock := generateLockHash(root, specs, comp, gcGen)
+	if item[lockAttr] != nil && !bytes.Equal(item[lockAttr].B, lock[:]) {
+		d.Panic("Malformed manifest for %s: lock is %x, not %s", dm.db, item[lockAttr].B, lock)
+	}
+	return manifestContents{*item[versAttr].S, lock, root, specs, comp, gcGen}
 }
 
 func validateManifest(item map[string]*dynamodb.AttributeValue) bool {
-	return len(item) == 5 &&
+	optional := 0
+	if item[lockAttr] != nil {
+		if item[lockAttr].B == nil {
+			return false
+		}
+		optional++
+	}
+	if item[compAttr] != nil {
+		if item[compAttr].S == nil || item[lockAttr] == nil {
+			return false
+		}
+		optional++
+	}
+	if item[gcGenAttr] != nil {
+		if item[gcGenAttr].N == nil || item[lockAttr] == nil {
+			return false
+		}
+		optional++
+	}
+	return len(item) == 5+optional &&
 		item[nbsVersAttr] != nil && item[nbsVersAttr].S != nil &&
 		StorageVersion == *item[nbsVersAttr].S &&
 		item[versAttr] != nil && item[versAttr].S != nil &&
@@ -78,45 +136,92 @@ func validateManifest(item map[string]*dynamodb.AttributeValue) bool {
 		item[tableSpecsAttr] != nil && item[tableSpecsAttr].S != nil
 }
 
-func (dm dynamoManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
-	tableSpecs = specs
-
-	tableInfo := make([]string, 2*len(tableSpecs))
-	formatSpecs(tableSpecs, tableInfo)
+func (dm dynamoManifest) Update(lastLock addr, newContents manifestContents, writeHook func()) manifestContents {
+	tableInfo := make([]string, 2*len(newContents.specs))
+	formatSpecs(newContents.specs, tableInfo)
 	putArgs := dynamodb.PutItemInput{
 		TableName: aws.String(dm.table),
 		Item: map[string]*dynamodb.AttributeValue{
 			dbAttr:         {S: aws.String(dm.db)},
 			nbsVersAttr:    {S: aws.String(StorageVersion)},
 			versAttr:       {S: aws.String(constants.NomsVersion)},
-			rootAttr:       {B: newRoot[:]},
-			tableSpecsAttr: {S: aws.String(strings.Join(tableInfo, ":"))},
+			rootAttr:       {B: newContents.root[:]},
+			tableSpecsAttr: {S: aws.String(dm.sealSpecs(strings.Join(tableInfo, ":")))},
+			lockAttr:       {B: newContents.lock[:]},
 		},
 	}
+	if newContents.comp != (compression{}) {
+		putArgs.Item[compAttr] = &dynamodb.AttributeValue{S: aws.String(newContents.comp.String())}
+	}
+	if newContents.gcGen != 0 {
+		putArgs.Item[gcGenAttr] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(newContents.gcGen, 10))}
+	}
 
-	expr := valueEqualsExpression
-	if root.IsEmpty() {
-		expr = valueNotExistsOrEqualsExpression
+	if lastLock == (addr{}) {
+		putArgs.ConditionExpression = aws.String(notExistsExpression)
+	} else {
+		putArgs.ConditionExpression = aws.String(lockEqualsExpression)
+		putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":lock": {B: lastLock[:]},
+			":vers": {S: aws.String(constants.NomsVersion)},
+		}
+	}
+	if dm.tryPut(&putArgs) {
+		return newContents
 	}
 
-	putArgs.ConditionExpression = aws.String(expr)
-	putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
-		":prev": {B: root[:]},
-		":vers": {S: aws.String(constants.NomsVersion)},
+	item := dm.getItem()
+	d.Chk.True(item != nil)
+	upstream := dm.parseItem(item)
+	d.Chk.True(upstream.vers == constants.NomsVersion)
+	if upstream.lock == lastLock && item[lockAttr] == nil {
+		// The manifest was written before there were locks, so the condition has to be on exactly what it holds now.
+		putArgs.ConditionExpression = aws.String(legacyEqualsExpression)
+		putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":prev":  item[rootAttr],
+			":specs": item[tableSpecsAttr],
+			":vers":  {S: aws.String(constants.NomsVersion)},
+		}
+		if dm.tryPut(&putArgs) {
+			return newContents
+		}
+		upstream = dm.parseItem(dm.getItem())
 	}
+	return upstream
+}
+
+// tryPut returns whether |putArgs| was written, or false if its condition
+// failed.
+func (dm dynamoManifest) tryPut(putArgs *dynamodb.PutItemInput) bool {
+	return tryPutItem(dm.ddbsvc, putArgs)
+}
 
-	_, err := dm.ddbsvc.PutItem(&putArgs)
+func tryPutItem(ddb ddbsvc, putArgs *dynamodb.PutItemInput) bool {
+	_, err := ddb.PutItem(putArgs)
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
 			if awsErr.Code() == "ConditionalCheckFailedException" {
-				exists, vers, actual, tableSpecs := dm.ParseIfExists(nil)
-				d.Chk.True(exists)
-				d.Chk.True(vers == constants.NomsVersion)
-				return actual, tableSpecs
+				return false
 			} // TODO handle other aws errors?
 		}
 		d.Chk.NoError(err)
 	}
+	return true
+}
+
+func (dm dynamoManifest) sealSpecs(specs string) string {
+	if dm.key == nil {
+		return specs
+	}
+	return base64.StdEncoding.EncodeToString(sealFile(dm.key, dm.db, []byte(specs)))
+}
 
-	return newRoot, tableSpecs
+func (dm dynamoManifest) openSpecs(specs string) string {
+	// Table specs are base32 hashes and counts, separated by colons, so a base64 string of sealed specs can't be mistaken for them.
+	sealed, err := base64.StdEncoding.DecodeString(specs)
+	if err != nil || !strings.HasPrefix(string(sealed), encryptedFileMagic) {
+		checkUnencrypted(dm.key, "The manifest of "+dm.db)
+		return specs
+	}
+	return string(openFile(dm.key, dm.db, sealed))
 }
@@ -6,6 +6,7 @@ package nbs
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/attic-labs/noms/go/constants"
@@ -22,7 +23,7 @@ const (
 
 func makeDynamoManifestFake(t *testing.T) (mm manifest, ddb *fakeDDB) {
 	ddb = makeFakeDDB(assert.New(t))
-	mm = newDynamoManifest(table, db, ddb)
+	mm = newDynamoManifest(table, db, ddb, nil)
 	return
 }
 
@@ -30,7 +31,7 @@ func TestDynamoManifestParseIfExists(t *testing.T) {
 	assert := assert.New(t)
 	mm, ddb := makeDynamoManifestFake(t)
 
-	exists, vers, root, tableSpecs := mm.ParseIfExists(nil)
+	exists, _ := mm.ParseIfExists(nil)
 	assert.False(exists)
 
 	// Simulate another process writing a manifest (with an old Noms version).
@@ -39,14 +40,15 @@ func TestDynamoManifestParseIfExists(t *testing.T) {
 	ddb.put(db, newRoot[:], "0", tableName.String()+":"+"0")
 
 	// ParseIfExists should now reflect the manifest written above.
-	exists, vers, root, tableSpecs = mm.ParseIfExists(nil)
+	exists, contents := mm.ParseIfExists(nil)
 	assert.True(exists)
-	assert.Equal("0", vers)
-	assert.Equal(newRoot, root)
-	if assert.Len(tableSpecs, 1) {
-		assert.Equal(tableName.String(), tableSpecs[0].name.String())
-		assert.Equal(uint32(0), tableSpecs[0].chunkCount)
+	assert.Equal("0", contents.vers)
+	assert.Equal(newRoot, contents.root)
+	if assert.Len(contents.specs, 1) {
+		assert.Equal(tableName.String(), contents.specs[0].name.String())
+		assert.Equal(uint32(0), contents.specs[0].chunkCount)
 	}
+	assert.Equal(generateLockHash(contents.root, contents.specs, compression{}, 0), contents.lock)
 }
 
 func TestDynamoManifestUpdateWontClobberOldVersion(t *testing.T) {
@@ -57,30 +59,128 @@ func TestDynamoManifestUpdateWontClobberOldVersion(t *testing.T) {
 	badRoot := hash.Of([]byte("bad root"))
 	ddb.put(db, badRoot[:], "0", "")
 
-	assert.Panics(func() { mm.Update(nil, badRoot, hash.Hash{}, nil) })
+	assert.Panics(func() {
+		mm.Update(generateLockHash(badRoot, nil, compression{}, 0), newManifestContents(hash.Hash{}, nil, compression{}, 0), nil)
+	})
 }
 
 func TestDynamoManifestUpdate(t *testing.T) {
 	assert := assert.New(t)
-	mm, _ := makeDynamoManifestFake(t)
+	mm, ddb := makeDynamoManifestFake(t)
 
 	// First, test winning the race against another process.
-	newRoot := hash.Of([]byte("new root"))
 	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
-	actual, tableSpecs := mm.Update(specs, hash.Hash{}, newRoot, nil)
-	assert.Equal(newRoot, actual)
-	assert.Equal(specs, tableSpecs)
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	upstream := mm.Update(addr{}, contents, nil)
+	assert.Equal(contents, upstream)
+	assert.Equal(contents.lock[:], ddb.data[db].lock)
 
 	// Now, test the case where the optimistic lock fails, and someone else updated the root since last we checked.
-	newRoot2 := hash.Of([]byte("new root 2"))
-	actual, tableSpecs = mm.Update(nil, hash.Hash{}, newRoot2, nil)
-	assert.Equal(newRoot, actual)
-	assert.Equal(specs, tableSpecs)
-	actual, tableSpecs = mm.Update(nil, actual, newRoot2, nil)
+	contents2 := newManifestContents(hash.Of([]byte("new root 2")), []tableSpec{}, compression{}, 0)
+	upstream = mm.Update(addr{}, contents2, nil)
+	assert.Equal(contents, upstream)
+	upstream = mm.Update(upstream.lock, contents2, nil)
+	assert.Equal(contents2, upstream)
+
+	// The lock covers the tables too, so an update from a writer that hasn't seen the latest tables fails, even though the root is the same.
+	contents3 := newManifestContents(contents2.root, specs, compression{}, 0)
+	upstream = mm.Update(contents.lock, contents3, nil)
+	assert.Equal(contents2, upstream)
+	upstream = mm.Update(contents2.lock, contents3, nil)
+	assert.Equal(contents3, upstream)
+}
+
+func TestDynamoManifestUpdateLegacy(t *testing.T) {
+	assert := assert.New(t)
+	mm, ddb := makeDynamoManifestFake(t)
+
+	// Simulate a manifest written before there were locks.
+	root := hash.Of([]byte("root"))
+	tableName := computeAddr([]byte("table1"))
+	ddb.put(db, root[:], constants.NomsVersion, tableName.String()+":"+"3")
+	exists, contents := mm.ParseIfExists(nil)
+	assert.True(exists)
+
+	stale := newManifestContents(root, nil, compression{}, 0)
+	assert.Equal(contents, mm.Update(stale.lock, newManifestContents(hash.Of([]byte("new root")), nil, compression{}, 0), nil))
+	assert.Nil(ddb.data[db].lock)
+
+	newContents := newManifestContents(hash.Of([]byte("new root")), contents.specs, compression{}, 0)
+	assert.Equal(newContents, mm.Update(contents.lock, newContents, nil))
+	assert.Equal(newContents.lock[:], ddb.data[db].lock)
+}
+
+func TestDynamoManifestCompression(t *testing.T) {
+	assert := assert.New(t)
+	mm, ddb := makeDynamoManifestFake(t)
+
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	assert.Equal(contents, mm.Update(addr{}, contents, nil))
+	assert.Empty(ddb.data[db].comp)
+
+	zstd := newManifestContents(contents.root, specs, compression{ZstdCodec, 0xabcd}, 0)
+	assert.Equal(zstd, mm.Update(contents.lock, zstd, nil))
+	assert.Equal("zstd.0000abcd", ddb.data[db].comp)
+	exists, actual := mm.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(zstd, actual)
+}
+
+func TestDynamoManifestGCGeneration(t *testing.T) {
+	assert := assert.New(t)
+	mm, ddb := makeDynamoManifestFake(t)
+
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	assert.Equal(contents, mm.Update(addr{}, contents, nil))
+	assert.Empty(ddb.data[db].gcGen)
+
+	collected := newManifestContents(contents.root, specs, compression{}, 2)
+	assert.Equal(collected, mm.Update(contents.lock, collected, nil))
+	assert.Equal("2", ddb.data[db].gcGen)
+	exists, actual := mm.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(collected, actual)
+}
+
+func TestDynamoManifestEncrypted(t *testing.T) {
+	assert := assert.New(t)
+	ddb := makeFakeDDB(assert)
+	key := newTestEncryptionKey(assert, 1)
+	mm := newDynamoManifest(table, db, ddb, key)
+
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	mm.Update(addr{}, contents, nil)
+	root, _, sealed := ddb.get(db)
+	assert.Equal(contents.root[:], root)
+	assert.NotContains(sealed, specs[0].name.String())
+
+	exists, actual := mm.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(contents, actual)
+
+	assert.Panics(func() { newDynamoManifest(table, db, ddb, nil).ParseIfExists(nil) })
+	assert.Panics(func() { newDynamoManifest(table, db, ddb, newTestEncryptionKey(assert, 2)).ParseIfExists(nil) })
+}
+
+func TestDynamoManifestRefusesUnencrypted(t *testing.T) {
+	assert := assert.New(t)
+	ddb := makeFakeDDB(assert)
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	newDynamoManifest(table, db, ddb, nil).Update(addr{}, contents, nil)
+
+	key := newTestEncryptionKey(assert, 1)
+	assert.Panics(func() { newDynamoManifest(table, db, ddb, key).ParseIfExists(nil) })
+	_, actual := newDynamoManifest(table, db, ddb, key.ReadingUnencrypted()).ParseIfExists(nil)
+	assert.Equal(contents, actual)
 }
 
 type fakeDDB struct {
 	data    map[string]record
+	logs    map[string]map[string]*dynamodb.AttributeValue // the items of dynamoRootLogs
 	assert  *assert.Assertions
 	numPuts int
 }
@@ -88,11 +188,15 @@ type fakeDDB struct {
 type record struct {
 	root        []byte
 	vers, specs string
+	lock        []byte // nil for manifests written before there were locks
+	comp        string // empty for the default compression
+	gcGen       string // empty until garbage has been collected
 }
 
 func makeFakeDDB(a *assert.Assertions) *fakeDDB {
 	return &fakeDDB{
 		data:   map[string]record{},
+		logs:   map[string]map[string]*dynamodb.AttributeValue{},
 		assert: a,
 	}
 }
@@ -100,6 +204,9 @@ func makeFakeDDB(a *assert.Assertions) *fakeDDB {
 func (m *fakeDDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
 	key := input.Key[dbAttr].S
 	m.assert.NotNil(key, "key should have been a String: %+v", input.Key[dbAttr])
+	if strings.Contains(*key, rootLogKeySuffix) {
+		return &dynamodb.GetItemOutput{Item: m.logs[*key]}, nil
+	}
 
 	item := map[string]*dynamodb.AttributeValue{}
 	root, vers, specs := m.get(*key)
@@ -109,6 +216,15 @@ func (m *fakeDDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput
 		item[versAttr] = &dynamodb.AttributeValue{S: aws.String(vers)}
 		item[rootAttr] = &dynamodb.AttributeValue{B: root}
 		item[tableSpecsAttr] = &dynamodb.AttributeValue{S: aws.String(specs)}
+		if lock := m.data[*key].lock; lock != nil {
+			item[lockAttr] = &dynamodb.AttributeValue{B: lock}
+		}
+		if comp := m.data[*key].comp; comp != "" {
+			item[compAttr] = &dynamodb.AttributeValue{S: aws.String(comp)}
+		}
+		if gcGen := m.data[*key].gcGen; gcGen != "" {
+			item[gcGenAttr] = &dynamodb.AttributeValue{N: aws.String(gcGen)}
+		}
 	}
 	return &dynamodb.GetItemOutput{Item: item}, nil
 }
@@ -118,13 +234,19 @@ func (m *fakeDDB) get(k string) ([]byte, string, string) {
 }
 
 func (m *fakeDDB) put(k string, r []byte, v string, s string) {
-	m.data[k] = record{r, v, s}
+	m.data[k] = record{r, v, s, nil, "", ""}
 }
 
 func (m *fakeDDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
 	m.assert.NotNil(input.Item[dbAttr], "%s should have been present", dbAttr)
 	m.assert.NotNil(input.Item[dbAttr].S, "key should have been a String: %+v", input.Item[dbAttr])
 	key := *input.Item[dbAttr].S
+	if itemSize(input.Item) > maxDynamoItemSize {
+		return nil, mockAWSError("ValidationException")
+	}
+	if strings.Contains(key, rootLogKeySuffix) {
+		return m.putRootLog(key, input)
+	}
 
 	m.assert.NotNil(input.Item[nbsVersAttr], "%s should have been present", nbsVersAttr)
 	m.assert.NotNil(input.Item[nbsVersAttr].S, "nbsVers should have been a String: %+v", input.Item[nbsVersAttr])
@@ -142,21 +264,86 @@ func (m *fakeDDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput
 	m.assert.NotNil(input.Item[tableSpecsAttr].S, "specs should have been a String: %+v", input.Item[tableSpecsAttr])
 	specs := *input.Item[tableSpecsAttr].S
 
-	mustNotExist := *(input.ConditionExpression) == valueNotExistsOrEqualsExpression
-	current, present := m.data[key]
+	m.assert.NotNil(input.Item[lockAttr], "%s should have been present", lockAttr)
+	m.assert.NotNil(input.Item[lockAttr].B, "lock should have been a blob: %+v", input.Item[lockAttr])
+	lock := input.Item[lockAttr].B
 
-	if mustNotExist && present {
-		return nil, mockAWSError("ConditionalCheckFailedException")
-	} else if !mustNotExist && !checkCondition(current, input.ExpressionAttributeValues) {
+	comp := ""
+	if input.Item[compAttr] != nil {
+		m.assert.NotNil(input.Item[compAttr].S, "comp should have been a String: %+v", input.Item[compAttr])
+		comp = *input.Item[compAttr].S
+	}
+
+	gcGen := ""
+	if input.Item[gcGenAttr] != nil {
+		m.assert.NotNil(input.Item[gcGenAttr].N, "gcGen should have been a Number: %+v", input.Item[gcGenAttr])
+		gcGen = *input.Item[gcGenAttr].N
+	}
+
+	current, present := m.data[key]
+	if !checkCondition(*input.ConditionExpression, current, present, input.ExpressionAttributeValues) {
 		return nil, mockAWSError("ConditionalCheckFailedException")
 	}
 
-	m.put(key, root, constants.NomsVersion, specs)
+	m.data[key] = record{root, constants.NomsVersion, specs, lock, comp, gcGen}
 	m.numPuts++
 
 	return &dynamodb.PutItemOutput{}, nil
 }
 
-func checkCondition(current record, expressionAttrVals map[string]*dynamodb.AttributeValue) bool {
-	return current.vers == *expressionAttrVals[":vers"].S && bytes.Equal(current.root, expressionAttrVals[":prev"].B)
+func (m *fakeDDB) putRootLog(key string, input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if !strings.HasSuffix(key, rootLogKeySuffix) {
+		m.assert.NotNil(input.Item[rootLogAttr], "%s should have been present", rootLogAttr)
+		m.assert.NotNil(input.Item[rootLogAttr].S, "log should have been a String: %+v", input.Item[rootLogAttr])
+		m.assert.NotNil(input.Item[rootLogPageAttr], "%s should have been present", rootLogPageAttr)
+		m.assert.NotNil(input.Item[rootLogPageAttr].N, "page should have been a Number: %+v", input.Item[rootLogPageAttr])
+	}
+	m.assert.NotNil(input.Item[rootLogSeqAttr], "%s should have been present", rootLogSeqAttr)
+	m.assert.NotNil(input.Item[rootLogSeqAttr].N, "seq should have been a Number: %+v", input.Item[rootLogSeqAttr])
+
+	current, present := m.logs[key]
+	switch *input.ConditionExpression {
+	case rootLogNotExistsExpression:
+		if present {
+			return nil, mockAWSError("ConditionalCheckFailedException")
+		}
+	case rootLogSeqEqualsExpression:
+		if !present || *current[rootLogSeqAttr].N != *input.ExpressionAttributeValues[":seq"].N {
+			return nil, mockAWSError("ConditionalCheckFailedException")
+		}
+	default:
+		panic("unknown condition " + *input.ConditionExpression)
+	}
+	m.logs[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// maxDynamoItemSize is DynamoDB's limit on the size of an item.
+const maxDynamoItemSize = 400 * 1024
+
+// itemSize returns the size of |item|, as DynamoDB counts it: the lengths of
+// its attributes' names and values.
+func itemSize(item map[string]*dynamodb.AttributeValue) (size int) {
+	for name, v := range item {
+		size += len(name) + len(v.B)
+		if v.S != nil {
+			size += len(*v.S)
+		}
+		if v.N != nil {
+			size += len(*v.N)
+		}
+	}
+	return
+}
+
+func checkCondition(expr string, current record, present bool, vals map[string]*dynamodb.AttributeValue) bool {
+	switch expr {
+	case notExistsExpression:
+		return !present
+	case lockEqualsExpression:
+		return present && current.vers == *vals[":vers"].S && bytes.Equal(current.lock, vals[":lock"].B)
+	case legacyEqualsExpression:
+		return present && current.lock == nil && current.vers == *vals[":vers"].S && bytes.Equal(current.root, vals[":prev"].B) && current.specs == *vals[":specs"].S
+	}
+	panic("unknown condition " + expr)
 }
@@ -0,0 +1,203 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	rootLogKeySuffix = "#rootlog"
+	rootLogAttr      = "log"
+	rootLogSeqAttr   = "seq"
+	rootLogPageAttr  = "page"
+)
+
+var (
+	rootLogNotExistsExpression = fmt.Sprintf("attribute_not_exists(%s)", dbAttr)
+	rootLogSeqEqualsExpression = fmt.Sprintf("%s = :seq", rootLogSeqAttr)
+
+	// rootLogPageSize is the number of records a dynamoRootLog keeps in each
+	// of its pages, and rootLogPages the number of pages it keeps. A record
+	// is about 100 bytes, so a page stays well below DynamoDB's limit of
+	// 400KB on the size of an item.
+	rootLogPageSize = 1024
+	rootLogPages    = 16
+)
+
+// dynamoRootLog keeps a rootLog in the DynamoDB table of a dynamoManifest,
+// in items of its own, next to the manifest's. The item whose key is the
+// manifest's with rootLogKeySuffix appended holds the number of records that
+// have been appended. Each Append claims the next number by incrementing it,
+// conditional on its current value, so that concurrent writers don't clobber
+// one another, and then adds the record to the page that holds it.
+//
+// Pages hold rootLogPageSize records each, and are kept in a ring of
+// rootLogPages items, whose keys have the page's position in the ring
+// appended, so page N overwrites page N-rootLogPages. Each is updated
+// conditional on a sequence number of its own. Only the last rootLogPages
+// pages are read, so the oldest records are dropped a page at a time.
+type dynamoRootLog struct {
+	table, db string
+	ddbsvc    ddbsvc
+}
+
+func newDynamoRootLog(table, namespace string, ddb ddbsvc) dynamoRootLog {
+	return dynamoRootLog{table, namespace + rootLogKeySuffix, ddb}
+}
+
+func (dl dynamoRootLog) Append(record string) {
+	var n uint64
+	for {
+		item := dl.getItem(dl.db)
+		count := dl.parseNumber(item, rootLogSeqAttr)
+		if dl.tryPut(dl.db, count, map[string]*dynamodb.AttributeValue{
+			rootLogSeqAttr: {N: aws.String(strconv.FormatUint(count+1, 10))},
+		}) {
+			n = count
+			break
+		}
+	}
+
+	page, key := dl.page(n)
+	for {
+		item := dl.getItem(key)
+		seq := dl.parseNumber(item, rootLogSeqAttr)
+		var records []string
+		if item != nil {
+			switch p := dl.parseNumber(item, rootLogPageAttr); {
+			case p > page:
+				// The ring has come round to this page's item again, so the record is already too old to keep.
+				return
+			case p == page:
+				records = []string{dl.parseLog(item)}
+			}
+		}
+		records = append(records, strconv.FormatUint(n, 10)+" "+record)
+		if dl.tryPut(key, seq, map[string]*dynamodb.AttributeValue{
+			rootLogAttr:     {S: aws.String(strings.Join(records, "\n"))},
+			rootLogPageAttr: {N: aws.String(strconv.FormatUint(page, 10))},
+			rootLogSeqAttr:  {N: aws.String(strconv.FormatUint(seq+1, 10))},
+		}) {
+			return
+		}
+	}
+}
+
+func (dl dynamoRootLog) Records() (records []string) {
+	count := dl.parseNumber(dl.getItem(dl.db), rootLogSeqAttr)
+	if count == 0 {
+		return nil
+	}
+	last, _ := dl.page(count - 1)
+	first := uint64(0)
+	if last >= uint64(rootLogPages) {
+		first = last - uint64(rootLogPages) + 1
+	}
+
+	numbered := map[uint64]string{}
+	for page := first; page <= last; page++ {
+		_, key := dl.page(page * uint64(rootLogPageSize))
+		item := dl.getItem(key)
+		if item == nil || dl.parseNumber(item, rootLogPageAttr) != page {
+			continue
+		}
+		for _, line := range strings.Split(dl.parseLog(item), "\n") {
+			i := strings.IndexByte(line, ' ')
+			if i < 0 {
+				d.Panic("Malformed root log for %s: %q", dl.db, line)
+			}
+			n, err := strconv.ParseUint(line[:i], 10, 64)
+			if err != nil {
+				d.Panic("Malformed root log for %s: %s", dl.db, err)
+			}
+			numbered[n] = line[i+1:]
+		}
+	}
+
+	// Records that were claimed by writers that died before adding them are missing.
+	for n := first * uint64(rootLogPageSize); n < count; n++ {
+		if r, present := numbered[n]; present {
+			records = append(records, r)
+		}
+	}
+	return
+}
+
+// page returns the number of the page that holds record |n|, and the key of
+// the item it's kept in.
+func (dl dynamoRootLog) page(n uint64) (page uint64, key string) {
+	page = n / uint64(rootLogPageSize)
+	return page, dl.db + "#" + strconv.FormatUint(page%uint64(rootLogPages), 10)
+}
+
+// getItem returns the item whose key is |key|, or nil if there isn't one.
+func (dl dynamoRootLog) getItem(key string) map[string]*dynamodb.AttributeValue {
+	result, err := dl.ddbsvc.GetItem(&dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(dl.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			dbAttr: {S: aws.String(key)},
+		},
+	})
+	d.PanicIfError(err)
+	if len(result.Item) == 0 {
+		return nil
+	}
+	return result.Item
+}
+
+// parseNumber returns the number in |item|'s attribute |attr|, or 0 if
+// |item| is nil.
+func (dl dynamoRootLog) parseNumber(item map[string]*dynamodb.AttributeValue, attr string) uint64 {
+	if item == nil {
+		return 0
+	}
+	if item[attr] == nil || item[attr].N == nil {
+		d.Panic("Malformed root log for %s: %+v", dl.db, item)
+	}
+	n, err := strconv.ParseUint(*item[attr].N, 10, 64)
+	if err != nil {
+		d.Panic("Malformed root log for %s: %s", dl.db, err)
+	}
+	return n
+}
+
+// parseLog returns the records in the page |item|, one per line, each
+// preceded by its number.
+func (dl dynamoRootLog) parseLog(item map[string]*dynamodb.AttributeValue) string {
+	if item[rootLogAttr] == nil || item[rootLogAttr].S == nil {
+		d.Panic("Malformed root log for %s: %+v", dl.db, item)
+	}
+	return *item[rootLogAttr].S
+}
+
+// tryPut writes |attrs| to the item whose key is |key|, and returns whether
+// it did, which it does only if the item's sequence number is still |seq|, or
+// it doesn't exist and |seq| is 0.
+func (dl dynamoRootLog) tryPut(key string, seq uint64, attrs map[string]*dynamodb.AttributeValue) bool {
+	putArgs := dynamodb.PutItemInput{
+		TableName: aws.String(dl.table),
+		Item:      map[string]*dynamodb.AttributeValue{dbAttr: {S: aws.String(key)}},
+	}
+	for k, v := range attrs {
+		putArgs.Item[k] = v
+	}
+	if seq == 0 {
+		putArgs.ConditionExpression = aws.String(rootLogNotExistsExpression)
+	} else {
+		putArgs.ConditionExpression = aws.String(rootLogSeqEqualsExpression)
+		putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":seq": {N: aws.String(strconv.FormatUint(seq, 10))},
+		}
+	}
+	return tryPutItem(dl.ddbsvc, &putArgs)
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/attic-labs/noms/go/d"
+)
+
+const (
+	// EncryptionKeySize is the size in bytes of an EncryptionKey, which is an AES-256 key.
+	EncryptionKeySize = 32
+
+	nonceSize    uint64 = 12
+	tagSize      uint64 = 16
+	sealOverhead        = nonceSize + tagSize
+
+	// encryptedFileMagic starts each file that's sealed with sealFile(), e.g. an encrypted manifest. It is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs/encrypted-file".
+	encryptedFileMagic = "\x33\xd9\x41\x6e\x1e\x3f\xb2\x83"
+)
+
+// EncryptionKey encrypts and authenticates the tables, manifest and
+// dictionaries of a NomsBlockStore, with AES-256-GCM. Chunk addresses are
+// computed over the plaintext, so encryption doesn't change them.
+type EncryptionKey struct {
+	id               uint32 // identifies the key, without revealing it
+	aead             cipher.AEAD
+	readsUnencrypted bool
+}
+
+// NewEncryptionKey returns an EncryptionKey for the EncryptionKeySize bytes
+// of |key|.
+func NewEncryptionKey(key []byte) (*EncryptionKey, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("Encryption key must be %d bytes, not %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	d.PanicIfError(err)
+	aead, err := cipher.NewGCM(block)
+	d.PanicIfError(err)
+	d.PanicIfFalse(uint64(aead.NonceSize()) == nonceSize && uint64(aead.Overhead()) == tagSize)
+	// The ID is derived from the key, so that reading with the wrong key is reported as such, rather than as corruption.
+	sum := sha256.Sum256(append([]byte("https://github.com/attic-labs/nbs/key:"), key...))
+	return &EncryptionKey{binary.BigEndian.Uint32(sum[:]), aead, false}, nil
+}
+
+// ParseEncryptionKey returns the EncryptionKey that |s| encodes in hex, as
+// generated by e.g. `openssl rand -hex 32`. Surrounding whitespace is ignored.
+func ParseEncryptionKey(s string) (*EncryptionKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("Encryption key must be hex-encoded: %s", err)
+	}
+	return NewEncryptionKey(key)
+}
+
+// ID returns a number that identifies the key, which is recorded in
+// everything encrypted with it.
+func (key *EncryptionKey) ID() uint32 {
+	return key.id
+}
+
+// ReadingUnencrypted returns a copy of |key| that can also read tables,
+// manifests and dictionaries written without encryption. Stores opened with
+// |key| itself refuse them, so that unencrypted data can't be slipped into an
+// encrypted store. This is how an existing store is migrated to encryption:
+// everything written with the copy is encrypted, and the tables written
+// before are rewritten encrypted as they're conjoined, or all at once by
+// syncing the store into a new one.
+func (key *EncryptionKey) ReadingUnencrypted() *EncryptionKey {
+	migrating := *key
+	migrating.readsUnencrypted = true
+	return &migrating
+}
+
+// seal appends to |dst| a random nonce, followed by |plaintext| encrypted and
+// authenticated along with |ad|, and returns the result. It takes
+// sealOverhead more bytes than plaintext. If |dst| has the capacity,
+// plaintext may be dst[len(dst)+nonceSize:], and is encrypted in place.
+func (key *EncryptionKey) seal(dst, plaintext, ad []byte) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, nonceSize)...)
+	_, err := rand.Read(dst[n:])
+	d.PanicIfError(err)
+	return key.aead.Seal(dst, dst[n:], plaintext, ad)
+}
+
+// open returns the plaintext of |sealed|, as returned by seal(), if it was
+// sealed along with |ad|.
+func (key *EncryptionKey) open(sealed, ad []byte) ([]byte, error) {
+	if uint64(len(sealed)) < sealOverhead {
+		return nil, fmt.Errorf("Sealed data is only %d bytes", len(sealed))
+	}
+	return key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ad)
+}
+
+// checkKey panics unless |key| is the key with ID |id|, with which |what|
+// was encrypted.
+func checkKey(key *EncryptionKey, id uint32, what string) {
+	if key == nil {
+		d.Panic("%s is encrypted, but no encryption key was given", what)
+	}
+	if key.id != id {
+		d.Panic("%s was encrypted with key %08x, not the given key %08x", what, id, key.id)
+	}
+}
+
+// checkUnencrypted panics if |what| wasn't encrypted, but |key| says
+// everything must be.
+func checkUnencrypted(key *EncryptionKey, what string) {
+	if key != nil && !key.readsUnencrypted {
+		d.Panic("%s was written without encryption, but an encryption key was given", what)
+	}
+}
+
+// sealFile returns |data|, sealed with |key| if it isn't nil, as the
+// contents of the file or object called |name|:
+//
+// +--------------------------+-----------------+-------------+
+// | (8) Encrypted File Magic | (Uint32) Key ID | Sealed Data |
+// +--------------------------+-----------------+-------------+
+//
+// Sealed Data is a random 12-byte nonce, followed by the AES-GCM encryption
+// of the data, with the file's name as additional data.
+func sealFile(key *EncryptionKey, name string, data []byte) []byte {
+	if key == nil {
+		return data
+	}
+	buff := make([]byte, len(encryptedFileMagic)+int(uint32Size), len(encryptedFileMagic)+int(uint32Size+sealOverhead)+len(data))
+	copy(buff, encryptedFileMagic)
+	binary.BigEndian.PutUint32(buff[len(encryptedFileMagic):], key.id)
+	return key.seal(buff, data, []byte(name))
+}
+
+// openFile returns the data that sealFile() returned |contents| for. Files
+// that weren't sealed are returned as they are, if |key| is nil or reads
+// unencrypted data.
+func openFile(key *EncryptionKey, name string, contents []byte) []byte {
+	if !strings.HasPrefix(string(contents), encryptedFileMagic) {
+		checkUnencrypted(key, name)
+		return contents
+	}
+	pos := uint64(len(encryptedFileMagic))
+	checkKey(key, binary.BigEndian.Uint32(contents[pos:]), name)
+	data, err := key.open(contents[pos+uint32Size:], []byte(name))
+	if err != nil {
+		d.Panic("Failed to decrypt %s: %s", name, err)
+	}
+	return data
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/testify/assert"
+)
+
+func newTestEncryptionKey(assert *assert.Assertions, b byte) *EncryptionKey {
+	key, err := NewEncryptionKey(bytes.Repeat([]byte{b}, EncryptionKeySize))
+	assert.NoError(err)
+	return key
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	assert := assert.New(t)
+	key, err := ParseEncryptionKey(strings.Repeat("0f", EncryptionKeySize) + "\n")
+	assert.NoError(err)
+	assert.Equal(newTestEncryptionKey(assert, 0x0f).ID(), key.ID())
+	assert.NotEqual(newTestEncryptionKey(assert, 0x0e).ID(), key.ID())
+
+	_, err = ParseEncryptionKey("not hex")
+	assert.Error(err)
+	_, err = ParseEncryptionKey("0f0f")
+	assert.Error(err)
+}
+
+func TestEncryptedTable(t *testing.T) {
+	assert := assert.New(t)
+	key := newTestEncryptionKey(assert, 1)
+	inputs := structChunks(100)
+
+	mt := newMemTable(1 << 20)
+	for _, c := range inputs {
+		mt.addChunk(computeAddr(c), c)
+	}
+	plainName, _, _ := mt.write(nil, nil)
+	name, data, count := mt.write(nil, key)
+	assert.EqualValues(len(inputs), count)
+	// The name is computed over the index, as it is for an unencrypted table.
+	assert.Equal(plainName, name)
+	assert.Equal(encryptedMagicNumber, string(data[uint64(len(data))-magicNumberSize:]))
+	assert.False(bytes.Contains(data, []byte("Springfield")))
+
+	index := parseTableIndex(data, key)
+	assertChunksInReader(inputs, newTableReader(index, bytes.NewReader(data), fileBlockSize, key), assert)
+
+	assert.Panics(func() { parseTableIndex(data, nil) })
+	assert.Panics(func() { parseTableIndex(data, newTestEncryptionKey(assert, 2)) })
+
+	// Each chunk record is bound to its address, so records can't be swapped.
+	tr := newTableReader(index, bytes.NewReader(data), fileBlockSize, key)
+	record := data[:index.lengths[0]]
+	assert.Panics(func() { tr.parseChunk(addr{}, record) })
+}
+
+func TestEncryptedConjoin(t *testing.T) {
+	assert := assert.New(t)
+	key := newTestEncryptionKey(assert, 1)
+	inputs := structChunks(200)
+
+	s3svc := makeFakeS3(assert)
+	s3p := s3TablePersister{s3: s3svc, bucket: "bucket", partSize: defaultS3PartSize, readRl: make(chan struct{}, 8), key: key}
+	sources := chunkSources{}
+	for _, part := range [][][]byte{inputs[:100], inputs[100:]} {
+		mt := newMemTable(1 << 20)
+		for _, c := range part {
+			mt.addChunk(computeAddr(c), c)
+		}
+		sources = append(sources, s3p.Compact(mt, nil))
+	}
+	src := s3p.CompactAll(sources, compression{})
+	assertChunksInReader(inputs, s3p.Open(src.hash(), src.count()), assert)
+
+	data := s3svc.data[src.hash().String()]
+	assert.False(bytes.Contains(data, []byte("Springfield")))
+	assert.Panics(func() { parseTableIndex(data, nil) })
+}
+
+func TestEncryptedLocalStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	key := newTestEncryptionKey(assert, 1)
+
+	inputs := structChunks(100)
+	dict, err := TrainDictionary(inputs, 1024)
+	assert.NoError(err)
+	store := NewEncryptedLocalStore(dir, 1<<12, key)
+	store.SetCompression(ZstdCodec, dict)
+	for _, data := range inputs {
+		store.Put(chunks.NewChunk(data))
+	}
+	root := chunks.NewChunk(inputs[0]).Hash()
+	assert.True(store.UpdateRoot(root, store.Root()))
+	store.Close()
+
+	for _, name := range []string{manifestFileName, dictionaryFileName(dict.ID())} {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(string(contents), encryptedFileMagic), name)
+	}
+
+	forgetDictionary(dict.ID())
+	store = NewEncryptedLocalStore(dir, 1<<12, key)
+	defer store.Close()
+	assert.Equal(root, store.Root())
+	for _, data := range inputs {
+		assertInputInStore(data, chunks.NewChunk(data).Hash(), store, assert)
+	}
+
+	assert.Panics(func() { NewLocalStore(dir, 1<<12) })
+	assert.Panics(func() { NewEncryptedLocalStore(dir, 1<<12, newTestEncryptionKey(assert, 2)) })
+}
+
+func TestEncryptedStoreRefusesUnencryptedTables(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	inputs := structChunks(100)
+	store := newNomsBlockStore(fileManifest{dir, nil}, newFSTableSet(dir, nil, nil), 1<<12, maxTables)
+	for _, data := range inputs[:50] {
+		store.Put(chunks.NewChunk(data))
+	}
+	assert.True(store.UpdateRoot(chunks.NewChunk(inputs[0]).Hash(), store.Root()))
+	store.Close()
+
+	key := newTestEncryptionKey(assert, 1)
+	assert.Panics(func() { newNomsBlockStore(fileManifest{dir, key}, newFSTableSet(dir, nil, key), 1<<12, maxTables) })
+
+	// A key that reads unencrypted data migrates the store: it encrypts what it writes.
+	migrating := key.ReadingUnencrypted()
+	store = newNomsBlockStore(fileManifest{dir, migrating}, newFSTableSet(dir, nil, migrating), 1<<12, maxTables)
+	for _, data := range inputs[50:] {
+		store.Put(chunks.NewChunk(data))
+	}
+	assert.True(store.UpdateRoot(chunks.NewChunk(inputs[1]).Hash(), store.Root()))
+	for _, data := range inputs {
+		assertInputInStore(data, chunks.NewChunk(data).Hash(), store, assert)
+	}
+	store.Close()
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(contents), encryptedFileMagic))
+	// The manifest is now encrypted, but the first table isn't.
+	assert.Panics(func() { newNomsBlockStore(fileManifest{dir, key}, newFSTableSet(dir, nil, key), 1<<12, maxTables) })
+}
+
+func TestEncryptedIndexCacheDoesNotShareKey(t *testing.T) {
+	assert := assert.New(t)
+	key := newTestEncryptionKey(assert, 1)
+	mt := newMemTable(1 << 20)
+	for _, c := range structChunks(10) {
+		mt.addChunk(computeAddr(c), c)
+	}
+	cache := newIndexCache(1 << 20)
+	s3p := s3TablePersister{s3: makeFakeS3(assert), bucket: "bucket", partSize: defaultS3PartSize, indexCache: cache, readRl: make(chan struct{}, 8), key: key}
+	src := s3p.Compact(mt, nil)
+	index, found := cache.get(src.hash())
+	assert.True(found)
+	assert.True(index.encrypted)
+
+	// A store without the key can't read the table through the cached index.
+	s3p.key = nil
+	assert.Panics(func() { s3p.Open(src.hash(), src.count()) })
+	s3p.key = newTestEncryptionKey(assert, 2)
+	assert.Panics(func() { s3p.Open(src.hash(), src.count()) })
+}
+
+func TestEncryptedLocalStoreFactory(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	key := newTestEncryptionKey(assert, 1)
+
+	store := NewEncryptedLocalStoreFactory(dir, 1<<12, key).CreateStore("db")
+	c := chunks.NewChunk([]byte("abc"))
+	store.Put(c)
+	assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+	store.Close()
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "db", manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(contents), encryptedFileMagic))
+	assert.Panics(func() { NewLocalStoreFactory(dir, 1<<12).CreateStore("db") })
+}
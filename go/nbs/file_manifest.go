@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"golang.org/x/sys/unix"
@@ -21,15 +22,25 @@ import (
 const (
 	manifestFileName = "manifest"
 	lockFileName     = "LOCK"
+	gcGenPrefix      = "gc"
 )
 
 // fileManifest provides access to a NomsBlockStore manifest stored on disk in |dir|. The format
 // is currently human readable:
 //
-// |-- String --|-- String --|-------- String --------|-- String --|- String --|...|-- String --|- String --|
-// | nbs version:Noms version:Base32-encoded root hash:table 1 hash:table 1 cnt:...:table N hash:table N cnt|
+// |-- String --|-- String --|-------- String --------|-- String --|- String --|...|-- String --|- String --|--- String ---|
+// | nbs version:Noms version:Base32-encoded root hash:table 1 hash:table 1 cnt:...:table N hash:table N cnt[:compression][:gcN]|
+//
+// The compression that new tables are written with, as formatted by
+// compression.String(), is only there if it isn't the default, and the GC
+// generation N only if garbage has been collected, so that other manifests
+// are written as they were before these were recorded.
+//
+// If |key| is not nil, the manifest is sealed with it, as by sealFile().
+// Manifests written without a key are only read if |key| reads unencrypted data.
 type fileManifest struct {
 	dir string
+	key *EncryptionKey
 }
 
 // ParseIfExists looks for a LOCK and manifest file in fm.dir. If it finds
@@ -38,7 +49,7 @@ type fileManifest struct {
 // that case, the other return values are undefined. If |readHook| is non-nil,
 // it will be executed while ParseIfExists() holds the manfiest file lock.
 // This is to allow for race condition testing.
-func (fm fileManifest) ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec) {
+func (fm fileManifest) ParseIfExists(readHook func()) (exists bool, contents manifestContents) {
 	// !exists(lockFileName) => unitialized store
 	if l := openIfExists(filepath.Join(fm.dir, lockFileName)); l != nil {
 		var f io.ReadCloser
@@ -55,7 +66,7 @@ func (fm fileManifest) ParseIfExists(readHook func()) (exists bool, vers string,
 		if f != nil {
 			defer checkClose(f)
 			exists = true
-			vers, root, tableSpecs = parseManifest(f)
+			contents = parseManifest(f, fm.key)
 		}
 	}
 	return
@@ -71,37 +82,54 @@ func openIfExists(path string) *os.File {
 	return f
 }
 
-func parseManifest(r io.Reader) (string, hash.Hash, []tableSpec) {
+func parseManifest(r io.Reader, key *EncryptionKey) manifestContents {
 	manifest, err := ioutil.ReadAll(r)
 	d.PanicIfError(err)
+	manifest = openFile(key, manifestFileName, manifest)
 
 	slices := strings.Split(string(manifest), ":")
-	if len(slices) < 3 || len(slices)%2 == 0 {
+	if len(slices) < 3 {
 		d.Chk.Fail("Malformed manifest: " + string(manifest))
 	}
 	d.PanicIfFalse(StorageVersion == string(slices[0]))
 
-	return slices[1], hash.Parse(slices[2]), parseSpecs(slices[3:])
+	// The last field of the specs is a chunk count, so a field after them that starts with "gc" can only be the GC generation.
+	var gcGen uint64
+	if last := slices[len(slices)-1]; len(slices) > 3 && strings.HasPrefix(last, gcGenPrefix) {
+		var err error
+		if gcGen, err = strconv.ParseUint(last[len(gcGenPrefix):], 10, 64); err != nil || gcGen == 0 {
+			d.Chk.Fail("Malformed manifest: " + string(manifest))
+		}
+		slices = slices[:len(slices)-1]
+	}
+	comp := compression{}
+	if len(slices)%2 == 0 {
+		var err error
+		if comp, err = parseCompression(slices[len(slices)-1]); err != nil || comp == (compression{}) {
+			d.Chk.Fail("Malformed manifest: " + string(manifest))
+		}
+		slices = slices[:len(slices)-1]
+	}
+	root, specs := hash.Parse(slices[2]), parseSpecs(slices[3:])
+	return manifestContents{slices[1], generateLockHash(root, specs, comp, gcGen), root, specs, comp, gcGen}
 }
 
-// Update optimistically tries to write a new manifest, containing |newRoot|
-// and the elements of |tables|. If the existing manifest on disk doesn't
-// contain |root|, Update fails and returns the parsed contents of the
-// manifest on disk. Callers should check that |actual| == |newRoot| upon
-// return and, if not, merge any desired new table information with the
-// contents of |tableSpecs| before trying again.
+// Update optimistically tries to write |newContents|. If the lock of the
+// existing manifest on disk isn't |lastLock|, Update fails and returns the
+// parsed contents of the manifest on disk. Callers should check that the
+// lock of the returned contents is newContents.lock upon return and, if not,
+// merge any desired new table information with the returned specs before
+// trying again.
 // If writeHook is non-nil, it will be invoked wile the manifest file lock is
 // held. This is to allow for testing of race conditions.
-func (fm fileManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
-	tableSpecs = specs
-
+func (fm fileManifest) Update(lastLock addr, newContents manifestContents, writeHook func()) (upstream manifestContents) {
 	// Write a temporary manifest file, to be renamed over manifestFileName upon success.
 	// The closure here ensures this file is closed before moving on.
 	tempManifestPath := func() string {
 		temp, err := ioutil.TempFile(fm.dir, "nbs_manifest_")
 		d.PanicIfError(err)
 		defer checkClose(temp)
-		writeManifest(temp, newRoot, tableSpecs)
+		writeManifest(temp, newContents, fm.key)
 		return temp.Name()
 	}()
 	defer os.Remove(tempManifestPath) // If we rename below, this will be a no-op
@@ -120,28 +148,33 @@ func (fm fileManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeH
 		if f := openIfExists(manifestPath); f != nil {
 			defer checkClose(f)
 
-			var mVers string
-			mVers, actual, tableSpecs = parseManifest(f)
-			d.PanicIfFalse(constants.NomsVersion == mVers)
+			upstream = parseManifest(f, fm.key)
+			d.PanicIfFalse(constants.NomsVersion == upstream.vers)
 		} else {
-			d.Chk.True(root == hash.Hash{})
+			d.Chk.True(lastLock == addr{})
 		}
 	}()
 
-	if root != actual {
-		return actual, tableSpecs
+	if lastLock != upstream.lock {
+		return upstream
 	}
 	err := os.Rename(tempManifestPath, manifestPath)
 	d.PanicIfError(err)
-	return newRoot, tableSpecs
+	return newContents
 }
 
-func writeManifest(temp io.Writer, root hash.Hash, specs []tableSpec) {
-	strs := make([]string, 2*len(specs)+3)
-	strs[0], strs[1], strs[2] = StorageVersion, constants.NomsVersion, root.String()
+func writeManifest(temp io.Writer, contents manifestContents, key *EncryptionKey) {
+	strs := make([]string, 2*len(contents.specs)+3)
+	strs[0], strs[1], strs[2] = StorageVersion, constants.NomsVersion, contents.root.String()
 	tableInfo := strs[3:]
-	formatSpecs(specs, tableInfo)
-	_, err := io.WriteString(temp, strings.Join(strs, ":"))
+	formatSpecs(contents.specs, tableInfo)
+	if contents.comp != (compression{}) {
+		strs = append(strs, contents.comp.String())
+	}
+	if contents.gcGen != 0 {
+		strs = append(strs, gcGenPrefix+strconv.FormatUint(contents.gcGen, 10))
+	}
+	_, err := temp.Write(sealFile(key, manifestFileName, []byte(strings.Join(strs, ":"))))
 	d.PanicIfError(err)
 }
 
@@ -21,7 +21,7 @@ import (
 func makeFileManifestTempDir(t *testing.T) fileManifest {
 	dir, err := ioutil.TempDir("", "")
 	assert.NoError(t, err)
-	return fileManifest{dir}
+	return fileManifest{dir, nil}
 }
 
 func TestFileManifestParseIfExists(t *testing.T) {
@@ -29,7 +29,7 @@ func TestFileManifestParseIfExists(t *testing.T) {
 	fm := makeFileManifestTempDir(t)
 	defer os.RemoveAll(fm.dir)
 
-	exists, vers, root, tableSpecs := fm.ParseIfExists(nil)
+	exists, _ := fm.ParseIfExists(nil)
 	assert.False(exists)
 
 	// Simulate another process writing a manifest (with an old Noms version).
@@ -39,14 +39,15 @@ func TestFileManifestParseIfExists(t *testing.T) {
 	assert.NoError(err)
 
 	// ParseIfExists should now reflect the manifest written above.
-	exists, vers, root, tableSpecs = fm.ParseIfExists(nil)
+	exists, contents := fm.ParseIfExists(nil)
 	assert.True(exists)
-	assert.Equal("0", vers)
-	assert.Equal(newRoot, root)
-	if assert.Len(tableSpecs, 1) {
-		assert.Equal(tableName.String(), tableSpecs[0].name.String())
-		assert.Equal(uint32(0), tableSpecs[0].chunkCount)
+	assert.Equal("0", contents.vers)
+	assert.Equal(newRoot, contents.root)
+	if assert.Len(contents.specs, 1) {
+		assert.Equal(tableName.String(), contents.specs[0].name.String())
+		assert.Equal(uint32(0), contents.specs[0].chunkCount)
 	}
+	assert.Equal(generateLockHash(contents.root, contents.specs, compression{}, 0), contents.lock)
 }
 
 func TestFileManifestParseIfExistsHoldsLock(t *testing.T) {
@@ -61,7 +62,7 @@ func TestFileManifestParseIfExistsHoldsLock(t *testing.T) {
 	assert.NoError(err)
 
 	// ParseIfExists should now reflect the manifest written above.
-	exists, vers, root, tableSpecs := fm.ParseIfExists(func() {
+	exists, contents := fm.ParseIfExists(func() {
 		// This should fail to get the lock, and therefore _not_ clobber the manifest.
 		badRoot := hash.Of([]byte("bad root"))
 		b, err := tryClobberManifest(fm.dir, strings.Join([]string{StorageVersion, "0", badRoot.String(), tableName.String(), "0"}, ":"))
@@ -69,11 +70,11 @@ func TestFileManifestParseIfExistsHoldsLock(t *testing.T) {
 	})
 
 	assert.True(exists)
-	assert.Equal(constants.NomsVersion, vers)
-	assert.Equal(newRoot, root)
-	if assert.Len(tableSpecs, 1) {
-		assert.Equal(tableName.String(), tableSpecs[0].name.String())
-		assert.Equal(uint32(0), tableSpecs[0].chunkCount)
+	assert.Equal(constants.NomsVersion, contents.vers)
+	assert.Equal(newRoot, contents.root)
+	if assert.Len(contents.specs, 1) {
+		assert.Equal(tableName.String(), contents.specs[0].name.String())
+		assert.Equal(uint32(0), contents.specs[0].chunkCount)
 	}
 }
 
@@ -86,7 +87,9 @@ func TestFileManifestUpdateWontClobberOldVersion(t *testing.T) {
 	err := clobberManifest(fm.dir, strings.Join([]string{StorageVersion, "0", hash.Hash{}.String()}, ":"))
 	assert.NoError(err)
 
-	assert.Panics(func() { fm.Update(nil, hash.Hash{}, hash.Hash{}, nil) })
+	assert.Panics(func() {
+		fm.Update(generateLockHash(hash.Hash{}, nil, compression{}, 0), newManifestContents(hash.Hash{}, nil, compression{}, 0), nil)
+	})
 }
 
 func TestFileManifestUpdate(t *testing.T) {
@@ -95,23 +98,73 @@ func TestFileManifestUpdate(t *testing.T) {
 	defer os.RemoveAll(fm.dir)
 
 	// First, test winning the race against another process.
-	newRoot := hash.Of([]byte("new root"))
 	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
-	actual, tableSpecs := fm.Update(specs, hash.Hash{}, newRoot, func() {
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	upstream := fm.Update(addr{}, contents, func() {
 		// This should fail to get the lock, and therefore _not_ clobber the manifest. So the Update should succeed.
 		newRoot2 := hash.Of([]byte("new root 2"))
 		b, err := tryClobberManifest(fm.dir, strings.Join([]string{StorageVersion, constants.NomsVersion, newRoot2.String()}, ":"))
 		assert.NoError(err, string(b))
 	})
-	assert.Equal(newRoot, actual)
-	assert.Equal(specs, tableSpecs)
+	assert.Equal(contents, upstream)
 
 	// Now, test the case where the optimistic lock fails, and someone else updated the root since last we checked.
-	newRoot2 := hash.Of([]byte("new root 2"))
-	actual, tableSpecs = fm.Update(nil, hash.Hash{}, newRoot2, nil)
-	assert.Equal(newRoot, actual)
-	assert.Equal(specs, tableSpecs)
-	actual, tableSpecs = fm.Update(nil, actual, newRoot2, nil)
+	contents2 := newManifestContents(hash.Of([]byte("new root 2")), []tableSpec{}, compression{}, 0)
+	upstream = fm.Update(addr{}, contents2, nil)
+	assert.Equal(contents, upstream)
+	upstream = fm.Update(upstream.lock, contents2, nil)
+	assert.Equal(contents2, upstream)
+
+	// The lock covers the tables too, so an update from a writer that hasn't seen the latest tables fails, even though the root is the same.
+	contents3 := newManifestContents(contents2.root, specs, compression{}, 0)
+	upstream = fm.Update(contents.lock, contents3, nil)
+	assert.Equal(contents2, upstream)
+	upstream = fm.Update(contents2.lock, contents3, nil)
+	assert.Equal(contents3, upstream)
+}
+
+func TestFileManifestCompression(t *testing.T) {
+	assert := assert.New(t)
+	fm := makeFileManifestTempDir(t)
+	defer os.RemoveAll(fm.dir)
+
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{}, 0)
+	assert.Equal(contents, fm.Update(addr{}, contents, nil))
+	b, err := ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.Len(strings.Split(string(b), ":"), 5) // the default compression isn't written
+
+	// The compression is covered by the lock, so changing only it is an update like any other.
+	zstd := newManifestContents(contents.root, specs, compression{ZstdCodec, 0xabcd}, 0)
+	assert.NotEqual(contents.lock, zstd.lock)
+	assert.Equal(zstd, fm.Update(contents.lock, zstd, nil))
+	b, err = ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasSuffix(string(b), ":zstd.0000abcd"))
+	exists, actual := fm.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(zstd, actual)
+}
+
+func TestFileManifestGCGeneration(t *testing.T) {
+	assert := assert.New(t)
+	fm := makeFileManifestTempDir(t)
+	defer os.RemoveAll(fm.dir)
+
+	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
+	contents := newManifestContents(hash.Of([]byte("new root")), specs, compression{ZstdCodec, 0}, 0)
+	assert.Equal(contents, fm.Update(addr{}, contents, nil))
+
+	collected := newManifestContents(contents.root, specs, contents.comp, 2)
+	assert.NotEqual(contents.lock, collected.lock)
+	assert.Equal(collected, fm.Update(contents.lock, collected, nil))
+	b, err := ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasSuffix(string(b), ":zstd:gc2"))
+	exists, actual := fm.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(collected, actual)
 }
 
 // tryClobberManifest simulates another process trying to access dir/manifestFileName concurrently. To avoid deadlock, it does a non-blocking lock of dir/lockFileName. If it can get the lock, it clobbers the manifest.
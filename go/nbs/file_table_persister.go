@@ -5,6 +5,7 @@
 package nbs
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"io/ioutil"
@@ -17,10 +18,11 @@ import (
 type fsTablePersister struct {
 	dir        string
 	indexCache *indexCache
+	key        *EncryptionKey // nil unless tables are encrypted
 }
 
 func (ftp fsTablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
-	return ftp.persistTable(mt.write(haver))
+	return ftp.persistTable(mt.write(haver, ftp.key))
 }
 
 func (ftp fsTablePersister) persistTable(name addr, data []byte, chunkCount uint32) chunkSource {
@@ -39,12 +41,76 @@ func (ftp fsTablePersister) persistTable(name addr, data []byte, chunkCount uint
 	return ftp.Open(name, chunkCount)
 }
 
-func (ftp fsTablePersister) CompactAll(sources chunkSources) chunkSource {
+// CompactAll streams the conjoined table to a temporary file in ftp.dir,
+// which is renamed once it is complete.
+func (ftp fsTablePersister) CompactAll(sources chunkSources, comp compression) chunkSource {
 	rl := make(chan struct{}, 32)
 	defer close(rl)
-	return ftp.persistTable(compactSourcesToBuffer(sources, rl))
+
+	temp, err := ioutil.TempFile(ftp.dir, "nbs_table_")
+	d.PanicIfError(err)
+	defer os.Remove(temp.Name()) // If we rename below, this will be a no-op
+	name, chunkCount := func() (addr, uint32) {
+		defer checkClose(temp)
+		w := bufio.NewWriter(temp)
+		name, _, chunkCount := conjoinTables(sources, comp, ftp.key, w, rl)
+		d.PanicIfError(w.Flush())
+		return name, chunkCount
+	}()
+	if chunkCount == 0 {
+		return emptyChunkSource{}
+	}
+	err = os.Rename(temp.Name(), filepath.Join(ftp.dir, name.String()))
+	d.PanicIfError(err)
+	return ftp.Open(name, chunkCount)
 }
 
 func (ftp fsTablePersister) Open(name addr, chunkCount uint32) chunkSource {
-	return newMmapTableReader(ftp.dir, name, chunkCount, ftp.indexCache)
+	return newMmapTableReader(ftp.dir, name, chunkCount, ftp.indexCache, ftp.key)
+}
+
+func (ftp fsTablePersister) PersistDictionary(dict *Dictionary) {
+	path := filepath.Join(ftp.dir, dictionaryFileName(dict.ID()))
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	temp, err := ioutil.TempFile(ftp.dir, "nbs_dict_")
+	d.PanicIfError(err)
+	defer os.Remove(temp.Name()) // If we rename below, this will be a no-op
+	func() {
+		defer checkClose(temp)
+		_, err := temp.Write(sealFile(ftp.key, dictionaryFileName(dict.ID()), dict.Bytes()))
+		d.PanicIfError(err)
+	}()
+	d.PanicIfError(os.Rename(temp.Name(), path))
+}
+
+func (ftp fsTablePersister) LoadDictionary(id uint32) {
+	loadDictionaryFile(ftp.dir, id, ftp.key)
+}
+
+// loadDictionaryFile reads the dictionary with ID |id| from its file in
+// |dir|, opening it with |key|, if it hasn't been read already.
+func loadDictionaryFile(dir string, id uint32, key *EncryptionKey) {
+	dictionaries.ensure(id, func() []byte {
+		data, err := ioutil.ReadFile(filepath.Join(dir, dictionaryFileName(id)))
+		d.PanicIfError(err)
+		return openFile(key, dictionaryFileName(id), data)
+	})
+}
+
+// PruneTableFiles removes the table files in ftp.dir that are named in
+// |retired| but not in |keepers|. Processes that already have a retired table
+// open can go on reading it, but those still working from a manifest that
+// names it will fail to open it, and have to re-read the manifest.
+func (ftp fsTablePersister) PruneTableFiles(keepers map[addr]struct{}, retired []addr) {
+	for _, name := range retired {
+		if _, present := keepers[name]; present {
+			continue
+		}
+		err := os.Remove(filepath.Join(ftp.dir, name.String()))
+		if !os.IsNotExist(err) {
+			d.PanicIfError(err)
+		}
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/attic-labs/testify/assert"
 )
@@ -30,7 +31,7 @@ func TestFSTablePersisterCompact(t *testing.T) {
 	if assert.True(src.count() > 0) {
 		buff, err := ioutil.ReadFile(filepath.Join(dir, src.hash().String()))
 		assert.NoError(err)
-		tr := newTableReader(parseTableIndex(buff), bytes.NewReader(buff), fileBlockSize)
+		tr := newTableReader(parseTableIndex(buff, nil), bytes.NewReader(buff), fileBlockSize, nil)
 		assertChunksInReader(testChunks, tr, assert)
 	}
 }
@@ -68,12 +69,12 @@ func TestFSTablePersisterCompactAll(t *testing.T) {
 	dir := makeTempDir(assert)
 	defer os.RemoveAll(dir)
 	fts := fsTablePersister{dir: dir}
-	src := fts.CompactAll(sources)
+	src := fts.CompactAll(sources, compression{})
 
 	if assert.True(src.count() > 0) {
 		buff, err := ioutil.ReadFile(filepath.Join(dir, src.hash().String()))
 		assert.NoError(err)
-		tr := newTableReader(parseTableIndex(buff), bytes.NewReader(buff), fileBlockSize)
+		tr := newTableReader(parseTableIndex(buff, nil), bytes.NewReader(buff), fileBlockSize, nil)
 		assertChunksInReader(testChunks, tr, assert)
 	}
 }
@@ -90,13 +91,44 @@ func TestFSTablePersisterCompactAllDups(t *testing.T) {
 	dir := makeTempDir(assert)
 	defer os.RemoveAll(dir)
 	fts := fsTablePersister{dir: dir}
-	src := fts.CompactAll(sources)
+	src := fts.CompactAll(sources, compression{})
 
 	if assert.True(src.count() > 0) {
 		buff, err := ioutil.ReadFile(filepath.Join(dir, src.hash().String()))
 		assert.NoError(err)
-		tr := newTableReader(parseTableIndex(buff), bytes.NewReader(buff), fileBlockSize)
+		tr := newTableReader(parseTableIndex(buff, nil), bytes.NewReader(buff), fileBlockSize, nil)
 		assertChunksInReader(testChunks, tr, assert)
 		assert.EqualValues(len(testChunks), tr.count())
 	}
 }
+
+func TestFSTablePersisterPruneTableFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := makeTempDir(assert)
+	defer os.RemoveAll(dir)
+	fts := fsTablePersister{dir: dir}
+
+	persist := func(chunks ...[]byte) addr {
+		mt := newMemTable(testMemTableSize)
+		for _, c := range chunks {
+			assert.True(mt.addChunk(computeAddr(c), c))
+		}
+		src := fts.Compact(mt, nil)
+		defer src.close()
+		return src.hash()
+	}
+	retired, kept, uncommitted := persist(testChunks[0]), persist(testChunks[1]), persist(testChunks[2])
+	old := time.Now().Add(-24 * time.Hour)
+	for _, name := range []addr{retired, kept, uncommitted} {
+		assert.NoError(os.Chtimes(filepath.Join(dir, name.String()), old, old))
+	}
+
+	// However old it is, a table that no manifest has named may be about to be committed by another process.
+	fts.PruneTableFiles(map[addr]struct{}{kept: {}}, []addr{retired, kept})
+	_, err := os.Stat(filepath.Join(dir, retired.String()))
+	assert.True(os.IsNotExist(err))
+	for _, name := range []addr{kept, uncommitted} {
+		_, err := os.Stat(filepath.Join(dir, name.String()))
+		assert.NoError(err)
+	}
+}
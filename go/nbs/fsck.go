@@ -0,0 +1,230 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const verifyReadSize = 1 << 22 // how much of a table verify() reads at a time
+
+// TableCheck is the result of checking one of the tables named in a store's
+// manifest.
+type TableCheck struct {
+	Name   string
+	Chunks uint32 // as recorded in the manifest
+	Err    error  // nil if the table is intact
+}
+
+// StoreChecker checks the tables of a NomsBlockStore without opening the
+// store, so that it can assess the damage to a store whose tables are missing
+// or corrupt, e.g. after a partial write to a full disk. A store can't be
+// opened at all while its manifest names a table that can't be read.
+type StoreChecker struct {
+	mm manifest
+	p  tablePersister
+}
+
+// NewLocalStoreChecker returns a StoreChecker for the store in |dir|, which
+// is encrypted with |key|, if it isn't nil.
+func NewLocalStoreChecker(dir string, key *EncryptionKey) *StoreChecker {
+	return &StoreChecker{fileManifest{dir, key}, fsTablePersister{dir, nil, key}}
+}
+
+// NewAWSStoreChecker returns a StoreChecker for the store that
+// NewEncryptedAWSStore() opens with the same arguments.
+func NewAWSStoreChecker(table, ns, bucket string, sess *session.Session, key *EncryptionKey) *StoreChecker {
+	p := s3TablePersister{s3.New(sess), bucket, defaultS3PartSize, nil, make(chan struct{}, defaultAWSReadLimit), key}
+	return &StoreChecker{newDynamoManifest(table, ns, dynamodb.New(sess), key), p}
+}
+
+// CheckTables returns the root of the store, and a TableCheck for each table
+// named in its manifest. Each table is read in full: its footer and index
+// must parse, the index must be sorted, and its hash must be the table's
+// name. Each chunk record must pass its CRC check, and its chunk must decode
+// and hash to the address that the index gives it.
+func (sc *StoreChecker) CheckTables() (root hash.Hash, checks []TableCheck) {
+	exists, contents := sc.mm.ParseIfExists(nil)
+	if !exists {
+		return
+	}
+	root = contents.root
+	for _, spec := range contents.specs {
+		check := TableCheck{Name: spec.name.String(), Chunks: spec.chunkCount}
+		check.Err = tryCheck(func() {
+			src := sc.p.Open(spec.name, spec.chunkCount)
+			defer src.close()
+			d.PanicIfError(src.(verifier).verify(spec.name))
+		})
+		checks = append(checks, check)
+	}
+	return
+}
+
+// ChunkStore returns a read-only ChunkStore over the tables in the store's
+// manifest, leaving out those named in |exclude|, such as the ones that
+// CheckTables() found to be damaged. It shows what the store would hold were
+// they dropped.
+func (sc *StoreChecker) ChunkStore(exclude []string) chunks.ChunkStore {
+	return newNomsBlockStore(excludingManifest{sc.mm, stringSet(exclude)}, tableSet{p: sc.p, rl: make(chan struct{}, concurrentCompactions)}, 0, maxTables)
+}
+
+// DropTables removes the tables named in |names| from the store's manifest,
+// leaving its root as it is. The chunks in them are lost, along with any that
+// can only be reached through them. The table files are left in place, since
+// GC and compaction only prune the tables they retire themselves. It panics
+// if the manifest changes while the tables are being dropped.
+func (sc *StoreChecker) DropTables(names []string) {
+	drop := stringSet(names)
+	exists, contents := sc.mm.ParseIfExists(nil)
+	d.PanicIfFalse(exists)
+	kept := []tableSpec{}
+	for _, spec := range contents.specs {
+		if _, present := drop[spec.name.String()]; !present {
+			kept = append(kept, spec)
+		}
+	}
+	// Dropping tables loses chunks, just as GC does, so writers that de-duped against them have to find out.
+	newContents := newManifestContents(contents.root, kept, contents.comp, contents.gcGen+1)
+	if actual := sc.mm.Update(contents.lock, newContents, nil); actual.lock != newContents.lock {
+		d.Panic("The store changed while it was being repaired; its root is now %s", actual.root)
+	}
+}
+
+func stringSet(strs []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(strs))
+	for _, s := range strs {
+		set[s] = struct{}{}
+	}
+	return set
+}
+
+// excludingManifest is a read-only view of a manifest, without the tables
+// named in |exclude|.
+type excludingManifest struct {
+	manifest
+	exclude map[string]struct{}
+}
+
+func (em excludingManifest) ParseIfExists(readHook func()) (exists bool, contents manifestContents) {
+	exists, contents = em.manifest.ParseIfExists(readHook)
+	specs := contents.specs
+	contents.specs = nil
+	for _, spec := range specs {
+		if _, present := em.exclude[spec.name.String()]; !present {
+			contents.specs = append(contents.specs, spec)
+		}
+	}
+	return
+}
+
+func (em excludingManifest) Update(lastLock addr, newContents manifestContents, writeHook func()) manifestContents {
+	panic("A store opened by a StoreChecker is read-only")
+}
+
+// tryCheck calls |f| and returns what it panics with, if anything, as an
+// error. Reading a damaged table can make any of the code that parses it
+// panic, and not always with an error of its own.
+func tryCheck(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = d.Unwrap(e)
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	f()
+	return
+}
+
+// verifier is implemented by the chunkSources that can verify() their table,
+// which is all of those backed by a tableReader.
+type verifier interface {
+	verify(name addr) error
+}
+
+// verify reads the whole of the table, which is persisted as |name|, and
+// returns the first problem it finds, if any. See StoreChecker.CheckTables().
+func (tr tableReader) verify(name addr) error {
+	seen := make([]bool, tr.chunkCount)
+	addrs := make([]addr, tr.chunkCount) // by ordinal
+	nameHash := sha512.New()
+	for i, prefix := range tr.prefixes {
+		if i > 0 && prefix < tr.prefixes[i-1] {
+			return fmt.Errorf("Index is out of order at entry %d", i)
+		}
+		ordinal := tr.ordinals[i]
+		if ordinal >= tr.chunkCount || seen[ordinal] {
+			return fmt.Errorf("Index entry %d has a bad ordinal %d", i, ordinal)
+		}
+		seen[ordinal] = true
+		a := &addrs[ordinal]
+		binary.BigEndian.PutUint64(a[:], prefix)
+		copy(a[addrPrefixSize:], tr.suffixes[uint64(ordinal)*addrSuffixSize:])
+		nameHash.Write(a[:])
+		if !tr.bloom.mayContain(*a) {
+			return fmt.Errorf("Bloom filter is missing chunk %s", a)
+		}
+	}
+	var computed addr
+	copy(computed[:], nameHash.Sum(nil))
+	if computed != name {
+		return fmt.Errorf("Index hashes to %s, not the table's name", computed)
+	}
+
+	// Chunk records are contiguous, in ordinal order, so they're read in large pieces.
+	totalData := uint64(0)
+	buff := []byte{}
+	for start := uint32(0); start < tr.chunkCount; {
+		end, size := start, uint64(0)
+		for end < tr.chunkCount && (end == start || size+uint64(tr.lengths[end]) <= verifyReadSize) {
+			size += uint64(tr.lengths[end])
+			end++
+		}
+		if uint64(cap(buff)) < size {
+			buff = make([]byte, size)
+		}
+		buff = buff[:size]
+		if _, err := tr.r.ReadAt(buff, int64(tr.offsets[start])); err != nil {
+			return fmt.Errorf("Failed to read chunk records %d to %d: %s", start, end-1, err)
+		}
+		for ordinal := start; ordinal < end; ordinal++ {
+			pos := tr.offsets[ordinal] - tr.offsets[start]
+			record := buff[pos : pos+uint64(tr.lengths[ordinal])]
+			a := addrs[ordinal]
+			if uint64(len(record)) < checksumSize {
+				return fmt.Errorf("Chunk record for %s is only %d bytes", a, len(record))
+			}
+			dataLen := uint64(len(record)) - checksumSize
+			if crc(record[:dataLen]) != binary.BigEndian.Uint32(record[dataLen:]) {
+				return fmt.Errorf("Chunk record for %s fails its CRC check", a)
+			}
+			data, err := tr.decodeChunk(a, record[:dataLen])
+			if err != nil {
+				return fmt.Errorf("Chunk record for %s can't be decoded: %s", a, err)
+			}
+			if computeAddr(data) != a {
+				return fmt.Errorf("Chunk record for %s holds chunk %s", a, computeAddr(data))
+			}
+			totalData += uint64(len(data))
+		}
+		start = end
+	}
+	if totalData != tr.totalUncompressedData {
+		return fmt.Errorf("Chunks total %d bytes, not %d", totalData, tr.totalUncompressedData)
+	}
+	return nil
+}
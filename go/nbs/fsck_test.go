@@ -0,0 +1,187 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/testify/assert"
+)
+
+// writeCheckerTestStore writes each of |tables| to the store in |dir| as a
+// table of its own, and returns the names of the tables, in order.
+func writeCheckerTestStore(assert *assert.Assertions, dir string, key *EncryptionKey, tables [][][]byte) []string {
+	store := NewEncryptedLocalStore(dir, 1<<20, key)
+	defer store.Close()
+	names, written := []string{}, map[addr]bool{}
+	for _, inputs := range tables {
+		for _, data := range inputs {
+			store.Put(chunks.NewChunk(data))
+		}
+		assert.True(store.UpdateRoot(chunks.NewChunk(inputs[0]).Hash(), store.Root()))
+		for _, spec := range store.tables.upstream.specs() {
+			if !written[spec.name] {
+				written[spec.name] = true
+				names = append(names, spec.name.String())
+			}
+		}
+	}
+	return names
+}
+
+func TestStoreCheckerCheckTables(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	inputs := structChunks(60)
+	tables := [][][]byte{inputs[:20], inputs[20:40], inputs[40:]}
+	names := writeCheckerTestStore(assert, dir, nil, tables)
+
+	sc := NewLocalStoreChecker(dir, nil)
+	root, checks := sc.CheckTables()
+	assert.Equal(chunks.NewChunk(inputs[40]).Hash(), root)
+	if assert.Len(checks, 3) {
+		for _, check := range checks {
+			assert.NoError(check.Err)
+			assert.EqualValues(20, check.Chunks)
+		}
+	}
+
+	// Damage a chunk record in one table, and remove another.
+	path := filepath.Join(dir, names[0])
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	data[10] ^= 0xff
+	assert.NoError(ioutil.WriteFile(path, data, 0644))
+	assert.NoError(os.Remove(filepath.Join(dir, names[1])))
+
+	_, checks = sc.CheckTables()
+	bad := []string{}
+	for _, check := range checks {
+		if check.Err != nil {
+			bad = append(bad, check.Name)
+		}
+	}
+	sort.Strings(bad)
+	expected := []string{names[0], names[1]}
+	sort.Strings(expected)
+	assert.Equal(expected, bad)
+
+	// The store can be read without the bad tables, which is what's left once they're dropped.
+	cs := sc.ChunkStore(bad)
+	assertInputInStore(inputs[40], chunks.NewChunk(inputs[40]).Hash(), cs, assert)
+	assert.True(cs.Get(chunks.NewChunk(inputs[0]).Hash()).IsEmpty())
+	assert.Panics(func() { cs.UpdateRoot(root, root) })
+	cs.Close()
+
+	sc.DropTables(bad)
+	store := NewLocalStore(dir, 1<<20)
+	defer store.Close()
+	assert.Equal(root, store.Root())
+	assert.EqualValues(20, store.tables.count())
+}
+
+// racingManifest calls race before each Update, as if another process got there first.
+type racingManifest struct {
+	manifest
+	race func()
+}
+
+func (rm racingManifest) Update(lastLock addr, newContents manifestContents, writeHook func()) manifestContents {
+	rm.race()
+	return rm.manifest.Update(lastLock, newContents, writeHook)
+}
+
+func TestStoreCheckerDropTablesRace(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	inputs := structChunks(40)
+	names := writeCheckerTestStore(assert, dir, nil, [][][]byte{inputs[:20], inputs[20:]})
+
+	// Another writer adds a table without moving the root, so the root alone can't tell that the manifest changed.
+	other := NewLocalStore(dir, 1<<20)
+	defer other.Close()
+	late := chunks.NewChunk([]byte("late"))
+	race := func() {
+		other.Put(late)
+		other.Flush()
+	}
+	sc := &StoreChecker{racingManifest{fileManifest{dir, nil}, race}, fsTablePersister{dir, nil, nil}}
+	assert.Panics(func() { sc.DropTables(names[:1]) })
+
+	store := NewLocalStore(dir, 1<<20)
+	defer store.Close()
+	assert.EqualValues(41, store.Count())
+	assertInputInStore(late.Data(), late.Hash(), store, assert)
+}
+
+func TestStoreCheckerTruncatedTable(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key := newTestEncryptionKey(assert, 1)
+	inputs := structChunks(20)
+	names := writeCheckerTestStore(assert, dir, key, [][][]byte{inputs})
+	_, checks := NewLocalStoreChecker(dir, key).CheckTables()
+	if assert.Len(checks, 1) {
+		assert.NoError(checks[0].Err)
+	}
+
+	// As if the disk filled up partway through writing it.
+	path := filepath.Join(dir, names[0])
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.NoError(os.Truncate(path, info.Size()/2))
+	_, checks = NewLocalStoreChecker(dir, key).CheckTables()
+	if assert.Len(checks, 1) {
+		assert.Error(checks[0].Err)
+	}
+}
+
+func TestTableVerify(t *testing.T) {
+	assert := assert.New(t)
+	inputs := structChunks(50)
+	name, data, _ := func() (addr, []byte, uint32) {
+		mt := newMemTable(1 << 20)
+		for _, c := range inputs {
+			mt.addChunk(computeAddr(c), c)
+		}
+		return mt.write(nil, nil)
+	}()
+	tr := newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil)
+	assert.NoError(tr.verify(name))
+	assert.Error(tr.verify(addr{}))
+
+	// Swapping the first two prefixes puts the index out of order.
+	swapped := tr
+	swapped.prefixes = append([]uint64{}, tr.prefixes...)
+	swapped.prefixes[0], swapped.prefixes[1] = swapped.prefixes[1], swapped.prefixes[0]
+	assert.Error(swapped.verify(name))
+
+	// A record that passes its CRC check, but holds another chunk, is caught by rehashing it.
+	damaged := append([]byte{}, data...)
+	record := damaged[:tr.lengths[0]]
+	dataLen := len(record) - int(checksumSize)
+	pos := bytes.Index(record, []byte("Springfield"))
+	assert.True(pos >= 0)
+	record[pos] = 's'
+	binary.BigEndian.PutUint32(record[dataLen:], crc(record[:dataLen]))
+	tr = newTableReader(parseTableIndex(damaged, nil), bytes.NewReader(damaged), fileBlockSize, nil)
+	assert.Error(tr.verify(name))
+}
@@ -0,0 +1,214 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/jpillora/backoff"
+)
+
+// DefaultRootLogRetention is how long roots recorded in the root log stay
+// live by default. GC keeps every chunk reachable from a root that the store
+// has had within this window, so that a root that has been overwritten can
+// still be restored with `noms root --update`.
+const DefaultRootLogRetention = 30 * 24 * time.Hour
+
+// GC copies every chunk reachable from the current root, or from any root
+// recorded in the root log within DefaultRootLogRetention, into new tables and
+// swaps them into the manifest in place of the existing tables, which are
+// then pruned from the underlying persister. GC holds the store lock for its
+// duration, so other operations on this NomsBlockStore will block until it
+// completes. It is an error to call GC while there are chunks that have been
+// Put() but not yet committed via UpdateRoot(), since those may have been
+// de-duped against tables that GC would drop.
+//
+// GC swaps the new tables into the manifest with the same optimistic
+// protocol as UpdateRoot(): if another writer moves the root, or changes the
+// tables, while GC is copying, the new tables are discarded and GC starts over
+// from the new state. Writers that have yet to see the swap fail to update
+// the manifest until they have rebased onto it, so they can't put back the
+// tables that GC retired. Each GC also bumps the GC generation recorded in
+// the manifest. Writers whose novel tables were de-duped against an earlier
+// generation may be relying on chunks that GC didn't keep, so when they
+// rebase onto the new generation, they copy those chunks out of the retired
+// tables before committing.
+//
+// GC returns an error, and leaves the store as it was, if a chunk that's
+// reachable from a root it keeps is missing, since that means the store is
+// damaged. Use GCKeepingRoots() for stores that are missing chunks on purpose.
+func (nbs *NomsBlockStore) GC() error {
+	return nbs.GCKeepingRoots(DefaultRootLogRetention, nil)
+}
+
+// GCKeepingRoots is like GC(), but keeps only those roots from the root log
+// that were set within |retention|. A |retention| of 0 collects everything
+// that isn't reachable from the current root. The chunks in |pruned|, which
+// shallow pulls have left out of the store (see datas.PrunedRefs()), are
+// allowed to be missing.
+func (nbs *NomsBlockStore) GCKeepingRoots(retention time.Duration, pruned hash.HashSet) error {
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+	d.Chk.True((nbs.mt == nil || nbs.mt.count() == 0) && len(nbs.tables.novel) == 0, "GC requires all pending writes to be committed")
+
+	b := &backoff.Backoff{
+		Min:    128 * time.Microsecond,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+	var retired chunkSources
+	for {
+		var ok bool
+		var err error
+		if ok, retired, err = nbs.tryGC(retention, pruned); err != nil {
+			return err
+		} else if ok {
+			break
+		}
+		time.Sleep(b.Duration())
+	}
+
+	keepers := map[addr]struct{}{}
+	for _, spec := range nbs.tables.ToSpecs() {
+		keepers[spec.name] = struct{}{}
+	}
+	retiredNames := make([]addr, 0, len(retired))
+	for _, src := range retired {
+		if _, present := keepers[src.hash()]; !present && src.count() > 0 {
+			retiredNames = append(retiredNames, src.hash())
+		}
+	}
+	retired.close()
+	nbs.tables.p.PruneTableFiles(keepers, retiredNames)
+	return nil
+}
+
+// tryGC makes a single attempt at collecting garbage. On success, it returns
+// the upstream tables that were replaced so the caller can close and prune
+// them. Must be called with nbs.mu held.
+func (nbs *NomsBlockStore) tryGC(retention time.Duration, pruned hash.HashSet) (ok bool, retired chunkSources, err error) {
+	// Start from the latest state on disk, so that we don't swap out tables someone else has just committed.
+	if exists, upstream := nbs.mm.ParseIfExists(nil); exists && upstream.lock != nbs.lock {
+		nbs.rebaseLocked(upstream)
+	}
+
+	live := hash.HashSet{}
+	pending := hash.HashSet{}
+	if !nbs.root.IsEmpty() {
+		pending.Insert(nbs.root)
+	}
+	cutoff := time.Now().Add(-retention)
+	for _, e := range nbs.rootLogLocked() {
+		if e.Time.Before(cutoff) {
+			continue
+		}
+		for _, h := range []hash.Hash{e.Previous, e.Root} {
+			// Roots that a previous GC already dropped are gone for good.
+			if !h.IsEmpty() && nbs.tables.has(addr(h)) {
+				pending.Insert(h)
+			}
+		}
+	}
+
+	var sources chunkSources
+	mt := nbs.newMemTableLocked()
+	// The tables written so far were never in the manifest, so they can be pruned if GC gives up, unless they're the same as tables that are in it, now or in |upstream|.
+	discard := func(upstream []tableSpec) {
+		keepers := map[addr]struct{}{}
+		for _, spec := range append(nbs.tables.ToSpecs(), upstream...) {
+			keepers[spec.name] = struct{}{}
+		}
+		names := make([]addr, 0, len(sources))
+		for _, src := range sources {
+			if src.count() > 0 {
+				names = append(names, src.hash())
+			}
+		}
+		sources.close()
+		nbs.tables.p.PruneTableFiles(keepers, names)
+	}
+	for len(pending) > 0 {
+		next := hash.HashSet{}
+		found, err := nbs.getAllLocked(pending, pruned)
+		if err != nil {
+			discard(nil)
+			return false, nil, err
+		}
+		for _, c := range found {
+			live.Insert(c.Hash())
+			if a := addr(c.Hash()); !mt.addChunk(a, c.Data()) {
+				sources = append(sources, nbs.tables.p.Compact(mt, nil))
+				mt = nbs.newMemTableLocked()
+				d.PanicIfFalse(mt.addChunk(a, c.Data()))
+			}
+			types.DecodeValue(c, nil).WalkRefs(func(r types.Ref) {
+				if h := r.TargetHash(); !live.Has(h) && !pending.Has(h) {
+					next.Insert(h)
+				}
+			})
+		}
+		pending = next
+	}
+	if mt.count() > 0 {
+		sources = append(sources, nbs.tables.p.Compact(mt, nil))
+	}
+
+	candidate := tableSet{
+		upstream: make(chunkSources, 0, len(sources)),
+		p:        nbs.tables.p,
+		rl:       nbs.tables.rl,
+	}
+	for _, src := range sources {
+		if src.count() > 0 {
+			candidate.upstream = append(candidate.upstream, src)
+		}
+	}
+
+	newContents := newManifestContents(nbs.root, candidate.ToSpecs(), nbs.comp, nbs.gcGen+1)
+	if upstream := nbs.mm.Update(nbs.lock, newContents, nil); upstream.lock != newContents.lock {
+		// Someone committed, or changed the tables, while we were copying. The tables we just wrote may be missing chunks reachable from the new root, so throw them away and try again.
+		discard(upstream.specs)
+		nbs.rebaseLocked(upstream)
+		return false, nil, nil
+	}
+	retired, nbs.tables = nbs.tables.upstream, candidate
+	nbs.nomsVersion, nbs.lock, nbs.gcGen = newContents.vers, newContents.lock, newContents.gcGen
+	return true, retired, nil
+}
+
+// getAllLocked is like GetMany(), but reads only from nbs.tables and must be
+// called with nbs.mu held. It returns an error if any of |hashes| is not
+// present, unless it's in |pruned|.
+func (nbs *NomsBlockStore) getAllLocked(hashes, pruned hash.HashSet) (found []chunks.Chunk, err error) {
+	reqs := toGetRecords(hashes)
+	foundChunks := make(chan *chunks.Chunk, 32)
+	go func() {
+		defer close(foundChunks)
+		wg := &sync.WaitGroup{}
+		nbs.tables.getMany(reqs, foundChunks, wg)
+		wg.Wait()
+	}()
+
+	seen := hash.HashSet{}
+	for c := range foundChunks {
+		if !seen.Has(c.Hash()) {
+			seen.Insert(c.Hash())
+			found = append(found, *c)
+		}
+	}
+	for h := range hashes {
+		if !seen.Has(h) && !pruned.Has(h) {
+			return nil, fmt.Errorf("Chunk %s is reachable but missing from the store", h)
+		}
+	}
+	return
+}
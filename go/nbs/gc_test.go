@@ -0,0 +1,262 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func putValues(store *NomsBlockStore, vals ...types.Value) (refs []types.Value) {
+	for _, v := range vals {
+		store.Put(types.EncodeValue(v, nil))
+		refs = append(refs, types.NewRef(v))
+	}
+	return
+}
+
+func countTableFiles(assert *assert.Assertions, dir string) (count int) {
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	for _, info := range infos {
+		if _, ok := parseTableFileName(info.Name()); ok {
+			count++
+		}
+	}
+	return
+}
+
+// parseTableFileName returns the addr named by |fileName|, if it is the name of a table file.
+func parseTableFileName(fileName string) (name addr, ok bool) {
+	if len(fileName) != encoding.EncodedLen(int(addrSize)) {
+		return
+	}
+	b, err := encoding.DecodeString(fileName)
+	if err != nil || len(b) != int(addrSize) {
+		return
+	}
+	copy(name[:], b)
+	return name, true
+}
+
+func TestGCDropsUnreachableChunks(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	garbage := putValues(store, types.String("garbage 1"), types.String("garbage 2"))
+	oldRoot := types.NewList(garbage...)
+	putValues(store, oldRoot)
+	assert.True(store.UpdateRoot(oldRoot.Hash(), store.Root()))
+
+	live := putValues(store, types.String("live 1"), types.String("live 2"), types.Number(42))
+	root := types.NewList(live...)
+	putValues(store, root)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+	assert.Equal(uint32(7), store.Count())
+
+	assert.NoError(store.GCKeepingRoots(0, nil))
+	assert.Equal(root.Hash(), store.Root())
+	assert.Equal(uint32(4), store.Count())
+	assert.True(store.Has(root.Hash()))
+	for _, r := range live {
+		assert.True(store.Has(r.(types.Ref).TargetHash()))
+	}
+	for _, r := range append(garbage, oldRoot) {
+		assert.False(store.Has(r.Hash()))
+	}
+	assert.Equal(1, countTableFiles(assert, dir))
+
+	// A fresh store should see only the live chunks.
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(root.Hash(), reopened.Root())
+	assert.Equal(uint32(4), reopened.Count())
+	assert.Equal(root.Hash(), types.DecodeValue(reopened.Get(root.Hash()), nil).Hash())
+}
+
+func TestGCKeepsRecentRoots(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	garbage := putValues(store, types.String("garbage"))
+	oldRoot := types.NewList(putValues(store, types.String("old"))...)
+	putValues(store, oldRoot)
+	assert.True(store.UpdateRoot(oldRoot.Hash(), store.Root()))
+
+	root := types.NewList(putValues(store, types.String("new"))...)
+	putValues(store, root)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	log := store.RootLog()
+	assert.Len(log, 2)
+	assert.Equal(oldRoot.Hash(), log[1].Previous)
+	assert.Equal(root.Hash(), log[1].Root)
+
+	// oldRoot is no longer reachable, but it's in the root log, so GC keeps it.
+	assert.NoError(store.GC())
+	assert.Equal(uint32(4), store.Count())
+	assert.True(store.Has(oldRoot.Hash()))
+	assert.False(store.Has(garbage[0].Hash()))
+	assert.True(store.UpdateRoot(oldRoot.Hash(), store.Root()))
+	assert.Len(store.RootLog(), 3)
+}
+
+func TestGCPicksUpConcurrentCommits(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	interloper := NewLocalStore(dir, testMemTableSize)
+	defer interloper.Close()
+
+	putValues(interloper, types.String("garbage"))
+	root := types.NewList(putValues(interloper, types.String("interloper"))...)
+	putValues(interloper, root)
+	assert.True(interloper.UpdateRoot(root.Hash(), interloper.Root()))
+
+	assert.NoError(store.GC())
+	assert.Equal(root.Hash(), store.Root())
+	assert.Equal(uint32(2), store.Count())
+
+	// The interloper's table was in the manifest, so it's pruned once GC has replaced it.
+	assert.Equal(1, countTableFiles(assert, dir))
+}
+
+func TestGCStaleWriterCantRestoreRetiredTables(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	putValues(store, types.String("garbage"))
+	root := types.NewList(putValues(store, types.String("live"))...)
+	putValues(store, root)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	// stale reads the manifest before the GC, and commits after it, without the root having moved in between.
+	stale := NewLocalStore(dir, testMemTableSize)
+	defer stale.Close()
+	retired := stale.tables.ToSpecs()
+	assert.NoError(store.GC())
+
+	newRoot := types.NewList(append(putValues(stale, types.String("stale")), types.NewRef(root))...)
+	putValues(stale, newRoot)
+	assert.True(stale.UpdateRoot(newRoot.Hash(), root.Hash()))
+
+	_, contents := fileManifest{dir, nil}.ParseIfExists(nil)
+	assert.Equal(newRoot.Hash(), contents.root)
+	for _, spec := range retired {
+		for _, s := range contents.specs {
+			assert.NotEqual(spec.name, s.name)
+		}
+	}
+
+	// The retired tables are gone for good, but everything that's reachable is still there.
+	assert.NoError(store.GC())
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(uint32(4), reopened.Count())
+	for _, v := range []types.Value{newRoot, root, types.String("live"), types.String("stale")} {
+		assert.True(reopened.Has(v.Hash()))
+	}
+}
+
+func TestGCKeepsChunksStaleWriterDedupedAgainst(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	reused := types.String("reused")
+	oldRoot := types.NewList(putValues(store, reused)...)
+	putValues(store, oldRoot)
+	assert.True(store.UpdateRoot(oldRoot.Hash(), store.Root()))
+	root := types.NewList(putValues(store, types.String("live"))...)
+	putValues(store, root)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	// stale puts a chunk that's already in the store, so its novel table leaves it out. Then GC collects it, since nothing it keeps refers to it.
+	stale := NewLocalStore(dir, testMemTableSize)
+	defer stale.Close()
+	newRoot := types.NewList(append(putValues(stale, reused), types.NewRef(root))...)
+	putValues(stale, newRoot)
+	assert.NoError(store.GCKeepingRoots(0, nil))
+	assert.False(store.Has(reused.Hash()))
+	assert.Equal(uint64(1), store.gcGen)
+
+	assert.True(stale.UpdateRoot(newRoot.Hash(), root.Hash()))
+	assert.Equal(uint64(1), stale.gcGen)
+
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(newRoot.Hash(), reopened.Root())
+	for _, v := range []types.Value{newRoot, reused, root, types.String("live")} {
+		assert.True(reopened.Has(v.Hash()))
+	}
+}
+
+func TestGCMissingChunks(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	missing := types.String("missing")
+	root := types.NewList(types.NewRef(missing))
+	putValues(store, root)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	// A reachable chunk that's missing means the store is damaged, and GC would make the damage permanent.
+	err = store.GC()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), missing.Hash().String())
+	}
+	assert.True(store.Has(root.Hash()))
+	assert.Equal(1, countTableFiles(assert, dir))
+
+	// Unless a shallow pull left it out on purpose.
+	pruned := hash.HashSet{}
+	pruned.Insert(missing.Hash())
+	assert.NoError(store.GCKeepingRoots(0, pruned))
+	assert.Equal(root.Hash(), store.Root())
+	assert.Equal(uint32(1), store.Count())
+}
+
+func TestGCPanicsWithPendingWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	store.Put(chunks.NewChunk([]byte("pending")))
+	assert.Panics(t, func() { store.GC() })
+	assert.Equal(t, hash.Hash{}, store.Root())
+}
@@ -5,8 +5,11 @@
 package nbs
 
 import (
+	"crypto/sha512"
+	"encoding/binary"
 	"strconv"
 
+	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
 )
@@ -19,31 +22,81 @@ type manifest interface {
 	// responsible for managing whatever concurrency guarantees they require
 	// for correctness.
 	// If the manifest exists, |exists| is set to true and manifest data is
-	// returned, including the version of the Noms data in the store, the root
-	// hash.Hash of the store, and a tableSpec describing every table that
-	// comprises the store.
+	// returned, including the version of the Noms data in the store, the lock
+	// and root hash.Hash of the store, a tableSpec describing every table
+	// that comprises the store, and how new tables are to be encoded.
 	// If the manifest doesn't exist, |exists| is set to false and the other
 	// return values are undefined. The |readHook| parameter allows race
 	// condition testing. If it is non-nil, it will be invoked while the
 	// implementation is guaranteeing exclusive access to the manifest.
-	ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec)
+	ParseIfExists(readHook func()) (exists bool, contents manifestContents)
 
-	// Update optimistically tries to write a new manifest containing
-	// |newRoot| and the tables referenced by |specs|. If |root| matches the root
-	// hash in the currently persisted manifest (logically, the root that
+	// Update optimistically tries to write |newContents|, whose lock must be
+	// generateLockHash() of its root, specs, compression and GC generation. If |lastLock| matches the
+	// lock in the currently persisted manifest (logically, the lock that
 	// would be returned by ParseIfExists), then Update succeeds and
-	// subsequent calls to both Update and ParseIfExists will reflect a
-	// manifest containing |newRoot| and |tables|. If not, Update fails.
-	// Regardless, |actual| and |tableSpecs| will reflect the current state of
-	// the world upon return. Callers should check that |actual| == |newRoot|
-	// and, if not, merge any desired new table information with the contents
-	// of |tableSpecs| before trying again.
+	// subsequent calls to both Update and ParseIfExists will reflect
+	// |newContents|. If not, Update fails. An empty |lastLock| matches only a
+	// manifest that doesn't exist yet. Regardless, the returned contents
+	// reflect the current state of the world upon return. Callers should
+	// check that its lock is newContents.lock and, if not, merge any desired
+	// new table information with its specs before trying again.
+	// Since the lock covers the table specs as well as the root, Update also
+	// fails if another writer changed only the tables, e.g. by compacting or
+	// collecting garbage, so a writer can't put back tables that have been
+	// retired since it last read the manifest. Writers that rebase onto a
+	// manifest with a new GC generation must also make sure that their novel
+	// chunks don't refer to chunks that GC collected; see
+	// NomsBlockStore.rebaseLocked().
 	// Concrete implementations are responsible for ensuring that concurrent
 	// Update calls (and ParseIfExists calls) are correct.
 	// If writeHook is non-nil, it will be invoked while the implementation is
 	// guaranteeing exclusive access to the manifest. This allows for testing
 	// of race conditions.
-	Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec)
+	Update(lastLock addr, newContents manifestContents, writeHook func()) manifestContents
+}
+
+// manifestContents is what a manifest holds: the Noms version of the data in
+// the store, its root, the tables that hold its chunks, the compression that
+// new tables are written with and the number of times garbage has been
+// collected, along with a lock that identifies the rest.
+type manifestContents struct {
+	vers  string
+	lock  addr
+	root  hash.Hash
+	specs []tableSpec
+	comp  compression
+	gcGen uint64
+}
+
+// newManifestContents returns the contents of a manifest that holds |root|,
+// |specs|, |comp| and |gcGen|, written by this version of Noms.
+func newManifestContents(root hash.Hash, specs []tableSpec, comp compression, gcGen uint64) manifestContents {
+	return manifestContents{constants.NomsVersion, generateLockHash(root, specs, comp, gcGen), root, specs, comp, gcGen}
+}
+
+// generateLockHash returns the lock of a manifest that holds |root|, |specs|,
+// |comp| and |gcGen|. It's derived from them, rather than stored alongside
+// them, so that manifests written before there were locks have one too. The
+// default compression and a GC generation of 0 don't change it, for the same
+// reason.
+func generateLockHash(root hash.Hash, specs []tableSpec, comp compression, gcGen uint64) (lock addr) {
+	h := sha512.New()
+	h.Write(root[:])
+	for _, spec := range specs {
+		h.Write(spec.name[:])
+		binary.Write(h, binary.BigEndian, spec.chunkCount)
+	}
+	if comp != (compression{}) {
+		h.Write([]byte{byte(comp.codec)})
+		binary.Write(h, binary.BigEndian, comp.dictID)
+	}
+	if gcGen != 0 {
+		h.Write([]byte("gc"))
+		binary.Write(h, binary.BigEndian, gcGen)
+	}
+	copy(lock[:], h.Sum(nil))
+	return
 }
 
 type tableSpec struct {
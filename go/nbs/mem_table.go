@@ -16,8 +16,9 @@ type memTable struct {
 	chunks             map[addr][]byte
 	order              []hasRecord // Must maintain the invariant that these are sorted by rec.order
 	maxData, totalData uint64
+	comp               compression // how write() encodes chunks
 
-	snapper snappyEncoder
+	snapper chunkEncoder
 }
 
 func newMemTable(memTableSize uint64) *memTable {
@@ -104,10 +105,12 @@ func (mt *memTable) extract(order EnumerationOrder, chunks chan<- extractRecord)
 	}
 }
 
-func (mt *memTable) write(haver chunkReader) (name addr, data []byte, count uint32) {
-	maxSize := maxTableSize(uint64(len(mt.order)), mt.totalData)
+// write returns the name, data and chunk count of a table of the chunks in mt
+// that |haver| doesn't have, encrypted with |key| if it isn't nil.
+func (mt *memTable) write(haver chunkReader, key *EncryptionKey) (name addr, data []byte, count uint32) {
+	maxSize := maxTableSize(uint64(len(mt.order)), mt.totalData, mt.comp, key)
 	buff := make([]byte, maxSize)
-	tw := newTableWriter(buff, mt.snapper)
+	tw := newTableWriter(buff, mt.comp, key, mt.snapper)
 
 	if haver != nil {
 		sort.Sort(hasRecordByPrefix(mt.order)) // hasMany() requires addresses to be sorted.
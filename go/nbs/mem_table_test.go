@@ -84,15 +84,15 @@ func TestMemTableWrite(t *testing.T) {
 
 	td1, _ := buildTable(chunks[1:2])
 	td2, _ := buildTable(chunks[2:])
-	tr1 := newTableReader(parseTableIndex(td1), bytes.NewReader(td1), fileBlockSize)
-	tr2 := newTableReader(parseTableIndex(td2), bytes.NewReader(td2), fileBlockSize)
+	tr1 := newTableReader(parseTableIndex(td1, nil), bytes.NewReader(td1), fileBlockSize, nil)
+	tr2 := newTableReader(parseTableIndex(td2, nil), bytes.NewReader(td2), fileBlockSize, nil)
 	assert.True(tr1.has(computeAddr(chunks[1])))
 	assert.True(tr2.has(computeAddr(chunks[2])))
 
-	_, data, count := mt.write(chunkReaderGroup{tr1, tr2})
+	_, data, count := mt.write(chunkReaderGroup{tr1, tr2}, nil)
 	assert.Equal(uint32(1), count)
 
-	outReader := newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
+	outReader := newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil)
 	assert.True(outReader.has(computeAddr(chunks[0])))
 	assert.False(outReader.has(computeAddr(chunks[1])))
 	assert.False(outReader.has(computeAddr(chunks[2])))
@@ -113,7 +113,7 @@ func TestMemTableSnappyWriteOutOfLine(t *testing.T) {
 	}
 	mt.snapper = &outOfLineSnappy{[]bool{false, true, false}} // chunks[1] should trigger a panic
 
-	assert.Panics(func() { mt.write(nil) })
+	assert.Panics(func() { mt.write(nil, nil) })
 }
 
 type outOfLineSnappy struct {
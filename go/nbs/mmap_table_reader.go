@@ -37,7 +37,7 @@ func init() {
 	}
 }
 
-func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *indexCache) chunkSource {
+func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *indexCache, key *EncryptionKey) chunkSource {
 	success := false
 	f, err := os.Open(filepath.Join(dir, h.String()))
 	d.PanicIfError(err)
@@ -59,18 +59,24 @@ func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *index
 
 	var buff []byte
 	if !found {
-		// index. Mmap won't take an offset that's not page-aligned, so find the nearest page boundary preceding the index.
-		indexOffset := fi.Size() - int64(footerSize) - int64(indexSize(chunkCount))
+		// index, and the bloom filter before it, if there is one. Mmap won't take an offset that's not page-aligned, so find the nearest page boundary preceding them.
+		indexOffset := fi.Size() - int64(maxTableTailSize(chunkCount))
+		if indexOffset < 0 {
+			indexOffset = 0 // a small table written without a bloom filter, encryption, or the longer footers
+		}
 		aligned := indexOffset / pageSize * pageSize // Thanks, integer arithmetic!
 		d.PanicIfTrue(fi.Size()-aligned > maxInt)
 		var err error
 		buff, err = unix.Mmap(int(f.Fd()), aligned, int(fi.Size()-aligned), unix.PROT_READ, unix.MAP_SHARED)
 		d.PanicIfError(err)
-		index = parseTableIndex(buff[indexOffset-aligned:])
+		index = parseTableIndex(buff[indexOffset-aligned:], key)
+		if id := index.comp.dictID; id != 0 {
+			loadDictionaryFile(dir, id, key)
+		}
 	}
 	success = true
 
-	source := &mmapTableReader{newTableReader(index, f, fileBlockSize), f, buff, h}
+	source := &mmapTableReader{newTableReader(index, f, fileBlockSize, key), f, buff, h}
 
 	d.PanicIfFalse(chunkCount == source.count())
 	return source
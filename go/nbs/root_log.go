@@ -0,0 +1,135 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// rootLogMaxSize is the size past which a fileRootLog is rotated, dropping
+// its oldest records. A dynamoRootLog is bounded by rootLogPageSize and
+// rootLogPages instead.
+var rootLogMaxSize = 1 << 20
+
+const (
+	rootLogFileName = "rootlog"
+
+	// pendingPrefix marks a record written before the manifest update that
+	// would make its entry's root current. The entry is written again,
+	// without it, once the update has succeeded.
+	pendingPrefix = "pending "
+)
+
+// rootLog is an append-only record of the roots a NomsBlockStore has had. It
+// holds lines as formatted by pendingRootLogRecord() and
+// chunks.RootLogEntry.String(), which resolveRootLog() turns into entries.
+type rootLog interface {
+	// Append adds |record| to the end of the log.
+	Append(record string)
+
+	// Records returns the contents of the log, oldest first.
+	Records() []string
+}
+
+func pendingRootLogRecord(e chunks.RootLogEntry) string {
+	return pendingPrefix + e.String()
+}
+
+// resolveRootLog returns the entries of the root log |records|, oldest
+// first, given that |root| is the current root. Since a record is written
+// as pending before the manifest update, and again once the update has
+// succeeded, a process that dies in between can leave a pending record whose
+// root was made current anyway. Such a record is kept if |root|, or the
+// previous root of a later record, shows that it was; the others are for
+// updates that failed.
+func resolveRootLog(records []string, root hash.Hash) (entries []chunks.RootLogEntry) {
+	parsed := make([]chunks.RootLogEntry, len(records))
+	pending := make([]bool, len(records))
+	committed := map[chunks.RootLogEntry]bool{}
+	for i, r := range records {
+		pending[i] = strings.HasPrefix(r, pendingPrefix)
+		e, err := chunks.ParseRootLogEntry(strings.TrimPrefix(r, pendingPrefix))
+		d.PanicIfError(err)
+		parsed[i] = e
+		if !pending[i] {
+			committed[e] = true
+		}
+	}
+
+	for i, e := range parsed {
+		if !pending[i] {
+			entries = append(entries, e)
+			continue
+		}
+		if committed[e] {
+			continue
+		}
+		made := e.Root == root
+		for _, later := range parsed[i+1:] {
+			made = made || later.Previous == e.Root
+		}
+		if made {
+			entries = append(entries, e)
+		}
+	}
+	return
+}
+
+// fileRootLog keeps a rootLog in a text file in |dir|, next to the manifest.
+// Each record is a single line, appended with O_APPEND so that concurrent
+// writers in other processes don't clobber one another. Once the file
+// outgrows rootLogMaxSize, it's renamed to rootLogFileName.1, replacing the
+// one before, so at most twice that is kept.
+type fileRootLog struct {
+	dir string
+}
+
+func (fl fileRootLog) Append(record string) {
+	path := filepath.Join(fl.dir, rootLogFileName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	d.PanicIfError(err)
+	defer checkClose(f)
+	_, err = f.WriteString(record + "\n")
+	d.PanicIfError(err)
+
+	if info, err := f.Stat(); err == nil && info.Size() < int64(rootLogMaxSize) {
+		return
+	}
+	// Only one writer may rotate the file. Any others waiting here will find that it has already been replaced.
+	d.PanicIfError(unix.Flock(int(f.Fd()), unix.LOCK_EX))
+	info, err := f.Stat()
+	d.PanicIfError(err)
+	if current, err := os.Stat(path); err == nil && os.SameFile(info, current) {
+		d.PanicIfError(os.Rename(path, path+".1"))
+	}
+}
+
+func (fl fileRootLog) Records() (records []string) {
+	path := filepath.Join(fl.dir, rootLogFileName)
+	for _, p := range []string{path + ".1", path} {
+		f := openIfExists(p)
+		if f == nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				records = append(records, line)
+			}
+		}
+		d.PanicIfError(scanner.Err())
+		checkClose(f)
+	}
+	return
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func testRootLogEntries(n int) (entries []chunks.RootLogEntry) {
+	prev := hash.Hash{}
+	for i := 0; i < n; i++ {
+		root := hash.Of([]byte{byte(i)})
+		entries = append(entries, chunks.RootLogEntry{Time: time.Unix(int64(1000+i), 0), Previous: prev, Root: root})
+		prev = root
+	}
+	return
+}
+
+func TestResolveRootLog(t *testing.T) {
+	assert := assert.New(t)
+	e := testRootLogEntries(4)
+	failed := chunks.RootLogEntry{Time: time.Unix(10, 0), Previous: e[0].Root, Root: hash.Of([]byte("failed"))}
+
+	records := []string{
+		e[0].String(), // written before there were pending records
+		pendingRootLogRecord(e[1]),
+		pendingRootLogRecord(failed),
+		e[1].String(),
+		pendingRootLogRecord(e[2]), // the writer died after updating the manifest, as e[3] shows
+		pendingRootLogRecord(e[3]), // the writer died after updating the manifest, as the current root shows
+	}
+	assert.Equal(e, resolveRootLog(records, e[3].Root))
+	assert.Equal(e[:3], resolveRootLog(records[:5], e[2].Root))
+	assert.Equal(e[:2], resolveRootLog(records[:5], e[1].Root))
+}
+
+func TestFileRootLogRotates(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	oldMaxSize := rootLogMaxSize
+	entries := testRootLogEntries(10)
+	rootLogMaxSize = 3 * (len(entries[0].String()) + 1)
+	defer func() { rootLogMaxSize = oldMaxSize }()
+
+	fl := fileRootLog{dir}
+	for _, e := range entries {
+		fl.Append(e.String())
+	}
+	// Each time the log reaches 3 records, it replaces the one before, so the last 3 rotated records are kept along with the current one.
+	assert.Equal(entries[6:], resolveRootLog(fl.Records(), hash.Hash{}))
+	_, err = os.Stat(filepath.Join(dir, rootLogFileName+".2"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestDynamoRootLog(t *testing.T) {
+	assert := assert.New(t)
+	ddb := makeFakeDDB(assert)
+
+	oldPageSize, oldPages := rootLogPageSize, rootLogPages
+	rootLogPageSize, rootLogPages = 2, 3
+	defer func() { rootLogPageSize, rootLogPages = oldPageSize, oldPages }()
+	entries := testRootLogEntries(11)
+
+	dl := newDynamoRootLog(table, db, ddb)
+	assert.Empty(dl.Records())
+	for _, e := range entries[:5] {
+		dl.Append(e.String())
+	}
+	assert.Equal(entries[:5], resolveRootLog(dl.Records(), hash.Hash{}))
+	for _, e := range entries[5:] {
+		dl.Append(e.String())
+	}
+	// Records are dropped a page at a time, so the last 3 pages, the newest of which has only the last record, are kept.
+	assert.Equal(entries[6:], resolveRootLog(dl.Records(), hash.Hash{}))
+	assert.Len(ddb.logs, 4)
+
+	// The log doesn't disturb the manifest it's kept next to.
+	exists, _ := newDynamoManifest(table, db, ddb, nil).ParseIfExists(nil)
+	assert.False(exists)
+}
+
+func TestDynamoRootLogOutgrowsItem(t *testing.T) {
+	assert := assert.New(t)
+	ddb := makeFakeDDB(assert)
+
+	// More records than fit in a single item.
+	entries := testRootLogEntries(maxDynamoItemSize/len(pendingRootLogRecord(testRootLogEntries(1)[0])) + 1)
+	dl := newDynamoRootLog(table, db, ddb)
+	for _, e := range entries {
+		dl.Append(pendingRootLogRecord(e))
+	}
+	records := dl.Records()
+	assert.Len(records, len(entries))
+	assert.Equal(pendingRootLogRecord(entries[len(entries)-1]), records[len(records)-1])
+	for _, item := range ddb.logs {
+		assert.True(itemSize(item) < maxDynamoItemSize/2)
+	}
+}
+
+func TestAWSStoreKeepsRootLog(t *testing.T) {
+	assert := assert.New(t)
+	ddb := makeFakeDDB(assert)
+	store := newNomsBlockStore(newDynamoManifest(table, db, ddb, nil), newS3TableSet(makeFakeS3(assert), "bucket", nil, make(chan struct{}, 8), nil), testMemTableSize, maxTables)
+	store.log = newDynamoRootLog(table, db, ddb)
+	defer store.Close()
+
+	first := types.String("first")
+	putValues(store, first)
+	assert.True(store.UpdateRoot(first.Hash(), store.Root()))
+	second := types.String("second")
+	putValues(store, second)
+	assert.True(store.UpdateRoot(second.Hash(), store.Root()))
+
+	log := store.RootLog()
+	assert.Len(log, 2)
+	assert.Equal(first.Hash(), log[0].Root)
+	assert.Equal(first.Hash(), log[1].Previous)
+	assert.Equal(second.Hash(), log[1].Root)
+}
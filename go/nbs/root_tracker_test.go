@@ -81,6 +81,22 @@ func TestChunkStoreManifestAppearsAfterConstruction(t *testing.T) {
 	assert.Equal(constants.NomsVersion, store.Version())
 }
 
+func TestChunkStoreRefreshRoot(t *testing.T) {
+	assert := assert.New(t)
+	fm, tt, store := makeStoreWithFakes(t)
+	defer store.Close()
+
+	// Simulate another process writing a manifest after construction.
+	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
+	newRoot := hash.Of([]byte("new root"))
+	src := tt.p.Compact(createMemTable(chunks), nil)
+	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks))}})
+
+	assert.Equal(newRoot, store.RefreshRoot())
+	assert.Equal(newRoot, store.Root())
+	assertDataInStore(chunks, store, assert)
+}
+
 func TestChunkStoreManifestFirstWriteByOtherProcess(t *testing.T) {
 	assert := assert.New(t)
 	fm := &fakeManifest{}
@@ -140,47 +156,34 @@ func assertDataInStore(slices [][]byte, store chunks.ChunkSource, assert *assert
 
 // fakeManifest simulates a fileManifest without touching disk.
 type fakeManifest struct {
-	version    string
-	root       hash.Hash
-	tableSpecs []tableSpec
-	mu         sync.RWMutex
+	contents manifestContents
+	mu       sync.RWMutex
 }
 
-// ParseIfExists returns any fake manifest data the caller has injected using Update() or set(). It treats an empty |fm.root| as a non-existent manifest.
-func (fm *fakeManifest) ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec) {
+// ParseIfExists returns any fake manifest data the caller has injected using Update() or set(). It treats an empty |fm.contents.lock| as a non-existent manifest.
+func (fm *fakeManifest) ParseIfExists(readHook func()) (exists bool, contents manifestContents) {
 	fm.mu.RLock()
 	defer fm.mu.RUnlock()
-	if fm.root != (hash.Hash{}) {
-		return true, fm.version, fm.root, fm.tableSpecs
+	if fm.contents.lock != (addr{}) {
+		return true, fm.contents
 	}
-	return false, "", hash.Hash{}, nil
+	return false, manifestContents{}
 }
 
-// Update checks whether |root| == |fm.root| and, if so, updates internal fake manifest state as per the manifest.Update() contract: |fm.root| is set to |newRoot|, and the contents of |specs| are merged into |fm.tableSpecs|. If |root| != |fm.root|, then the update fails. Regardless of success or failure, the current state is returned.
-func (fm *fakeManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
+// Update checks whether |lastLock| == |fm.contents.lock| and, if so, updates internal fake manifest state as per the manifest.Update() contract: |fm.contents| is set to |newContents|. If |lastLock| != |fm.contents.lock|, then the update fails. Regardless of success or failure, the current state is returned.
+func (fm *fakeManifest) Update(lastLock addr, newContents manifestContents, writeHook func()) manifestContents {
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
-	if fm.root != root {
-		return fm.root, fm.tableSpecs
+	if fm.contents.lock == lastLock {
+		fm.contents = newContents
 	}
-	fm.version = constants.NomsVersion
-	fm.root = newRoot
-
-	known := map[addr]struct{}{}
-	for _, t := range fm.tableSpecs {
-		known[t.name] = struct{}{}
-	}
-
-	for _, t := range specs {
-		if _, present := known[t.name]; !present {
-			fm.tableSpecs = append(fm.tableSpecs, t)
-		}
-	}
-	return fm.root, fm.tableSpecs
+	return fm.contents
 }
 
 func (fm *fakeManifest) set(version string, root hash.Hash, specs []tableSpec) {
-	fm.version, fm.root, fm.tableSpecs = version, root, specs
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.contents = manifestContents{version, generateLockHash(root, specs, compression{}, 0), root, specs, compression{}, 0}
 }
 
 func newFakeTableSet() tableSet {
@@ -188,39 +191,62 @@ func newFakeTableSet() tableSet {
 }
 
 func newFakeTablePersister() tablePersister {
-	return fakeTablePersister{map[addr]tableReader{}}
+	return fakeTablePersister{map[addr]tableReader{}, &sync.Mutex{}}
 }
 
 type fakeTablePersister struct {
 	sources map[addr]tableReader
+	mu      *sync.Mutex // tables may be conjoined in the background
 }
 
 func (ftp fakeTablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
 	if mt.count() > 0 {
-		name, data, chunkCount := mt.write(haver)
+		name, data, chunkCount := mt.write(haver, nil)
 		if chunkCount > 0 {
-			ftp.sources[name] = newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
+			ftp.mu.Lock()
+			defer ftp.mu.Unlock()
+			ftp.sources[name] = newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil)
 			return chunkSourceAdapter{ftp.sources[name], name}
 		}
 	}
 	return emptyChunkSource{}
 }
 
-func (ftp fakeTablePersister) CompactAll(sources chunkSources) chunkSource {
+func (ftp fakeTablePersister) CompactAll(sources chunkSources, comp compression) chunkSource {
 	rl := make(chan struct{}, 32)
 	defer close(rl)
-	name, data, chunkCount := compactSourcesToBuffer(sources, rl)
+	buff := &bytes.Buffer{}
+	name, _, chunkCount := conjoinTables(sources, comp, nil, buff, rl)
 	if chunkCount > 0 {
-		ftp.sources[name] = newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
+		ftp.mu.Lock()
+		defer ftp.mu.Unlock()
+		data := buff.Bytes()
+		ftp.sources[name] = newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil)
 		return chunkSourceAdapter{ftp.sources[name], name}
 	}
 	return emptyChunkSource{}
 }
 
 func (ftp fakeTablePersister) Open(name addr, chunkCount uint32) chunkSource {
+	ftp.mu.Lock()
+	defer ftp.mu.Unlock()
 	return chunkSourceAdapter{ftp.sources[name], name}
 }
 
+func (ftp fakeTablePersister) PersistDictionary(dict *Dictionary) {}
+
+func (ftp fakeTablePersister) LoadDictionary(id uint32) {}
+
+func (ftp fakeTablePersister) PruneTableFiles(keepers map[addr]struct{}, retired []addr) {
+	ftp.mu.Lock()
+	defer ftp.mu.Unlock()
+	for name := range ftp.sources {
+		if _, present := keepers[name]; !present {
+			delete(ftp.sources, name)
+		}
+	}
+}
+
 type chunkSourceAdapter struct {
 	tableReader
 	h addr
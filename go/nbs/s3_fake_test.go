@@ -56,7 +56,7 @@ func (m *fakeS3) readerForTable(name addr) chunkReader {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if buff, present := m.data[name.String()]; present {
-		return newTableReader(parseTableIndex(buff), bytes.NewReader(buff), s3BlockSize)
+		return newTableReader(parseTableIndex(buff, nil), bytes.NewReader(buff), s3BlockSize, nil)
 	}
 	return nil
 }
@@ -166,6 +166,9 @@ func parseRange(hdr string, total int) (start, end int) {
 		// negative range
 		fromEnd, err := strconv.Atoi(hdr[1:])
 		d.PanicIfError(err)
+		if fromEnd > total {
+			return 0, total // like S3, return the whole object
+		}
 		return total - fromEnd, total
 	}
 	ends := strings.Split(hdr, "-")
@@ -5,7 +5,11 @@
 package nbs
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
 	"sort"
 	"sync"
 	"time"
@@ -24,10 +28,29 @@ type s3TablePersister struct {
 	partSize   int
 	indexCache *indexCache
 	readRl     chan struct{}
+	key        *EncryptionKey // nil unless tables are encrypted
 }
 
 func (s3p s3TablePersister) Open(name addr, chunkCount uint32) chunkSource {
-	return newS3TableReader(s3p.s3, s3p.bucket, name, chunkCount, s3p.indexCache, s3p.readRl)
+	return newS3TableReader(s3p.s3, s3p.bucket, name, chunkCount, s3p.indexCache, s3p.readRl, s3p.key)
+}
+
+func (s3p s3TablePersister) PersistDictionary(dict *Dictionary) {
+	_, err := s3p.s3.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s3p.bucket),
+		Key:    aws.String(dictionaryFileName(dict.ID())),
+		Body:   bytes.NewReader(sealFile(s3p.key, dictionaryFileName(dict.ID()), dict.Bytes())),
+	})
+	d.PanicIfError(err)
+}
+
+func (s3p s3TablePersister) LoadDictionary(id uint32) {
+	loadS3Dictionary(s3p.s3, s3p.bucket, id, s3p.key)
+}
+
+// PruneTableFiles is a no-op for S3. Expiring unreferenced tables is left to
+// the bucket's lifecycle configuration.
+func (s3p s3TablePersister) PruneTableFiles(keepers map[addr]struct{}, retired []addr) {
 }
 
 type s3UploadedPart struct {
@@ -36,31 +59,64 @@ type s3UploadedPart struct {
 }
 
 func (s3p s3TablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
-	return s3p.persistTable(mt.write(haver))
+	return s3p.persistTable(mt.write(haver, s3p.key))
 }
 
 func (s3p s3TablePersister) persistTable(name addr, data []byte, chunkCount uint32) chunkSource {
 	if chunkCount > 0 {
 		t1 := time.Now()
-		s3p.multipartUpload(data, name.String())
+		s3p.multipartUpload(bytes.NewReader(data), len(data), name.String())
 		verbose.Log("Compacted table of %d Kb in %s", len(data)/1024, time.Since(t1))
 
 		s3tr := &s3TableReader{s3: s3p.s3, bucket: s3p.bucket, h: name}
-		index := parseTableIndex(data)
+		index := parseTableIndex(data, s3p.key)
 		if s3p.indexCache != nil {
 			s3p.indexCache.put(name, index)
 		}
-		s3tr.tableReader = newTableReader(index, s3tr, s3BlockSize)
+		s3tr.tableReader = newTableReader(index, s3tr, s3BlockSize, s3p.key)
 		return s3tr
 	}
 	return emptyChunkSource{}
 }
 
-func (s3p s3TablePersister) CompactAll(sources chunkSources) chunkSource {
-	return s3p.persistTable(compactSourcesToBuffer(sources, s3p.readRl))
+// CompactAll streams the conjoined table to a local temporary file, and
+// uploads it from there, so that the table needn't fit in memory.
+func (s3p s3TablePersister) CompactAll(sources chunkSources, comp compression) chunkSource {
+	temp, err := ioutil.TempFile("", "nbs_table_")
+	d.PanicIfError(err)
+	defer os.Remove(temp.Name())
+	defer checkClose(temp)
+
+	w := bufio.NewWriter(temp)
+	name, length, chunkCount := conjoinTables(sources, comp, s3p.key, w, s3p.readRl)
+	d.PanicIfError(w.Flush())
+	if chunkCount == 0 {
+		return emptyChunkSource{}
+	}
+
+	t1 := time.Now()
+	s3p.multipartUpload(temp, int(length), name.String())
+	verbose.Log("Compacted table of %d Kb in %s", length/1024, time.Since(t1))
+
+	// The bloom filter and index are at the end of the table, which is the only part that parseTableIndex() reads.
+	tail := make([]byte, maxTableTailSize(chunkCount))
+	if uint64(len(tail)) > length {
+		tail = tail[:length]
+	}
+	_, err = temp.ReadAt(tail, int64(length)-int64(len(tail)))
+	d.PanicIfError(err)
+	index := parseTableIndex(tail, s3p.key)
+	if s3p.indexCache != nil {
+		s3p.indexCache.put(name, index)
+	}
+	s3tr := &s3TableReader{s3: s3p.s3, bucket: s3p.bucket, h: name}
+	s3tr.tableReader = newTableReader(index, s3tr, s3BlockSize, s3p.key)
+	return s3tr
 }
 
-func (s3p s3TablePersister) multipartUpload(data []byte, key string) {
+// multipartUpload uploads the |size| bytes of |data| to |key|, in parts of
+// s3p.partSize that are sent concurrently.
+func (s3p s3TablePersister) multipartUpload(data io.ReaderAt, size int, key string) {
 	result, err := s3p.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
 		Bucket: aws.String(s3p.bucket),
 		Key:    aws.String(key),
@@ -68,7 +124,7 @@ func (s3p s3TablePersister) multipartUpload(data []byte, key string) {
 	d.Chk.NoError(err)
 	uploadID := *result.UploadId
 
-	multipartUpload, err := s3p.uploadParts(data, key, uploadID)
+	multipartUpload, err := s3p.uploadParts(data, size, key, uploadID)
 	if err != nil {
 		_, abrtErr := s3p.s3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
 			Bucket:   aws.String(s3p.bucket),
@@ -88,10 +144,10 @@ func (s3p s3TablePersister) multipartUpload(data []byte, key string) {
 	d.Chk.NoError(err)
 }
 
-func (s3p s3TablePersister) uploadParts(data []byte, key, uploadID string) (*s3.CompletedMultipartUpload, error) {
+func (s3p s3TablePersister) uploadParts(data io.ReaderAt, size int, key, uploadID string) (*s3.CompletedMultipartUpload, error) {
 	sent, failed, done := make(chan s3UploadedPart), make(chan error), make(chan struct{})
 
-	numParts := getNumParts(len(data), s3p.partSize)
+	numParts := getNumParts(size, s3p.partSize)
 	var wg sync.WaitGroup
 	wg.Add(numParts)
 	sendPart := func(partNum int) {
@@ -106,14 +162,14 @@ func (s3p s3TablePersister) uploadParts(data []byte, key, uploadID string) (*s3.
 		// Upload the desired part
 		start, end := (partNum-1)*s3p.partSize, partNum*s3p.partSize
 		if partNum == numParts { // If this is the last part, make sure it includes any overflow
-			end = len(data)
+			end = size
 		}
 		result, err := s3p.s3.UploadPart(&s3.UploadPartInput{
 			Bucket:     aws.String(s3p.bucket),
 			Key:        aws.String(key),
 			PartNumber: aws.Int64(int64(partNum)),
 			UploadId:   aws.String(uploadID),
-			Body:       bytes.NewReader(data[start:end]),
+			Body:       io.NewSectionReader(data, int64(start), int64(end-start)),
 		})
 		if err != nil {
 			failed <- err
@@ -6,6 +6,7 @@ package nbs
 
 import (
 	"bytes"
+	"io/ioutil"
 	"sync"
 	"testing"
 
@@ -36,7 +37,7 @@ func TestS3TablePersisterCompact(t *testing.T) {
 }
 
 func calcPartSize(rdr chunkReader, maxPartNum int) int {
-	return int(maxTableSize(uint64(rdr.count()), rdr.uncompressedLen())) / maxPartNum
+	return int(maxTableSize(uint64(rdr.count()), rdr.uncompressedLen(), compression{}, nil)) / maxPartNum
 }
 
 func TestS3TablePersisterCompactSinglePart(t *testing.T) {
@@ -124,7 +125,7 @@ func TestS3TablePersisterCompactAll(t *testing.T) {
 	defer close(rl)
 
 	s3p := s3TablePersister{s3: s3svc, bucket: "bucket", partSize: 128, indexCache: cache, readRl: rl}
-	src := s3p.CompactAll(sources)
+	src := s3p.CompactAll(sources, compression{})
 	assert.NotNil(cache.get(src.hash()))
 
 	if assert.True(src.count() > 0) {
@@ -139,19 +140,19 @@ func bytesToChunkSource(bs ...[]byte) chunkSource {
 	for _, b := range bs {
 		sum += len(b)
 	}
-	maxSize := maxTableSize(uint64(len(bs)), uint64(sum))
+	maxSize := maxTableSize(uint64(len(bs)), uint64(sum), compression{}, nil)
 	buff := make([]byte, maxSize)
-	tw := newTableWriter(buff, nil)
+	tw := newTableWriter(buff, compression{}, nil, nil)
 	for _, b := range bs {
 		tw.addChunk(computeAddr(b), b)
 	}
 	tableSize, name := tw.finish()
 	data := buff[:tableSize]
-	rdr := newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
+	rdr := newTableReader(parseTableIndex(data, nil), bytes.NewReader(data), fileBlockSize, nil)
 	return chunkSourceAdapter{rdr, name}
 }
 
-func TestCompactSourcesToBufferPanic(t *testing.T) {
+func TestConjoinTablesPanic(t *testing.T) {
 	assert := assert.New(t)
 	rl := make(chan struct{}, 1)
 	defer close(rl)
@@ -159,7 +160,7 @@ func TestCompactSourcesToBufferPanic(t *testing.T) {
 	src := bytesToChunkSource([]byte("hello"))
 	pcs := panicingChunkSource{src}
 
-	assert.Panics(func() { compactSourcesToBuffer(chunkSources{pcs}, rl) })
+	assert.Panics(func() { conjoinTables(chunkSources{pcs}, compression{}, nil, ioutil.Discard, rl) })
 }
 
 type panicingChunkSource struct {
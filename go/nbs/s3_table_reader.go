@@ -7,6 +7,8 @@ package nbs
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 
 	"github.com/attic-labs/noms/go/d"
 	"github.com/aws/aws-sdk-go/aws"
@@ -35,7 +37,7 @@ type s3svc interface {
 	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
 }
 
-func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexCache *indexCache, readRl chan struct{}) chunkSource {
+func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexCache *indexCache, readRl chan struct{}, key *EncryptionKey) chunkSource {
 	source := &s3TableReader{s3: s3, bucket: bucket, h: h, readRl: readRl}
 
 	var index tableIndex
@@ -45,20 +47,23 @@ func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexC
 	}
 
 	if !found {
-		size := indexSize(chunkCount) + footerSize
+		// The bloom filter comes before the index, if there is one. A small table written without one may be shorter than |size|, in which case all of it is read.
+		size := maxTableTailSize(chunkCount)
 		buff := make([]byte, size)
 
 		n, err := source.readRange(buff, fmt.Sprintf("%s=-%d", s3RangePrefix, size))
 		d.PanicIfError(err)
-		d.PanicIfFalse(size == uint64(n))
-		index = parseTableIndex(buff)
+		index = parseTableIndex(buff[:n], key)
+		if id := index.comp.dictID; id != 0 {
+			loadS3Dictionary(s3, bucket, id, key)
+		}
 
 		if indexCache != nil {
 			indexCache.put(h, index)
 		}
 	}
 
-	source.tableReader = newTableReader(index, source, s3BlockSize)
+	source.tableReader = newTableReader(index, source, s3BlockSize, key)
 	d.PanicIfFalse(chunkCount == source.count())
 	return source
 }
@@ -91,7 +96,24 @@ func (s3tr *s3TableReader) readRange(p []byte, rangeHeader string) (n int, err e
 		Range:  aws.String(rangeHeader),
 	})
 	d.PanicIfError(err)
-	d.PanicIfFalse(*result.ContentLength == int64(len(p)))
+	// A suffix range longer than the table gets all of it.
+	d.PanicIfFalse(*result.ContentLength == int64(len(p)) || (strings.HasPrefix(rangeHeader, s3RangePrefix+"=-") && *result.ContentLength < int64(len(p))))
+
+	return io.ReadFull(result.Body, p[:*result.ContentLength])
+}
 
-	return io.ReadFull(result.Body, p)
+// loadS3Dictionary reads the dictionary with ID |id| from |bucket|, opening
+// it with |key|, if it hasn't been read already.
+func loadS3Dictionary(svc s3svc, bucket string, id uint32, key *EncryptionKey) {
+	dictionaries.ensure(id, func() []byte {
+		result, err := svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(dictionaryFileName(id)),
+		})
+		d.PanicIfError(err)
+		defer result.Body.Close()
+		data, err := ioutil.ReadAll(result.Body)
+		d.PanicIfError(err)
+		return openFile(key, dictionaryFileName(id), data)
+	})
 }
@@ -6,6 +6,7 @@ package nbs
 
 import (
 	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
@@ -50,16 +51,25 @@ func makeGlobalIndexCache() { globalIndexCache = newIndexCache(defaultIndexCache
 
 type NomsBlockStore struct {
 	mm          manifest
+	log         rootLog // nil if this store doesn't keep a root log
 	nomsVersion string
 
 	mu     sync.RWMutex // protects the following state
 	mt     *memTable
 	tables tableSet
+	lock   addr // of the manifest that nbs last read or wrote
 	root   hash.Hash
+	comp   compression // how new tables are encoded
+	gcGen  uint64      // of the manifest that nbs last read or wrote
 
-	mtSize    uint64
-	maxTables int
-	putCount  uint64
+	mtSize     uint64
+	maxTables  int
+	putCount   uint64
+	compacting bool // whether a background compaction is running
+	closing    bool
+
+	compactMu sync.Mutex // held for each round of compaction
+	compactWg sync.WaitGroup
 }
 
 type AWSStoreFactory struct {
@@ -67,39 +77,104 @@ type AWSStoreFactory struct {
 	table, bucket string
 	indexCache    *indexCache
 	readRl        chan struct{}
+	key           *EncryptionKey
 }
 
 func NewAWSStoreFactory(sess *session.Session, table, bucket string, indexCacheSize uint64) chunks.Factory {
+	return NewEncryptedAWSStoreFactory(sess, table, bucket, indexCacheSize, nil)
+}
+
+// NewEncryptedAWSStoreFactory is like NewAWSStoreFactory, but the stores it
+// creates are encrypted with |key|, as by NewEncryptedAWSStore().
+func NewEncryptedAWSStoreFactory(sess *session.Session, table, bucket string, indexCacheSize uint64, key *EncryptionKey) chunks.Factory {
 	var indexCache *indexCache
 	if indexCacheSize > 0 {
 		indexCache = newIndexCache(indexCacheSize)
 	}
-	return &AWSStoreFactory{sess, table, bucket, indexCache, make(chan struct{}, defaultAWSReadLimit)}
+	return &AWSStoreFactory{sess, table, bucket, indexCache, make(chan struct{}, defaultAWSReadLimit), key}
 }
 
 func (asf *AWSStoreFactory) CreateStore(ns string) chunks.ChunkStore {
-	return newAWSStore(asf.table, ns, asf.bucket, asf.sess, defaultMemTableSize, asf.indexCache, asf.readRl)
+	return newAWSStore(asf.table, ns, asf.bucket, asf.sess, defaultMemTableSize, asf.indexCache, asf.readRl, asf.key)
 }
 
 func (asf *AWSStoreFactory) Shutter() {
 }
 
+// LocalStoreFactory creates NomsBlockStores in subdirectories of dir, one
+// per namespace.
+type LocalStoreFactory struct {
+	dir          string
+	memTableSize uint64
+	key          *EncryptionKey
+}
+
+func NewLocalStoreFactory(dir string, memTableSize uint64) chunks.Factory {
+	return NewEncryptedLocalStoreFactory(dir, memTableSize, nil)
+}
+
+// NewEncryptedLocalStoreFactory is like NewLocalStoreFactory, but the stores
+// it creates are encrypted with |key|, as by NewEncryptedLocalStore().
+func NewEncryptedLocalStoreFactory(dir string, memTableSize uint64, key *EncryptionKey) chunks.Factory {
+	return &LocalStoreFactory{dir, memTableSize, key}
+}
+
+func (lsf *LocalStoreFactory) CreateStore(ns string) chunks.ChunkStore {
+	return NewEncryptedLocalStore(filepath.Join(lsf.dir, ns), lsf.memTableSize, lsf.key)
+}
+
+// HasNamespace returns true if a store has been created for ns.
+func (lsf *LocalStoreFactory) HasNamespace(ns string) bool {
+	_, err := os.Stat(filepath.Join(lsf.dir, ns))
+	if os.IsNotExist(err) {
+		return false
+	}
+	d.PanicIfError(err)
+	return true
+}
+
+func (lsf *LocalStoreFactory) Shutter() {
+}
+
 func NewAWSStore(table, ns, bucket string, sess *session.Session, memTableSize uint64) *NomsBlockStore {
+	return NewEncryptedAWSStore(table, ns, bucket, sess, memTableSize, nil)
+}
+
+// NewEncryptedAWSStore is like NewAWSStore, but encrypts the tables it writes
+// to S3, and the table specs it writes to DynamoDB, with |key|. It refuses
+// those written without encryption, unless |key| reads unencrypted data, as
+// EncryptionKey.ReadingUnencrypted() describes. If |key| is nil, nothing is
+// encrypted.
+func NewEncryptedAWSStore(table, ns, bucket string, sess *session.Session, memTableSize uint64, key *EncryptionKey) *NomsBlockStore {
 	indexCacheOnce.Do(makeGlobalIndexCache)
-	return newAWSStore(table, ns, bucket, sess, memTableSize, globalIndexCache, make(chan struct{}, 32))
+	return newAWSStore(table, ns, bucket, sess, memTableSize, globalIndexCache, make(chan struct{}, 32), key)
 }
 
-func newAWSStore(table, ns, bucket string, sess *session.Session, memTableSize uint64, indexCache *indexCache, readRl chan struct{}) *NomsBlockStore {
-	mm := newDynamoManifest(table, ns, dynamodb.New(sess))
-	ts := newS3TableSet(s3.New(sess), bucket, indexCache, readRl)
-	return newNomsBlockStore(mm, ts, memTableSize, maxTables)
+func newAWSStore(table, ns, bucket string, sess *session.Session, memTableSize uint64, indexCache *indexCache, readRl chan struct{}, key *EncryptionKey) *NomsBlockStore {
+	ddb := dynamodb.New(sess)
+	mm := newDynamoManifest(table, ns, ddb, key)
+	ts := newS3TableSet(s3.New(sess), bucket, indexCache, readRl, key)
+	nbs := newNomsBlockStore(mm, ts, memTableSize, maxTables)
+	nbs.log = newDynamoRootLog(table, ns, ddb)
+	return nbs
 }
 
 func NewLocalStore(dir string, memTableSize uint64) *NomsBlockStore {
+	return NewEncryptedLocalStore(dir, memTableSize, nil)
+}
+
+// NewEncryptedLocalStore is like NewLocalStore, but encrypts the tables and
+// manifest it writes with |key|. It refuses those written without
+// encryption, unless |key| reads unencrypted data, as
+// EncryptionKey.ReadingUnencrypted() describes. If |key| is nil, nothing is
+// encrypted.
+func NewEncryptedLocalStore(dir string, memTableSize uint64, key *EncryptionKey) *NomsBlockStore {
 	err := os.MkdirAll(dir, 0777)
 	d.PanicIfError(err)
 	indexCacheOnce.Do(makeGlobalIndexCache)
-	return newNomsBlockStore(fileManifest{dir}, newFSTableSet(dir, globalIndexCache), memTableSize, maxTables)
+	nbs := newNomsBlockStore(fileManifest{dir, key}, newFSTableSet(dir, globalIndexCache, key), memTableSize, maxTables)
+	nbs.log = fileRootLog{dir}
+	return nbs
 }
 
 func newNomsBlockStore(mm manifest, ts tableSet, memTableSize uint64, maxTables int) *NomsBlockStore {
@@ -114,9 +189,10 @@ func newNomsBlockStore(mm manifest, ts tableSet, memTableSize uint64, maxTables
 		maxTables:   maxTables,
 	}
 
-	if exists, vers, root, tableSpecs := nbs.mm.ParseIfExists(nil); exists {
-		nbs.nomsVersion, nbs.root = vers, root
-		nbs.tables, _ = nbs.tables.Rebase(tableSpecs)
+	if exists, contents := nbs.mm.ParseIfExists(nil); exists {
+		nbs.nomsVersion, nbs.lock, nbs.root, nbs.gcGen = contents.vers, contents.lock, contents.root, contents.gcGen
+		nbs.tables, _ = nbs.tables.Rebase(contents.specs)
+		nbs.useCompressionLocked(contents.comp)
 	}
 
 	return nbs
@@ -148,16 +224,78 @@ func (nbs *NomsBlockStore) PutMany(chunx []chunks.Chunk) (err chunks.Backpressur
 	return err
 }
 
+// SetCompression makes the tables that nbs writes from now on encode their
+// chunks with |codec|, and, if |dict| is not nil, with the zstd dictionary
+// |dict|, which is stored alongside them. The choice is recorded in the
+// manifest, so the store is opened with it from then on, by this process and
+// others. Tables that have already been written keep their codec until they
+// are conjoined with tables written with another.
+func (nbs *NomsBlockStore) SetCompression(codec Codec, dict *Dictionary) {
+	comp := compression{codec: codec}
+	if dict != nil {
+		d.PanicIfFalse(codec == ZstdCodec)
+		nbs.tables.p.PersistDictionary(dict)
+		dictionaries.add(dict)
+		comp.dictID = dict.ID()
+	}
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+	for {
+		newContents := newManifestContents(nbs.root, nbs.tables.upstream.specs(), comp, nbs.gcGen)
+		upstream := nbs.mm.Update(nbs.lock, newContents, nil)
+		if upstream.lock == newContents.lock {
+			nbs.nomsVersion, nbs.lock = newContents.vers, newContents.lock
+			break
+		}
+		nbs.rebaseLocked(upstream)
+	}
+	nbs.useCompressionLocked(comp)
+}
+
+// Compression returns the codec that nbs writes new tables with, and the ID
+// of their dictionary, or 0 if they don't have one.
+func (nbs *NomsBlockStore) Compression() (Codec, uint32) {
+	nbs.mu.RLock()
+	defer nbs.mu.RUnlock()
+	return nbs.comp.codec, nbs.comp.dictID
+}
+
+// useCompressionLocked makes the tables that nbs writes from now on encode
+// their chunks as |comp| says, as read from the manifest. nbs.mu must be
+// held.
+func (nbs *NomsBlockStore) useCompressionLocked(comp compression) {
+	if comp.dictID != 0 {
+		nbs.tables.p.LoadDictionary(comp.dictID)
+	}
+	nbs.comp = comp
+	if nbs.mt != nil {
+		nbs.mt.comp = comp
+	}
+}
+
+// newMemTableLocked returns an empty memTable that will be written with
+// nbs.comp. nbs.mu must be held.
+func (nbs *NomsBlockStore) newMemTableLocked() *memTable {
+	mt := newMemTable(nbs.mtSize)
+	mt.comp = nbs.comp
+	return mt
+}
+
 // TODO: figure out if there's a non-error reason for this to return false. If not, get rid of return value.
 func (nbs *NomsBlockStore) addChunk(h addr, data []byte) bool {
 	nbs.mu.Lock()
 	defer nbs.mu.Unlock()
+	return nbs.addChunkLocked(h, data)
+}
+
+// addChunkLocked implements addChunk(). nbs.mu must be held.
+func (nbs *NomsBlockStore) addChunkLocked(h addr, data []byte) bool {
 	if nbs.mt == nil {
-		nbs.mt = newMemTable(nbs.mtSize)
+		nbs.mt = nbs.newMemTableLocked()
 	}
 	if !nbs.mt.addChunk(h, data) {
 		nbs.tables = nbs.tables.Prepend(nbs.mt)
-		nbs.mt = newMemTable(nbs.mtSize)
+		nbs.mt = nbs.newMemTableLocked()
 		return nbs.mt.addChunk(h, data)
 	}
 	return true
@@ -292,46 +430,166 @@ func (nbs *NomsBlockStore) Root() hash.Hash {
 	return nbs.root
 }
 
-func (nbs *NomsBlockStore) UpdateRoot(current, last hash.Hash) bool {
+// RefreshRoot re-reads the manifest, so that the store sees any root and
+// tables committed by other NomsBlockStores over the same storage since it
+// last read or updated it.
+func (nbs *NomsBlockStore) RefreshRoot() hash.Hash {
 	nbs.mu.Lock()
 	defer nbs.mu.Unlock()
-	if nbs.root != last {
-		return false
+	if exists, contents := nbs.mm.ParseIfExists(nil); exists && contents.lock != nbs.lock {
+		nbs.rebaseLocked(contents)
 	}
+	return nbs.root
+}
 
-	if nbs.mt != nil && nbs.mt.count() > 0 {
-		nbs.tables = nbs.tables.Prepend(nbs.mt)
-		nbs.mt = nil
+// rebaseLocked makes nbs reflect |upstream|, as read from the manifest,
+// keeping its novel tables. nbs.mu must be held.
+//
+// Novel tables are de-duped against the tables nbs had when they were
+// written, so they can leave out chunks that GC has since collected. If
+// |upstream| is from a later GC generation than nbs last saw, the chunks that
+// are reachable from |roots| or from nbs's novel chunks, but that are no
+// longer in |upstream|, are copied out of the dropped tables into novel ones
+// before those are closed. See keepCollectedLocked().
+func (nbs *NomsBlockStore) rebaseLocked(upstream manifestContents, roots ...hash.Hash) {
+	// Since we're going to start fresh, re-opening all the new tables from upstream, close the chunkSources that are dropped during Rebase().
+	var dropped chunkSources
+	collected := upstream.gcGen != nbs.gcGen
+	nbs.nomsVersion, nbs.lock, nbs.root, nbs.gcGen = upstream.vers, upstream.lock, upstream.root, upstream.gcGen
+	nbs.tables, dropped = nbs.tables.Rebase(upstream.specs)
+	nbs.useCompressionLocked(upstream.comp)
+	if collected {
+		nbs.keepCollectedLocked(dropped, roots)
 	}
+	dropped.close()
+}
 
-	candidate := nbs.tables
-	var compactees chunkSources
-	if candidate.Size() > nbs.maxTables {
-		candidate, compactees = candidate.Compact() // Compact() must only compact upstream tables (BUG 3142)
+// keepCollectedLocked copies into nbs.mt every chunk in |dropped| that can be
+// reached from |roots|, or from the chunks in nbs.mt and nbs.tables.novel,
+// without going through nbs.tables.upstream, which GC leaves holding every
+// chunk reachable from those it holds. Chunks that are in none of them, such
+// as those that shallow pulls leave out, stay missing. nbs.mu must be held.
+func (nbs *NomsBlockStore) keepCollectedLocked(dropped chunkSources, roots []hash.Hash) {
+	pending := hash.HashSet{}
+	for _, r := range roots {
+		if !r.IsEmpty() {
+			pending.Insert(r)
+		}
+	}
+	ch := make(chan extractRecord, 32)
+	go func() {
+		defer close(ch)
+		for _, src := range nbs.tables.novel {
+			src.extract(InsertOrder, ch)
+		}
+		if nbs.mt != nil {
+			nbs.mt.extract(InsertOrder, ch)
+		}
+	}()
+	for rec := range ch {
+		types.DecodeValue(chunks.NewChunkWithHash(hash.Hash(rec.a), rec.data), nil).WalkRefs(func(r types.Ref) {
+			pending.Insert(r.TargetHash())
+		})
 	}
 
-	actual, tableNames := nbs.mm.Update(candidate.ToSpecs(), nbs.root, current, nil)
+	seen := hash.HashSet{}
+	for len(pending) > 0 {
+		next := hash.HashSet{}
+		for h := range pending {
+			seen.Insert(h)
+			a := addr(h)
+			if nbs.tables.has(a) || (nbs.mt != nil && nbs.mt.has(a)) {
+				continue
+			}
+			var data []byte
+			for _, src := range dropped {
+				if data = src.get(a); data != nil {
+					break
+				}
+			}
+			if data == nil {
+				continue
+			}
+			d.PanicIfFalse(nbs.addChunkLocked(a, data))
+			types.DecodeValue(chunks.NewChunkWithHash(h, data), nil).WalkRefs(func(r types.Ref) {
+				if h := r.TargetHash(); !seen.Has(h) {
+					next.Insert(h)
+				}
+			})
+		}
+		pending = next
+	}
+}
 
-	if current != actual {
-		// Optimistic lock failure. Since we're going to start fresh, re-opening all the new tables from upstream, and re-calculate which tables to compact, close all the compactees as well as the chunkSources that are dropped during Rebase().
-		compactees.close()
-		var dropped chunkSources
-		nbs.root = actual
-		nbs.tables, dropped = candidate.Rebase(tableNames)
-		dropped.close()
-		return false
+func (nbs *NomsBlockStore) UpdateRoot(current, last hash.Hash) bool {
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+	var newContents manifestContents
+	// The root log entry is recorded as pending before the manifest is updated, and again once the update has succeeded, so that a crash in between can't lose it. See resolveRootLog().
+	logEntry := chunks.RootLogEntry{Time: time.Now(), Previous: last, Root: current}
+	logged := nbs.log == nil || current == last
+	for {
+		if nbs.root != last {
+			return false
+		}
+		if !logged {
+			nbs.log.Append(pendingRootLogRecord(logEntry))
+			logged = true
+		}
+
+		if nbs.mt != nil && nbs.mt.count() > 0 {
+			nbs.tables = nbs.tables.Prepend(nbs.mt)
+			nbs.mt = nil
+		}
+
+		newContents = newManifestContents(current, nbs.tables.ToSpecs(), nbs.comp, nbs.gcGen)
+		upstream := nbs.mm.Update(nbs.lock, newContents, nil)
+		if upstream.lock != newContents.lock {
+			// Optimistic lock failure. If someone else only changed the tables, e.g. by compacting them, the root is still |last|, so try again on top of their tables. If they collected garbage, rebasing first keeps the chunks that |current| needs.
+			nbs.rebaseLocked(upstream, current)
+			continue
+		}
+		break
 	}
-	nbs.tables = candidate.Flatten()
-	compactees.close()
-	nbs.nomsVersion, nbs.root = constants.NomsVersion, current
+	nbs.tables = nbs.tables.Flatten()
+	if nbs.log != nil && current != last {
+		nbs.log.Append(logEntry.String())
+	}
+	nbs.nomsVersion, nbs.lock, nbs.root = newContents.vers, newContents.lock, current
+	// Tables are compacted in the background, so that committing doesn't have to wait for the conjoined tables to be written.
+	nbs.maybeCompactLocked()
 	return true
 }
 
+// RootLog returns the roots this store has had, oldest first, as far back as
+// its root log goes. The log is bounded in size, so the oldest are
+// eventually dropped.
+func (nbs *NomsBlockStore) RootLog() []chunks.RootLogEntry {
+	nbs.mu.RLock()
+	defer nbs.mu.RUnlock()
+	return nbs.rootLogLocked()
+}
+
+// rootLogLocked implements RootLog(). nbs.mu must be held.
+func (nbs *NomsBlockStore) rootLogLocked() []chunks.RootLogEntry {
+	if nbs.log == nil {
+		return nil
+	}
+	return resolveRootLog(nbs.log.Records(), nbs.root)
+}
+
 func (nbs *NomsBlockStore) Version() string {
 	return nbs.nomsVersion
 }
 
+// Close waits for any compaction running in the background to finish, and
+// closes the store's tables.
 func (nbs *NomsBlockStore) Close() (err error) {
+	nbs.mu.Lock()
+	nbs.closing = true
+	nbs.mu.Unlock()
+	nbs.compactWg.Wait()
+
 	nbs.mu.Lock()
 	defer nbs.mu.Unlock()
 	return nbs.tables.Close()
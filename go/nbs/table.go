@@ -21,9 +21,9 @@ import (
    An Index maps each address to the position of its corresponding chunk. Addresses are logically sorted within the Index, but the corresponding chunks need not be.
 
    Table:
-   +----------------+----------------+-----+----------------+-------+--------+
-   | Chunk Record 0 | Chunk Record 1 | ... | Chunk Record N | Index | Footer |
-   +----------------+----------------+-----+----------------+-------+--------+
+   +----------------+----------------+-----+----------------+--------------+-------+--------+
+   | Chunk Record 0 | Chunk Record 1 | ... | Chunk Record N | Bloom Filter | Index | Footer |
+   +----------------+----------------+-----+----------------+--------------+-------+--------+
 
    Chunk Record:
    +---------------------------+----------------+
@@ -33,6 +33,16 @@ import (
      -Address suffix is the 4 least-significant bytes of the Chunk's address. Used (e.g. in place
       of CRC32) as a checksum and a filter against false positive reads costing more than one IOP.
 
+   Bloom Filter:
+   +------+---------------------+---------------------+-----------------+
+   | Bits | (Uint32) Hash Count | (Uint32) Bits CRC32 | (8) Bloom Magic |
+   +------+---------------------+---------------------+-----------------+
+
+     -The Bloom Filter is optional. Tables written before it was introduced don't have one, and are read as before.
+     -Bits is ceil(N * 10 / 8) bytes long, so the size of the section depends only on N. Bit i of Bits is bit (i % 8) of byte (i / 8).
+     -An address A is recorded by setting bits (H1 + j * H2) % len(Bits) for 0 <= j < Hash Count, where H1 and H2 are the first two 8-byte words of A.
+     -Bloom Magic is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs/bloom". Along with the CRC32, it tells a Bloom Filter apart from the end of the last Chunk Record in a table that doesn't have one.
+
    Index:
    +------------+---------+----------+
    | Prefix Map | Lengths | Suffixes |
@@ -79,6 +89,32 @@ import (
 
      -Total Uncompressed Chunk Data is the sum of the uncompressed byte lengths of all contained chunk byte slices.
      -Magic Number is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs".
+     -Chunk Data in a table with this Footer is snappy-encoded.
+
+   Codec Footer:
+   +-----------------+--------------------------+----------------------+----------------------------------------+------------------------+
+   | (Uint8) Codec   | (Uint32) Dictionary ID   | (Uint32) Chunk Count | (Uint64) Total Uncompressed Chunk Data | (8) Codec Magic Number |
+   +-----------------+--------------------------+----------------------+----------------------------------------+------------------------+
+
+     -Tables whose Chunk Data isn't snappy-encoded end with a Codec Footer in place of the Footer. Codec 1 is zstd.
+     -Dictionary ID is the ID of the zstd dictionary each Chunk Data was compressed with, or 0 if there is none. The dictionary is stored alongside the table, in a file named "dict_" followed by the ID in 8 hex digits.
+     -Codec Magic Number is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs/codec".
+
+   Encrypted Footer:
+   +---------------+------------------------+-----------------+----------------------+----------------------------------------+----------------------------+
+   | (Uint8) Codec | (Uint32) Dictionary ID | (Uint32) Key ID | (Uint32) Chunk Count | (Uint64) Total Uncompressed Chunk Data | (8) Encrypted Magic Number |
+   +---------------+------------------------+-----------------+----------------------+----------------------------------------+----------------------------+
+
+     -Encrypted tables end with an Encrypted Footer, and are laid out as:
+
+      +-----------------------+-----+-----------------------+------------+-------------------------------+------------------+
+      | Sealed Chunk Record 0 | ... | Sealed Chunk Record N | (12) Nonce | Sealed Bloom Filter and Index | Encrypted Footer |
+      +-----------------------+-----+-----------------------+------------+-------------------------------+------------------+
+
+     -A Sealed Chunk Record is a Chunk Record whose Chunk Data is a random 12-byte nonce, followed by the AES-256-GCM encryption of the encoded chunk, with the chunk's address as additional data. The CRC32 and Lengths cover the whole of the sealed Chunk Data.
+     -The Bloom Filter and Index are encrypted together, with the Encrypted Footer as additional data, and followed by the 16-byte GCM tag. The Footer, and so the number of chunks and the table's size, are not encrypted. Neither are the table's name and chunk addresses, which are hashes of the plaintext.
+     -Key ID identifies the key the table was encrypted with, so that reading with another key fails cleanly.
+     -Encrypted Magic Number is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs/encrypted".
 
     NOTE: Unsigned integer quanities, hashes and hash suffix are all encoded big-endian
 
@@ -87,6 +123,7 @@ import (
   There are two phases to loading chunk data for a given Hash from an NBS Table: Checking for the chunk's presence, and fetching the chunk's bytes. When performing a has-check, only the first phase is necessary.
 
   Phase one: Chunk presence
+  - If the Table has a Bloom Filter, check the bits for your Hash. If any is unset, your chunk is not in this Table.
   - Slice off the first 8 bytes of your Hash to create a Prefix
   - Since the Prefix Tuples in the Prefix Map are in lexicographic order, binary search the Prefix Map for the desired Prefix.
   - For all Prefix Tuples with a matching Prefix:
@@ -105,20 +142,24 @@ import (
 */
 
 const (
-	addrSize           uint64 = 20
-	addrPrefixSize     uint64 = 8
-	addrSuffixSize            = addrSize - addrPrefixSize
-	uint64Size         uint64 = 8
-	uint32Size         uint64 = 4
-	ordinalSize        uint64 = uint32Size
-	lengthSize         uint64 = uint32Size
-	magicNumber               = "\xff\xb5\xd8\xc2\x24\x63\xee\x50"
-	magicNumberSize    uint64 = uint64(len(magicNumber))
-	footerSize                = uint32Size + uint64Size + magicNumberSize
-	prefixTupleSize           = addrPrefixSize + ordinalSize
-	checksumSize       uint64 = uint32Size
-	maxChunkLengthSize uint64 = binary.MaxVarintLen64
-	maxChunkSize       uint64 = 0xffffffff // Snappy won't compress slices bigger than this
+	addrSize             uint64 = 20
+	addrPrefixSize       uint64 = 8
+	addrSuffixSize              = addrSize - addrPrefixSize
+	uint64Size           uint64 = 8
+	uint32Size           uint64 = 4
+	ordinalSize          uint64 = uint32Size
+	lengthSize           uint64 = uint32Size
+	magicNumber                 = "\xff\xb5\xd8\xc2\x24\x63\xee\x50"
+	magicNumberSize      uint64 = uint64(len(magicNumber))
+	footerSize                  = uint32Size + uint64Size + magicNumberSize
+	codecMagicNumber            = "\xe6\x45\xef\x64\xa0\x49\x3b\x3e"
+	codecSize            uint64 = 1
+	encryptedMagicNumber        = "\xfe\xf0\xad\xfb\x0b\x7a\x83\x50"
+	maxFooterSize               = codecSize + 2*uint32Size + footerSize // the size of an Encrypted Footer
+	prefixTupleSize             = addrPrefixSize + ordinalSize
+	checksumSize         uint64 = uint32Size
+	maxChunkLengthSize   uint64 = binary.MaxVarintLen64
+	maxChunkSize         uint64 = 0xffffffff // Snappy won't compress slices bigger than this
 )
 
 var crcTable = crc32.MakeTable(crc32.Castagnoli)
@@ -214,10 +255,21 @@ type chunkSource interface {
 	close() error
 	hash() addr
 	calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool)
+	// encoding returns how the chunk records of the table are encoded.
+	encoding() compression
 }
 
 type chunkSources []chunkSource
 
+// specs returns the name and chunk count of each of css.
+func (css chunkSources) specs() []tableSpec {
+	specs := make([]tableSpec, len(css))
+	for i, src := range css {
+		specs[i] = tableSpec{src.hash(), src.count()}
+	}
+	return specs
+}
+
 func (css chunkSources) close() (err error) {
 	for _, haver := range css {
 		if e := haver.close(); e != nil {
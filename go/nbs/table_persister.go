@@ -5,8 +5,8 @@
 package nbs
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/attic-labs/noms/go/d"
@@ -15,8 +15,24 @@ import (
 
 type tablePersister interface {
 	Compact(mt *memTable, haver chunkReader) chunkSource
-	CompactAll(sources chunkSources) chunkSource
+	CompactAll(sources chunkSources, comp compression) chunkSource
 	Open(name addr, chunkCount uint32) chunkSource
+
+	// PersistDictionary stores |dict| alongside the tables, so that those
+	// written with it can be read by other processes.
+	PersistDictionary(dict *Dictionary)
+
+	// LoadDictionary reads the dictionary with ID |id|, as stored by
+	// PersistDictionary, so that tables can be written with it, if it hasn't
+	// been already.
+	LoadDictionary(id uint32)
+
+	// PruneTableFiles deletes the persisted tables named in |retired|, which
+	// have just been dropped from the manifest, unless they're also named in
+	// |keepers|. Tables that aren't in |retired| are never deleted, since
+	// they may have been persisted by another process that has yet to commit
+	// them. Implementations may choose to leave retired tables in place.
+	PruneTableFiles(keepers map[addr]struct{}, retired []addr)
 }
 
 type indexCache struct {
@@ -38,37 +54,18 @@ func (sic indexCache) get(name addr) (tableIndex, bool) {
 }
 
 func (sic indexCache) put(name addr, idx tableIndex) {
-	indexSize := uint64(idx.chunkCount) * (addrSize + ordinalSize + lengthSize + uint64Size)
+	indexSize := uint64(idx.chunkCount)*(addrSize+ordinalSize+lengthSize+uint64Size) + uint64(len(idx.bloom.bits))
 	sic.cache.Add(name, indexSize, idx)
 }
 
-type chunkSourcesByDescendingCount chunkSources
-
-func (csbc chunkSourcesByDescendingCount) Len() int { return len(csbc) }
-func (csbc chunkSourcesByDescendingCount) Less(i, j int) bool {
-	srcI, srcJ := csbc[i], csbc[j]
-	if srcI.count() == srcJ.count() {
-		hi, hj := srcI.hash(), srcJ.hash()
-		return bytes.Compare(hi[:], hj[:]) > 0
-	}
-	return srcI.count() > srcJ.count()
-}
-func (csbc chunkSourcesByDescendingCount) Swap(i, j int) { csbc[i], csbc[j] = csbc[j], csbc[i] }
-
-func compactSourcesToBuffer(sources chunkSources, rl chan struct{}) (name addr, data []byte, chunkCount uint32) {
+// conjoinTables writes a table holding the chunks of |sources| to |w|,
+// encoded as |comp| says and encrypted with |key| if it isn't nil, and
+// returns its name, length and chunk count.
+// Chunks found in more than one source are written once. The table is streamed to w as the sources are
+// read, so only its index, and not its chunk data, is held in memory.
+func conjoinTables(sources chunkSources, comp compression, key *EncryptionKey, w io.Writer, rl chan struct{}) (name addr, length uint64, chunkCount uint32) {
 	d.Chk.True(rl != nil)
-	totalData := uint64(0)
-	for _, src := range sources {
-		chunkCount += src.count()
-		totalData += src.uncompressedLen()
-	}
-	if chunkCount == 0 {
-		return
-	}
-
-	maxSize := maxTableSize(uint64(chunkCount), totalData)
-	buff := make([]byte, maxSize) // This can blow up RAM (BUG 3130)
-	tw := newTableWriter(buff, nil)
+	stw := newStreamingTableWriter(w, comp, key)
 
 	// Use "channel of channels" ordered-concurrency pattern so that chunks from a given table stay together, preserving whatever locality was present in that table.
 	chunkChans := make(chan chan extractRecord)
@@ -105,7 +102,7 @@ func compactSourcesToBuffer(sources chunkSources, rl chan struct{}) (name addr,
 	for chunks := range chunkChans {
 		for chunk := range chunks {
 			if _, present := known[chunk.a]; !present {
-				tw.addChunk(chunk.a, chunk.data)
+				stw.addChunk(chunk.a, chunk.data)
 				known[chunk.a] = struct{}{}
 			}
 		}
@@ -119,6 +116,9 @@ func compactSourcesToBuffer(sources chunkSources, rl chan struct{}) (name addr,
 		panic(fmt.Errorf(errString))
 	}
 
-	tableSize, name := tw.finish()
-	return name, buff[:tableSize], uint32(len(known))
+	if len(known) == 0 {
+		return
+	}
+	length, name = stw.finish()
+	return name, length, uint32(len(known))
 }
@@ -14,7 +14,6 @@ import (
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
-	"github.com/golang/snappy"
 )
 
 type tableIndex struct {
@@ -23,6 +22,10 @@ type tableIndex struct {
 	prefixes, offsets     []uint64
 	lengths, ordinals     []uint32
 	suffixes              []byte
+	bloom                 bloomFilter // zero if the table doesn't have one
+	comp                  compression
+	encrypted             bool
+	keyID                 uint32 // of the key the table is encrypted with
 }
 
 // tableReader implements get & has queries against a single nbs table. goroutine safe.
@@ -30,15 +33,17 @@ type tableReader struct {
 	tableIndex
 	r         io.ReaderAt
 	blockSize uint64
+	key       *EncryptionKey // nil unless the table is encrypted
 }
 
-// parses a valid nbs tableIndex from a byte stream. |buff| must end with an NBS index and footer, though it may contain an unspecified number of bytes before that data. |tableIndex| doesn't keep alive any references to |buff|.
-func parseTableIndex(buff []byte) tableIndex {
+// parses a valid nbs tableIndex from a byte stream. |buff| must end with an NBS index and footer, though it may contain an unspecified number of bytes before that data. If the table is encrypted, |key| must be the key it was encrypted with. If it isn't, |key| must be nil or read unencrypted tables. |tableIndex| doesn't keep alive any references to |buff|, or |key|, so it may be cached and shared by stores with different keys.
+func parseTableIndex(buff []byte, key *EncryptionKey) tableIndex {
 	pos := uint64(len(buff))
 
 	// footer
 	pos -= magicNumberSize
-	d.Chk.True(string(buff[pos:]) == magicNumber)
+	magic := string(buff[pos:])
+	d.Chk.True(magic == magicNumber || magic == codecMagicNumber || magic == encryptedMagicNumber)
 
 	// total uncompressed chunk data
 	pos -= uint64Size
@@ -47,6 +52,35 @@ func parseTableIndex(buff []byte) tableIndex {
 	pos -= uint32Size
 	chunkCount := binary.BigEndian.Uint32(buff[pos:])
 
+	keyID := uint32(0)
+	if magic == encryptedMagicNumber {
+		pos -= uint32Size
+		keyID = binary.BigEndian.Uint32(buff[pos:])
+	}
+
+	comp := compression{}
+	if magic != magicNumber {
+		pos -= uint32Size
+		comp.dictID = binary.BigEndian.Uint32(buff[pos:])
+		pos -= codecSize
+		comp.codec = Codec(buff[pos])
+	}
+
+	if magic == encryptedMagicNumber {
+		// The bloom filter and index are sealed together, with the footer as additional data.
+		checkKey(key, keyID, "Table")
+		footer := buff[pos:]
+		sealedSize := bloomFilterSize(chunkCount) + indexSize(chunkCount) + sealOverhead
+		pos -= sealedSize
+		plaintext, err := key.open(buff[pos:pos+sealedSize], footer)
+		if err != nil {
+			d.Panic("Failed to decrypt table index: %s", err)
+		}
+		buff, pos = plaintext, uint64(len(plaintext))
+	} else {
+		checkUnencrypted(key, "Table")
+	}
+
 	// index
 	suffixesSize := uint64(chunkCount) * addrSuffixSize
 	pos -= suffixesSize
@@ -61,11 +95,18 @@ func parseTableIndex(buff []byte) tableIndex {
 	pos -= tuplesSize
 	prefixes, ordinals := computePrefixes(chunkCount, buff[pos:pos+tuplesSize])
 
+	// bloom filter, if |buff| includes one
+	bloom, _ := parseBloomFilter(buff[:pos], chunkCount)
+
 	return tableIndex{
 		chunkCount, totalUncompressedData,
 		prefixes, offsets,
 		lengths, ordinals,
 		suffixes,
+		bloom,
+		comp,
+		magic == encryptedMagicNumber,
+		keyID,
 	}
 }
 
@@ -137,9 +178,16 @@ func (ti tableIndex) lookupOrdinal(h addr) uint32 {
 	return ti.chunkCount
 }
 
-// newTableReader parses a valid nbs table byte stream and returns a reader. buff must end with an NBS index and footer, though it may contain an unspecified number of bytes before that data. r should allow retrieving any desired range of bytes from the table.
-func newTableReader(index tableIndex, r io.ReaderAt, blockSize uint64) tableReader {
-	return tableReader{index, r, blockSize}
+// newTableReader returns a tableReader for the table with |index|, which
+// must be readable with |key|, as for parseTableIndex().
+func newTableReader(index tableIndex, r io.ReaderAt, blockSize uint64, key *EncryptionKey) tableReader {
+	if index.encrypted {
+		checkKey(key, index.keyID, "Table")
+	} else {
+		checkUnencrypted(key, "Table")
+		key = nil
+	}
+	return tableReader{index, r, blockSize, key}
 }
 
 // Scan across (logically) two ordered slices of address prefixes.
@@ -154,6 +202,11 @@ func (tr tableReader) hasMany(addrs []hasRecord) (remaining bool) {
 			continue
 		}
 
+		if !tr.bloom.mayContain(*addr.a) {
+			remaining = true
+			continue
+		}
+
 		for filterIdx < filterLen && addr.prefix > tr.prefixes[filterIdx] {
 			filterIdx++
 		}
@@ -194,6 +247,9 @@ func (tr tableReader) uncompressedLen() uint64 {
 
 // returns true iff |h| can be found in this table.
 func (tr tableReader) has(h addr) bool {
+	if !tr.bloom.mayContain(h) {
+		return false
+	}
 	ordinal := tr.lookupOrdinal(h)
 	return ordinal < tr.count()
 }
@@ -212,7 +268,7 @@ func (tr tableReader) get(h addr) (data []byte) {
 	n, err := tr.r.ReadAt(buff, int64(offset))
 	d.Chk.NoError(err)
 	d.Chk.True(n == int(length))
-	data = tr.parseChunk(buff)
+	data = tr.parseChunk(h, buff)
 	d.Chk.True(data != nil)
 
 	return
@@ -242,7 +298,7 @@ func (tr tableReader) readAtOffsets(readStart, readEnd uint64, reqs []getRecord,
 		localStart := rec.offset - readStart
 		localEnd := localStart + uint64(tr.lengths[rec.ordinal])
 		d.Chk.True(localEnd <= readLength)
-		data := tr.parseChunk(buff[localStart:localEnd])
+		data := tr.parseChunk(*rec.a, buff[localStart:localEnd])
 		c := chunks.NewChunkWithHash(hash.Hash(*rec.a), data)
 		foundChunks <- &c
 	}
@@ -360,19 +416,35 @@ func canReadAhead(fRec offsetRec, fLength uint32, readStart, readEnd, blockSize
 	return fRec.offset + uint64(fLength), true
 }
 
-// Fetches the byte stream of data logically encoded within the table starting at |pos|.
-func (tr tableReader) parseChunk(buff []byte) []byte {
+// Fetches the byte stream of data logically encoded within the table starting at |pos|, which is the chunk with address |h|.
+func (tr tableReader) parseChunk(h addr, buff []byte) []byte {
 	dataLen := uint64(len(buff)) - checksumSize
 
 	chksum := binary.BigEndian.Uint32(buff[dataLen:])
 	d.Chk.True(chksum == crc(buff[:dataLen]))
 
-	data, err := snappy.Decode(nil, buff[:dataLen])
+	data, err := tr.decodeChunk(h, buff[:dataLen])
 	d.Chk.NoError(err)
 
 	return data
 }
 
+func (tr tableReader) encoding() compression {
+	return tr.comp
+}
+
+// decodeChunk returns the chunk with address |h| that the Chunk Data
+// |encoded| holds, opening it first if the table is encrypted.
+func (tr tableReader) decodeChunk(h addr, encoded []byte) ([]byte, error) {
+	if tr.key != nil {
+		var err error
+		if encoded, err = tr.key.open(encoded, h[:]); err != nil {
+			return nil, err
+		}
+	}
+	return tr.comp.decode(encoded)
+}
+
 func (tr tableReader) calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool) {
 	var offsetRecords offsetRecSlice
 	// Pass #1: Build the set of table locations which must be read in order to find all the elements of |reqs| which are present in this table.
@@ -429,7 +501,7 @@ func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecor
 
 	sendChunk := func(i uint32) {
 		localOffset := tr.offsets[i] - tr.offsets[0]
-		chunks <- extractRecord{hashes[i], tr.parseChunk(buff[localOffset : localOffset+uint64(tr.lengths[i])])}
+		chunks <- extractRecord{hashes[i], tr.parseChunk(hashes[i], buff[localOffset:localOffset+uint64(tr.lengths[i])])}
 	}
 
 	if order == ReverseOrder {
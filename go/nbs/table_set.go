@@ -5,7 +5,6 @@
 package nbs
 
 import (
-	"sort"
 	"sync"
 
 	"github.com/attic-labs/noms/go/chunks"
@@ -14,16 +13,16 @@ import (
 
 const concurrentCompactions = 5
 
-func newS3TableSet(s3 s3svc, bucket string, indexCache *indexCache, readRl chan struct{}) tableSet {
+func newS3TableSet(s3 s3svc, bucket string, indexCache *indexCache, readRl chan struct{}, key *EncryptionKey) tableSet {
 	return tableSet{
-		p:  s3TablePersister{s3, bucket, defaultS3PartSize, indexCache, readRl},
+		p:  s3TablePersister{s3, bucket, defaultS3PartSize, indexCache, readRl, key},
 		rl: make(chan struct{}, concurrentCompactions),
 	}
 }
 
-func newFSTableSet(dir string, indexCache *indexCache) tableSet {
+func newFSTableSet(dir string, indexCache *indexCache, key *EncryptionKey) tableSet {
 	return tableSet{
-		p:  fsTablePersister{dir, indexCache},
+		p:  fsTablePersister{dir, indexCache, key},
 		rl: make(chan struct{}, concurrentCompactions),
 	}
 }
@@ -147,39 +146,6 @@ func (ts tableSet) Prepend(mt *memTable) tableSet {
 	return newTs
 }
 
-// Compact returns a new tableSet that's smaller than |ts|. It takes the
-// max(2, len(ts)/2) smallest upstream tables, compacts them into a single
-// large table, then returns a new tableSet with novel = ts.novel, and
-// upstream set to this new large table and the not-compacted members of
-// ts.upstream. The compactees are returned separately so that the caller can
-// close them if she so chooses.
-func (ts tableSet) Compact() (ns tableSet, compactees chunkSources) {
-	ns = tableSet{
-		novel: make(chunkSources, len(ts.novel)),
-		p:     ts.p,
-		rl:    ts.rl,
-	}
-	copy(ns.novel, ts.novel)
-
-	max := func(a, b int) int {
-		if a > b {
-			return a
-		}
-		return b
-	}
-
-	sortedUpstream := make(chunkSources, len(ts.upstream))
-	copy(sortedUpstream, ts.upstream)
-	sort.Sort(chunkSourcesByDescendingCount(sortedUpstream))
-
-	partition := len(sortedUpstream) - max(2, len(sortedUpstream)/2)
-	toCompact := sortedUpstream[partition:]
-	compacted := ts.p.CompactAll(toCompact)
-	ns.upstream = append(chunkSources{compacted}, sortedUpstream[:partition]...)
-
-	return ns, toCompact
-}
-
 func (ts tableSet) extract(order EnumerationOrder, chunks chan<- extractRecord) {
 	// Since new tables are _prepended_ to a tableSet, extracting chunks in ReverseOrder requires iterating ts.novel, then ts.upstream, from front to back, while doing insertOrder requires iterating ts.upstream back to front, followed by ts.novel.
 	if order == ReverseOrder {
@@ -243,20 +209,32 @@ func (ts tableSet) Rebase(specs []tableSpec) (merged tableSet, dropped chunkSour
 		}
 	}
 
-	// Open all the new upstream tables concurrently
+	// Open all the new upstream tables concurrently. A table that can't be opened, e.g. because it's encrypted with another key, panics on the caller's goroutine, once the others are closed.
 	openedTables := make(chunkSources, len(tablesToOpen))
+	failures := make([]interface{}, len(tablesToOpen))
 	wg := &sync.WaitGroup{}
 	i := 0
 	for _, spec := range tablesToOpen {
 		wg.Add(1)
 		go func(idx int, spec tableSpec) {
+			defer wg.Done()
+			defer func() { failures[idx] = recover() }()
 			openedTables[idx] = ts.p.Open(spec.name, spec.chunkCount)
-			wg.Done()
 		}(i, spec)
 		i++
 	}
 
 	wg.Wait()
+	for _, r := range failures {
+		if r != nil {
+			for _, t := range openedTables {
+				if t != nil {
+					t.close()
+				}
+			}
+			panic(r)
+		}
+	}
 	merged.upstream = append(merged.upstream, openedTables...)
 	return merged, dropped
 }
@@ -7,7 +7,6 @@ package nbs
 import (
 	"io/ioutil"
 	"os"
-	"sort"
 	"testing"
 
 	"github.com/attic-labs/testify/assert"
@@ -104,63 +103,6 @@ func TestTableSetExtract(t *testing.T) {
 	ts.Close()
 }
 
-func TestTableSetCompact(t *testing.T) {
-	assert := assert.New(t)
-	ts := newFakeTableSet()
-	defer ts.Close()
-	assert.Empty(ts.ToSpecs())
-
-	moreChunks := append(testChunks, []byte("booboo"))
-	for _, c := range moreChunks {
-		mt := newMemTable(testMemTableSize)
-		mt.addChunk(computeAddr(c), c)
-		ts = ts.Prepend(mt)
-	}
-
-	// Put in one larger table, to be sure that it's not selected for compaction
-	extraChunks := [][]byte{[]byte("fubu"), []byte("fubar")}
-	mt := newMemTable(testMemTableSize)
-	mt.addChunk(computeAddr(extraChunks[0]), extraChunks[0])
-	mt.addChunk(computeAddr(extraChunks[1]), extraChunks[1])
-	ts = ts.Prepend(mt)
-	ts = ts.Flatten()
-	bigTable := ts.upstream[0]
-	assert.Equal(5, ts.Size())
-
-	var compacted chunkSources
-	ts, compacted = ts.Compact() // Should compact len/2 smallest (7/2 == 3) tables into 1, leaving 4 tables
-	assert.NoError(compacted.close())
-
-	assert.Equal(4, ts.Size())
-	assert.Contains(ts.upstream, bigTable)
-	assertChunksInReader(moreChunks, ts, assert)
-	assertChunksInReader(extraChunks, ts, assert)
-
-	ts, compacted = ts.Compact() // Should compact len/2 smallest (4/2 == 2) tables into 1, leaving 3 tables
-	assert.NoError(compacted.close())
-
-	// After two waves of compaction on a set of tables of size 2, 1, 1, 1, 1 there should be 3 tables, each with 2 chunks in it.
-	assert.Equal(3, ts.Size())
-	for _, source := range ts.upstream {
-		assert.EqualValues(2, source.count())
-	}
-	assertChunksInReader(moreChunks, ts, assert)
-	assertChunksInReader(extraChunks, ts, assert)
-
-	ts, compacted = ts.Compact() // Should compact max(2, len/2) smallest (2 > 3/2 == 2) tables into 1
-	assert.NoError(compacted.close())
-	// After one last compaction there should be 2 tables, one of size 4 and one of size 2.
-	if assert.Equal(2, ts.Size()) {
-		sources := make(chunkSources, 2)
-		copy(sources, ts.upstream)
-		sort.Sort(chunkSourcesByDescendingCount(sources))
-		assert.EqualValues(4, sources[0].count())
-		assert.EqualValues(2, sources[1].count())
-		assertChunksInReader(moreChunks, ts, assert)
-		assertChunksInReader(extraChunks, ts, assert)
-	}
-}
-
 func makeTempDir(assert *assert.Assertions) string {
 	dir, err := ioutil.TempDir("", "")
 	assert.NoError(err)
@@ -180,12 +122,12 @@ func TestTableSetRebase(t *testing.T) {
 		}
 		return ts
 	}
-	fullTS := newFSTableSet(dir, nil)
+	fullTS := newFSTableSet(dir, nil, nil)
 	assert.Empty(fullTS.ToSpecs())
 	fullTS = insert(fullTS, testChunks...)
 	fullTS = fullTS.Flatten()
 
-	ts := newFSTableSet(dir, nil)
+	ts := newFSTableSet(dir, nil, nil)
 	ts = insert(ts, testChunks[0])
 	assert.Equal(1, ts.Size())
 	ts = ts.Flatten()
@@ -25,11 +25,11 @@ func buildTable(chunks [][]byte) ([]byte, addr) {
 	for _, chunk := range chunks {
 		totalData += uint64(len(chunk))
 	}
-	capacity := maxTableSize(uint64(len(chunks)), totalData)
+	capacity := maxTableSize(uint64(len(chunks)), totalData, compression{}, nil)
 
 	buff := make([]byte, capacity)
 
-	tw := newTableWriter(buff, nil)
+	tw := newTableWriter(buff, compression{}, nil, nil)
 
 	for _, chunk := range chunks {
 		tw.addChunk(computeAddr(chunk), chunk)
@@ -49,7 +49,7 @@ func TestSimple(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(chunks)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	assertChunksInReader(chunks, tr, assert)
 
@@ -92,7 +92,7 @@ func TestHasMany(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(chunks)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	addrs := addrSlice{computeAddr(chunks[0]), computeAddr(chunks[1]), computeAddr(chunks[2])}
 	hasAddrs := []hasRecord{
@@ -127,9 +127,9 @@ func TestHasManySequentialPrefix(t *testing.T) {
 	bogusData := []byte("bogus") // doesn't matter what this is. hasMany() won't check chunkRecords
 	totalData := uint64(len(bogusData) * len(addrs))
 
-	capacity := maxTableSize(uint64(len(addrs)), totalData)
+	capacity := maxTableSize(uint64(len(addrs)), totalData, compression{}, nil)
 	buff := make([]byte, capacity)
-	tw := newTableWriter(buff, nil)
+	tw := newTableWriter(buff, compression{}, nil, nil)
 
 	for _, a := range addrs {
 		tw.addChunk(a, bogusData)
@@ -138,7 +138,7 @@ func TestHasManySequentialPrefix(t *testing.T) {
 	length, _ := tw.finish()
 	buff = buff[:length]
 
-	tr := newTableReader(parseTableIndex(buff), bytes.NewReader(buff), fileBlockSize)
+	tr := newTableReader(parseTableIndex(buff, nil), bytes.NewReader(buff), fileBlockSize, nil)
 
 	hasAddrs := make([]hasRecord, 2)
 	// Leave out the first address
@@ -162,7 +162,7 @@ func TestGetMany(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(data)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	addrs := addrSlice{computeAddr(data[0]), computeAddr(data[1]), computeAddr(data[2])}
 	getBatch := []getRecord{
@@ -197,7 +197,7 @@ func TestCalcReads(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(chunks)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), 0)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), 0, nil)
 	addrs := addrSlice{computeAddr(chunks[0]), computeAddr(chunks[1]), computeAddr(chunks[2])}
 	getBatch := []getRecord{
 		{&addrs[0], binary.BigEndian.Uint64(addrs[0][:addrPrefixSize]), false},
@@ -228,7 +228,7 @@ func TestExtract(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(chunks)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	addrs := addrSlice{computeAddr(chunks[0]), computeAddr(chunks[1]), computeAddr(chunks[2])}
 
@@ -268,7 +268,7 @@ func Test65k(t *testing.T) {
 	}
 
 	tableData, _ := buildTable(chunks)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	for i := 0; i < count; i++ {
 		data := dataFn(i)
@@ -313,7 +313,7 @@ func doTestNGetMany(t *testing.T, count int) {
 	}
 
 	tableData, _ := buildTable(data)
-	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	tr := newTableReader(parseTableIndex(tableData, nil), bytes.NewReader(tableData), fileBlockSize, nil)
 
 	getBatch := make([]getRecord, len(data))
 	for i := 0; i < count; i++ {
@@ -354,7 +354,7 @@ func TestEmpty(t *testing.T) {
 	assert := assert.New(t)
 
 	buff := make([]byte, footerSize)
-	tw := newTableWriter(buff, nil)
+	tw := newTableWriter(buff, compression{}, nil, nil)
 	length, _ := tw.finish()
 	assert.Equal(length, footerSize)
 
@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash"
+	"io"
 	"sort"
 
 	"github.com/attic-labs/noms/go/d"
@@ -22,11 +23,14 @@ type tableWriter struct {
 	totalUncompressedData uint64
 	prefixes              prefixIndexSlice // TODO: This is in danger of exploding memory
 	blockHash             hash.Hash
+	comp                  compression
+	key                   *EncryptionKey // nil unless the table is to be encrypted
 
-	snapper snappyEncoder
+	snapper chunkEncoder
 }
 
-type snappyEncoder interface {
+// chunkEncoder compresses |src|, into |dst| if it's big enough.
+type chunkEncoder interface {
 	Encode(dst, src []byte) []byte
 }
 
@@ -36,26 +40,39 @@ func (r realSnappyEncoder) Encode(dst, src []byte) []byte {
 	return snappy.Encode(dst, src)
 }
 
-func maxTableSize(numChunks, totalData uint64) uint64 {
+func maxTableSize(numChunks, totalData uint64, comp compression, key *EncryptionKey) uint64 {
 	avgChunkSize := totalData / numChunks
 	d.Chk.True(avgChunkSize < maxChunkSize)
-	maxSnappySize := snappy.MaxEncodedLen(int(avgChunkSize))
-	d.Chk.True(maxSnappySize > 0)
-	return numChunks*(prefixTupleSize+lengthSize+addrSuffixSize+checksumSize+uint64(maxSnappySize)) + footerSize
+	maxEncodedSize := comp.maxEncodedLen(avgChunkSize)
+	d.Chk.True(maxEncodedSize > 0)
+	tailSize := bloomFilterSize(uint32(numChunks)) + maxFooterSize
+	if key != nil {
+		maxEncodedSize += sealOverhead
+		tailSize += sealOverhead
+	}
+	return numChunks*(prefixTupleSize+lengthSize+addrSuffixSize+checksumSize+maxEncodedSize) + tailSize
 }
 
 func indexSize(numChunks uint32) uint64 {
 	return uint64(numChunks) * (addrSuffixSize + lengthSize + prefixTupleSize)
 }
 
-// len(buff) must be >= maxTableSize(numChunks, totalData)
-func newTableWriter(buff []byte, snapper snappyEncoder) *tableWriter {
+// maxTableTailSize returns the most space that the bloom filter, index and
+// footer of a table of |numChunks| chunks can take, however it's written.
+func maxTableTailSize(numChunks uint32) uint64 {
+	return bloomFilterSize(numChunks) + indexSize(numChunks) + sealOverhead + maxFooterSize
+}
+
+// len(buff) must be >= maxTableSize(numChunks, totalData, comp, key). Chunks are encoded as |comp| says, by |snapper| if it's not nil, and the table is encrypted with |key| if it's not nil.
+func newTableWriter(buff []byte, comp compression, key *EncryptionKey, snapper chunkEncoder) *tableWriter {
 	if snapper == nil {
-		snapper = realSnappyEncoder{}
+		snapper = comp.encoder()
 	}
 	return &tableWriter{
 		buff:      buff,
 		blockHash: sha512.New(),
+		comp:      comp,
+		key:       key,
 		snapper:   snapper,
 	}
 }
@@ -65,16 +82,26 @@ func (tw *tableWriter) addChunk(h addr, data []byte) bool {
 		panic("NBS blocks cannont be zero length")
 	}
 
-	// Compress data straight into tw.buff
+	// Compress data straight into tw.buff, leaving room for a nonce before it if it's to be sealed
+	recordStart := tw.pos
+	if tw.key != nil {
+		tw.pos += nonceSize
+	}
 	compressed := tw.snapper.Encode(tw.buff[tw.pos:], data)
 	dataLength := uint64(len(compressed))
 
 	// BUG 3156 indicated that, sometimes, snappy decided that there's not enough space in tw.buff[tw.pos:] to encode into.
-	// This _should never happen anymore be_, because we iterate over all chunks to be added and sum the max amount of space that snappy says it might need.
-	// Since we know that |data| can't be 0-length, we also know that the compressed version of |data| has length greater than zero. The first element in a snappy-encoded blob is a Uvarint indicating how much data is present. Therefore, if there's a Uvarint-encoded 0 at tw.buff[tw.pos:], we know that snappy did not write anything there and we have a problem.
-	if v, n := binary.Uvarint(tw.buff[tw.pos:]); v == 0 {
-		d.Chk.True(n != 0)
-		panic(fmt.Errorf("BUG 3156: unbuffered chunk %s: uncompressed %d, compressed %d, snappy max %d, tw.buff %d\n", h.String(), len(data), dataLength, snappy.MaxEncodedLen(len(data)), len(tw.buff[tw.pos:])))
+	// This _should never happen anymore be_, because we iterate over all chunks to be added and sum the max amount of space that any codec says it might need.
+	// Since we know that |data| can't be 0-length, we also know that the compressed version of |data| has length greater than zero. Every codec encodes into tw.buff[tw.pos:] when there's room, and allocates a new slice when there isn't, so if |compressed| doesn't start at tw.buff[tw.pos], the codec did not write there and we have a problem.
+	if dataLength == 0 || &compressed[0] != &tw.buff[tw.pos] {
+		panic(fmt.Errorf("BUG 3156: unbuffered chunk %s: uncompressed %d, compressed %d, %s max %d, tw.buff %d\n", h.String(), len(data), dataLength, tw.comp.codec, tw.comp.maxEncodedLen(uint64(len(data))), len(tw.buff[tw.pos:])))
+	}
+
+	if tw.key != nil {
+		// Encrypt in place, after the nonce
+		compressed = tw.key.seal(tw.buff[recordStart:recordStart], compressed, h[:])
+		dataLength = uint64(len(compressed))
+		tw.pos = recordStart
 	}
 
 	tw.pos += dataLength
@@ -96,8 +123,22 @@ func (tw *tableWriter) addChunk(h addr, data []byte) bool {
 }
 
 func (tw *tableWriter) finish() (uncompressedLength uint64, blockAddr addr) {
-	tw.writeIndex()
-	tw.writeFooter()
+	if tw.key == nil {
+		tw.writeBloomFilter()
+		tw.writeIndex()
+		tw.writeFooter()
+	} else {
+		// The bloom filter and index are written after room for a nonce, and then sealed in place, with the footer as additional data. The tag goes between them and the footer.
+		sealedStart := tw.pos
+		tw.pos += nonceSize
+		tw.writeBloomFilter()
+		tw.writeIndex()
+		plaintext := tw.buff[sealedStart+nonceSize : tw.pos]
+		tw.pos += tagSize
+		footerStart := tw.pos
+		tw.writeFooter()
+		tw.key.seal(tw.buff[sealedStart:sealedStart], plaintext, tw.buff[footerStart:tw.pos])
+	}
 	uncompressedLength = tw.pos
 
 	var h []byte
@@ -118,6 +159,20 @@ func (hs prefixIndexSlice) Len() int           { return len(hs) }
 func (hs prefixIndexSlice) Less(i, j int) bool { return hs[i].prefix < hs[j].prefix }
 func (hs prefixIndexSlice) Swap(i, j int)      { hs[i], hs[j] = hs[j], hs[i] }
 
+func (tw *tableWriter) writeBloomFilter() {
+	if len(tw.prefixes) == 0 {
+		return
+	}
+	bf := newBloomFilter(uint32(len(tw.prefixes)))
+	var h addr
+	for _, pi := range tw.prefixes {
+		binary.BigEndian.PutUint64(h[:], pi.prefix)
+		copy(h[addrPrefixSize:], pi.suffix)
+		bf.add(h)
+	}
+	tw.pos += bf.write(tw.buff[tw.pos:])
+}
+
 func (tw *tableWriter) writeIndex() {
 	sort.Sort(tw.prefixes)
 
@@ -153,6 +208,18 @@ func (tw *tableWriter) writeIndex() {
 }
 
 func (tw *tableWriter) writeFooter() {
+	// Unencrypted snappy tables keep the original footer, so that they can still be read by versions of NBS that predate codecs.
+	if tw.key != nil || tw.comp != (compression{}) {
+		tw.buff[tw.pos] = byte(tw.comp.codec)
+		tw.pos += codecSize
+		binary.BigEndian.PutUint32(tw.buff[tw.pos:], tw.comp.dictID)
+		tw.pos += uint32Size
+	}
+	if tw.key != nil {
+		binary.BigEndian.PutUint32(tw.buff[tw.pos:], tw.key.ID())
+		tw.pos += uint32Size
+	}
+
 	// chunk count
 	chunkCount := uint32(len(tw.prefixes))
 	binary.BigEndian.PutUint32(tw.buff[tw.pos:], chunkCount)
@@ -163,6 +230,69 @@ func (tw *tableWriter) writeFooter() {
 	tw.pos += uint64Size
 
 	// magic number
-	copy(tw.buff[tw.pos:], magicNumber)
+	switch {
+	case tw.key != nil:
+		copy(tw.buff[tw.pos:], encryptedMagicNumber)
+	case tw.comp != (compression{}):
+		copy(tw.buff[tw.pos:], codecMagicNumber)
+	default:
+		copy(tw.buff[tw.pos:], magicNumber)
+	}
 	tw.pos += magicNumberSize
 }
+
+// streamingTableWriter is like tableWriter, but writes each chunk to |w| as
+// it is added, rather than into a buffer big enough for the whole table. Only
+// the index and bloom filter are held in memory until finish() is called. NOT
+// goroutine safe.
+type streamingTableWriter struct {
+	w       io.Writer
+	tw      *tableWriter // builds the index
+	scratch []byte
+	sealed  []byte
+	pos     uint64
+}
+
+func newStreamingTableWriter(w io.Writer, comp compression, key *EncryptionKey) *streamingTableWriter {
+	return &streamingTableWriter{w: w, tw: newTableWriter(nil, comp, key, nil)}
+}
+
+func (stw *streamingTableWriter) addChunk(h addr, data []byte) {
+	if len(data) == 0 {
+		panic("NBS blocks cannont be zero length")
+	}
+	compressed := stw.tw.snapper.Encode(stw.scratch[:cap(stw.scratch)], data)
+	stw.scratch = compressed
+	if stw.tw.key != nil {
+		stw.sealed = stw.tw.key.seal(stw.sealed[:0], compressed, h[:])
+		compressed = stw.sealed
+	}
+	checksum := [checksumSize]byte{}
+	binary.BigEndian.PutUint32(checksum[:], crc(compressed))
+	stw.write(compressed)
+	stw.write(checksum[:])
+
+	stw.tw.totalUncompressedData += uint64(len(data))
+	stw.tw.prefixes = append(stw.tw.prefixes, prefixIndexRec{
+		h.Prefix(),
+		h[addrPrefixSize:],
+		uint32(len(stw.tw.prefixes)),
+		uint32(checksumSize + uint64(len(compressed))),
+	})
+}
+
+func (stw *streamingTableWriter) write(p []byte) {
+	_, err := stw.w.Write(p)
+	d.PanicIfError(err)
+	stw.pos += uint64(len(p))
+}
+
+// finish writes the bloom filter, index and footer, and returns the length
+// and name of the table.
+func (stw *streamingTableWriter) finish() (length uint64, blockAddr addr) {
+	numChunks := uint32(len(stw.tw.prefixes))
+	stw.tw.buff = make([]byte, maxTableTailSize(numChunks))
+	indexLength, blockAddr := stw.tw.finish()
+	stw.write(stw.tw.buff[:indexLength])
+	return stw.pos, blockAddr
+}
@@ -14,7 +14,7 @@ import (
 	"github.com/attic-labs/noms/go/types"
 )
 
-var datasetCapturePrefixRe = regexp.MustCompile("^(" + datas.DatasetRe.String() + ")")
+var datasetCapturePrefixRe = regexp.MustCompile("^(" + datas.TagIDRe.String() + "|" + datas.MergeStateIDRe.String() + "|" + datas.DatasetRe.String() + ")")
 
 // AbsolutePath represents a path originating at a dataset or a well-formed
 // hash (i.e. '#' + 32 chars) representing a Noms Value that is independently
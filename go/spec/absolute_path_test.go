@@ -28,6 +28,8 @@ func TestAbsolutePathToAndFromString(t *testing.T) {
 	h := types.Number(42).Hash() // arbitrary hash
 	test(fmt.Sprintf("foo.bar[#%s]", h.String()))
 	test(fmt.Sprintf("#%s.bar[42]", h.String()))
+	test("tag:v1.2.value[0]")
+	test("merge-state:foo.value.conflicts")
 }
 
 func TestAbsolutePaths(t *testing.T) {
@@ -48,6 +50,8 @@ func TestAbsolutePaths(t *testing.T) {
 	ds, err = db.CommitValue(ds, list)
 	assert.NoError(err)
 	head := ds.Head()
+	_, err = db.Tag("v1.2", ds.HeadRef())
+	assert.NoError(err)
 
 	resolvesTo := func(exp types.Value, str string) {
 		p, err := NewAbsolutePath(str)
@@ -65,6 +69,9 @@ func TestAbsolutePaths(t *testing.T) {
 	resolvesTo(list, "ds.value")
 	resolvesTo(s0, "ds.value[0]")
 	resolvesTo(s1, "ds.value[1]")
+	resolvesTo(head, "tag:v1.2")
+	resolvesTo(list, "tag:v1.2.value")
+	resolvesTo(s1, "tag:v1.2.value[1]")
 	resolvesTo(head, "#"+head.Hash().String())
 	resolvesTo(list, "#"+list.Hash().String())
 	resolvesTo(s0, "#"+s0.Hash().String())
@@ -76,6 +83,7 @@ func TestAbsolutePaths(t *testing.T) {
 	resolvesTo(nil, "foo.parents")
 	resolvesTo(nil, "foo.value")
 	resolvesTo(nil, "foo.value[0]")
+	resolvesTo(nil, "tag:v1.3.value")
 	resolvesTo(nil, "#"+types.String("baz").Hash().String())
 	resolvesTo(nil, "#"+types.String("baz").Hash().String()+"[0]")
 }
@@ -7,12 +7,13 @@
 package spec
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/url"
-	"regexp"
 	"strings"
 
 	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/nbs"
@@ -26,7 +27,6 @@ const (
 )
 
 var (
-	datasetRe = regexp.MustCompile("^" + datas.DatasetRe.String() + "$")
 	ldbStores = map[string]*refCountingLdbStore{}
 )
 
@@ -35,6 +35,15 @@ type SpecOptions struct {
 	// Authorization token for requests. For example, if the database is HTTP
 	// this will used for an `Authorization: Bearer ${authorization}` header.
 	Authorization string
+
+	// TLSConfig, if not nil, is used for https connections to the database,
+	// e.g. to trust a private CA, or to present a client certificate.
+	TLSConfig *tls.Config
+
+	// EncryptionKey, if not nil, is used to encrypt nbs and aws databases at
+	// rest. Data written without it can't be read, unless the key came from
+	// EncryptionKey.ReadingUnencrypted(), as when migrating a database.
+	EncryptionKey *nbs.EncryptionKey
 }
 
 // Spec describes a Database, Dataset, or a path to a Value. They should be
@@ -49,6 +58,8 @@ type Spec struct {
 
 	// DatabaseName is the name of the Spec's database, which is the string after
 	// "protocol:". http/https specs include their leading "//" characters.
+	// A server that serves many databases serves each of them under
+	// /db/<name>, e.g. http://localhost:8000/db/photos.
 	DatabaseName string
 
 	// Options are the SpecOptions that the Spec was constructed with.
@@ -101,8 +112,8 @@ func ForDatasetOpts(spec string, opts SpecOptions) (Spec, error) {
 		return Spec{}, err
 	}
 
-	if !datasetRe.MatchString(dsName) {
-		return Spec{}, fmt.Errorf("Dataset %s must match %s", dsName, datasetRe.String())
+	if !datas.IsValidDatasetName(dsName) {
+		return Spec{}, fmt.Errorf("Dataset %s must match %s", dsName, datas.DatasetFullRe.String())
 	}
 
 	sp, err := newSpec(spec, dbSpec, opts)
@@ -159,9 +170,9 @@ func (sp Spec) NewChunkStore() chunks.ChunkStore {
 	case "http", "https":
 		return nil
 	case "aws":
-		return parseAWSSpec(sp.Href())
+		return parseAWSSpec(sp.Href(), sp.Options.EncryptionKey)
 	case "nbs":
-		return nbs.NewLocalStore(sp.DatabaseName, 1<<28)
+		return nbs.NewEncryptedLocalStore(sp.DatabaseName, 1<<28, sp.Options.EncryptionKey)
 	case "ldb":
 		return getLdbStore(sp.DatabaseName)
 	case "mem":
@@ -170,14 +181,44 @@ func (sp Spec) NewChunkStore() chunks.ChunkStore {
 	panic("unreachable")
 }
 
-func parseAWSSpec(awsURL string) chunks.ChunkStore {
+func parseAWSSpec(awsURL string, key *nbs.EncryptionKey) chunks.ChunkStore {
+	table, bucket, ns, sess := awsSpecParts(awsURL)
+	if bucket == "" {
+		if key != nil {
+			d.Panic("Only aws databases with a bucket can be encrypted")
+		}
+		return chunks.NewDynamoStore(table, ns, sess, false)
+	}
+	return nbs.NewEncryptedAWSStore(table, ns, bucket, sess, 1<<28, key)
+}
+
+// awsSpecParts splits an aws: URL into a DynamoDB table, an optional S3
+// bucket, and the namespace of a database within them, and makes a session
+// with which to reach them.
+func awsSpecParts(awsURL string) (table, bucket, ns string, sess *session.Session) {
 	u, _ := url.Parse(awsURL)
 	parts := strings.SplitN(u.Host, ":", 2) // [table] [, bucket]?
-	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
-	if len(parts) == 1 {
-		return chunks.NewDynamoStore(parts[0], u.Path, sess, false)
+	table, ns = parts[0], u.Path
+	if len(parts) == 2 {
+		bucket = parts[1]
+	}
+	sess = session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
+	return
+}
+
+// NewStoreChecker returns an nbs.StoreChecker for the NBS store that this
+// Spec's DatabaseName describes, or nil if it isn't one. Unlike
+// NewChunkStore, it works even if the store's tables are damaged.
+func (sp Spec) NewStoreChecker() *nbs.StoreChecker {
+	switch sp.Protocol {
+	case "nbs":
+		return nbs.NewLocalStoreChecker(sp.DatabaseName, sp.Options.EncryptionKey)
+	case "aws":
+		if table, bucket, ns, sess := awsSpecParts(sp.Href()); bucket != "" {
+			return nbs.NewAWSStoreChecker(table, ns, bucket, sess, sp.Options.EncryptionKey)
+		}
 	}
-	return nbs.NewAWSStore(parts[0], u.Path, parts[1], sess, 1<<28)
+	return nil
 }
 
 // GetDataset returns the current Dataset instance for this Spec's Database.
@@ -261,13 +302,13 @@ func (sp Spec) Close() error {
 func (sp Spec) createDatabase() datas.Database {
 	switch sp.Protocol {
 	case "http", "https":
-		return datas.NewRemoteDatabase(sp.Href(), sp.Options.Authorization)
+		return datas.NewRemoteDatabaseTLS(sp.Href(), sp.Options.Authorization, sp.Options.TLSConfig)
 	case "aws":
-		return datas.NewDatabase(parseAWSSpec(sp.Href()))
+		return datas.NewDatabase(parseAWSSpec(sp.Href(), sp.Options.EncryptionKey))
 	case "ldb":
 		return datas.NewDatabase(getLdbStore(sp.DatabaseName))
 	case "nbs":
-		return datas.NewDatabase(nbs.NewLocalStore(sp.DatabaseName, 1<<28))
+		return datas.NewDatabase(nbs.NewEncryptedLocalStore(sp.DatabaseName, 1<<28, sp.Options.EncryptionKey))
 	case "mem":
 		return datas.NewDatabase(chunks.NewMemoryStore())
 	}
@@ -306,6 +347,8 @@ func parseDatabaseSpec(spec string) (protocol, name string, err error) {
 			err = fmt.Errorf("%s has empty host", spec)
 		} else if parts[0] == "aws" && u.Path == "" {
 			err = fmt.Errorf("%s does not specify a database ID", spec)
+		} else if parts[0] != "aws" && !isDatabasePath(u.Path) {
+			err = fmt.Errorf("%s must name a database as %s<name>, where name matches %s", spec, constants.DatabasesPath, datas.DatabaseNameRe)
 		} else {
 			protocol, name = parts[0], parts[1]
 		}
@@ -319,6 +362,16 @@ func parseDatabaseSpec(spec string) (protocol, name string, err error) {
 	return
 }
 
+// isDatabasePath returns false if |path| is under the prefix that a server
+// serving many databases serves them under, but isn't the path of one of
+// them, e.g. /db/foo/bar.
+func isDatabasePath(path string) bool {
+	if !strings.HasPrefix(path, constants.DatabasesPath) {
+		return true
+	}
+	return datas.DatabaseNameRe.MatchString(strings.TrimSuffix(strings.TrimPrefix(path, constants.DatabasesPath), "/"))
+}
+
 func splitDatabaseSpec(spec string) (string, string, error) {
 	lastIdx := strings.LastIndex(spec, Separator)
 	if lastIdx == -1 {
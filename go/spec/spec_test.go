@@ -208,6 +208,9 @@ func TestForDatabase(t *testing.T) {
 		"aws://t:b",
 		"aws://t",
 		"aws://t:",
+		"http://localhost:8000/db/",
+		"http://localhost:8000/db/a/b",
+		"http://localhost:8000/db/a.b",
 	}
 
 	for _, spec := range badSpecs {
@@ -225,6 +228,8 @@ func TestForDatabase(t *testing.T) {
 		{"http://localhost:8000", "http", "//localhost:8000"},
 		{"http://localhost:8000/fff", "http", "//localhost:8000/fff"},
 		{"https://local.attic.io/john/doe", "https", "//local.attic.io/john/doe"},
+		{"http://localhost:8000/db/photos", "http", "//localhost:8000/db/photos"},
+		{"http://localhost:8000/db/photos/", "http", "//localhost:8000/db/photos/"},
 		{"mem", "mem", ""},
 		{tmpDir, "ldb", tmpDir},
 		{"ldb:" + tmpDir, "ldb", tmpDir},
@@ -279,13 +284,15 @@ func TestForDataset(t *testing.T) {
 		assert.Error(err, spec)
 	}
 
-	invalidDatasetNames := []string{" ", "", "$", "#", ":", "\n", "💩"}
+	invalidDatasetNames := []string{" ", "", "$", "#", ":", "\n", "💩", "tag:", "tag:v1.x", "merge-state:"}
 	for _, s := range invalidDatasetNames {
 		_, err := ForDataset("mem::" + s)
 		assert.Error(err)
 	}
+	_, err := ForDataset("mem::foo:bar")
+	assert.EqualError(err, "Dataset foo:bar must match "+datas.DatasetFullRe.String())
 
-	validDatasetNames := []string{"a", "Z", "0", "/", "-", "_"}
+	validDatasetNames := []string{"a", "Z", "0", "/", "-", "_", "tag:v1.2", "merge-state:a"}
 	for _, s := range validDatasetNames {
 		_, err := ForDataset("mem::" + s)
 		assert.NoError(err)
@@ -56,6 +56,42 @@ func (b Blob) Splice(idx uint64, deleteCount uint64, data []byte) Blob {
 	return newBlob(ch.Done())
 }
 
+// DEFAULT_MAX_BLOB_SPLICE_MATRIX_SIZE is smaller than its List counterpart
+// because Blob diffs compare individual bytes. Changed regions bigger than
+// this are reported as replaced wholesale.
+const DEFAULT_MAX_BLOB_SPLICE_MATRIX_SIZE = 1e6
+
+// Diff streams the diff from last to the current Blob to the changes channel,
+// as Splices whose indices are byte offsets. Subtrees of the two Blobs that
+// have the same hash are skipped without being read, so the cost of a diff
+// is proportional to the size of the chunks that changed rather than to the
+// size of the Blobs. Caller can close closeChan to cancel the diff operation.
+func (b Blob) Diff(last Blob, changes chan<- Splice, closeChan <-chan struct{}) {
+	b.DiffWithLimit(last, changes, closeChan, DEFAULT_MAX_BLOB_SPLICE_MATRIX_SIZE)
+}
+
+// DiffWithLimit is like Diff, but lets the caller choose how big an edit
+// distance matrix to compute when comparing the bytes of changed chunks,
+// rather than just reporting that the chunks were replaced.
+func (b Blob) DiffWithLimit(last Blob, changes chan<- Splice, closeChan <-chan struct{}, maxSpliceMatrixSize uint64) {
+	if b.Equals(last) {
+		return
+	}
+	bLen, lastLen := b.Len(), last.Len()
+	if bLen == 0 {
+		changes <- Splice{0, lastLen, 0, 0} // everything removed
+		return
+	}
+	if lastLen == 0 {
+		changes <- Splice{0, 0, bLen, 0} // everything added
+		return
+	}
+
+	lastCur := newCursorAtIndex(last.seq, 0, false)
+	bCur := newCursorAtIndex(b.seq, 0, false)
+	indexedSequenceDiff(last.seq, lastCur.depth(), 0, b.seq, bCur.depth(), 0, changes, closeChan, maxSpliceMatrixSize)
+}
+
 // Concat returns a new Blob comprised of this joined with other. It only needs
 // to visit the rightmost prolly tree chunks of this Blob, and the leftmost
 // prolly tree chunks of other, so it's efficient.
@@ -235,6 +235,52 @@ func TestBlobSplice(t *testing.T) {
 	assert.Equal(buf.String(), "Yes, it's hard to satisfy arv")
 }
 
+func TestBlobDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	smallTestChunks()
+	defer normalProductionChunks()
+
+	vs := NewTestValueStore()
+	r := rand.New(rand.NewSource(0))
+	last := NewBlob(&io.LimitedReader{R: r, N: 1e5})
+	last = vs.ReadValue(vs.WriteValue(last).TargetHash()).(Blob)
+
+	current := last.Splice(1000, 10, []byte("hello")).Splice(50000, 0, []byte("world")).Splice(90000, 100, nil)
+
+	changes := make(chan Splice)
+	go func() {
+		current.Diff(last, changes, nil)
+		close(changes)
+	}()
+
+	// Applying the splices, last to first, to |last| must reproduce |current|.
+	splices := []Splice{}
+	changed := uint64(0)
+	for sp := range changes {
+		splices = append(splices, sp)
+		changed += sp.SpRemoved + sp.SpAdded
+	}
+	assert.True(len(splices) >= 3)
+	assert.True(changed < last.Len()/10, "%d bytes changed", changed)
+
+	patched := last
+	for i := len(splices) - 1; i >= 0; i-- {
+		sp := splices[i]
+		data := make([]byte, sp.SpAdded)
+		reader := current.Reader()
+		reader.Seek(int64(sp.SpFrom), 0)
+		_, err := io.ReadFull(reader, data)
+		assert.NoError(err)
+		patched = patched.Splice(sp.SpAt, sp.SpRemoved, data)
+	}
+	assert.True(current.Equals(patched))
+
+	changes = make(chan Splice, 1)
+	NewEmptyBlob().Diff(last, changes, nil)
+	assert.Equal(Splice{0, last.Len(), 0, 0}, <-changes)
+}
+
 func TestBlobConcat(t *testing.T) {
 	assert := assert.New(t)
 
@@ -97,7 +97,7 @@ func calcSplices(previousLength uint64, currentLength uint64, maxSpliceMatrixSiz
 	currentLength = currentEnd - currentStart
 
 	if previousLength*currentLength > maxSpliceMatrixSize {
-		return []Splice{{0, previousLength, currentLength, 0}}
+		return []Splice{{previousStart, previousLength, currentLength, currentStart}}
 	}
 
 	splices := make([]Splice, 0)
@@ -200,3 +200,14 @@ func TestEditDistanceReverse(t *testing.T) {
 		},
 	)
 }
+
+func TestEditDistanceMatrixTooBig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	last := []uint64{0, 1, 2, 3, 4, 5}
+	current := []uint64{0, 1, 9, 8, 7, 6, 5}
+	actual := calcSplices(uint64(len(last)), uint64(len(current)), 1,
+		func(i uint64, j uint64) bool { return last[i] == current[j] })
+	// The shared prefix and suffix are still trimmed off the single splice.
+	assert.Equal([]Splice{{2, 3, 4, 2}}, actual)
+}
@@ -103,10 +103,12 @@ func (w *hrsWriter) Write(v Value) {
 		w.write(strconv.Quote(string(v.(String))))
 
 	case BlobKind:
-		w.maybeWriteIndentation()
+		// Blobs are always tagged, since untagged hex bytes would read back as Numbers.
+		w.write("Blob(")
 		blob := v.(Blob)
 		encoder := &hexWriter{hrs: w, size: blob.Len()}
 		_, w.err = io.Copy(encoder, blob.Reader())
+		w.write(")")
 
 	case ListKind:
 		w.write("[")
@@ -202,9 +204,9 @@ func (w *hrsWriter) writeStruct(v Struct, printStructName bool) {
 func (w *hrsWriter) WriteTagged(v Value) {
 	t := v.Type()
 	switch t.Kind() {
-	case BoolKind, NumberKind, StringKind:
+	case BlobKind, BoolKind, NumberKind, StringKind:
 		w.Write(v)
-	case BlobKind, ListKind, MapKind, RefKind, SetKind, TypeKind, CycleKind:
+	case ListKind, MapKind, RefKind, SetKind, TypeKind, CycleKind:
 		w.writeType(t, nil)
 		w.write("(")
 		w.Write(v)
@@ -154,6 +154,7 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 	metaItems := []metaTuple{}
 	mapItems := []mapEntry{}
 	valueItems := []Value{}
+	blobItems := []byte{}
 
 	childIsMeta := false
 	isIndexedSequence := false
@@ -174,6 +175,8 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 			valueItems = append(valueItems, t.data...)
 		case listLeafSequence:
 			valueItems = append(valueItems, t.values...)
+		case blobLeafSequence:
+			blobItems = append(blobItems, t.data...)
 		default:
 			panic("unreachable")
 		}
@@ -183,6 +186,10 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 		return newMetaSequence(metaItems, ms.Type(), ms.vr)
 	}
 
+	if BlobKind == ms.Type().Kind() {
+		return newBlobLeafSequence(ms.vr, blobItems)
+	}
+
 	if isIndexedSequence {
 		return newListLeafSequence(ms.vr, valueItems...)
 	}
@@ -0,0 +1,488 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// ParseHumanReadable parses a Value written in the human-readable encoding
+// produced by EncodedValue() and EncodedValueWithTags(), which is what noms
+// show prints. The target of any Ref is read from vrw.
+//
+// The untagged encoding is ambiguous in a few places, which are resolved as
+// follows:
+//   - `{}` is an empty Map. A `{...}` that starts with a field name and a
+//     `:` is a Struct with no name. Otherwise, it's a Map if it holds
+//     `key: value` pairs, and a Set if not.
+//   - A word that is a valid hash is a Ref, rather than a field or struct name.
+//
+// A Blob is always tagged, e.g. `Blob(00 01 02)`, as the encoder writes it.
+//
+// Prefixing any value with its type, as EncodedValueWithTags() does, settles
+// what kind of value it is, e.g. `Set<Number>({})`. Types are parsed in the
+// form written by Type.Describe(), and comments starting with `//` are
+// skipped.
+func ParseHumanReadable(vrw ValueReadWriter, s string) (v Value, err error) {
+	p := &hrsParser{s: s, vrw: vrw}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(hrsParseError)
+			if !ok {
+				panic(r)
+			}
+			v, err = nil, pe
+		}
+	}()
+	v = p.parseValue()
+	if p.skipSpace(); p.pos < len(p.s) {
+		p.fail("end of input")
+	}
+	return
+}
+
+type hrsParseError struct {
+	line, col int
+	msg       string
+}
+
+func (e hrsParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.line, e.col, e.msg)
+}
+
+// hrsParser is a recursive descent parser for the human-readable encoding.
+// It reports errors by panicking with an hrsParseError, which
+// ParseHumanReadable() recovers from.
+type hrsParser struct {
+	s   string
+	pos int
+	vrw ValueReadWriter
+}
+
+var hrsKeywords = map[string]bool{
+	"Blob": true, "Bool": true, "Number": true, "String": true, "Type": true, "Value": true,
+	"List": true, "Map": true, "Ref": true, "Set": true, "struct": true, "Cycle": true,
+}
+
+func (p *hrsParser) errorf(format string, args ...interface{}) {
+	consumed := p.s[:p.pos]
+	line := strings.Count(consumed, "\n") + 1
+	col := p.pos - strings.LastIndex(consumed, "\n")
+	panic(hrsParseError{line, col, fmt.Sprintf(format, args...)})
+}
+
+// fail reports that the parser expected one thing, and found another.
+func (p *hrsParser) fail(expected string) {
+	found := "end of input"
+	if p.pos < len(p.s) {
+		found = strconv.Quote(p.peekToken())
+	}
+	p.errorf("expected %s, found %s", expected, found)
+}
+
+func (p *hrsParser) skipSpace() {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			if nl := strings.IndexByte(p.s[p.pos:], '\n'); nl >= 0 {
+				p.pos += nl + 1
+			} else {
+				p.pos = len(p.s)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '+' || c == '-'
+}
+
+// peekToken returns the next word, or punctuation character, without consuming it.
+func (p *hrsParser) peekToken() string {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.s) && isWordByte(p.s[end]) {
+		end++
+	}
+	if end == p.pos && end < len(p.s) {
+		end++
+	}
+	return p.s[p.pos:end]
+}
+
+func (p *hrsParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// accept consumes the punctuation character c, if it's next.
+func (p *hrsParser) accept(c byte) bool {
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *hrsParser) expect(c byte) {
+	if !p.accept(c) {
+		p.fail(strconv.Quote(string(c)))
+	}
+}
+
+func (p *hrsParser) word() string {
+	w := p.peekToken()
+	if w == "" || !isWordByte(w[0]) {
+		p.fail("a word")
+	}
+	p.pos += len(w)
+	return w
+}
+
+func isIdent(w string) bool {
+	if w == "" || !(w[0] >= 'a' && w[0] <= 'z' || w[0] >= 'A' && w[0] <= 'Z') {
+		return false
+	}
+	for i := 1; i < len(w); i++ {
+		if c := w[i]; c == '.' || c == '+' || c == '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isFieldName reports whether w, if followed by a `:`, is a struct field.
+func isFieldName(w string) bool {
+	if _, ok := hash.MaybeParse(w); ok {
+		return false
+	}
+	return isIdent(w) && !hrsKeywords[w] && w != "true" && w != "false"
+}
+
+func (p *hrsParser) ident() string {
+	start := p.pos
+	w := p.word()
+	if !isIdent(w) {
+		p.pos = start
+		p.fail("a name")
+	}
+	return w
+}
+
+func (p *hrsParser) parseValue() Value {
+	switch c := p.peek(); {
+	case c == 0:
+		p.fail("a value")
+	case c == '"':
+		return p.parseString()
+	case c == '[':
+		return p.parseList()
+	case c == '{':
+		return p.parseBraces()
+	case !isWordByte(c):
+		p.fail("a value")
+	}
+
+	start := p.pos
+	w := p.word()
+	switch {
+	case w == "true" || w == "false":
+		return Bool(w == "true")
+	case len(w) == hash.StringLen:
+		if h, ok := hash.MaybeParse(w); ok {
+			return p.readRef(h, nil)
+		}
+	case hrsKeywords[w]:
+		p.pos = start
+		t := p.parseType()
+		if p.accept('(') {
+			v := p.parseTaggedValue(t)
+			p.expect(')')
+			return v
+		}
+		return t
+	case isIdent(w):
+		return p.parseStructBody(w)
+	}
+	if f, err := strconv.ParseFloat(w, 64); err == nil {
+		return Number(f)
+	}
+	p.pos = start
+	p.fail("a value")
+	return nil
+}
+
+// parseTaggedValue parses the value inside the parentheses of a tagged
+// value, e.g. the `{}` of `Set<Number>({})`, and checks that it is a |t|.
+func (p *hrsParser) parseTaggedValue(t *Type) Value {
+	v := p.parseUncheckedTaggedValue(t)
+	if t.Kind() != ValueKind && !IsSubtype(t, v.Type()) {
+		p.errorf("%s is not a %s", EncodedValue(v), t.Describe())
+	}
+	return v
+}
+
+func (p *hrsParser) parseUncheckedTaggedValue(t *Type) Value {
+	switch t.Kind() {
+	case BlobKind:
+		return p.parseBlob()
+	case ListKind:
+		return p.parseList()
+	case MapKind:
+		p.expect('{')
+		if p.accept('}') {
+			return NewMap()
+		}
+		return p.parseMapOrSet(p.parseValue(), MapKind)
+	case SetKind:
+		p.expect('{')
+		if p.accept('}') {
+			return NewSet()
+		}
+		return p.parseMapOrSet(p.parseValue(), SetKind)
+	case RefKind:
+		start := p.pos
+		h, ok := hash.MaybeParse(p.word())
+		if !ok {
+			p.pos = start
+			p.fail("a hash")
+		}
+		return p.readRef(h, t.Desc.(CompoundDesc).ElemTypes[0])
+	case StructKind:
+		return p.parseStructBody(t.Desc.(StructDesc).Name)
+	case TypeKind:
+		return p.parseType()
+	}
+	return p.parseValue()
+}
+
+func (p *hrsParser) parseString() Value {
+	start := p.pos
+	end := start + 1
+	for ; end < len(p.s) && p.s[end] != '"'; end++ {
+		if p.s[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(p.s) {
+		p.errorf("unterminated string")
+	}
+	s, err := strconv.Unquote(p.s[start : end+1])
+	if err != nil {
+		p.errorf("invalid string %s", p.s[start:end+1])
+	}
+	p.pos = end + 1
+	return String(s)
+}
+
+func (p *hrsParser) parseList() Value {
+	p.expect('[')
+	values := ValueSlice{}
+	for !p.accept(']') {
+		values = append(values, p.parseValue())
+		if !p.accept(',') {
+			p.expect(']')
+			break
+		}
+	}
+	return NewList(values...)
+}
+
+// parseBraces parses an untagged `{...}`, which may be a Map, a Set or a
+// Struct with no name.
+func (p *hrsParser) parseBraces() Value {
+	p.expect('{')
+	if p.accept('}') {
+		return NewMap()
+	}
+	if w := p.peekToken(); isFieldName(w) {
+		start := p.pos
+		p.pos += len(w)
+		isField := p.peek() == ':'
+		p.pos = start
+		if isField {
+			return p.parseStructFields("")
+		}
+	}
+	first := p.parseValue()
+	if p.peek() == ':' {
+		return p.parseMapOrSet(first, MapKind)
+	}
+	return p.parseMapOrSet(first, SetKind)
+}
+
+// parseMapOrSet parses the rest of a Map or Set, after the opening `{` and
+// first key or element.
+func (p *hrsParser) parseMapOrSet(first Value, kind NomsKind) Value {
+	values := ValueSlice{}
+	for v := first; ; v = p.parseValue() {
+		values = append(values, v)
+		if kind == MapKind {
+			p.expect(':')
+			values = append(values, p.parseValue())
+		}
+		if !p.accept(',') {
+			p.expect('}')
+			break
+		}
+		if p.accept('}') {
+			break
+		}
+	}
+	if kind == MapKind {
+		return NewMap(values...)
+	}
+	return NewSet(values...)
+}
+
+// parseStructBody parses the `{field: value, ...}` of a Struct named name.
+func (p *hrsParser) parseStructBody(name string) Value {
+	p.expect('{')
+	return p.parseStructFields(name)
+}
+
+// parseStructFields parses the fields of a Struct named name, after the
+// opening `{`.
+func (p *hrsParser) parseStructFields(name string) Value {
+	data := StructData{}
+	for !p.accept('}') {
+		p.skipSpace()
+		start := p.pos
+		field := p.ident()
+		if _, ok := data[field]; ok {
+			p.pos = start
+			p.errorf("duplicate field %s", field)
+		}
+		p.expect(':')
+		data[field] = p.parseValue()
+		if !p.accept(',') {
+			p.expect('}')
+			break
+		}
+	}
+	return NewStruct(name, data)
+}
+
+func (p *hrsParser) parseBlob() Value {
+	buf := &bytes.Buffer{}
+	for p.peek() != ')' {
+		start := p.pos
+		w := p.word()
+		b, err := strconv.ParseUint(w, 16, 8)
+		if err != nil || len(w) != 2 {
+			p.pos = start
+			p.fail("a hex byte")
+		}
+		buf.WriteByte(byte(b))
+	}
+	return NewBlob(buf)
+}
+
+// readRef returns a Ref to the Value with hash h. If t isn't nil, it's the
+// type of the target given in the tag.
+func (p *hrsParser) readRef(h hash.Hash, t *Type) Value {
+	target := p.vrw.ReadValue(h)
+	if target == nil {
+		p.errorf("no value with hash #%s", h)
+	}
+	r := NewRef(target)
+	if t == nil {
+		return r
+	}
+	if t.Kind() == ValueKind {
+		return ToRefOfValue(r)
+	}
+	if !t.Equals(target.Type()) {
+		p.errorf("#%s is a %s, not a %s", h, target.Type().Describe(), t.Describe())
+	}
+	return r
+}
+
+// parseType parses a Type, possibly a union of several.
+func (p *hrsParser) parseType() *Type {
+	t := p.parseSingleType()
+	if p.peek() != '|' {
+		return t
+	}
+	ts := []*Type{t}
+	for p.accept('|') {
+		ts = append(ts, p.parseSingleType())
+	}
+	return MakeUnionType(ts...)
+}
+
+func (p *hrsParser) parseSingleType() *Type {
+	start := p.pos
+	switch w := p.ident(); w {
+	case "Blob", "Bool", "Number", "String", "Type", "Value":
+		return MakePrimitiveTypeByString(w)
+	case "List", "Ref", "Set":
+		p.expect('<')
+		elemType := MakeUnionType()
+		if p.peek() != '>' {
+			elemType = p.parseType()
+		}
+		p.expect('>')
+		switch w {
+		case "List":
+			return MakeListType(elemType)
+		case "Ref":
+			return MakeRefType(elemType)
+		}
+		return MakeSetType(elemType)
+	case "Map":
+		p.expect('<')
+		keyType, valueType := MakeUnionType(), MakeUnionType()
+		if p.peek() != '>' {
+			keyType = p.parseType()
+			p.expect(',')
+			valueType = p.parseType()
+		}
+		p.expect('>')
+		return MakeMapType(keyType, valueType)
+	case "Cycle":
+		p.expect('<')
+		levelStart := p.pos
+		level, err := strconv.ParseUint(p.word(), 10, 32)
+		if err != nil {
+			p.pos = levelStart
+			p.fail("a cycle level")
+		}
+		p.expect('>')
+		return MakeCycleType(uint32(level))
+	case "struct":
+		name := ""
+		if p.peek() != '{' {
+			name = p.ident()
+		}
+		p.expect('{')
+		fields := FieldMap{}
+		for !p.accept('}') {
+			field := p.ident()
+			p.expect(':')
+			fields[field] = p.parseType()
+			if !p.accept(',') {
+				p.expect('}')
+				break
+			}
+		}
+		return MakeStructTypeFromFields(name, fields)
+	}
+	p.pos = start
+	p.fail("a type")
+	return nil
+}
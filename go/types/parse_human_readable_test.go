@@ -0,0 +1,177 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func assertParseHRS(t *testing.T, vrw ValueReadWriter, expected Value, s string) {
+	assert := assert.New(t)
+	v, err := ParseHumanReadable(vrw, s)
+	if assert.NoError(err, s) {
+		assert.True(expected.Equals(v), "parsing %s gave %s", s, EncodedValueWithTags(v))
+	}
+}
+
+// assertHRSRoundTrip checks that v can be read back from both the plain and
+// tagged human-readable encodings.
+func assertHRSRoundTrip(t *testing.T, vrw ValueReadWriter, v Value) {
+	assertParseHRS(t, vrw, v, EncodedValue(v))
+	assertParseHRS(t, vrw, v, EncodedValueWithTags(v))
+}
+
+func TestParseHumanReadablePrimitives(t *testing.T) {
+	vs := NewTestValueStore()
+
+	for _, v := range []Value{
+		Bool(true), Bool(false),
+		Number(0), Number(42), Number(-42), Number(3.1415926535), Number(3.1415926535e20), Number(-1e-10),
+		String(""), String("abc"), String("\t\n\"\\"), String("\xff"), String("💩"),
+	} {
+		assertHRSRoundTrip(t, vs, v)
+	}
+	assertParseHRS(t, vs, Number(1), "  1  // one\n")
+}
+
+func TestParseHumanReadableCollections(t *testing.T) {
+	vs := NewTestValueStore()
+
+	for _, v := range []Value{
+		NewList(),
+		NewList(Number(0), Number(1), Number(2), Number(3)),
+		NewList(NewList(String("a")), NewList()),
+		NewSet(Number(0), String("a"), Bool(true), Number(3)),
+		NewSet(NewSet(Number(1))),
+		NewMap(Number(0), Bool(false), Number(1), Bool(true)),
+		NewMap(NewList(Number(1)), NewSet(String("x")), String("k"), NewMap()),
+		NewMap(NumberType, String("types can be keys")),
+	} {
+		assertHRSRoundTrip(t, vs, v)
+	}
+
+	// Empty Sets must be tagged, since `{}` is an empty Map.
+	assertParseHRS(t, vs, NewMap(), "{}")
+	assertParseHRS(t, vs, NewSet(), EncodedValueWithTags(NewSet()))
+	assertParseHRS(t, vs, NewList(Number(1), Number(2)), "[1, 2]")
+	assertParseHRS(t, vs, NewSet(Number(1), Number(2)), "{1, 2}")
+}
+
+func TestParseHumanReadableStructs(t *testing.T) {
+	vs := NewTestValueStore()
+
+	for _, v := range []Value{
+		NewStruct("S", StructData{}),
+		NewStruct("S", StructData{"x": Number(1), "y": NewList(String("a"))}),
+		NewStruct("", StructData{"a": Bool(true)}),
+		NewStruct("Outer", StructData{"inner": NewStruct("Inner", StructData{"z": NewMap()}), "x_2": Number(2)}),
+		NewList(NewStruct("S", StructData{"n": Number(1)}), NewStruct("S", StructData{"n": Number(2)})),
+	} {
+		assertHRSRoundTrip(t, vs, v)
+	}
+}
+
+func TestParseHumanReadableBlob(t *testing.T) {
+	vs := NewTestValueStore()
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	assertParseHRS(t, vs, NewBlob(bytes.NewReader(data)), EncodedValueWithTags(NewBlob(bytes.NewReader(data))))
+	assertParseHRS(t, vs, NewBlob(bytes.NewReader(nil)), "Blob()")
+	assertParseHRS(t, vs, NewStruct("File", StructData{"data": NewBlob(bytes.NewReader([]byte{0xca, 0xfe}))}), "File {data: Blob(ca fe)}")
+}
+
+func TestParseHumanReadableBlobRoundTrip(t *testing.T) {
+	vs := NewTestValueStore()
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for _, v := range []Value{
+		NewEmptyBlob(),
+		NewBlob(bytes.NewReader([]byte{0x01})),
+		NewBlob(bytes.NewReader(data)),
+		NewStruct("File", StructData{"data": NewBlob(bytes.NewReader([]byte{0x01}))}),
+		NewList(NewBlob(bytes.NewReader([]byte{0x01, 0x02})), NewEmptyBlob(), NewBlob(bytes.NewReader(data))),
+	} {
+		assertHRSRoundTrip(t, vs, v)
+	}
+}
+
+func TestParseHumanReadableRefs(t *testing.T) {
+	vs := NewTestValueStore()
+
+	r := vs.WriteValue(Number(42))
+	assertHRSRoundTrip(t, vs, r)
+	assertHRSRoundTrip(t, vs, NewStruct("S", StructData{"r": r}))
+	assertParseHRS(t, vs, ToRefOfValue(r), "Ref<Value>("+r.TargetHash().String()+")")
+
+	_, err := ParseHumanReadable(vs, "Ref<String>("+r.TargetHash().String()+")")
+	assert.Error(t, err)
+	_, err = ParseHumanReadable(vs, NewRef(String("not written")).TargetHash().String())
+	assert.Error(t, err)
+}
+
+func TestParseHumanReadableTypes(t *testing.T) {
+	vs := NewTestValueStore()
+
+	cyclic := MakeStructType("Node", []string{"children", "value"}, []*Type{MakeListType(MakeCycleType(0)), NumberType})
+	for _, v := range []Value{
+		NumberType,
+		ValueType,
+		MakeListType(MakeUnionType()),
+		MakeMapType(StringType, MakeSetType(BoolType)),
+		MakeRefType(BlobType),
+		MakeUnionType(NumberType, StringType),
+		MakeListType(MakeUnionType(NumberType, MakeStructType("S", []string{"x"}, []*Type{StringType}))),
+		MakeStructType("", []string{"a"}, []*Type{TypeType}),
+		cyclic,
+		NewList(cyclic, StringType),
+	} {
+		assertHRSRoundTrip(t, vs, v)
+	}
+}
+
+func TestParseHumanReadableErrors(t *testing.T) {
+	assert := assert.New(t)
+	vs := NewTestValueStore()
+
+	for s, msg := range map[string]string{
+		"":                                    `1:1: expected a value, found end of input`,
+		"[1, 2":                               `1:6: expected "]", found end of input`,
+		"[1,\n  2 3]":                         `2:5: expected "]", found "3"`,
+		"S {x: 1, x: 2}":                      `1:10: duplicate field x`,
+		"\"abc":                               `1:1: unterminated string`,
+		"1 2":                                 `1:3: expected end of input, found "2"`,
+		"List<Number":                         `1:12: expected ">", found end of input`,
+		"Blob(0g)":                            `1:6: expected a hex byte, found "0g"`,
+		"{1: 2, 3}":                           `1:9: expected ":", found "}"`,
+		"Number(\"a\")":                       `1:11: "a" is not a Number`,
+		"Set<Number>(x)":                      `1:13: expected "{", found "x"`,
+		"?":                                   `1:1: expected a value, found "?"`,
+		"struct S {x: Foo}":                   `1:14: expected a type, found "Foo"`,
+		"Cycle<x>":                            `1:7: expected a cycle level, found "x"`,
+		"Map<Number>":                         `1:11: expected ",", found ">"`,
+		"S {1: 2}":                            `1:4: expected a name, found "1"`,
+		"S":                                   `1:2: expected "{", found end of input`,
+		"Ref<Number>(bogus)":                  `1:13: expected a hash, found "bogus"`,
+		"List<Number>([\"a\"])":               "1:19: [\n  \"a\",\n] is not a List<Number>",
+		"Map<String, Number>({\"a\": \"b\"})": "1:31: {\n  \"a\": \"b\",\n} is not a Map<String, Number>",
+		"Set<Bool>({1})":                      "1:14: {\n  1,\n} is not a Set<Bool>",
+		"struct S {x: Number}({x: \"a\"})":    "1:30: S {\n  x: \"a\",\n} is not a struct S {\n  x: Number,\n}",
+		"struct S {x: Number, y: Number}({x: 1})": "1:39: S {\n  x: 1,\n} is not a struct S {\n  x: Number,\n  y: Number,\n}",
+	} {
+		_, err := ParseHumanReadable(vs, s)
+		if assert.Error(err, s) {
+			assert.Equal(msg, err.Error(), s)
+		}
+	}
+}
@@ -98,6 +98,25 @@ func (vbs *ValidatingBatchingSink) Enqueue(c chunks.Chunk, v Value) (err chunks.
 	return
 }
 
+// EnqueueIncomplete is like Enqueue, but doesn't check that the Chunks that
+// v refers to are present, e.g. because a pull that has been checkpointed
+// part way through has yet to copy them. The caller is responsible for
+// writing them before committing anything that refers to v.
+func (vbs *ValidatingBatchingSink) EnqueueIncomplete(c chunks.Chunk, v Value) (err chunks.BackpressureError) {
+	h := c.Hash()
+	vbs.vs.set(h, hintedChunk{v.Type(), h}, false)
+
+	vbs.batch[vbs.count] = c
+	vbs.count++
+
+	if vbs.count == batchSize {
+		err = vbs.cs.PutMany(vbs.batch[:vbs.count])
+		vbs.count = 0
+	}
+
+	return
+}
+
 // Flush Puts any Chunks buffered by Enqueue calls into the backing
 // ChunkStore. If the attempt to Put fails, this method returns the
 // BackpressureError returned by the underlying ChunkStore.
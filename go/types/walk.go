@@ -247,3 +247,106 @@ func WalkDifferentStructs(last, current Value, vr ValueReader) (added, removed m
 
 	return
 }
+
+// RefPathCallback is called by WalkRefPaths with each Ref that it reaches,
+// along with the hash of the value that holds the Ref, and the Path to the
+// Ref within that value. If the Ref is internal to a chunked collection,
+// rather than a Ref value, the Path is to the collection. It returns the
+// Ref's target, to be walked in turn, or nil to skip it.
+type RefPathCallback func(r Ref, from hash.Hash, p Path) Value
+
+type refPathRec struct {
+	v      Value
+	from   hash.Hash
+	p      Path
+	offset uint64 // of the first element in v, if v is part of a chunked List
+}
+
+// WalkRefPaths walks the values reachable from |target|, calling |cb| for
+// each Ref to a chunk that it hasn't yet reached. Unlike WalkValues, it reads
+// nothing itself, so |cb| decides what to do about chunks that are missing or
+// can't be decoded.
+func WalkRefPaths(target Value, cb RefPathCallback) {
+	visited := hash.HashSet{}
+	values := []refPathRec{{target, target.Hash(), Path{}, 0}}
+
+	// follow calls cb with |r|, if its target hasn't been reached before, and walks the target as |next| says.
+	follow := func(r Ref, from hash.Hash, p Path, next refPathRec) {
+		h := r.TargetHash()
+		if visited.Has(h) {
+			return
+		}
+		visited.Insert(h)
+		if next.v = cb(r, from, p); next.v != nil {
+			values = append(values, next)
+		}
+	}
+
+	for len(values) > 0 {
+		rec := values[len(values)-1]
+		values = values[:len(values)-1]
+
+		switch v := rec.v.(type) {
+		case Ref:
+			// A Path can't go through a Ref, so its target is walked from its own hash.
+			follow(v, rec.from, rec.p, refPathRec{from: v.TargetHash(), p: Path{}})
+		case Struct:
+			for i, f := range v.desc().fields {
+				values = append(values, refPathRec{v.values[i], rec.from, rec.p.Append(NewFieldPath(f.name)), 0})
+			}
+		case Collection:
+			switch seq := v.sequence().(type) {
+			case metaSequence:
+				offset := rec.offset
+				for _, mt := range seq.tuples {
+					if mt.child != nil {
+						values = append(values, refPathRec{mt.child, rec.from, rec.p, offset})
+					} else {
+						follow(mt.ref, rec.from, rec.p, refPathRec{from: rec.from, p: rec.p, offset: offset})
+					}
+					offset += mt.numLeaves
+				}
+			case listLeafSequence:
+				for i, elem := range seq.values {
+					if mightHaveRefs(elem) {
+						values = append(values, refPathRec{elem, rec.from, rec.p.Append(NewIndexPath(Number(rec.offset + uint64(i)))), 0})
+					}
+				}
+			case setLeafSequence:
+				for _, elem := range seq.data {
+					if mightHaveRefs(elem) {
+						values = append(values, refPathRec{elem, rec.from, rec.p.Append(indexPathFor(elem, false)), 0})
+					}
+				}
+			case mapLeafSequence:
+				for _, entry := range seq.data {
+					if mightHaveRefs(entry.key) {
+						values = append(values, refPathRec{entry.key, rec.from, rec.p.Append(indexPathFor(entry.key, true)), 0})
+					}
+					if mightHaveRefs(entry.value) {
+						values = append(values, refPathRec{entry.value, rec.from, rec.p.Append(indexPathFor(entry.key, false)), 0})
+					}
+				}
+			}
+		}
+	}
+}
+
+// mightHaveRefs returns false if |v| is a primitive, or anything else that
+// can't contain a Ref, so that WalkRefPaths needn't make a Path to it.
+func mightHaveRefs(v Value) bool {
+	switch v.(type) {
+	case Ref, Struct, Collection:
+		return true
+	}
+	return false
+}
+
+// indexPathFor returns the PathPart that indexes a Map or Set by |key|, or
+// into |key| itself if |intoKey|.
+func indexPathFor(key Value, intoKey bool) PathPart {
+	if ValueCanBePathIndex(key) {
+		return newIndexPath(key, intoKey)
+	}
+	return newHashIndexPath(key.Hash(), intoKey)
+}
@@ -234,6 +234,36 @@ func (suite *WalkAllTestSuite) TestWalkNestedComposites() {
 	suite.assertCallbackCount(nested, 25)
 }
 
+func (suite *WalkAllTestSuite) TestWalkRefPaths() {
+	leaf := suite.NewList(Number(1))
+	missing := NewRef(String("never written"))
+	nums := make([]Value, 1<<12)
+	for i := range nums {
+		nums[i] = Number(i)
+	}
+	nums[3000] = suite.NewSet(Number(2))
+	chunked := suite.vs.ReadValue(suite.NewList(nums...).TargetHash())
+	s := NewStruct("S", StructData{
+		"a": leaf,
+		"l": chunked,
+		"m": NewMap(String("k"), missing),
+	})
+
+	reached, count := map[string]hash.Hash{}, 0
+	WalkRefPaths(s, func(r Ref, from hash.Hash, p Path) Value {
+		reached["#"+from.String()+p.String()] = r.TargetHash()
+		count++
+		return suite.vs.ReadValue(r.TargetHash())
+	})
+	prefix := "#" + s.Hash().String()
+	suite.Equal(leaf.TargetHash(), reached[prefix+".a"])
+	suite.Equal(missing.TargetHash(), reached[prefix+`.m["k"]`])
+	suite.Equal(nums[3000].(Ref).TargetHash(), reached[prefix+".l[3000]"])
+	// The chunks of the list are reached from the list itself.
+	suite.Contains(reached, prefix+".l")
+	suite.Equal(3+len(chunked.(List).sequence().(metaSequence).tuples), count)
+}
+
 type WalkTestSuite struct {
 	WalkAllTestSuite
 	shouldSeeItem Value